@@ -0,0 +1,231 @@
+// Package audit records security-relevant events (blocked scripts, killed
+// processes, debug endpoint access, authentication failures) as JSON lines
+// in a sink separate from the application log.
+//
+// Every event carries a sequence number and the SHA-256 hash of the previous
+// event, so a deleted, reordered or edited line breaks the chain and is
+// detected by Verify.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	EventScriptBlocked = "script_blocked"
+	EventProcessKilled = "process_killed"
+	EventDebugAccess   = "debug_access"
+	EventDebugDenied   = "debug_denied"
+	EventAuthFailure   = "auth_failure"
+	EventPanic         = "panic"
+)
+
+// Event is one line of the audit log
+type Event struct {
+	Seq       uint64                 `json:"seq"`
+	Timestamp time.Time              `json:"timestamp"`
+	Type      string                 `json:"event"`
+	Actor     string                 `json:"actor,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	PrevHash  string                 `json:"prev_hash"`
+	Hash      string                 `json:"hash"`
+}
+
+// computeHash hashes the event with its Hash field empty
+func (e Event) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Logger writes chained events to its sink. It is safe for concurrent use.
+type Logger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	closer   io.Closer
+	seq      uint64
+	prevHash string
+	now      func() time.Time
+}
+
+// New creates a logger writing to w, starting a new chain
+func New(w io.Writer) *Logger {
+	return &Logger{w: w, now: time.Now}
+}
+
+// Open creates a logger for destination: "stdout", "stderr" or a file path.
+// An existing file is appended to and its chain continued.
+func Open(destination string) (*Logger, error) {
+	switch destination {
+	case "stdout":
+		return New(os.Stdout), nil
+	case "stderr":
+		return New(os.Stderr), nil
+	case "":
+		return nil, errors.New("audit destination is empty")
+	}
+
+	last, err := lastEvent(destination)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(destination, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	l := New(f)
+	l.closer = f
+	if last != nil {
+		l.seq = last.Seq
+		l.prevHash = last.Hash
+	}
+	return l, nil
+}
+
+// lastEvent returns the last event of the file at path, nil when the file
+// does not exist or is empty
+func lastEvent(path string) (*Event, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	defer f.Close()
+
+	var last *Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit log %s is corrupted: %w", path, err)
+		}
+		last = &e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	return last, nil
+}
+
+// Record appends an event to the log and returns it
+func (l *Logger) Record(eventType, actor, ip string, details map[string]interface{}) (Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := Event{
+		Seq:       l.seq + 1,
+		Timestamp: l.now().UTC(),
+		Type:      eventType,
+		Actor:     actor,
+		IP:        ip,
+		Details:   details,
+		PrevHash:  l.prevHash,
+	}
+	hash, err := e.computeHash()
+	if err != nil {
+		return e, fmt.Errorf("hashing audit event: %w", err)
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, fmt.Errorf("encoding audit event: %w", err)
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return e, fmt.Errorf("writing audit event: %w", err)
+	}
+	l.seq = e.Seq
+	l.prevHash = e.Hash
+	return e, nil
+}
+
+// Close closes the file behind the logger, if any
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Verify reads an audit log and checks the sequence numbers and the hash
+// chain. It returns the number of valid events and the first inconsistency.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	count := 0
+	var prev *Event
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return count, fmt.Errorf("line %d: %w", count+1, err)
+		}
+		hash, err := e.computeHash()
+		if err != nil {
+			return count, err
+		}
+		if hash != e.Hash {
+			return count, fmt.Errorf("event %d: hash mismatch, the event was modified", e.Seq)
+		}
+		if prev != nil {
+			if e.Seq != prev.Seq+1 {
+				return count, fmt.Errorf("event %d: expected sequence %d, events are missing or reordered", e.Seq, prev.Seq+1)
+			}
+			if e.PrevHash != prev.Hash {
+				return count, fmt.Errorf("event %d: previous hash does not match event %d", e.Seq, prev.Seq)
+			}
+		}
+		prev = &e
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// current is the process-wide logger used by Record; nil disables auditing
+var current atomic.Pointer[Logger]
+
+// SetDefault sets the logger used by Record and returns the previous one.
+// A nil logger disables auditing.
+func SetDefault(l *Logger) *Logger {
+	return current.Swap(l)
+}
+
+// Enabled reports whether a default logger is set
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Record appends an event to the default logger. It does nothing when
+// auditing is disabled; write errors are returned so callers may log them.
+func Record(eventType, actor, ip string, details map[string]interface{}) error {
+	l := current.Load()
+	if l == nil {
+		return nil
+	}
+	_, err := l.Record(eventType, actor, ip, details)
+	return err
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readEvents(t *testing.T, data string) []Event {
+	t.Helper()
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		var e Event
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestRecordChainsEvents(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+
+	_, err := l.Record(EventDebugAccess, "debug_token", "10.0.0.1", map[string]interface{}{"path": "/debug/info"})
+	require.NoError(t, err)
+	_, err = l.Record(EventAuthFailure, "alice", "10.0.0.2", nil)
+	require.NoError(t, err)
+
+	events := readEvents(t, buf.String())
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(1), events[0].Seq)
+	assert.Equal(t, EventDebugAccess, events[0].Type)
+	assert.Equal(t, "debug_token", events[0].Actor)
+	assert.Equal(t, "10.0.0.1", events[0].IP)
+	assert.Equal(t, "/debug/info", events[0].Details["path"])
+	assert.False(t, events[0].Timestamp.IsZero())
+	assert.Empty(t, events[0].PrevHash)
+	assert.Equal(t, uint64(2), events[1].Seq)
+	assert.Equal(t, events[0].Hash, events[1].PrevHash)
+
+	count, err := Verify(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+	for _, actor := range []string{"a", "b", "c"} {
+		_, err := l.Record(EventAuthFailure, actor, "", nil)
+		require.NoError(t, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	edited := strings.Replace(lines[1], `"actor":"b"`, `"actor":"x"`, 1)
+	_, err := Verify(strings.NewReader(strings.Join([]string{lines[0], edited, lines[2]}, "\n")))
+	assert.ErrorContains(t, err, "hash mismatch")
+
+	_, err = Verify(strings.NewReader(strings.Join([]string{lines[0], lines[2]}, "\n")))
+	assert.ErrorContains(t, err, "missing or reordered")
+}
+
+func TestOpenContinuesTheChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	require.NoError(t, err)
+	_, err = l.Record(EventProcessKilled, "debug_token", "", map[string]interface{}{"wid": "w1"})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	l, err = Open(path)
+	require.NoError(t, err)
+	e, err := l.Record(EventProcessKilled, "debug_token", "", map[string]interface{}{"wid": "w2"})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	assert.Equal(t, uint64(2), e.Seq)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	count, err := Verify(f)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestDefaultLogger(t *testing.T) {
+	previous := SetDefault(nil)
+	t.Cleanup(func() { SetDefault(previous) })
+
+	assert.False(t, Enabled())
+	assert.NoError(t, Record(EventAuthFailure, "alice", "", nil), "recording is a no-op when disabled")
+
+	var buf bytes.Buffer
+	SetDefault(New(&buf))
+	assert.True(t, Enabled())
+	require.NoError(t, Record(EventAuthFailure, "alice", "127.0.0.1", nil))
+	events := readEvents(t, buf.String())
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0].Actor)
+}
@@ -1,11 +1,14 @@
 package commons
 
 import (
+	"net/http"
+	"strings"
+
 	"github.com/arturoeanton/nflow-runtime/engine"
 	"github.com/gorilla/sessions"
 )
 
-func GetSessionStore(pgSessionConfig *engine.PgSessionConfig) sessions.Store {
+func GetSessionStore(pgSessionConfig *engine.PgSessionConfig, sessionConfig *engine.SessionConfig) sessions.Store {
 	/*
 		if pgSessionConfig.Url != "" {
 			log.Println("pg session")
@@ -36,5 +39,43 @@ func GetSessionStore(pgSessionConfig *engine.PgSessionConfig) sessions.Store {
 			}
 
 	*/
-	return sessions.NewCookieStore([]byte("secret"))
+	store := sessions.NewCookieStore([]byte("secret"))
+	store.Options = SessionOptions(sessionConfig)
+	// Keep the codecs in line with the cookie lifetime
+	store.MaxAge(store.Options.MaxAge)
+	return store
+}
+
+// SessionOptions builds the cookie options of the session store. HttpOnly
+// is on unless explicitly disabled.
+func SessionOptions(config *engine.SessionConfig) *sessions.Options {
+	opts := &sessions.Options{
+		Path:     "/",
+		MaxAge:   86400 * 30,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if config == nil {
+		return opts
+	}
+
+	if config.CookiePath != "" {
+		opts.Path = config.CookiePath
+	}
+	if config.CookieMaxAge > 0 {
+		opts.MaxAge = config.CookieMaxAge
+	}
+	if config.CookieHTTPOnly != nil {
+		opts.HttpOnly = *config.CookieHTTPOnly
+	}
+	opts.Domain = config.CookieDomain
+	opts.Secure = config.CookieSecure
+
+	switch strings.ToLower(config.CookieSameSite) {
+	case "strict":
+		opts.SameSite = http.SameSiteStrictMode
+	case "none":
+		opts.SameSite = http.SameSiteNoneMode
+	}
+	return opts
 }
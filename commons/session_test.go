@@ -0,0 +1,62 @@
+package commons
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func saveSessionCookie(t *testing.T, config *engine.SessionConfig) *http.Cookie {
+	store := GetSessionStore(&engine.PgSessionConfig{}, config)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	s, err := store.Get(req, "nflow_form")
+	require.NoError(t, err)
+	s.Values["user"] = "ana"
+	require.NoError(t, s.Save(req, rec))
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+func TestSessionCookieDefaults(t *testing.T) {
+	cookie := saveSessionCookie(t, &engine.SessionConfig{})
+
+	assert.Equal(t, "nflow_form", cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+	assert.False(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, "/", cookie.Path)
+	assert.Equal(t, 86400*30, cookie.MaxAge)
+}
+
+func TestSessionCookieHTTPSPolicy(t *testing.T) {
+	httpOnly := true
+	cookie := saveSessionCookie(t, &engine.SessionConfig{
+		CookieSecure:   true,
+		CookieSameSite: "Strict",
+		CookieHTTPOnly: &httpOnly,
+		CookieDomain:   "example.com",
+		CookiePath:     "/app",
+		CookieMaxAge:   3600,
+	})
+
+	assert.True(t, cookie.Secure)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.Equal(t, "example.com", cookie.Domain)
+	assert.Equal(t, "/app", cookie.Path)
+	assert.Equal(t, 3600, cookie.MaxAge)
+}
+
+func TestSessionCookieHTTPOnlyCanBeDisabled(t *testing.T) {
+	httpOnly := false
+	cookie := saveSessionCookie(t, &engine.SessionConfig{CookieHTTPOnly: &httpOnly})
+	assert.False(t, cookie.HttpOnly)
+}
@@ -1,16 +1,24 @@
 package endpoints
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
+	"maps"
 	"net/http"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/arturoeanton/nflow-runtime/audit"
 	"github.com/arturoeanton/nflow-runtime/engine"
 	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/plugins"
 	"github.com/arturoeanton/nflow-runtime/process"
 	"github.com/labstack/echo/v4"
 )
@@ -37,75 +45,53 @@ var (
 func debugMiddleware(config *engine.DebugConfig) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// Check if debug endpoints are enabled
-			if !config.Enabled {
+			switch err := engine.CheckDebugAuth(c, *config); {
+			case errors.Is(err, engine.ErrDebugDisabled):
 				return c.JSON(http.StatusNotFound, echo.Map{
 					"error": "Debug endpoints are disabled",
 				})
+			case errors.Is(err, engine.ErrDebugTokenInvalid):
+				auditDebug(c, audit.EventDebugDenied, "invalid or missing debug token")
+				return c.JSON(http.StatusUnauthorized, echo.Map{
+					"error": "Invalid or missing debug token",
+				})
+			case errors.Is(err, engine.ErrDebugIPNotAllowed):
+				auditDebug(c, audit.EventDebugDenied, "ip not allowed")
+				return c.JSON(http.StatusForbidden, echo.Map{
+					"error": fmt.Sprintf("IP %s not allowed", engine.DebugClientIP(c.Request())),
+				})
 			}
 
-			// Check auth token if configured
-			if config.AuthToken != "" {
-				token := c.Request().Header.Get("X-Debug-Token")
-				if token == "" {
-					token = c.QueryParam("debug_token")
-				}
-				if token != config.AuthToken {
-					return c.JSON(http.StatusUnauthorized, echo.Map{
-						"error": "Invalid or missing debug token",
-					})
-				}
-			}
-
-			// Check IP whitelist if configured
-			if config.AllowedIPs != "" {
-				clientIP := getClientIP(c.Request())
-				allowed := false
-				for _, allowedIP := range strings.Split(config.AllowedIPs, ",") {
-					allowedIP = strings.TrimSpace(allowedIP)
-					if allowedIP == clientIP {
-						allowed = true
-						break
-					}
-					// Check if it's a CIDR range
-					if strings.Contains(allowedIP, "/") {
-						_, ipNet, err := net.ParseCIDR(allowedIP)
-						if err == nil && ipNet.Contains(net.ParseIP(clientIP)) {
-							allowed = true
-							break
-						}
-					}
-				}
-				if !allowed {
-					return c.JSON(http.StatusForbidden, echo.Map{
-						"error": fmt.Sprintf("IP %s not allowed", clientIP),
-					})
-				}
-			}
-
+			auditDebug(c, audit.EventDebugAccess, "")
 			return next(c)
 		}
 	}
 }
 
-// getClientIP extracts the real client IP address
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
+// debugActor names the caller of a debug endpoint in the audit log:
+// "debug_token" when the request carried a token, "anonymous" otherwise
+func debugActor(c echo.Context) string {
+	if c.Request().Header.Get("X-Debug-Token") != "" || c.QueryParam("debug_token") != "" {
+		return "debug_token"
 	}
+	return "anonymous"
+}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+// auditDebug records a debug endpoint request in the audit log
+func auditDebug(c echo.Context, event, reason string) {
+	if !audit.Enabled() {
+		return
+	}
+	details := map[string]interface{}{
+		"method": c.Request().Method,
+		"path":   c.Request().URL.Path,
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	if err := audit.Record(event, debugActor(c), engine.DebugClientIP(c.Request()), details); err != nil {
+		logger.Error("Audit log:", err)
 	}
-
-	// Fall back to RemoteAddr
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return ip
 }
 
 // RegisterDebugEndpoints registers all debug endpoints
@@ -121,12 +107,24 @@ func RegisterDebugEndpoints(e *echo.Echo, config *engine.ConfigWorkspace, appJso
 
 	// System information
 	debug.GET("/info", handleDebugInfo)
-	debug.GET("/config", handleDebugConfig(config))
+	debug.GET("/config", handleDebugConfig)
+	debug.GET("/selftest", handleDebugSelfTest)
+
+	// Log verbosity, changed without restarting
+	debug.GET("/loglevel", handleDebugGetLogLevel)
+	debug.POST("/loglevel", handleDebugSetLogLevel)
 
 	// Repository information
 	debug.GET("/repositories", handleDebugRepositories)
 	debug.GET("/playbooks", handleDebugPlaybooks(appJson))
 	debug.GET("/playbook/:flow", handleDebugPlaybook(appJson))
+	debug.POST("/playbook/:flow/diff", handleDebugPlaybookDiff(appJson))
+
+	// Node kill switch
+	debug.GET("/nodes/disabled", handleDebugDisabledNodes)
+	debug.POST("/nodes/disabled/:key", handleDebugDisableNode)
+	debug.DELETE("/nodes/disabled/:key", handleDebugEnableNode)
+	debug.DELETE("/nodes/disabled", handleDebugResetNodeSwitches)
 
 	// Cache management
 	debug.POST("/cache/invalidate", handleCacheInvalidate)
@@ -144,6 +142,11 @@ func RegisterDebugEndpoints(e *echo.Echo, config *engine.ConfigWorkspace, appJso
 
 	// VM Pool information
 	debug.GET("/vm-pool", handleDebugVMPool)
+	debug.POST("/vm-pool/warm", handleDebugWarmVMPool)
+
+	// Plugins
+	debug.GET("/plugins", handleDebugPlugins)
+	debug.POST("/plugins/reload", handleDebugReloadPlugins)
 
 	// Database information
 	debug.GET("/database/stats", handleDebugDatabaseStats)
@@ -153,10 +156,20 @@ func RegisterDebugEndpoints(e *echo.Echo, config *engine.ConfigWorkspace, appJso
 	debug.GET("/runtime", handleDebugRuntime)
 	debug.GET("/goroutines", handleDebugGoroutines)
 	debug.GET("/memory", handleDebugMemory)
+	debug.POST("/gc", handleDebugGC)
 
 	// Tracker information
 	debug.GET("/tracker/stats", handleDebugTrackerStats)
 
+	// Outbound HTTP circuit breakers
+	debug.GET("/http/circuit-breakers", handleDebugHTTPCircuitBreakers)
+	debug.DELETE("/http/circuit-breakers", handleDebugResetHTTPCircuitBreakers)
+
+	// Side effects recorded in test mode
+	debug.GET("/test-mode/calls", handleDebugTestModeCalls)
+	debug.DELETE("/test-mode/calls", handleDebugClearTestModeCalls)
+	debug.POST("/test-mode/reseed", handleDebugTestModeReseed)
+
 	// URL cache information
 	debug.GET("/url-cache", handleDebugURLCache)
 	debug.DELETE("/url-cache", handleDebugClearURLCache)
@@ -184,44 +197,10 @@ func handleDebugInfo(c echo.Context) error {
 	})
 }
 
-func handleDebugConfig(config *engine.ConfigWorkspace) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		// Sanitize sensitive information
-		sanitized := echo.Map{
-			"vm_pool": echo.Map{
-				"max_size":              config.VMPoolConfig.MaxSize,
-				"preload_size":          config.VMPoolConfig.PreloadSize,
-				"idle_timeout":          config.VMPoolConfig.IdleTimeout,
-				"max_memory_mb":         config.VMPoolConfig.MaxMemoryMB,
-				"max_execution_seconds": config.VMPoolConfig.MaxExecutionSeconds,
-				"enable_filesystem":     config.VMPoolConfig.EnableFileSystem,
-				"enable_network":        config.VMPoolConfig.EnableNetwork,
-			},
-			"tracker": echo.Map{
-				"enabled":        config.TrackerConfig.Enabled,
-				"workers":        config.TrackerConfig.Workers,
-				"batch_size":     config.TrackerConfig.BatchSize,
-				"channel_buffer": config.TrackerConfig.ChannelBuffer,
-			},
-			"database": echo.Map{
-				"driver": config.DatabaseNflow.Driver,
-			},
-			"redis": echo.Map{
-				"configured": config.RedisConfig.Host != "",
-			},
-			"debug": echo.Map{
-				"enabled":      config.DebugConfig.Enabled,
-				"enable_pprof": config.DebugConfig.EnablePprof,
-			},
-			"monitor": echo.Map{
-				"enabled":                 config.MonitorConfig.Enabled,
-				"health_check_path":       config.MonitorConfig.HealthCheckPath,
-				"metrics_path":            config.MonitorConfig.MetricsPath,
-				"enable_detailed_metrics": config.MonitorConfig.EnableDetailedMetrics,
-			},
-		}
-		return c.JSON(http.StatusOK, sanitized)
-	}
+// handleDebugConfig returns the effective configuration with the secret
+// fields redacted
+func handleDebugConfig(c echo.Context) error {
+	return c.JSON(http.StatusOK, engine.RedactedConfig(engine.GetConfig()))
 }
 
 func handleDebugRepositories(c echo.Context) error {
@@ -244,8 +223,22 @@ func handleDebugRepositories(c echo.Context) error {
 	return c.JSON(http.StatusOK, info)
 }
 
+// handleDebugPlaybooks lists the flows of the app sorted by key, filtered
+// by ?search= (case-insensitive, on the key or flow key) and paginated with
+// ?limit= and ?offset=. total_flows and total_nodes count the whole app,
+// matched the flows passing the search.
 func handleDebugPlaybooks(appJson string) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		limit, err := queryNonNegative(c, "limit")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		offset, err := queryNonNegative(c, "offset")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		search := strings.ToLower(c.QueryParam("search"))
+
 		ctx := c.Request().Context()
 		repo := engine.GetPlaybookRepository()
 		if repo == nil {
@@ -257,21 +250,21 @@ func handleDebugPlaybooks(appJson string) echo.HandlerFunc {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 		}
 
-		summary := echo.Map{
-			"app":         appJson,
-			"total_flows": 0,
-			"total_nodes": 0,
-			"flows":       []echo.Map{},
-		}
-
 		flows := []echo.Map{}
+		totalFlows := 0
 		totalNodes := 0
 
-		for key, flowMap := range playbooks {
-			for flowKey, pb := range flowMap {
+		for _, key := range slices.Sorted(maps.Keys(playbooks)) {
+			flowMap := playbooks[key]
+			for _, flowKey := range slices.Sorted(maps.Keys(flowMap)) {
+				pb := flowMap[flowKey]
 				if pb != nil {
 					nodeCount := len(*pb)
+					totalFlows++
 					totalNodes += nodeCount
+					if search != "" && !strings.Contains(strings.ToLower(key), search) && !strings.Contains(strings.ToLower(flowKey), search) {
+						continue
+					}
 					flows = append(flows, echo.Map{
 						"key":        key,
 						"flow_key":   flowKey,
@@ -281,12 +274,35 @@ func handleDebugPlaybooks(appJson string) echo.HandlerFunc {
 			}
 		}
 
-		summary["total_flows"] = len(flows)
-		summary["total_nodes"] = totalNodes
-		summary["flows"] = flows
+		matched := len(flows)
+		flows = flows[min(offset, matched):]
+		if limit > 0 && limit < len(flows) {
+			flows = flows[:limit]
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"app":         appJson,
+			"total_flows": totalFlows,
+			"total_nodes": totalNodes,
+			"matched":     matched,
+			"limit":       limit,
+			"offset":      offset,
+			"flows":       flows,
+		})
+	}
+}
 
-		return c.JSON(http.StatusOK, summary)
+// queryNonNegative parses the query parameter name, 0 when missing
+func queryNonNegative(c echo.Context, name string) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
 	}
+	return n, nil
 }
 
 func handleDebugPlaybook(appJson string) echo.HandlerFunc {
@@ -304,23 +320,126 @@ func handleDebugPlaybook(appJson string) echo.HandlerFunc {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 		}
 
-		// Find the specific flow
-		for key, flowMap := range playbooks {
-			for flowKey, pb := range flowMap {
-				if flowKey == flow || key == flow {
-					if pb != nil {
-						return c.JSON(http.StatusOK, echo.Map{
-							"flow":       flow,
-							"node_count": len(*pb),
-							"nodes":      *pb,
-						})
-					}
-				}
+		pb := findFlowPlaybook(playbooks, flow)
+		if pb == nil {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Flow not found"})
+		}
+		return c.JSON(http.StatusOK, echo.Map{
+			"flow":       flow,
+			"node_count": len(*pb),
+			"nodes":      *pb,
+		})
+	}
+}
+
+// handleDebugPlaybookDiff compares the cached version of a flow with the
+// candidate playbook in the body, a map of node id to node as returned in
+// "nodes" by GET /debug/playbook/:flow
+func handleDebugPlaybookDiff(appJson string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		flow := c.Param("flow")
+
+		var candidate model.Playbook
+		if err := json.NewDecoder(c.Request().Body).Decode(&candidate); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid playbook JSON: " + err.Error()})
+		}
+
+		repo := engine.GetPlaybookRepository()
+		if repo == nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Repository not available"})
+		}
+		playbooks, err := repo.LoadPlaybook(c.Request().Context(), appJson)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		pb := findFlowPlaybook(playbooks, flow)
+		if pb == nil {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Flow not found"})
+		}
+
+		diff := engine.DiffPlaybooks(*pb, candidate)
+		return c.JSON(http.StatusOK, echo.Map{
+			"flow":    flow,
+			"version": engine.PlaybookVersion(pb),
+			"changed": !diff.Empty(),
+			"diff":    diff,
+		})
+	}
+}
+
+// findFlowPlaybook returns the playbook whose outer or flow key is flow
+func findFlowPlaybook(playbooks map[string]map[string]*model.Playbook, flow string) *model.Playbook {
+	for key, flowMap := range playbooks {
+		for flowKey, pb := range flowMap {
+			if (flowKey == flow || key == flow) && pb != nil {
+				return pb
 			}
 		}
+	}
+	return nil
+}
+
+func handleDebugGetLogLevel(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"level": logger.GetLevel().String()})
+}
+
+// handleDebugSetLogLevel accepts {"level": "error|info|verbose"} or
+// {"verbose": true|false}
+func handleDebugSetLogLevel(c echo.Context) error {
+	var body struct {
+		Level   string `json:"level"`
+		Verbose *bool  `json:"verbose"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
 
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "Flow not found"})
+	var level logger.Level
+	switch {
+	case body.Level != "":
+		parsed, err := logger.ParseLevel(body.Level)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		level = parsed
+	case body.Verbose != nil && *body.Verbose:
+		level = logger.LevelVerbose
+	case body.Verbose != nil:
+		level = logger.LevelInfo
+	default:
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "level or verbose is required"})
 	}
+
+	previous := logger.GetLevel()
+	logger.SetLevel(level)
+	logger.Infof("Log level changed from %s to %s", previous, level)
+	return c.JSON(http.StatusOK, echo.Map{"level": level.String(), "previous": previous.String()})
+}
+
+func handleDebugDisabledNodes(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"disabled": engine.DisabledNodes()})
+}
+
+// handleDebugDisableNode switches off the node ID or node type :key
+func handleDebugDisableNode(c echo.Context) error {
+	key := c.Param("key")
+	engine.DisableNode(key)
+	logger.Infof("Node %s disabled", key)
+	return c.JSON(http.StatusOK, echo.Map{"disabled": engine.DisabledNodes()})
+}
+
+// handleDebugEnableNode switches :key back on, even when
+// playbook.disabled_nodes lists it
+func handleDebugEnableNode(c echo.Context) error {
+	key := c.Param("key")
+	engine.EnableNode(key)
+	logger.Infof("Node %s enabled", key)
+	return c.JSON(http.StatusOK, echo.Map{"disabled": engine.DisabledNodes()})
+}
+
+func handleDebugResetNodeSwitches(c echo.Context) error {
+	engine.ResetNodeSwitches()
+	return c.JSON(http.StatusOK, echo.Map{"disabled": engine.DisabledNodes()})
 }
 
 func handleCacheInvalidate(c echo.Context) error {
@@ -362,8 +481,15 @@ func handleCacheStats(c echo.Context) error {
 	})
 }
 
+// handleDebugProcesses lists the active processes, optionally filtered by
+// ?endpoint= (path prefix), ?user=, ?state= and ?flow=
 func handleDebugProcesses(c echo.Context) error {
-	processes := process.GetProcessList()
+	processes := process.FilterProcesses(process.Filter{
+		Endpoint: c.QueryParam("endpoint"),
+		Username: c.QueryParam("user"),
+		State:    c.QueryParam("state"),
+		FlowName: c.QueryParam("flow"),
+	})
 
 	summary := echo.Map{
 		"total":     len(processes),
@@ -387,6 +513,11 @@ func handleDebugProcess(c echo.Context) error {
 func handleDebugKillProcess(c echo.Context) error {
 	wid := c.Param("wid")
 	process.WKill(wid)
+	if err := audit.Record(audit.EventProcessKilled, debugActor(c), engine.DebugClientIP(c.Request()), map[string]interface{}{
+		"wid": wid,
+	}); err != nil {
+		logger.Error("Audit log:", err)
+	}
 	return c.JSON(http.StatusOK, echo.Map{
 		"message": "Process killed",
 		"wid":     wid,
@@ -415,6 +546,66 @@ func handleDebugVMPool(c echo.Context) error {
 	})
 }
 
+// handleDebugWarmVMPool tops the pool up to vm_pool.preload_size idle VMs,
+// or to ?size=n, ahead of an expected traffic spike
+func handleDebugWarmVMPool(c echo.Context) error {
+	manager := engine.GetVMManager()
+	target := manager.PreloadSize()
+	if size := c.QueryParam("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "size must be a non-negative integer"})
+		}
+		target = n
+	}
+
+	created, err := manager.Warm(target)
+	response := echo.Map{
+		"created":   created,
+		"target":    target,
+		"available": manager.Available(),
+		"mode":      manager.Mode(),
+	}
+	if err != nil {
+		response["error"] = err.Error()
+		return c.JSON(http.StatusServiceUnavailable, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func handleDebugPlugins(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"plugins": engine.PluginNames()})
+}
+
+// handleDebugReloadPlugins reloads the configured plugins. It waits up to
+// ?timeout seconds (default 30) for the requests using the previous plugins
+// before answering; when they are still running it answers 202 and the
+// previous plugins are shut down once they end.
+func handleDebugReloadPlugins(c echo.Context) error {
+	timeout := 30 * time.Second
+	if value := c.QueryParam("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "timeout must be a non-negative integer"})
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+	defer cancel()
+	loaded, err := engine.ReloadPlugins(ctx)
+	response := echo.Map{
+		"loaded":  loaded,
+		"plugins": engine.PluginNames(),
+	}
+	if err != nil {
+		response["draining"] = true
+		response["error"] = err.Error()
+		return c.JSON(http.StatusAccepted, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
 func handleDebugDatabaseStats(c echo.Context) error {
 	db, err := engine.GetDB()
 	if err != nil {
@@ -500,6 +691,28 @@ func handleDebugMemory(c echo.Context) error {
 	})
 }
 
+// handleDebugGC runs a garbage collection and reports the heap it freed,
+// telling uncollected garbage apart from memory still referenced
+func handleDebugGC(c echo.Context) error {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	runtime.GC()
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"freed_bytes":         int64(before.HeapAlloc) - int64(after.HeapAlloc),
+		"heap_alloc_before":   before.HeapAlloc,
+		"heap_alloc_after":    after.HeapAlloc,
+		"heap_objects_before": before.HeapObjects,
+		"heap_objects_after":  after.HeapObjects,
+		"heap_sys":            after.HeapSys,
+		"gc_runs":             after.NumGC,
+		"duration_ms":         duration.Milliseconds(),
+	})
+}
+
 func handleDebugTrackerStats(c echo.Context) error {
 	// This would need to be implemented in the tracker
 	return c.JSON(http.StatusOK, echo.Map{
@@ -507,6 +720,54 @@ func handleDebugTrackerStats(c echo.Context) error {
 	})
 }
 
+func handleDebugHTTPCircuitBreakers(c echo.Context) error {
+	states := plugins.GetHTTPCircuitBreakerStates()
+	open := 0
+	for _, state := range states {
+		if state.State != "closed" {
+			open++
+		}
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"total": len(states),
+		"open":  open,
+		"hosts": states,
+	})
+}
+
+func handleDebugResetHTTPCircuitBreakers(c echo.Context) error {
+	plugins.ResetHTTPCircuitBreakers()
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "HTTP circuit breakers reset",
+	})
+}
+
+func handleDebugTestModeCalls(c echo.Context) error {
+	calls := plugins.RecordedCalls(c.QueryParam("kind"))
+	return c.JSON(http.StatusOK, echo.Map{
+		"enabled": plugins.TestModeEnabled(),
+		"seeded":  engine.Seeded(),
+		"count":   len(calls),
+		"calls":   calls,
+	})
+}
+
+func handleDebugClearTestModeCalls(c echo.Context) error {
+	plugins.ClearRecordedCalls()
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Recorded calls cleared",
+	})
+}
+
+func handleDebugTestModeReseed(c echo.Context) error {
+	engine.Reseed()
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Seeded sequence restarted",
+		"seeded":  engine.Seeded(),
+	})
+}
+
 func handleDebugURLCache(c echo.Context) error {
 	if urlCache == nil {
 		return c.JSON(http.StatusOK, echo.Map{
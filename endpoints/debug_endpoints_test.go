@@ -0,0 +1,491 @@
+package endpoints
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/audit"
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/plugins"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/labstack/echo/v4"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugLogLevel(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	previous := logger.GetLevel()
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		logger.SetLevel(previous)
+	})
+	logger.SetLevel(logger.LevelInfo)
+
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true, AuthToken: "t0k"},
+	}, "", nil)
+
+	setLevel := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/debug/loglevel", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Debug-Token", token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	logger.Verbose("hidden message")
+	assert.NotContains(t, out.String(), "hidden message")
+
+	assert.Equal(t, http.StatusUnauthorized, setLevel(`{"verbose":true}`, "wrong").Code)
+	assert.Equal(t, logger.LevelInfo, logger.GetLevel())
+
+	rec := setLevel(`{"verbose":true}`, "t0k")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"verbose","previous":"info"}`, rec.Body.String())
+	logger.Verbose("visible message")
+	assert.Contains(t, out.String(), "visible message")
+
+	rec = setLevel(`{"level":"info"}`, "t0k")
+	require.Equal(t, http.StatusOK, rec.Code)
+	out.Reset()
+	logger.Verbose("hidden again")
+	assert.NotContains(t, out.String(), "hidden again")
+
+	assert.Equal(t, http.StatusBadRequest, setLevel(`{"level":"loud"}`, "t0k").Code)
+	assert.Equal(t, http.StatusBadRequest, setLevel(`{}`, "t0k").Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/loglevel?debug_token=t0k", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.JSONEq(t, `{"level":"info"}`, rec.Body.String())
+}
+
+func TestDebugEndpointsAudit(t *testing.T) {
+	var buf bytes.Buffer
+	previous := audit.SetDefault(audit.New(&buf))
+	t.Cleanup(func() { audit.SetDefault(previous) })
+
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true, AuthToken: "t0k"},
+	}, "", nil)
+
+	call := func(method, target, token string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = "192.0.2.7:1234"
+		if token != "" {
+			req.Header.Set("X-Debug-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/debug/loglevel", ""))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/debug/loglevel", "t0k"))
+	assert.Equal(t, http.StatusOK, call(http.MethodDelete, "/debug/process/wf-1", "t0k"))
+
+	var events []audit.Event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event audit.Event
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 4)
+
+	assert.Equal(t, audit.EventDebugDenied, events[0].Type)
+	assert.Equal(t, "anonymous", events[0].Actor)
+	assert.Equal(t, "192.0.2.7", events[0].IP)
+	assert.Equal(t, "invalid or missing debug token", events[0].Details["reason"])
+
+	assert.Equal(t, audit.EventDebugAccess, events[1].Type)
+	assert.Equal(t, "debug_token", events[1].Actor)
+	assert.Equal(t, "/debug/loglevel", events[1].Details["path"])
+
+	assert.Equal(t, audit.EventDebugAccess, events[2].Type)
+	assert.Equal(t, audit.EventProcessKilled, events[3].Type)
+	assert.Equal(t, "wf-1", events[3].Details["wid"])
+
+	count, err := audit.Verify(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+}
+
+func TestDebugGC(t *testing.T) {
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true, AuthToken: "t0k"},
+	}, "", nil)
+
+	gc := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/debug/gc", nil)
+		if token != "" {
+			req.Header.Set("X-Debug-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, gc("").Code)
+
+	var runtimeStats runtime.MemStats
+	runtime.ReadMemStats(&runtimeStats)
+	rec := gc("t0k")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	for _, key := range []string{"freed_bytes", "heap_alloc_before", "heap_alloc_after",
+		"heap_objects_before", "heap_objects_after", "heap_sys", "gc_runs", "duration_ms"} {
+		assert.IsType(t, float64(0), body[key], key)
+	}
+	assert.Equal(t, body["heap_alloc_before"].(float64)-body["heap_alloc_after"].(float64), body["freed_bytes"])
+	assert.Greater(t, body["gc_runs"].(float64), float64(runtimeStats.NumGC), "a collection must have run")
+}
+
+func TestDebugWarmVMPool(t *testing.T) {
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "", nil)
+
+	warm := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, warm("/debug/vm-pool/warm?size=-1").Code)
+
+	rec := warm("/debug/vm-pool/warm")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Created   int `json:"created"`
+		Target    int `json:"target"`
+		Available int `json:"available"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	manager := engine.GetVMManager()
+	assert.Equal(t, manager.PreloadSize(), body.Target)
+	assert.GreaterOrEqual(t, body.Available, body.Target)
+}
+
+func TestDebugSelfTest(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	repo := engine.GetConfigRepository()
+	repo.SetDB(db)
+	t.Cleanup(func() {
+		repo.SetDB(nil)
+		db.Close()
+	})
+
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "", nil)
+
+	selfTest := func() (*httptest.ResponseRecorder, map[string]SelfTestCheck) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/selftest", nil))
+		var body struct {
+			Status string                   `json:"status"`
+			Checks map[string]SelfTestCheck `json:"checks"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec, body.Checks
+	}
+
+	rec, checks := selfTest()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Len(t, checks, 6)
+	for _, name := range []string{"encryption", "sanitizer", "analyzer", "database", "vm_acquire", "vm_script"} {
+		assert.Equal(t, "pass", checks[name].Status, "%s: %s", name, checks[name].Message)
+	}
+
+	db.Close()
+	rec, checks = selfTest()
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "fail", checks["database"].Status)
+	assert.NotEmpty(t, checks["database"].Message)
+	assert.Equal(t, "pass", checks["vm_script"].Status)
+}
+
+func TestDebugProcessesFilters(t *testing.T) {
+	tagged := []struct {
+		wid, endpoint, flow, user, state string
+	}{
+		{"filter-1", "/orders/1", "Orders", "ana", "run"},
+		{"filter-2", "/orders/2", "Orders", "bob", "wait"},
+		{"filter-3", "/ordersx", "Other", "ana", "run"},
+		{"filter-4", "/users", "Users", "", "end"},
+	}
+	for _, tc := range tagged {
+		p := process.CreateProcess(tc.wid)
+		p.SetTags(tc.endpoint, tc.flow, tc.user)
+		p.State = tc.state
+		defer p.Close()
+	}
+
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "", nil)
+
+	list := func(query string) []string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/processes?"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var body struct {
+			Total     int                        `json:"total"`
+			Processes map[string]process.Process `json:"processes"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, len(body.Processes), body.Total)
+		var wids []string
+		for wid := range body.Processes {
+			if strings.HasPrefix(wid, "filter-") {
+				wids = append(wids, wid)
+			}
+		}
+		sort.Strings(wids)
+		return wids
+	}
+
+	assert.Equal(t, []string{"filter-1", "filter-2", "filter-3", "filter-4"}, list(""))
+	assert.Equal(t, []string{"filter-1", "filter-2"}, list("endpoint=/orders"), "path prefix")
+	assert.Equal(t, []string{"filter-1", "filter-2"}, list("endpoint=/orders/"))
+	assert.Equal(t, []string{"filter-1"}, list("endpoint=/orders/1"))
+	assert.Equal(t, []string{"filter-1", "filter-3"}, list("user=ana"))
+	assert.Equal(t, []string{"filter-1", "filter-3"}, list("state=run"))
+	assert.Equal(t, []string{"filter-1", "filter-2"}, list("flow=Orders"))
+	assert.Equal(t, []string{"filter-3"}, list("user=ana&state=run&flow=Other"))
+	assert.Empty(t, list("user=nobody"))
+}
+
+func TestDebugTestModeCalls(t *testing.T) {
+	plugins.ConfigureTestMode(true, 0)
+	defer plugins.ConfigureTestMode(false, 0)
+	plugins.RecordCall("mail", "ana@example.com", map[string]interface{}{"subject": "Welcome"})
+	plugins.RecordCall("http", "https://api.example.com/orders", map[string]interface{}{"method": "POST"})
+
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "", nil)
+
+	list := func(query string) (bool, []plugins.RecordedCall) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/test-mode/calls"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var body struct {
+			Enabled bool                   `json:"enabled"`
+			Count   int                    `json:"count"`
+			Calls   []plugins.RecordedCall `json:"calls"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, len(body.Calls), body.Count)
+		return body.Enabled, body.Calls
+	}
+
+	enabled, calls := list("")
+	assert.True(t, enabled)
+	require.Len(t, calls, 2)
+	assert.Equal(t, "mail", calls[0].Kind)
+	assert.Equal(t, "Welcome", calls[0].Data["subject"])
+
+	_, calls = list("?kind=http")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "https://api.example.com/orders", calls[0].Target)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/debug/test-mode/calls", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, calls = list("")
+	assert.Empty(t, calls)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/test-mode/reseed", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"seeded":false`)
+}
+
+func TestDebugReloadPlugins(t *testing.T) {
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "", nil)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/plugins/reload?timeout=x", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/plugins/reload", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Loaded  int      `json:"loaded"`
+		Plugins []string `json:"plugins"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, len(body.Plugins), body.Loaded)
+	assert.Contains(t, body.Plugins, "client_http")
+}
+
+func TestDebugDisabledNodes(t *testing.T) {
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "", nil)
+	defer engine.ResetNodeSwitches()
+
+	disabled := func(method, path string) []string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var body struct {
+			Disabled []string `json:"disabled"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body.Disabled
+	}
+
+	assert.Empty(t, disabled(http.MethodGet, "/debug/nodes/disabled"))
+	assert.Equal(t, []string{"node_7"}, disabled(http.MethodPost, "/debug/nodes/disabled/node_7"))
+	assert.Equal(t, []string{"node_7", "sendmail"}, disabled(http.MethodPost, "/debug/nodes/disabled/sendmail"))
+	assert.Equal(t, []string{"sendmail"}, disabled(http.MethodDelete, "/debug/nodes/disabled/node_7"))
+	assert.Equal(t, []string{"sendmail"}, disabled(http.MethodGet, "/debug/nodes/disabled"))
+	assert.Empty(t, disabled(http.MethodDelete, "/debug/nodes/disabled"))
+}
+
+func TestDebugPlaybookDiff(t *testing.T) {
+	engine.InitializePlaybookRepository(nil)
+	repo := engine.GetPlaybookRepository()
+	t.Cleanup(repo.InvalidateAllCache)
+
+	var current model.Playbook
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"start": {"data": {"type": "starter"}, "outputs": {"output_1": {"connections": [{"node": "js_1", "output": "input_1"}]}}},
+		"js_1":  {"data": {"type": "js", "code": "one()"}, "outputs": {}}
+	}`), &current))
+	repo.Set("diff_app", map[string]map[string]*model.Playbook{"Home": {"data": &current}})
+	repo.SetReloaded("diff_app")
+
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "diff_app", nil)
+	diff := func(flow, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/debug/playbook/"+flow+"/diff", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// js_1 changes its code and a new js_2 node follows it
+	rec := diff("Home", `{
+		"start": {"data": {"type": "starter"}, "outputs": {"output_1": {"connections": [{"node": "js_1", "output": "input_1"}]}}},
+		"js_1":  {"data": {"type": "js", "code": "two()"}, "outputs": {"output_1": {"connections": [{"node": "js_2", "output": "input_1"}]}}},
+		"js_2":  {"data": {"type": "js", "code": "three()"}, "outputs": {}}
+	}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Changed bool                `json:"changed"`
+		Version string              `json:"version"`
+		Diff    engine.PlaybookDiff `json:"diff"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.True(t, body.Changed)
+	assert.Equal(t, engine.PlaybookVersion(&current), body.Version)
+	assert.Equal(t, []string{"js_2"}, body.Diff.Added)
+	assert.Empty(t, body.Diff.Removed)
+	assert.Equal(t, []engine.NodeChange{{Node: "js_1", Type: "js", Fields: []string{"code"}}}, body.Diff.Modified)
+	assert.Equal(t, []engine.Connection{{From: "js_1", Output: "output_1", To: "js_2", Input: "input_1"}}, body.Diff.AddedConnections)
+	assert.Empty(t, body.Diff.RemovedConnections)
+
+	assert.Equal(t, http.StatusNotFound, diff("Missing", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, diff("Home", `not json`).Code)
+}
+
+func TestDebugPlaybooksPagination(t *testing.T) {
+	engine.InitializePlaybookRepository(nil)
+	repo := engine.GetPlaybookRepository()
+	t.Cleanup(repo.InvalidateAllCache)
+
+	node := func() *model.Playbook {
+		return &model.Playbook{"start": &model.Node{Data: map[string]interface{}{"type": "starter"}}}
+	}
+	repo.Set("pages_app", map[string]map[string]*model.Playbook{
+		"Orders":    {"data": node(), "archive": node()},
+		"Customers": {"data": node()},
+		"Invoices":  {"data": node()},
+	})
+	repo.SetReloaded("pages_app")
+
+	e := echo.New()
+	RegisterDebugEndpoints(e, &engine.ConfigWorkspace{
+		DebugConfig: engine.DebugConfig{Enabled: true},
+	}, "pages_app", nil)
+
+	type flow struct {
+		Key     string `json:"key"`
+		FlowKey string `json:"flow_key"`
+	}
+	var body struct {
+		TotalFlows int    `json:"total_flows"`
+		TotalNodes int    `json:"total_nodes"`
+		Matched    int    `json:"matched"`
+		Flows      []flow `json:"flows"`
+	}
+	list := func(query string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/playbooks"+query, nil))
+		body.Flows = nil
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		}
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, list(""))
+	assert.Equal(t, 4, body.TotalFlows)
+	assert.Equal(t, 4, body.TotalNodes)
+	assert.Equal(t, 4, body.Matched)
+	assert.Equal(t, []flow{{"Customers", "data"}, {"Invoices", "data"}, {"Orders", "archive"}, {"Orders", "data"}}, body.Flows)
+
+	require.Equal(t, http.StatusOK, list("?limit=2&offset=1"))
+	assert.Equal(t, []flow{{"Invoices", "data"}, {"Orders", "archive"}}, body.Flows)
+	assert.Equal(t, 4, body.Matched)
+
+	require.Equal(t, http.StatusOK, list("?offset=10"))
+	assert.Empty(t, body.Flows)
+
+	require.Equal(t, http.StatusOK, list("?search=ORDER"))
+	assert.Equal(t, 4, body.TotalFlows)
+	assert.Equal(t, 2, body.Matched)
+	assert.Equal(t, []flow{{"Orders", "archive"}, {"Orders", "data"}}, body.Flows)
+
+	require.Equal(t, http.StatusOK, list("?search=archive&limit=5"))
+	assert.Equal(t, []flow{{"Orders", "archive"}}, body.Flows)
+
+	assert.Equal(t, http.StatusBadRequest, list("?limit=-1"))
+	assert.Equal(t, http.StatusBadRequest, list("?offset=x"))
+}
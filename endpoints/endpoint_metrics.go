@@ -0,0 +1,73 @@
+package endpoints
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// defaultMaxEndpointLabels bounds the distinct endpoint label values
+	defaultMaxEndpointLabels = 200
+	// otherEndpointLabel collects the endpoints seen after the limit
+	otherEndpointLabel = "_other"
+)
+
+// requestsByEndpoint counts requests by endpoint, method and status;
+// sum(nflow_requests_total) is the overall total
+var requestsByEndpoint = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "nflow_requests_total",
+	Help: "Total number of HTTP requests",
+}, []string{"endpoint", "method", "status"})
+
+// requestEndpoint returns the endpoint label for c: the urlpattern of the
+// resolved workflow, else the echo route, never the raw URL
+func requestEndpoint(c echo.Context) string {
+	if pattern, ok := c.Get(engine.EndpointPatternKey).(string); ok && pattern != "" {
+		return pattern
+	}
+	if path := c.Path(); path != "" {
+		return path
+	}
+	return otherEndpointLabel
+}
+
+// requestStatus returns the status the request is answered with, taking
+// into account errors still to be rendered by the echo error handler
+func requestStatus(c echo.Context, err error) int {
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he.Code
+		}
+		return http.StatusInternalServerError
+	}
+	return c.Response().Status
+}
+
+// recordEndpointRequest counts a request by endpoint, method and status.
+// Once maxEndpointLabels endpoints are tracked, new ones are counted as
+// otherEndpointLabel so the totals stay right without unbounded series.
+func (m *MetricsCollector) recordEndpointRequest(endpoint, method string, status int) {
+	limit := m.maxEndpointLabels
+	if limit <= 0 {
+		limit = defaultMaxEndpointLabels
+	}
+
+	m.mu.Lock()
+	if m.endpointNames == nil {
+		m.endpointNames = make(map[string]struct{})
+	}
+	if _, known := m.endpointNames[endpoint]; !known {
+		if len(m.endpointNames) >= limit {
+			endpoint = otherEndpointLabel
+		} else {
+			m.endpointNames[endpoint] = struct{}{}
+		}
+	}
+	m.mu.Unlock()
+
+	requestsByEndpoint.WithLabelValues(endpoint, method, strconv.Itoa(status)).Inc()
+}
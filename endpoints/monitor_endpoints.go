@@ -24,6 +24,15 @@ type MetricsCollector struct {
 	requestsErrors   uint64
 	activeRequests   int64
 
+	// Of the errors, transient ones (429, 503) the client should retry and
+	// hard ones (other 5xx)
+	requestsTransientErrors uint64
+	requestsHardErrors      uint64
+
+	// Requests slower than sloTarget, guarded by mu (0 disables it)
+	requestsSLOBreaches uint64
+	sloTarget           time.Duration
+
 	// Workflow metrics
 	workflowsTotal    uint64
 	workflowsDuration uint64
@@ -43,6 +52,10 @@ type MetricsCollector struct {
 	cacheHits   uint64
 	cacheMisses uint64
 
+	// Endpoint labels in use by requestsByEndpoint, guarded by mu
+	endpointNames     map[string]struct{}
+	maxEndpointLabels int
+
 	// Start time for uptime calculation
 	startTime time.Time
 
@@ -66,21 +79,56 @@ func metricsMiddleware() echo.MiddlewareFunc {
 			atomic.AddInt64(&metrics.activeRequests, 1)
 			atomic.AddUint64(&metrics.requestsTotal, 1)
 
-			err := next(c)
-
-			duration := time.Since(start)
-			atomic.AddUint64(&metrics.requestsDuration, uint64(duration.Microseconds()))
-			atomic.AddInt64(&metrics.activeRequests, -1)
-
-			if err != nil || c.Response().Status >= 400 {
-				atomic.AddUint64(&metrics.requestsErrors, 1)
-			}
-
+			// Counted in a defer so a panic, answered with a 500 by the
+			// recover middleware, is counted as well
+			var err error
+			panicked := true
+			defer func() {
+				duration := time.Since(start)
+				atomic.AddUint64(&metrics.requestsDuration, uint64(duration.Microseconds()))
+				observeRequestDuration(duration)
+				atomic.AddInt64(&metrics.activeRequests, -1)
+				if metrics.sloBreached(duration) {
+					atomic.AddUint64(&metrics.requestsSLOBreaches, 1)
+				}
+
+				status := http.StatusInternalServerError
+				if !panicked {
+					status = requestStatus(c, err)
+				}
+				if err != nil || status >= 400 {
+					atomic.AddUint64(&metrics.requestsErrors, 1)
+				}
+				switch {
+				case isTransientStatus(status):
+					atomic.AddUint64(&metrics.requestsTransientErrors, 1)
+				case status >= 500:
+					atomic.AddUint64(&metrics.requestsHardErrors, 1)
+				}
+				metrics.recordEndpointRequest(requestEndpoint(c), c.Request().Method, status)
+			}()
+
+			err = next(c)
+			panicked = false
 			return err
 		}
 	}
 }
 
+// sloBreached reports whether a request taking duration missed the
+// latency target of monitor.slo_target_ms
+func (m *MetricsCollector) sloBreached(duration time.Duration) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sloTarget > 0 && duration > m.sloTarget
+}
+
+// isTransientStatus reports whether status tells the client to retry
+// later: rate limited or out of capacity
+func isTransientStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
 // RegisterMonitoringEndpoints registers health and metrics endpoints
 func RegisterMonitoringEndpoints(e *echo.Echo, config *engine.ConfigWorkspace) {
 	if !config.MonitorConfig.Enabled {
@@ -99,6 +147,7 @@ func RegisterMonitoringEndpoints(e *echo.Echo, config *engine.ConfigWorkspace) {
 	e.HEAD(healthPath, handleHealthCheck(config))
 
 	// Prometheus metrics endpoint
+	metricsRegistry(config)
 	metricsPath := config.MonitorConfig.MetricsPath
 	if metricsPath == "" {
 		metricsPath = "/metrics"
@@ -112,16 +161,17 @@ func RegisterMonitoringEndpoints(e *echo.Echo, config *engine.ConfigWorkspace) {
 	}
 
 	// Add metrics middleware
+	metrics.mu.Lock()
+	metrics.maxEndpointLabels = config.MonitorConfig.MaxEndpointLabels
+	metrics.sloTarget = time.Duration(config.MonitorConfig.SLOTargetMs) * time.Millisecond
+	metrics.mu.Unlock()
 	e.Use(metricsMiddleware())
 }
 
 // startMetricsServer starts a separate HTTP server for metrics
 func startMetricsServer(port, path string, config *engine.ConfigWorkspace) {
 	mux := http.NewServeMux()
-	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		c := echo.New().NewContext(r, &echoResponseWriter{w})
-		handleMetrics(config)(c)
-	})
+	mux.Handle(path, metricsHandler(config))
 
 	logger.Infof("Starting metrics server on port %s", port)
 	if err := http.ListenAndServe(":"+port, mux); err != nil {
@@ -129,23 +179,6 @@ func startMetricsServer(port, path string, config *engine.ConfigWorkspace) {
 	}
 }
 
-// echoResponseWriter adapts http.ResponseWriter to echo.Response
-type echoResponseWriter struct {
-	http.ResponseWriter
-}
-
-func (w *echoResponseWriter) Header() http.Header {
-	return w.ResponseWriter.Header()
-}
-
-func (w *echoResponseWriter) Write(b []byte) (int, error) {
-	return w.ResponseWriter.Write(b)
-}
-
-func (w *echoResponseWriter) WriteHeader(code int) {
-	w.ResponseWriter.WriteHeader(code)
-}
-
 // Health check response structure
 type HealthStatus struct {
 	Status     string                     `json:"status"`
@@ -157,8 +190,9 @@ type HealthStatus struct {
 }
 
 type ComponentHealth struct {
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+	Status  string                 `json:"status"`
+	Message string                 `json:"message,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 // handleHealthCheck provides comprehensive health status
@@ -188,15 +222,29 @@ func handleHealthCheck(config *engine.ConfigWorkspace) echo.HandlerFunc {
 			}
 		}
 
-		// Check process repository
-		processHealth := checkProcessHealth()
-		health.Components["processes"] = processHealth
+		// Check process repository and memory usage against the thresholds:
+		// warning keeps answering 200, critical degrades
+		for name, componentHealth := range map[string]ComponentHealth{
+			"processes": checkProcessHealth(&config.MonitorConfig),
+			"memory":    checkMemoryHealth(&config.MonitorConfig),
+		} {
+			health.Components[name] = componentHealth
+			switch componentHealth.Status {
+			case "critical":
+				health.Status = "degraded"
+			case "warning":
+				if health.Status == "healthy" {
+					health.Status = "warning"
+				}
+			}
+		}
 
-		// Check memory usage
-		memoryHealth := checkMemoryHealth()
-		health.Components["memory"] = memoryHealth
-		if memoryHealth.Status != "healthy" {
-			health.Status = "degraded"
+		// Check the plugins depending on external services
+		for name, pluginHealth := range checkPluginsHealth() {
+			health.Components["plugin:"+name] = pluginHealth
+			if pluginHealth.Status != "healthy" {
+				health.Status = "degraded"
+			}
 		}
 
 		// Add detailed metrics if enabled
@@ -206,7 +254,7 @@ func handleHealthCheck(config *engine.ConfigWorkspace) echo.HandlerFunc {
 
 		// Return appropriate status code
 		statusCode := http.StatusOK
-		if health.Status != "healthy" {
+		if health.Status == "degraded" {
 			statusCode = http.StatusServiceUnavailable
 		}
 
@@ -216,113 +264,7 @@ func handleHealthCheck(config *engine.ConfigWorkspace) echo.HandlerFunc {
 
 // handleMetrics provides Prometheus-compatible metrics
 func handleMetrics(config *engine.ConfigWorkspace) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		c.Response().Header().Set("Content-Type", "text/plain; version=0.0.4")
-
-		output := ""
-
-		// Basic metrics
-		output += fmt.Sprintf("# HELP nflow_up Whether the nFlow Runtime is up\n")
-		output += fmt.Sprintf("# TYPE nflow_up gauge\n")
-		output += fmt.Sprintf("nflow_up 1\n\n")
-
-		output += fmt.Sprintf("# HELP nflow_uptime_seconds Number of seconds since nFlow Runtime started\n")
-		output += fmt.Sprintf("# TYPE nflow_uptime_seconds counter\n")
-		output += fmt.Sprintf("nflow_uptime_seconds %f\n\n", time.Since(metrics.startTime).Seconds())
-
-		// Request metrics
-		output += fmt.Sprintf("# HELP nflow_requests_total Total number of HTTP requests\n")
-		output += fmt.Sprintf("# TYPE nflow_requests_total counter\n")
-		output += fmt.Sprintf("nflow_requests_total %d\n\n", atomic.LoadUint64(&metrics.requestsTotal))
-
-		output += fmt.Sprintf("# HELP nflow_requests_errors_total Total number of HTTP request errors\n")
-		output += fmt.Sprintf("# TYPE nflow_requests_errors_total counter\n")
-		output += fmt.Sprintf("nflow_requests_errors_total %d\n\n", atomic.LoadUint64(&metrics.requestsErrors))
-
-		output += fmt.Sprintf("# HELP nflow_requests_active Number of active HTTP requests\n")
-		output += fmt.Sprintf("# TYPE nflow_requests_active gauge\n")
-		output += fmt.Sprintf("nflow_requests_active %d\n\n", atomic.LoadInt64(&metrics.activeRequests))
-
-		// Calculate average request duration
-		totalRequests := atomic.LoadUint64(&metrics.requestsTotal)
-		if totalRequests > 0 {
-			avgDuration := float64(atomic.LoadUint64(&metrics.requestsDuration)) / float64(totalRequests) / 1000.0 // Convert to milliseconds
-			output += fmt.Sprintf("# HELP nflow_request_duration_milliseconds Average HTTP request duration\n")
-			output += fmt.Sprintf("# TYPE nflow_request_duration_milliseconds gauge\n")
-			output += fmt.Sprintf("nflow_request_duration_milliseconds %f\n\n", avgDuration)
-		}
-
-		// Workflow metrics
-		output += fmt.Sprintf("# HELP nflow_workflows_total Total number of workflows executed\n")
-		output += fmt.Sprintf("# TYPE nflow_workflows_total counter\n")
-		output += fmt.Sprintf("nflow_workflows_total %d\n\n", atomic.LoadUint64(&metrics.workflowsTotal))
-
-		output += fmt.Sprintf("# HELP nflow_workflows_errors_total Total number of workflow errors\n")
-		output += fmt.Sprintf("# TYPE nflow_workflows_errors_total counter\n")
-		output += fmt.Sprintf("nflow_workflows_errors_total %d\n\n", atomic.LoadUint64(&metrics.workflowsErrors))
-
-		// Process metrics
-		activeProcesses := int64(len(process.GetProcessList()))
-		output += fmt.Sprintf("# HELP nflow_processes_active Number of active workflow processes\n")
-		output += fmt.Sprintf("# TYPE nflow_processes_active gauge\n")
-		output += fmt.Sprintf("nflow_processes_active %d\n\n", activeProcesses)
-
-		output += fmt.Sprintf("# HELP nflow_processes_total Total number of workflow processes created\n")
-		output += fmt.Sprintf("# TYPE nflow_processes_total counter\n")
-		output += fmt.Sprintf("nflow_processes_total %d\n\n", atomic.LoadUint64(&metrics.processesTotal))
-
-		// Database metrics
-		if db, err := engine.GetDB(); err == nil {
-			stats := db.Stats()
-			output += fmt.Sprintf("# HELP nflow_db_connections_open Number of open database connections\n")
-			output += fmt.Sprintf("# TYPE nflow_db_connections_open gauge\n")
-			output += fmt.Sprintf("nflow_db_connections_open %d\n\n", stats.OpenConnections)
-
-			output += fmt.Sprintf("# HELP nflow_db_connections_in_use Number of database connections in use\n")
-			output += fmt.Sprintf("# TYPE nflow_db_connections_in_use gauge\n")
-			output += fmt.Sprintf("nflow_db_connections_in_use %d\n\n", stats.InUse)
-
-			output += fmt.Sprintf("# HELP nflow_db_connections_idle Number of idle database connections\n")
-			output += fmt.Sprintf("# TYPE nflow_db_connections_idle gauge\n")
-			output += fmt.Sprintf("nflow_db_connections_idle %d\n\n", stats.Idle)
-		}
-
-		// Go runtime metrics
-		var m runtime.MemStats
-		runtime.ReadMemStats(&m)
-
-		output += fmt.Sprintf("# HELP nflow_go_goroutines Number of goroutines\n")
-		output += fmt.Sprintf("# TYPE nflow_go_goroutines gauge\n")
-		output += fmt.Sprintf("nflow_go_goroutines %d\n\n", runtime.NumGoroutine())
-
-		output += fmt.Sprintf("# HELP nflow_go_memory_alloc_bytes Current memory allocation\n")
-		output += fmt.Sprintf("# TYPE nflow_go_memory_alloc_bytes gauge\n")
-		output += fmt.Sprintf("nflow_go_memory_alloc_bytes %d\n\n", m.Alloc)
-
-		output += fmt.Sprintf("# HELP nflow_go_memory_sys_bytes Total memory obtained from system\n")
-		output += fmt.Sprintf("# TYPE nflow_go_memory_sys_bytes gauge\n")
-		output += fmt.Sprintf("nflow_go_memory_sys_bytes %d\n\n", m.Sys)
-
-		output += fmt.Sprintf("# HELP nflow_go_gc_runs_total Number of GC runs\n")
-		output += fmt.Sprintf("# TYPE nflow_go_gc_runs_total counter\n")
-		output += fmt.Sprintf("nflow_go_gc_runs_total %d\n\n", m.NumGC)
-
-		// Cache metrics
-		output += fmt.Sprintf("# HELP nflow_cache_hits_total Total number of cache hits\n")
-		output += fmt.Sprintf("# TYPE nflow_cache_hits_total counter\n")
-		output += fmt.Sprintf("nflow_cache_hits_total %d\n\n", atomic.LoadUint64(&metrics.cacheHits))
-
-		output += fmt.Sprintf("# HELP nflow_cache_misses_total Total number of cache misses\n")
-		output += fmt.Sprintf("# TYPE nflow_cache_misses_total counter\n")
-		output += fmt.Sprintf("nflow_cache_misses_total %d\n\n", atomic.LoadUint64(&metrics.cacheMisses))
-
-		// Detailed metrics if enabled
-		if config.MonitorConfig.EnableDetailedMetrics {
-			output += getDetailedPrometheusMetrics()
-		}
-
-		return c.String(http.StatusOK, output)
-	}
+	return echo.WrapHandler(metricsHandler(config))
 }
 
 // Health check helper functions
@@ -349,38 +291,127 @@ func checkDatabaseHealth() ComponentHealth {
 	return ComponentHealth{Status: "healthy"}
 }
 
+// checkRedisHealth pings the shared Redis client and reports the state of
+// its connection pool
 func checkRedisHealth(config *engine.ConfigWorkspace) ComponentHealth {
-	// This would need actual Redis client check
-	return ComponentHealth{
-		Status:  "healthy",
-		Message: "Redis health check not implemented",
+	client := engine.GetRedisClient()
+	stats := client.PoolStats()
+	details := map[string]interface{}{
+		"pool_size":   client.Options().PoolSize,
+		"total_conns": stats.TotalConns,
+		"idle_conns":  stats.IdleConns,
+		"stale_conns": stats.StaleConns,
+		"hits":        stats.Hits,
+		"misses":      stats.Misses,
+		"timeouts":    stats.Timeouts,
 	}
-}
 
-func checkProcessHealth() ComponentHealth {
-	processes := len(process.GetProcessList())
-	if processes > 1000 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.WithContext(ctx).Ping().Err(); err != nil {
 		return ComponentHealth{
-			Status:  "warning",
-			Message: fmt.Sprintf("High number of active processes: %d", processes),
+			Status:  "unhealthy",
+			Message: fmt.Sprintf("Redis ping failed: %v", err),
+			Details: details,
 		}
 	}
-	return ComponentHealth{Status: "healthy"}
+	return ComponentHealth{Status: "healthy", Details: details}
 }
 
-func checkMemoryHealth() ComponentHealth {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
+// checkPluginsHealth returns the health of every loaded plugin; plugins
+// without a health check are healthy
+func checkPluginsHealth() map[string]ComponentHealth {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	// Alert if memory usage is above 1GB
-	if m.Alloc > 1024*1024*1024 {
-		return ComponentHealth{
-			Status:  "warning",
-			Message: fmt.Sprintf("High memory usage: %d MB", m.Alloc/1024/1024),
+	components := make(map[string]ComponentHealth)
+	for name, err := range engine.CheckPluginsHealth(ctx) {
+		if err != nil {
+			components[name] = ComponentHealth{Status: "unhealthy", Message: err.Error()}
+			continue
 		}
+		components[name] = ComponentHealth{Status: "healthy"}
 	}
+	return components
+}
 
-	return ComponentHealth{Status: "healthy"}
+// Default health thresholds, see MonitorConfig
+const (
+	defaultMemoryWarnMB      = 1024
+	defaultMemoryCriticalMB  = 2048
+	defaultProcessesWarn     = 1000
+	defaultProcessesCritical = 5000
+)
+
+// healthThreshold returns value, fallback when it is 0 and 0 (disabled)
+// when it is negative
+func healthThreshold(value, fallback int) uint64 {
+	switch {
+	case value == 0:
+		return uint64(fallback)
+	case value < 0:
+		return 0
+	default:
+		return uint64(value)
+	}
+}
+
+// thresholdStatus returns critical or warning when value is past the
+// critical or warn level, healthy otherwise. A 0 level is disabled.
+func thresholdStatus(value, warn, critical uint64) string {
+	switch {
+	case critical > 0 && value > critical:
+		return "critical"
+	case warn > 0 && value > warn:
+		return "warning"
+	}
+	return "healthy"
+}
+
+func checkProcessHealth(config *engine.MonitorConfig) ComponentHealth {
+	return processHealth(len(process.GetProcessList()), config)
+}
+
+func processHealth(active int, config *engine.MonitorConfig) ComponentHealth {
+	warn := healthThreshold(config.ProcessesWarn, defaultProcessesWarn)
+	critical := healthThreshold(config.ProcessesCritical, defaultProcessesCritical)
+	health := ComponentHealth{
+		Status: thresholdStatus(uint64(active), warn, critical),
+		Details: map[string]interface{}{
+			"active":   active,
+			"rejected": process.Rejected(),
+			"warn":     warn,
+			"critical": critical,
+		},
+	}
+	if health.Status != "healthy" {
+		health.Message = fmt.Sprintf("High number of active processes: %d", active)
+	}
+	return health
+}
+
+func checkMemoryHealth(config *engine.MonitorConfig) ComponentHealth {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return memoryHealth(m.Alloc, config)
+}
+
+func memoryHealth(alloc uint64, config *engine.MonitorConfig) ComponentHealth {
+	warnMB := healthThreshold(config.MemoryWarnMB, defaultMemoryWarnMB)
+	criticalMB := healthThreshold(config.MemoryCriticalMB, defaultMemoryCriticalMB)
+	health := ComponentHealth{
+		Status: thresholdStatus(alloc, warnMB*1024*1024, criticalMB*1024*1024),
+		Details: map[string]interface{}{
+			"alloc_mb":    alloc / 1024 / 1024,
+			"warn_mb":     warnMB,
+			"critical_mb": criticalMB,
+		},
+	}
+	if health.Status != "healthy" {
+		health.Message = fmt.Sprintf("High memory usage: %d MB", alloc/1024/1024)
+	}
+	return health
 }
 
 // getDetailedMetrics returns detailed metrics for health check
@@ -396,9 +427,13 @@ func getDetailedMetrics() map[string]interface{} {
 
 	return map[string]interface{}{
 		"requests": map[string]interface{}{
-			"total":  atomic.LoadUint64(&metrics.requestsTotal),
-			"errors": atomic.LoadUint64(&metrics.requestsErrors),
-			"active": atomic.LoadInt64(&metrics.activeRequests),
+			"total":            atomic.LoadUint64(&metrics.requestsTotal),
+			"errors":           atomic.LoadUint64(&metrics.requestsErrors),
+			"transient_errors": atomic.LoadUint64(&metrics.requestsTransientErrors),
+			"hard_errors":      atomic.LoadUint64(&metrics.requestsHardErrors),
+			"slo_breaches":     atomic.LoadUint64(&metrics.requestsSLOBreaches),
+			"panics":           engine.PanicCount(),
+			"active":           atomic.LoadInt64(&metrics.activeRequests),
 		},
 		"workflows": map[string]interface{}{
 			"total":  atomic.LoadUint64(&metrics.workflowsTotal),
@@ -412,6 +447,8 @@ func getDetailedMetrics() map[string]interface{} {
 			"connections_open":   dbStats.OpenConnections,
 			"connections_in_use": dbStats.InUse,
 			"connections_idle":   dbStats.Idle,
+			"queries":            atomic.LoadUint64(&metrics.dbQueriesTotal),
+			"slow_queries":       engine.SlowQueries(),
 		},
 		"memory": map[string]interface{}{
 			"alloc_mb":      m.Alloc / 1024 / 1024,
@@ -426,42 +463,6 @@ func getDetailedMetrics() map[string]interface{} {
 	}
 }
 
-// getDetailedPrometheusMetrics returns additional detailed metrics
-func getDetailedPrometheusMetrics() string {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	output := ""
-
-	// Detailed memory metrics
-	output += fmt.Sprintf("# HELP nflow_go_memory_heap_alloc_bytes Heap allocation\n")
-	output += fmt.Sprintf("# TYPE nflow_go_memory_heap_alloc_bytes gauge\n")
-	output += fmt.Sprintf("nflow_go_memory_heap_alloc_bytes %d\n\n", m.HeapAlloc)
-
-	output += fmt.Sprintf("# HELP nflow_go_memory_heap_sys_bytes Heap system memory\n")
-	output += fmt.Sprintf("# TYPE nflow_go_memory_heap_sys_bytes gauge\n")
-	output += fmt.Sprintf("nflow_go_memory_heap_sys_bytes %d\n\n", m.HeapSys)
-
-	output += fmt.Sprintf("# HELP nflow_go_memory_heap_idle_bytes Heap idle memory\n")
-	output += fmt.Sprintf("# TYPE nflow_go_memory_heap_idle_bytes gauge\n")
-	output += fmt.Sprintf("nflow_go_memory_heap_idle_bytes %d\n\n", m.HeapIdle)
-
-	output += fmt.Sprintf("# HELP nflow_go_memory_heap_inuse_bytes Heap in-use memory\n")
-	output += fmt.Sprintf("# TYPE nflow_go_memory_heap_inuse_bytes gauge\n")
-	output += fmt.Sprintf("nflow_go_memory_heap_inuse_bytes %d\n\n", m.HeapInuse)
-
-	output += fmt.Sprintf("# HELP nflow_go_memory_heap_objects Number of heap objects\n")
-	output += fmt.Sprintf("# TYPE nflow_go_memory_heap_objects gauge\n")
-	output += fmt.Sprintf("nflow_go_memory_heap_objects %d\n\n", m.HeapObjects)
-
-	// GC metrics
-	output += fmt.Sprintf("# HELP nflow_go_gc_cpu_fraction GC CPU fraction\n")
-	output += fmt.Sprintf("# TYPE nflow_go_gc_cpu_fraction gauge\n")
-	output += fmt.Sprintf("nflow_go_gc_cpu_fraction %f\n\n", m.GCCPUFraction)
-
-	return output
-}
-
 // UpdateMetrics provides methods to update metrics from other parts of the application
 func UpdateWorkflowMetrics(success bool, duration time.Duration) {
 	atomic.AddUint64(&metrics.workflowsTotal, 1)
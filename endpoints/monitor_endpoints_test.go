@@ -0,0 +1,442 @@
+package endpoints
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/labstack/echo/v4"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetMetrics replaces the global collector and registry for the duration
+// of a test
+func resetMetrics(t *testing.T, maxEndpointLabels int) {
+	previous := metrics
+	metrics = &MetricsCollector{startTime: time.Now(), maxEndpointLabels: maxEndpointLabels}
+	requestsByEndpoint.Reset()
+	registryOnce = sync.Once{}
+	t.Cleanup(func() {
+		metrics = previous
+		requestsByEndpoint.Reset()
+		registryOnce = sync.Once{}
+		engine.SetNodeObserver(nil)
+		engine.SetQueryObserver(nil)
+	})
+}
+
+func newMetricsTestServer() *echo.Echo {
+	return newMetricsTestServerWithConfig(&engine.ConfigWorkspace{})
+}
+
+func newMetricsTestServerWithConfig(config *engine.ConfigWorkspace) *echo.Echo {
+	e := echo.New()
+	e.Use(metricsMiddleware())
+	e.GET("/metrics", handleMetrics(config))
+	e.GET("/sleep/:ms", func(c echo.Context) error {
+		ms, _ := strconv.Atoi(c.Param("ms"))
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/status/:code", func(c echo.Context) error {
+		if code, _ := strconv.Atoi(c.Param("code")); code >= 400 {
+			return echo.NewHTTPError(code, "boom")
+		}
+		return c.String(http.StatusOK, "ok")
+	})
+	// Simulates the workflow handler resolving a starter urlpattern
+	e.Any("/*", func(c echo.Context) error {
+		c.Set(engine.EndpointPatternKey, "/users/:id")
+		return c.String(http.StatusOK, "user")
+	})
+	return e
+}
+
+func serve(e *echo.Echo, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+// scrape fetches /metrics and parses it with the Prometheus text parser
+func scrape(t *testing.T, e *echo.Echo) map[string]*dto.MetricFamily {
+	rec := serve(e, http.MethodGet, "/metrics")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(rec.Body)
+	require.NoError(t, err)
+	return families
+}
+
+// counterValue returns the value of the series of family matching labels
+func counterValue(family *dto.MetricFamily, labels map[string]string) (float64, bool) {
+	for _, m := range family.GetMetric() {
+		matched := 0
+		for _, lp := range m.GetLabel() {
+			if v, ok := labels[lp.GetName()]; ok && v == lp.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return m.GetCounter().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func requestsTotal(t *testing.T, families map[string]*dto.MetricFamily, endpoint, method, status string) float64 {
+	family, ok := families["nflow_requests_total"]
+	require.True(t, ok, "nflow_requests_total missing")
+	v, ok := counterValue(family, map[string]string{"endpoint": endpoint, "method": method, "status": status})
+	require.True(t, ok, "no series for %s %s %s", endpoint, method, status)
+	return v
+}
+
+func TestMetricsScrape(t *testing.T) {
+	resetMetrics(t, 0)
+	e := newMetricsTestServer()
+	serve(e, http.MethodGet, "/status/200")
+
+	families := scrape(t, e)
+	for _, name := range []string{
+		"nflow_up", "nflow_uptime_seconds", "nflow_requests_total", "nflow_requests_errors_total",
+		"nflow_requests_active", "nflow_request_duration_milliseconds", "nflow_workflows_total",
+		"nflow_workflows_errors_total", "nflow_processes_active", "nflow_processes_total",
+		"nflow_go_goroutines", "nflow_go_memory_alloc_bytes", "nflow_go_memory_sys_bytes",
+		"nflow_go_gc_runs_total", "nflow_cache_hits_total", "nflow_cache_misses_total",
+		"nflow_redis_pool_hits_total", "nflow_redis_pool_total_connections",
+	} {
+		assert.Contains(t, families, name)
+	}
+	assert.Equal(t, dto.MetricType_COUNTER, families["nflow_requests_total"].GetType())
+	assert.Equal(t, dto.MetricType_GAUGE, families["nflow_requests_active"].GetType())
+	assert.Equal(t, float64(1), families["nflow_up"].GetMetric()[0].GetGauge().GetValue())
+	assert.NotContains(t, families, "nflow_go_memory_heap_alloc_bytes", "detailed metrics are off")
+}
+
+func TestMetricsEndpointLabels(t *testing.T) {
+	resetMetrics(t, 0)
+	e := newMetricsTestServer()
+
+	serve(e, http.MethodGet, "/users/1")
+	serve(e, http.MethodGet, "/users/2")
+	serve(e, http.MethodPost, "/users/3")
+	serve(e, http.MethodGet, "/status/200")
+	serve(e, http.MethodGet, "/status/500")
+
+	families := scrape(t, e)
+	assert.Equal(t, float64(2), requestsTotal(t, families, "/users/:id", "GET", "200"))
+	assert.Equal(t, float64(1), requestsTotal(t, families, "/users/:id", "POST", "200"))
+	assert.Equal(t, float64(1), requestsTotal(t, families, "/status/:code", "GET", "200"))
+	assert.Equal(t, float64(1), requestsTotal(t, families, "/status/:code", "GET", "500"))
+	assert.Len(t, families["nflow_requests_total"].GetMetric(), 4, "raw URLs must not become labels")
+	assert.Equal(t, float64(1), families["nflow_requests_errors_total"].GetMetric()[0].GetCounter().GetValue())
+}
+
+func TestMetricsTransientAndHardErrors(t *testing.T) {
+	resetMetrics(t, 0)
+	e := newMetricsTestServer()
+
+	serve(e, http.MethodGet, "/status/503")
+	serve(e, http.MethodGet, "/status/503")
+	serve(e, http.MethodGet, "/status/429")
+	serve(e, http.MethodGet, "/status/500")
+	serve(e, http.MethodGet, "/status/404")
+	serve(e, http.MethodGet, "/status/200")
+
+	families := scrape(t, e)
+	value := func(name string) float64 {
+		require.Contains(t, families, name)
+		return families[name].GetMetric()[0].GetCounter().GetValue()
+	}
+	assert.Equal(t, float64(5), value("nflow_requests_errors_total"))
+	assert.Equal(t, float64(3), value("nflow_requests_transient_errors_total"))
+	assert.Equal(t, float64(1), value("nflow_requests_hard_errors_total"))
+}
+
+func TestMetricsSLOBreaches(t *testing.T) {
+	resetMetrics(t, 0)
+	e := echo.New()
+	RegisterMonitoringEndpoints(e, &engine.ConfigWorkspace{
+		MonitorConfig: engine.MonitorConfig{Enabled: true, SLOTargetMs: 30},
+	})
+	e.GET("/sleep/:ms", func(c echo.Context) error {
+		ms, _ := strconv.Atoi(c.Param("ms"))
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return c.String(http.StatusOK, "ok")
+	})
+
+	serve(e, http.MethodGet, "/sleep/0")
+	serve(e, http.MethodGet, "/sleep/60")
+	serve(e, http.MethodGet, "/sleep/60")
+	serve(e, http.MethodGet, "/sleep/1")
+
+	families := scrape(t, e)
+	require.Contains(t, families, "nflow_requests_slo_breach_total")
+	assert.Equal(t, float64(2), families["nflow_requests_slo_breach_total"].GetMetric()[0].GetCounter().GetValue())
+
+	// Without a target nothing is a breach
+	metrics.mu.Lock()
+	metrics.sloTarget = 0
+	metrics.mu.Unlock()
+	serve(e, http.MethodGet, "/sleep/60")
+	families = scrape(t, e)
+	assert.Equal(t, float64(2), families["nflow_requests_slo_breach_total"].GetMetric()[0].GetCounter().GetValue())
+}
+
+func TestMetricsCountPanics(t *testing.T) {
+	resetMetrics(t, 0)
+	e := echo.New()
+	e.Use(engine.RecoverMiddleware())
+	e.Use(metricsMiddleware())
+	e.GET("/metrics", handleMetrics(&engine.ConfigWorkspace{}))
+	e.GET("/panic", func(c echo.Context) error {
+		panic("boom")
+	})
+
+	before := engine.PanicCount()
+	rec := serve(e, http.MethodGet, "/panic")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	families := scrape(t, e)
+	value := func(name string) float64 {
+		require.Contains(t, families, name)
+		return families[name].GetMetric()[0].GetCounter().GetValue()
+	}
+	assert.Equal(t, float64(1), value("nflow_requests_errors_total"))
+	assert.Equal(t, float64(1), value("nflow_requests_hard_errors_total"))
+	assert.Equal(t, float64(before+1), value("nflow_panics_total"))
+	assert.Equal(t, float64(1), requestsTotal(t, families, "/panic", "GET", "500"))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&metrics.activeRequests), "the panicking request must not stay active")
+}
+
+func TestMetricsEndpointLabelsCapped(t *testing.T) {
+	resetMetrics(t, 2)
+
+	metrics.recordEndpointRequest("/a", http.MethodGet, 200)
+	metrics.recordEndpointRequest("/b", http.MethodGet, 200)
+	metrics.recordEndpointRequest("/c", http.MethodGet, 200)
+	metrics.recordEndpointRequest("/d", http.MethodGet, 200)
+	metrics.recordEndpointRequest("/a", http.MethodGet, 200)
+
+	families := scrape(t, newMetricsTestServer())
+	assert.Equal(t, float64(2), requestsTotal(t, families, "/a", "GET", "200"))
+	assert.Equal(t, float64(1), requestsTotal(t, families, "/b", "GET", "200"))
+	assert.Equal(t, float64(2), requestsTotal(t, families, otherEndpointLabel, "GET", "200"))
+	_, found := counterValue(families["nflow_requests_total"], map[string]string{"endpoint": "/c"})
+	assert.False(t, found)
+}
+
+// bucketCounts returns the cumulative count per finite upper bound of a
+// histogram, the +Inf bucket is the sample count
+func bucketCounts(h *dto.Histogram) map[float64]uint64 {
+	counts := make(map[float64]uint64)
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		counts[b.GetUpperBound()] = b.GetCumulativeCount()
+	}
+	return counts
+}
+
+func TestMetricsDurationHistograms(t *testing.T) {
+	resetMetrics(t, 0)
+	config := &engine.ConfigWorkspace{}
+	config.MonitorConfig.RequestDurationBuckets = []float64{1, 0.05, 0.01}
+	config.MonitorConfig.NodeDurationBuckets = []float64{0.01, 0.1}
+	e := newMetricsTestServerWithConfig(config)
+
+	for _, ms := range []string{"0", "0", "20", "60"} {
+		serve(e, http.MethodGet, "/sleep/"+ms)
+	}
+	observeNodeDuration("js", 5*time.Millisecond)
+	observeNodeDuration("js", 50*time.Millisecond)
+	observeNodeDuration("http", 200*time.Millisecond)
+
+	families := scrape(t, e)
+
+	request := families["nflow_request_duration_seconds"]
+	require.NotNil(t, request)
+	assert.Equal(t, dto.MetricType_HISTOGRAM, request.GetType())
+	h := request.GetMetric()[0].GetHistogram()
+	assert.Equal(t, uint64(4), h.GetSampleCount())
+	assert.Equal(t, map[float64]uint64{0.01: 2, 0.05: 3, 1: 4}, bucketCounts(h))
+
+	node := families["nflow_node_duration_seconds"]
+	require.NotNil(t, node)
+	for _, m := range node.GetMetric() {
+		switch m.GetLabel()[0].GetValue() {
+		case "js":
+			assert.Equal(t, map[float64]uint64{0.01: 1, 0.1: 2}, bucketCounts(m.GetHistogram()))
+		case "http":
+			assert.Equal(t, map[float64]uint64{0.01: 0, 0.1: 0}, bucketCounts(m.GetHistogram()))
+			assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+		default:
+			t.Errorf("unexpected node type %s", m.GetLabel()[0].GetValue())
+		}
+	}
+}
+
+func TestMetricsDeepCopyCost(t *testing.T) {
+	resetMetrics(t, 0)
+	e := newMetricsTestServerWithConfig(&engine.ConfigWorkspace{})
+	before := scrape(t, e)["nflow_playbook_deepcopy_duration_seconds"].GetMetric()[0].GetHistogram().GetSampleCount()
+
+	observeDeepCopyDuration(3 * time.Microsecond)
+	observeDeepCopyDuration(40 * time.Microsecond)
+
+	families := scrape(t, e)
+	copies := families["nflow_playbook_deepcopy_duration_seconds"]
+	require.NotNil(t, copies)
+	assert.Equal(t, before+2, copies.GetMetric()[0].GetHistogram().GetSampleCount())
+	require.NotNil(t, families["nflow_playbook_cache_hit_nodes"])
+	assert.Equal(t, float64(engine.CacheHitNodes()), families["nflow_playbook_cache_hit_nodes"].GetMetric()[0].GetGauge().GetValue())
+}
+
+// unhealthyPlugin is a plugin whose external service is unreachable
+type unhealthyPlugin struct{}
+
+func (unhealthyPlugin) Run(c echo.Context, vars map[string]string, payloadIn interface{}, dromedary_data string, callback chan string) (interface{}, string, error) {
+	return payloadIn, "output_1", nil
+}
+func (unhealthyPlugin) Name() string                         { return "test_smtp" }
+func (unhealthyPlugin) AddFeatureJS() map[string]interface{} { return nil }
+func (unhealthyPlugin) HealthCheck() error                   { return errors.New("smtp server unreachable") }
+
+func TestHealthCheckReportsPlugins(t *testing.T) {
+	repo := engine.GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() {
+		repo.SetConfig(original)
+		engine.RegisterPluginFactory("test_smtp", nil)
+		engine.LoadPlugins()
+	})
+	config := original
+	config.PluginConfig.Plugins = []string{"test_smtp", "rules"}
+	repo.SetConfig(config)
+	engine.RegisterPluginFactory("test_smtp", func(*engine.ConfigWorkspace) engine.NflowPlugin { return unhealthyPlugin{} })
+	engine.LoadPlugins()
+
+	e := echo.New()
+	e.GET("/health", handleHealthCheck(&engine.ConfigWorkspace{}))
+	rec := serve(e, http.MethodGet, "/health")
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var health HealthStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &health))
+	assert.Equal(t, "degraded", health.Status)
+	assert.Equal(t, ComponentHealth{Status: "unhealthy", Message: "smtp server unreachable"}, health.Components["plugin:test_smtp"])
+	assert.Equal(t, ComponentHealth{Status: "healthy"}, health.Components["plugin:rules"], "plugins without a health check are healthy")
+}
+
+func TestHealthCheckReportsRedisPool(t *testing.T) {
+	repo := engine.GetConfigRepository()
+	previous := repo.GetRedisClient()
+	t.Cleanup(func() { repo.SetRedisClient(previous) })
+	// Nothing listens on port 1, the ping fails right away
+	repo.SetRedisClient(engine.NewRedisClient(engine.RedisConfig{Host: "127.0.0.1:1", MaxConnectionPool: 3}))
+
+	config := &engine.ConfigWorkspace{}
+	config.RedisConfig.Host = "127.0.0.1:1"
+	e := echo.New()
+	e.GET("/health", handleHealthCheck(config))
+	rec := serve(e, http.MethodGet, "/health")
+
+	var health HealthStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &health))
+	redisHealth := health.Components["redis"]
+	assert.Equal(t, "unhealthy", redisHealth.Status)
+	assert.Contains(t, redisHealth.Message, "Redis ping failed")
+	assert.Equal(t, float64(3), redisHealth.Details["pool_size"])
+	assert.Contains(t, redisHealth.Details, "idle_conns")
+	assert.Equal(t, "degraded", health.Status)
+}
+
+func TestMemoryHealthThresholds(t *testing.T) {
+	const mb = 1024 * 1024
+	config := &engine.MonitorConfig{MemoryWarnMB: 100, MemoryCriticalMB: 200}
+
+	assert.Equal(t, "healthy", memoryHealth(50*mb, config).Status)
+	assert.Equal(t, "healthy", memoryHealth(100*mb, config).Status, "at the warn level")
+	warning := memoryHealth(150*mb, config)
+	assert.Equal(t, "warning", warning.Status)
+	assert.Equal(t, "High memory usage: 150 MB", warning.Message)
+	assert.Equal(t, "critical", memoryHealth(250*mb, config).Status)
+
+	// Defaults: 1GB warn, 2GB critical
+	assert.Equal(t, "healthy", memoryHealth(512*mb, &engine.MonitorConfig{}).Status)
+	assert.Equal(t, "warning", memoryHealth(1500*mb, &engine.MonitorConfig{}).Status)
+	assert.Equal(t, "critical", memoryHealth(3000*mb, &engine.MonitorConfig{}).Status)
+
+	// -1 disables a level
+	assert.Equal(t, "warning", memoryHealth(3000*mb, &engine.MonitorConfig{MemoryCriticalMB: -1}).Status)
+	assert.Equal(t, "healthy", memoryHealth(3000*mb, &engine.MonitorConfig{MemoryWarnMB: -1, MemoryCriticalMB: -1}).Status)
+}
+
+func TestProcessHealthThresholds(t *testing.T) {
+	config := &engine.MonitorConfig{ProcessesWarn: 2, ProcessesCritical: 4}
+
+	assert.Equal(t, "healthy", processHealth(2, config).Status)
+	assert.Equal(t, "warning", processHealth(3, config).Status)
+	assert.Equal(t, "critical", processHealth(5, config).Status)
+	assert.Equal(t, "warning", processHealth(1001, &engine.MonitorConfig{}).Status, "default warn level")
+	assert.Equal(t, "critical", processHealth(5001, &engine.MonitorConfig{}).Status, "default critical level")
+}
+
+func TestHealthCheckWarnVsCritical(t *testing.T) {
+	// Keep the database out of the way so only the process levels matter
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	repo := engine.GetConfigRepository()
+	repo.SetDB(db)
+	t.Cleanup(func() {
+		repo.SetDB(nil)
+		db.Close()
+	})
+
+	active := len(process.GetProcessList())
+	for i := 0; i < 3; i++ {
+		p := process.CreateProcess(fmt.Sprintf("health-levels-%d", i))
+		defer p.Close()
+	}
+
+	check := func(warn, critical int) (int, HealthStatus) {
+		e := echo.New()
+		e.GET("/health", handleHealthCheck(&engine.ConfigWorkspace{MonitorConfig: engine.MonitorConfig{
+			ProcessesWarn: warn, ProcessesCritical: critical, MemoryWarnMB: -1, MemoryCriticalMB: -1,
+		}}))
+		rec := serve(e, http.MethodGet, "/health")
+		var health HealthStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &health))
+		return rec.Code, health
+	}
+
+	code, health := check(active+10, active+20)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "healthy", health.Status)
+
+	code, health = check(active+1, active+20)
+	assert.Equal(t, http.StatusOK, code, "a warning keeps the instance in rotation")
+	assert.Equal(t, "warning", health.Status)
+	assert.Equal(t, "warning", health.Components["processes"].Status)
+
+	code, health = check(active+1, active+2)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "degraded", health.Status)
+	assert.Equal(t, "critical", health.Components["processes"].Status)
+}
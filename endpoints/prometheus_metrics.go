@@ -0,0 +1,352 @@
+package endpoints
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	registryOnce sync.Once
+	registry     *prometheus.Registry
+
+	// detailedMetrics adds the detailed memory and GC metrics to the output
+	detailedMetrics atomic.Bool
+
+	// Duration histograms, created with the configured buckets by
+	// metricsRegistry
+	requestDuration prometheus.Histogram
+	nodeDuration    *prometheus.HistogramVec
+
+	// deepCopyDuration times the node copies made before each step; the
+	// buckets go from 1µs to about 0.26s
+	deepCopyDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "nflow_playbook_deepcopy_duration_seconds",
+		Help:    "Duration of the node copies made before running each workflow step",
+		Buckets: prometheus.ExponentialBuckets(0.000001, 4, 10),
+	})
+)
+
+// metricsHandler serves the registry in the Prometheus exposition format
+func metricsHandler(config *engine.ConfigWorkspace) http.Handler {
+	detailedMetrics.Store(config.MonitorConfig.EnableDetailedMetrics)
+	return promhttp.HandlerFor(metricsRegistry(config), promhttp.HandlerOpts{})
+}
+
+// metricsRegistry returns the registry with the nFlow metrics, registered
+// once with the buckets of the first config. The values kept by the
+// MetricsCollector are read at scrape time so the health endpoint and the
+// metrics always agree.
+func metricsRegistry(config *engine.ConfigWorkspace) *prometheus.Registry {
+	registryOnce.Do(func() {
+		requestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "nflow_request_duration_seconds",
+			Help:    "HTTP request duration",
+			Buckets: durationBuckets(config.MonitorConfig.RequestDurationBuckets),
+		})
+		nodeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nflow_node_duration_seconds",
+			Help:    "Workflow node duration by node type",
+			Buckets: durationBuckets(config.MonitorConfig.NodeDurationBuckets),
+		}, []string{"type"})
+		engine.SetNodeObserver(observeNodeDuration)
+		engine.SetDeepCopyObserver(observeDeepCopyDuration)
+		engine.SetQueryObserver(observeQueryDuration)
+
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(
+			requestDuration,
+			nodeDuration,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "nflow_up",
+				Help: "Whether the nFlow Runtime is up",
+			}, func() float64 { return 1 }),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "nflow_uptime_seconds",
+				Help: "Number of seconds since nFlow Runtime started",
+			}, func() float64 { return time.Since(metrics.startTime).Seconds() }),
+
+			// Request metrics
+			requestsByEndpoint,
+			counterFunc("nflow_requests_errors_total", "Total number of HTTP request errors",
+				func() uint64 { return atomic.LoadUint64(&metrics.requestsErrors) }),
+			counterFunc("nflow_requests_transient_errors_total", "Total number of HTTP requests answered 429 or 503, to be retried by the client",
+				func() uint64 { return atomic.LoadUint64(&metrics.requestsTransientErrors) }),
+			counterFunc("nflow_requests_hard_errors_total", "Total number of HTTP requests answered with a 5xx other than 503",
+				func() uint64 { return atomic.LoadUint64(&metrics.requestsHardErrors) }),
+			counterFunc("nflow_requests_slo_breach_total", "Total number of HTTP requests slower than monitor.slo_target_ms",
+				func() uint64 { return atomic.LoadUint64(&metrics.requestsSLOBreaches) }),
+			counterFunc("nflow_panics_total", "Total number of panics recovered while serving requests",
+				engine.PanicCount),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "nflow_requests_active",
+				Help: "Number of active HTTP requests",
+			}, func() float64 { return float64(atomic.LoadInt64(&metrics.activeRequests)) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "nflow_request_duration_milliseconds",
+				Help: "Average HTTP request duration",
+			}, averageRequestDuration),
+
+			// Workflow metrics
+			counterFunc("nflow_workflows_total", "Total number of workflows executed",
+				func() uint64 { return atomic.LoadUint64(&metrics.workflowsTotal) }),
+			counterFunc("nflow_workflows_errors_total", "Total number of workflow errors",
+				func() uint64 { return atomic.LoadUint64(&metrics.workflowsErrors) }),
+
+			// Process metrics
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "nflow_forks_active",
+				Help: "Number of forked workflows running",
+			}, func() float64 { active, _ := engine.ForkStats(); return float64(active) }),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "nflow_forks_rejected_total",
+				Help: "Total number of forks rejected by vm_pool.max_concurrent_forks",
+			}, func() float64 { _, rejected := engine.ForkStats(); return float64(rejected) }),
+			counterFunc("nflow_goroutine_limit_exceeded_total", "Total number of requests that spawned more goroutines than vm_pool.max_goroutines_per_request",
+				engine.GoroutineLimitExceeded),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "nflow_processes_active",
+				Help: "Number of active workflow processes",
+			}, func() float64 { return float64(len(process.GetProcessList())) }),
+			counterFunc("nflow_processes_rejected_total", "Total number of workflows rejected by vm_pool.max_active_processes",
+				process.Rejected),
+			counterFunc("nflow_processes_total", "Total number of workflow processes created",
+				func() uint64 { return atomic.LoadUint64(&metrics.processesTotal) }),
+
+			// Cache metrics
+			counterFunc("nflow_cache_hits_total", "Total number of cache hits",
+				func() uint64 { return atomic.LoadUint64(&metrics.cacheHits) }),
+			counterFunc("nflow_cache_misses_total", "Total number of cache misses",
+				func() uint64 { return atomic.LoadUint64(&metrics.cacheMisses) }),
+			deepCopyDuration,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "nflow_playbook_cache_hit_nodes",
+				Help: "Number of nodes of the playbooks returned by the last playbook cache hit",
+			}, func() float64 { return float64(engine.CacheHitNodes()) }),
+			counterFunc("nflow_starter_node_reached_total", "Total number of workflows stopped with 422 because a connection led to a starter node",
+				engine.StarterNodeReached),
+			labeledCounterCollector{
+				desc: prometheus.NewDesc("nflow_corrupted_starters_removed_total",
+					"Total number of corrupted starter nodes removed from loaded playbooks", []string{"app"}, nil),
+				values: engine.CorruptedStartersRemoved,
+			},
+			labeledCounterCollector{
+				desc: prometheus.NewDesc("nflow_unknown_node_type_total",
+					"Total number of nodes reached whose type has no registered step", []string{"type"}, nil),
+				values: engine.UnknownNodeTypes,
+			},
+
+			// Database metrics
+			counterFunc("nflow_db_queries_total", "Total number of database calls made by the engine",
+				func() uint64 { return atomic.LoadUint64(&metrics.dbQueriesTotal) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "nflow_db_query_duration_milliseconds",
+				Help: "Average database call duration",
+			}, averageQueryDuration),
+			counterFunc("nflow_db_slow_queries_total", "Total number of database calls slower than database_nflow.slow_query_ms",
+				engine.SlowQueries),
+
+			newRuntimeCollector(),
+			newRedisPoolCollector(),
+		)
+	})
+	return registry
+}
+
+// durationBuckets returns the configured buckets, sorted, or the
+// Prometheus defaults
+func durationBuckets(buckets []float64) []float64 {
+	if len(buckets) == 0 {
+		return prometheus.DefBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// observeRequestDuration records a request in the duration histogram
+func observeRequestDuration(d time.Duration) {
+	if requestDuration != nil {
+		requestDuration.Observe(d.Seconds())
+	}
+}
+
+// observeQueryDuration records a database call, installed as the engine
+// query observer
+func observeQueryDuration(operation string, d time.Duration) {
+	UpdateDatabaseMetrics(d)
+}
+
+// observeNodeDuration records a node run, installed as the engine node
+// observer
+func observeNodeDuration(nodeType string, d time.Duration) {
+	if nodeDuration != nil {
+		nodeDuration.WithLabelValues(nodeType).Observe(d.Seconds())
+	}
+}
+
+// observeDeepCopyDuration records a node copy, installed as the engine
+// deep copy observer
+func observeDeepCopyDuration(d time.Duration) {
+	deepCopyDuration.Observe(d.Seconds())
+}
+
+// labeledCounterCollector reports an engine counter kept per label value,
+// e.g. per app or per node type
+type labeledCounterCollector struct {
+	desc   *prometheus.Desc
+	values func() map[string]uint64
+}
+
+func (c labeledCounterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c labeledCounterCollector) Collect(ch chan<- prometheus.Metric) {
+	for label, count := range c.values() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(count), label)
+	}
+}
+
+// redisPoolCollector reports the connection pool of the shared Redis client
+type redisPoolCollector struct {
+	hits, misses, timeouts *prometheus.Desc
+	total, idle, stale     *prometheus.Desc
+}
+
+func newRedisPoolCollector() *redisPoolCollector {
+	return &redisPoolCollector{
+		hits:     prometheus.NewDesc("nflow_redis_pool_hits_total", "Times a free connection was found in the Redis pool", nil, nil),
+		misses:   prometheus.NewDesc("nflow_redis_pool_misses_total", "Times a free connection was not found in the Redis pool", nil, nil),
+		timeouts: prometheus.NewDesc("nflow_redis_pool_timeouts_total", "Times a wait for a Redis pool connection timed out", nil, nil),
+		total:    prometheus.NewDesc("nflow_redis_pool_total_connections", "Connections in the Redis pool", nil, nil),
+		idle:     prometheus.NewDesc("nflow_redis_pool_idle_connections", "Idle connections in the Redis pool", nil, nil),
+		stale:    prometheus.NewDesc("nflow_redis_pool_stale_connections", "Stale connections removed from the Redis pool", nil, nil),
+	}
+}
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{c.hits, c.misses, c.timeouts, c.total, c.idle, c.stale} {
+		ch <- desc
+	}
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := engine.GetRedisClient().PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(stats.StaleConns))
+}
+
+func counterFunc(name, help string, value func() uint64) prometheus.CounterFunc {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+		return float64(value())
+	})
+}
+
+// averageQueryDuration returns the mean database call duration in
+// milliseconds
+func averageQueryDuration() float64 {
+	total := atomic.LoadUint64(&metrics.dbQueriesTotal)
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadUint64(&metrics.dbQueryDuration)) / float64(total) / 1000.0
+}
+
+// averageRequestDuration returns the mean request duration in milliseconds
+func averageRequestDuration() float64 {
+	total := atomic.LoadUint64(&metrics.requestsTotal)
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadUint64(&metrics.requestsDuration)) / float64(total) / 1000.0
+}
+
+// runtimeCollector reports the database pool and Go runtime metrics from a
+// single snapshot per scrape
+type runtimeCollector struct {
+	dbOpen, dbInUse, dbIdle *prometheus.Desc
+	goroutines              *prometheus.Desc
+	memAlloc, memSys        *prometheus.Desc
+	gcRuns                  *prometheus.Desc
+
+	// Detailed metrics
+	heapAlloc, heapSys, heapIdle, heapInuse *prometheus.Desc
+	heapObjects                             *prometheus.Desc
+	gcCPUFraction                           *prometheus.Desc
+}
+
+func newRuntimeCollector() *runtimeCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, nil, nil)
+	}
+	return &runtimeCollector{
+		dbOpen:        desc("nflow_db_connections_open", "Number of open database connections"),
+		dbInUse:       desc("nflow_db_connections_in_use", "Number of database connections in use"),
+		dbIdle:        desc("nflow_db_connections_idle", "Number of idle database connections"),
+		goroutines:    desc("nflow_go_goroutines", "Number of goroutines"),
+		memAlloc:      desc("nflow_go_memory_alloc_bytes", "Current memory allocation"),
+		memSys:        desc("nflow_go_memory_sys_bytes", "Total memory obtained from system"),
+		gcRuns:        desc("nflow_go_gc_runs_total", "Number of GC runs"),
+		heapAlloc:     desc("nflow_go_memory_heap_alloc_bytes", "Heap allocation"),
+		heapSys:       desc("nflow_go_memory_heap_sys_bytes", "Heap system memory"),
+		heapIdle:      desc("nflow_go_memory_heap_idle_bytes", "Heap idle memory"),
+		heapInuse:     desc("nflow_go_memory_heap_inuse_bytes", "Heap in-use memory"),
+		heapObjects:   desc("nflow_go_memory_heap_objects", "Number of heap objects"),
+		gcCPUFraction: desc("nflow_go_gc_cpu_fraction", "GC CPU fraction"),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (rc *runtimeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		rc.dbOpen, rc.dbInUse, rc.dbIdle, rc.goroutines, rc.memAlloc, rc.memSys, rc.gcRuns,
+		rc.heapAlloc, rc.heapSys, rc.heapIdle, rc.heapInuse, rc.heapObjects, rc.gcCPUFraction,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector
+func (rc *runtimeCollector) Collect(ch chan<- prometheus.Metric) {
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+
+	// Database metrics, only when the database is configured
+	if db, err := engine.GetDB(); err == nil {
+		stats := db.Stats()
+		gauge(rc.dbOpen, float64(stats.OpenConnections))
+		gauge(rc.dbInUse, float64(stats.InUse))
+		gauge(rc.dbIdle, float64(stats.Idle))
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	gauge(rc.goroutines, float64(runtime.NumGoroutine()))
+	gauge(rc.memAlloc, float64(m.Alloc))
+	gauge(rc.memSys, float64(m.Sys))
+	ch <- prometheus.MustNewConstMetric(rc.gcRuns, prometheus.CounterValue, float64(m.NumGC))
+
+	if detailedMetrics.Load() {
+		gauge(rc.heapAlloc, float64(m.HeapAlloc))
+		gauge(rc.heapSys, float64(m.HeapSys))
+		gauge(rc.heapIdle, float64(m.HeapIdle))
+		gauge(rc.heapInuse, float64(m.HeapInuse))
+		gauge(rc.heapObjects, float64(m.HeapObjects))
+		gauge(rc.gcCPUFraction, m.GCCPUFraction)
+	}
+}
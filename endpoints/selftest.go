@@ -0,0 +1,161 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/arturoeanton/nflow-runtime/security/analyzer"
+	"github.com/arturoeanton/nflow-runtime/security/encryption"
+	"github.com/arturoeanton/nflow-runtime/security/sanitizer"
+	"github.com/labstack/echo/v4"
+)
+
+// SelfTestCheck is the outcome of one subsystem check of /debug/selftest
+type SelfTestCheck struct {
+	Status     string `json:"status"` // pass or fail
+	Message    string `json:"message,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// selfTestStep is a named subsystem check, nil error means it passed
+type selfTestStep struct {
+	name  string
+	check func() error
+}
+
+// handleDebugSelfTest exercises each subsystem with known inputs and
+// reports pass/fail per subsystem: 200 when all pass, 503 otherwise
+func handleDebugSelfTest(c echo.Context) error {
+	var instance *engine.VMInstance
+	manager := engine.GetVMManager()
+	defer func() {
+		if instance != nil {
+			manager.ReleaseVM(instance)
+		}
+	}()
+
+	steps := []selfTestStep{
+		{"encryption", selfTestEncryption},
+		{"sanitizer", selfTestSanitizer},
+		{"analyzer", selfTestAnalyzer},
+		{"database", selfTestDatabase},
+		{"vm_acquire", func() (err error) {
+			// Isolated so the VM features leave the caller's session alone
+			instance, err = manager.AcquireVM(engine.NewIsolatedContext(c))
+			return err
+		}},
+		{"vm_script", func() error {
+			if instance == nil {
+				return fmt.Errorf("no VM acquired")
+			}
+			return selfTestScript(instance)
+		}},
+	}
+
+	status := "pass"
+	checks := make(map[string]SelfTestCheck, len(steps))
+	start := time.Now()
+	for _, step := range steps {
+		stepStart := time.Now()
+		check := SelfTestCheck{Status: "pass"}
+		if err := step.check(); err != nil {
+			check.Status = "fail"
+			check.Message = err.Error()
+			status = "fail"
+		}
+		check.DurationMs = time.Since(stepStart).Milliseconds()
+		checks[step.name] = check
+	}
+
+	code := http.StatusOK
+	if status != "pass" {
+		code = http.StatusServiceUnavailable
+	}
+	return c.JSON(code, echo.Map{
+		"status":      status,
+		"checks":      checks,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"timestamp":   time.Now().Unix(),
+	})
+}
+
+// selfTestEncryption round trips a value with the configured key, or with
+// a throwaway key when none is configured
+func selfTestEncryption() error {
+	key := engine.GetConfig().SecurityConfig.EncryptionKey
+	if key == "" {
+		generated, err := encryption.GenerateKeyString()
+		if err != nil {
+			return err
+		}
+		key = generated
+	}
+	service, err := encryption.NewEncryptionService(key)
+	if err != nil {
+		return err
+	}
+
+	const plaintext = "nflow-selftest"
+	ciphertext, err := service.Encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	decrypted, err := service.Decrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+	if decrypted != plaintext {
+		return fmt.Errorf("round trip returned %q", decrypted)
+	}
+	return nil
+}
+
+// selfTestSanitizer checks that an email is masked out of a log line
+func selfTestSanitizer() error {
+	const email = "selftest@example.com"
+	sanitized := sanitizer.NewLogSanitizer(nil).Sanitize("user " + email + " logged in")
+	if strings.Contains(sanitized, email) {
+		return fmt.Errorf("email was not masked: %q", sanitized)
+	}
+	return nil
+}
+
+// selfTestAnalyzer checks that eval is reported as a high severity issue
+func selfTestAnalyzer() error {
+	issues, err := analyzer.NewStaticAnalyzer().AnalyzeScript(`eval("1 + 1")`)
+	if err != nil {
+		return err
+	}
+	if !analyzer.HasHighSeverityIssues(issues) {
+		return fmt.Errorf("eval was not reported as high severity")
+	}
+	return nil
+}
+
+// selfTestDatabase pings the nFlow database
+func selfTestDatabase() error {
+	db, err := engine.GetDB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// selfTestScript runs a trivial script in an acquired VM
+func selfTestScript(instance *engine.VMInstance) error {
+	value, err := instance.VM.RunString("1 + 1")
+	if err != nil {
+		return err
+	}
+	if result := value.ToInteger(); result != 2 {
+		return fmt.Errorf("1 + 1 returned %d", result)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultAllowedMethods applies when [server].allowed_methods is not set.
+// TRACE and CONNECT are left out.
+var defaultAllowedMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// AllowedMethodsMiddleware answers 405 to the requests whose method is not
+// in allowed_methods, before any workflow is resolved for them
+func AllowedMethodsMiddleware(config *ServerConfig) echo.MiddlewareFunc {
+	methods := defaultAllowedMethods
+	if len(config.AllowedMethods) > 0 {
+		methods = make([]string, 0, len(config.AllowedMethods))
+		for _, method := range config.AllowedMethods {
+			methods = append(methods, strings.ToUpper(strings.TrimSpace(method)))
+		}
+	}
+	allowed := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowed[method] = true
+	}
+	allowHeader := strings.Join(methods, ", ")
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !allowed[c.Request().Method] {
+				c.Response().Header().Set(echo.HeaderAllow, allowHeader)
+				return c.JSON(http.StatusMethodNotAllowed, echo.Map{"error": "Method not allowed"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveWithAllowedMethods(config *ServerConfig, method string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(AllowedMethodsMiddleware(config))
+	e.Any("/*", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(method, "/flow", nil))
+	return rec
+}
+
+func TestAllowedMethodsDefault(t *testing.T) {
+	for _, method := range defaultAllowedMethods {
+		assert.Equal(t, http.StatusOK, serveWithAllowedMethods(&ServerConfig{}, method).Code, method)
+	}
+
+	for _, method := range []string{http.MethodTrace, http.MethodConnect, "PROPFIND"} {
+		rec := serveWithAllowedMethods(&ServerConfig{}, method)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, method)
+		assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS", rec.Header().Get(echo.HeaderAllow))
+	}
+}
+
+func TestAllowedMethodsConfigured(t *testing.T) {
+	config := &ServerConfig{AllowedMethods: []string{"get", " POST "}}
+
+	assert.Equal(t, http.StatusOK, serveWithAllowedMethods(config, http.MethodGet).Code)
+	assert.Equal(t, http.StatusOK, serveWithAllowedMethods(config, http.MethodPost).Code)
+
+	rec := serveWithAllowedMethods(config, http.MethodDelete)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, POST", rec.Header().Get(echo.HeaderAllow))
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"github.com/arturoeanton/nflow-runtime/audit"
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/labstack/echo/v4"
+)
+
+// recordAudit records a security event of the request c in the audit log
+func recordAudit(c echo.Context, event, actor string, details map[string]interface{}) {
+	if !audit.Enabled() {
+		return
+	}
+	ip := ""
+	if c != nil {
+		ip = c.RealIP()
+	}
+	if actor == "" {
+		actor = "anonymous"
+	}
+	if err := audit.Record(event, actor, ip, details); err != nil {
+		logger.Error("Audit log:", err)
+	}
+}
+
+// profileActor returns the username of an auth profile, "" when there is none
+func profileActor(profile interface{}) string {
+	switch p := profile.(type) {
+	case map[string]string:
+		return p["username"]
+	case map[string]interface{}:
+		if username, ok := p["username"].(string); ok {
+			return username
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/audit"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAudit(t *testing.T) {
+	var buf bytes.Buffer
+	previous := audit.SetDefault(audit.New(&buf))
+	t.Cleanup(func() { audit.SetDefault(previous) })
+
+	req := httptest.NewRequest("GET", "/private", nil)
+	req.Header.Set(echo.HeaderXRealIP, "198.51.100.4")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	recordAudit(c, audit.EventAuthFailure, profileActor(nil), map[string]interface{}{"path": "/private"})
+	recordAudit(c, audit.EventAuthFailure, profileActor(map[string]string{"username": "alice"}), nil)
+
+	var events []audit.Event
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var event audit.Event
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, "anonymous", events[0].Actor)
+	assert.Equal(t, "198.51.100.4", events[0].IP)
+	assert.Equal(t, "/private", events[0].Details["path"])
+	assert.Equal(t, "alice", events[1].Actor)
+}
+
+func TestProfileActor(t *testing.T) {
+	assert.Equal(t, "", profileActor(nil))
+	assert.Equal(t, "bob", profileActor(map[string]interface{}{"username": "bob"}))
+	assert.Equal(t, "", profileActor("bob"))
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeAuthFlag(t *testing.T) {
+	cases := []struct {
+		flag     interface{}
+		value    string
+		required bool
+	}{
+		{nil, "", false},
+		{false, "false", false},
+		{"false", "false", false},
+		{true, "true", true},
+		{"true", "true", true},
+		{"admin", "admin", true},
+		{42, "42", true},
+	}
+	for _, tc := range cases {
+		data := map[string]interface{}{}
+		if tc.flag != nil {
+			data["nflow_auth"] = tc.flag
+		}
+		value, required := nodeAuthFlag(&model.Node{Data: data})
+		assert.Equal(t, tc.value, value, "%v", tc.flag)
+		assert.Equal(t, tc.required, required, "%v", tc.flag)
+	}
+	_, required := nodeAuthFlag(nil)
+	assert.False(t, required)
+}
+
+func TestRunWritesAuthSessionOnlyForAuthNodes(t *testing.T) {
+	useVMManager(t, newTestVMManager(2, nil))
+
+	repo := GetConfigRepository()
+	previousRedis := repo.GetRedisClient()
+	repo.SetRedisClient(redis.NewClient(&redis.Options{}))
+	t.Cleanup(func() { repo.SetRedisClient(previousRedis) })
+
+	// auth.js lets every flag through except "deny"
+	authCodeCache.Lock()
+	previousCode, previousLoaded, previousCheck := authCodeCache.code, authCodeCache.loaded, authCodeCache.lastCheck
+	authCodeCache.code = `function auth() { if (auth_flag === "deny") { next = "login"; } }`
+	authCodeCache.loaded, authCodeCache.lastCheck = true, time.Now()
+	authCodeCache.Unlock()
+	t.Cleanup(func() {
+		authCodeCache.Lock()
+		authCodeCache.code, authCodeCache.loaded, authCodeCache.lastCheck = previousCode, previousLoaded, previousCheck
+		authCodeCache.Unlock()
+	})
+
+	var received []interface{}
+	Steps["test_auth_end"] = payloadTestStep{received: &received}
+	defer delete(Steps, "test_auth_end")
+
+	runWithFlag := func(flag interface{}) *httptest.ResponseRecorder {
+		output := &model.Output{}
+		output.Connections = append(output.Connections, struct {
+			Node   string `json:"node"`
+			Output string `json:"output"`
+		}{Node: "node_1", Output: "input_1"})
+		start := &model.Node{
+			Data:    map[string]interface{}{"type": "starter"},
+			Outputs: map[string]*model.Output{"output_1": output},
+		}
+		if flag != nil {
+			start.Data["nflow_auth"] = flag
+		}
+		pb := model.Playbook{
+			"start":  start,
+			"node_1": &model.Node{Data: map[string]interface{}{"type": "test_auth_end"}},
+		}
+
+		c, rec := newTraceTestContext(t, "/private", DebugConfig{})
+		require.NoError(t, run(&model.Controller{Playbook: &pb, Start: start}, c, model.Vars{}, "", "/private", uuid.New().String(), nil, false))
+		return rec
+	}
+	authCookie := func(rec *httptest.ResponseRecorder) bool {
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == "auth-session" {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, flag := range []interface{}{nil, false, "false"} {
+		rec := runWithFlag(flag)
+		assert.False(t, authCookie(rec), "no auth session write without auth (%v)", flag)
+	}
+	assert.Len(t, received, 3)
+
+	rec := runWithFlag(true)
+	assert.True(t, authCookie(rec), "auth nodes record redirect_url")
+	assert.Len(t, received, 4)
+
+	rec = runWithFlag("deny")
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.True(t, authCookie(rec), "the login page needs redirect_url")
+	assert.Len(t, received, 4)
+}
@@ -0,0 +1,44 @@
+package engine
+
+import "strings"
+
+// GetBasePath returns [server].base_path normalized as "/prefix", or ""
+// when the runtime is mounted at the root
+func GetBasePath() string {
+	return normalizeBasePath(GetConfig().ServerConfig.BasePath)
+}
+
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(basePath, "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
+// StripBasePath removes the base path from a request URI so endpoints
+// resolve as if the runtime owned the root. URIs outside the base path are
+// returned unchanged.
+func StripBasePath(requestURI string) string {
+	basePath := GetBasePath()
+	if basePath == "" || !strings.HasPrefix(requestURI, basePath) {
+		return requestURI
+	}
+	rest := requestURI[len(basePath):]
+	switch {
+	case rest == "":
+		return "/"
+	case rest[0] == '/':
+		return rest
+	case rest[0] == '?':
+		return "/" + rest
+	}
+	// "/apix" does not belong to "/api"
+	return requestURI
+}
+
+// WithBasePath prefixes an absolute runtime path with the base path, for
+// redirects and links generated by the runtime
+func WithBasePath(path string) string {
+	return GetBasePath() + path
+}
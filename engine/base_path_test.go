@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasePath(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	config := original
+	config.ServerConfig.BasePath = ""
+	repo.SetConfig(config)
+	assert.Equal(t, "/users/1", StripBasePath("/users/1"))
+	assert.Equal(t, "/nflow_login", WithBasePath("/nflow_login"))
+
+	config.ServerConfig.BasePath = "api/workflows/"
+	repo.SetConfig(config)
+	assert.Equal(t, "/api/workflows", GetBasePath())
+
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"/api/workflows/users/1", "/users/1"},
+		{"/api/workflows/users?id=1", "/users?id=1"},
+		{"/api/workflows", "/"},
+		{"/api/workflows?id=1", "/?id=1"},
+		{"/api/workflowsx/users", "/api/workflowsx/users"},
+		{"/other/users", "/other/users"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, StripBasePath(tt.uri), tt.uri)
+	}
+	assert.Equal(t, "/api/workflows/nflow_login", WithBasePath("/nflow_login"))
+}
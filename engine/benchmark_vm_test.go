@@ -14,7 +14,7 @@ import (
 // BenchmarkVMPool tests the performance of VM pool
 func BenchmarkVMPool(b *testing.B) {
 	// Initialize VM manager
-	vmManager := NewVMManagerWithConfig(200, &VMPoolConfig{
+	vmManager := newTestVMManager(200, &VMPoolConfig{
 		MaxSize:       200,
 		PreloadSize:   100,
 		IdleTimeout:   10,
@@ -25,7 +25,6 @@ func BenchmarkVMPool(b *testing.B) {
 	e := echo.New()
 	req := e.NewContext(nil, nil).Request()
 	c := e.NewContext(req, nil)
-	c.Set("_test_context", true)
 
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
@@ -56,7 +55,7 @@ func BenchmarkVMPool(b *testing.B) {
 // BenchmarkVMCreation compares VM pool vs creating new VMs
 func BenchmarkVMCreation(b *testing.B) {
 	b.Run("WithPool", func(b *testing.B) {
-		vmManager := NewVMManagerWithConfig(200, &VMPoolConfig{
+		vmManager := newTestVMManager(200, &VMPoolConfig{
 			MaxSize:       200,
 			PreloadSize:   100,
 			EnableMetrics: false,
@@ -64,7 +63,6 @@ func BenchmarkVMCreation(b *testing.B) {
 		e := echo.New()
 		req := e.NewContext(nil, nil).Request()
 		c := e.NewContext(req, nil)
-		c.Set("_test_context", true)
 
 		b.ResetTimer()
 		b.RunParallel(func(pb *testing.PB) {
@@ -95,7 +93,7 @@ func BenchmarkVMCreation(b *testing.B) {
 
 // TestVMPoolConcurrency tests concurrent access with heavy load
 func TestVMPoolConcurrency(t *testing.T) {
-	vmManager := NewVMManagerWithConfig(200, &VMPoolConfig{
+	vmManager := newTestVMManager(200, &VMPoolConfig{
 		MaxSize:       200,
 		PreloadSize:   100,
 		EnableMetrics: true,
@@ -104,7 +102,6 @@ func TestVMPoolConcurrency(t *testing.T) {
 	e := echo.New()
 	req := e.NewContext(nil, nil).Request()
 	c := e.NewContext(req, nil)
-	c.Set("_test_context", true)
 
 	// Number of concurrent goroutines
 	concurrency := 200
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/arturoeanton/nflow-runtime/plugins"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultRetryAfterSeconds  = 1
+	defaultMaxActiveProcesses = 10000
+)
+
+// IsTransientError reports whether err is a capacity condition that clears
+// by itself (VM pool exhausted, VM creation backing off, fork or process
+// limit reached) and the client should retry, as opposed to a bug
+func IsTransientError(err error) bool {
+	return errors.Is(err, ErrVMPoolExhausted) ||
+		errors.Is(err, plugins.ErrCircuitOpen) ||
+		errors.Is(err, ErrForkLimitReached) ||
+		errors.Is(err, process.ErrProcessLimitReached)
+}
+
+// maxActiveProcesses returns vm_pool.max_active_processes, 0 when unlimited
+func maxActiveProcesses() int {
+	switch limit := GetConfig().VMPoolConfig.MaxActiveProcesses; {
+	case limit == 0:
+		return defaultMaxActiveProcesses
+	case limit < 0:
+		return 0
+	default:
+		return limit
+	}
+}
+
+func retryAfterSeconds() int {
+	if seconds := GetConfig().VMPoolConfig.RetryAfterSeconds; seconds > 0 {
+		return seconds
+	}
+	return defaultRetryAfterSeconds
+}
+
+// respondUnavailable answers 503 with a Retry-After header for a transient
+// capacity condition
+func respondUnavailable(c echo.Context, message string) error {
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds()))
+	return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": message})
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/plugins"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useVMManager replaces the VM manager used by run() for the duration of a test
+func useVMManager(t *testing.T, manager *VMManager) {
+	GetVMManager()
+	previous := vmManager
+	vmManager = manager
+	t.Cleanup(func() { vmManager = previous })
+}
+
+func TestRunAnswers503WhenPoolExhausted(t *testing.T) {
+	manager := newTestVMManager(1, &VMPoolConfig{PreloadSize: 1, AcquireTimeoutMs: 20})
+	useVMManager(t, manager)
+
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.VMPoolConfig.RetryAfterSeconds = 7
+	repo.SetConfig(config)
+
+	held, err := manager.AcquireVM(createTestContext())
+	require.NoError(t, err)
+	defer manager.ReleaseVM(held)
+
+	c, rec := newTraceTestContext(t, "/", DebugConfig{})
+	pb := model.Playbook{}
+	require.NoError(t, run(&model.Controller{Playbook: &pb}, c, model.Vars{}, "", "/", uuid.New().String(), nil, false))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "7", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"Server busy, retry later"}`, rec.Body.String())
+}
+
+func TestRunAnswers500WhenVMCreationFails(t *testing.T) {
+	manager := newTestVMManager(1, &VMPoolConfig{PreloadSize: 0})
+	manager.factory = func() (*goja.Runtime, error) { return nil, errors.New("broken factory") }
+	useVMManager(t, manager)
+
+	c, rec := newTraceTestContext(t, "/", DebugConfig{})
+	pb := model.Playbook{}
+	require.NoError(t, run(&model.Controller{Playbook: &pb}, c, model.Vars{}, "", "/", uuid.New().String(), nil, false))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestRunAnswers503WhenProcessLimitReached(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.VMPoolConfig.MaxActiveProcesses = len(process.GetProcessList()) + 2
+	config.VMPoolConfig.RetryAfterSeconds = 3
+	repo.SetConfig(config)
+
+	for i := 0; i < 2; i++ {
+		p, err := process.TryCreateProcess(uuid.New().String(), maxActiveProcesses())
+		require.NoError(t, err)
+		defer p.Close()
+	}
+
+	rejectedBefore := process.Rejected()
+	c, rec := newTraceTestContext(t, "/", DebugConfig{})
+	pb := model.Playbook{}
+	wid := uuid.New().String()
+	require.NoError(t, run(&model.Controller{Playbook: &pb}, c, model.Vars{}, "", "/", wid, nil, false))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"Too many active workflows, retry later"}`, rec.Body.String())
+	assert.Equal(t, rejectedBefore+1, process.Rejected())
+	_, exists := process.GetProcessID(wid)
+	assert.False(t, exists)
+
+	// Forks are rejected as well
+	err := run(&model.Controller{Playbook: &pb}, createTestContext(), model.Vars{}, "", "/", uuid.New().String(), nil, true)
+	assert.True(t, errors.Is(err, process.ErrProcessLimitReached))
+	assert.Equal(t, rejectedBefore+2, process.Rejected())
+}
+
+func TestMaxActiveProcesses(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+
+	for limit, expected := range map[int]int{0: defaultMaxActiveProcesses, -1: 0, 5: 5} {
+		config := original
+		config.VMPoolConfig.MaxActiveProcesses = limit
+		repo.SetConfig(config)
+		assert.Equal(t, expected, maxActiveProcesses(), "limit %d", limit)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, IsTransientError(fmt.Errorf("%w: timeout", ErrVMPoolExhausted)))
+	assert.True(t, IsTransientError(fmt.Errorf("failed to create VM: %w", plugins.ErrCircuitOpen)))
+	assert.True(t, IsTransientError(ErrForkLimitReached))
+	assert.True(t, IsTransientError(process.ErrProcessLimitReached))
+	assert.False(t, IsTransientError(errors.New("broken factory")))
+	assert.False(t, IsTransientError(nil))
+}
@@ -3,39 +3,90 @@ package engine
 import (
 	"context"
 	"log"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/security"
 )
 
 // ConfigWorkspace represents the complete configuration structure for nFlow Runtime.
 // It is loaded from the config.toml file and contains all settings for databases,
 // services, plugins, and security configurations.
 type ConfigWorkspace struct {
-	ConfigBasedate       ConfigBasedate    `toml:"database"`
-	ConfigMail           ConfigMail        `toml:"mail"`
-	URLConfig            URLConfig         `toml:"url"`
-	MongoConfig          MongoConfig       `toml:"mongo"`
-	PluginConfig         PluginConfig      `toml:"plugin"`
-	RedisConfig          RedisConfig       `toml:"redis"`
-	PgSessionConfig      PgSessionConfig   `toml:"pg_session"`
-	TwilioConfig         TwilioConfig      `toml:"twilio"`
-	Env                  map[string]string `toml:"env"`
-	HttpsEngineConfig    HttpsConfig       `toml:"https_engine"`
-	HttpsDesingnerConfig HttpsConfig       `toml:"https_designer"`
-	DatabaseNflow        DatabaseNflow     `toml:"database_nflow"`
-	VMPoolConfig         VMPoolConfig      `toml:"vm_pool"`
-	TrackerConfig        TrackerConfig     `toml:"tracker"`
-	DebugConfig          DebugConfig       `toml:"debug"`
-	MonitorConfig        MonitorConfig     `toml:"monitor"`
-	RateLimitConfig      RateLimitConfig   `toml:"rate_limit"`
+	ServerConfig         ServerConfig          `toml:"server"`
+	ConfigBasedate       ConfigBasedate        `toml:"database"`
+	ConfigMail           ConfigMail            `toml:"mail"`
+	URLConfig            URLConfig             `toml:"url"`
+	MongoConfig          MongoConfig           `toml:"mongo"`
+	PluginConfig         PluginConfig          `toml:"plugin"`
+	RedisConfig          RedisConfig           `toml:"redis"`
+	PgSessionConfig      PgSessionConfig       `toml:"pg_session"`
+	SessionConfig        SessionConfig         `toml:"session"`
+	CSRFConfig           CSRFConfig            `toml:"csrf"`
+	ContinuationConfig   ContinuationConfig    `toml:"continuation"`
+	SecurityHeaders      SecurityHeadersConfig `toml:"security_headers"`
+	TwilioConfig         TwilioConfig          `toml:"twilio"`
+	Env                  map[string]string     `toml:"env"`
+	HttpsEngineConfig    HttpsConfig           `toml:"https_engine"`
+	HttpsDesingnerConfig HttpsConfig           `toml:"https_designer"`
+	DatabaseNflow        DatabaseNflow         `toml:"database_nflow"`
+	VMPoolConfig         VMPoolConfig          `toml:"vm_pool"`
+	TrackerConfig        TrackerConfig         `toml:"tracker"`
+	DebugConfig          DebugConfig           `toml:"debug"`
+	MonitorConfig        MonitorConfig         `toml:"monitor"`
+	RateLimitConfig      RateLimitConfig       `toml:"rate_limit"`
+	HTTPClientConfig     HTTPClientConfig      `toml:"http_client"`
+	GrpcClientConfig     GrpcClientConfig      `toml:"grpc_client"`
+	QueueConfig          QueueConfig           `toml:"queue"`
+	ExecConfig           ExecConfig            `toml:"exec"`
+	FileSystemConfig     FileSystemConfig      `toml:"filesystem"`
+	S3Config             S3Config              `toml:"s3"`
+	ResponseConfig       ResponseConfig        `toml:"response"`
+	GlobalsConfig        GlobalsConfig         `toml:"globals"`
+	RequestConfig        RequestConfig         `toml:"request"`
+	JSONConfig           JSONConfig            `toml:"json"`
+	PlaybookConfig       PlaybookConfig        `toml:"playbook"`
+	SecretsConfig        SecretsConfig         `toml:"secrets"`
+	AuditConfig          AuditConfig           `toml:"audit"`
+	I18nConfig           I18nConfig            `toml:"i18n"`
+	TestModeConfig       TestModeConfig        `toml:"test_mode"`
+	SecurityConfig       security.Config       `toml:"security"`
 }
 
 // VMPoolConfig configures the JavaScript VM pool for workflow execution.
 // It includes settings for pool size, resource limits, and security sandboxing.
 type VMPoolConfig struct {
-	MaxSize         int  `toml:"max_size"`         // Maximum number of VMs in pool (default: 50)
-	PreloadSize     int  `toml:"preload_size"`     // Number of VMs to preload (default: max_size/2)
-	IdleTimeout     int  `toml:"idle_timeout"`     // Minutes before idle VM is removed (default: 10)
-	CleanupInterval int  `toml:"cleanup_interval"` // Minutes between cleanup runs (default: 5)
-	EnableMetrics   bool `toml:"enable_metrics"`   // Enable VM pool metrics logging
+	Mode            string `toml:"mode"`             // "pool" reuses VMs, "fresh" creates one per request (default: pool)
+	MaxSize         int    `toml:"max_size"`         // Maximum number of VMs in pool (default: 50)
+	PreloadSize     int    `toml:"preload_size"`     // Number of VMs to preload (default: max_size/2)
+	IdleTimeout     int    `toml:"idle_timeout"`     // Minutes before idle VM is removed (default: 10)
+	CleanupInterval int    `toml:"cleanup_interval"` // Minutes between cleanup runs (default: 5)
+	EnableMetrics   bool   `toml:"enable_metrics"`   // Enable VM pool metrics logging
+
+	// Globals reset to undefined on every release, on top of the ones set
+	// during the request (default: form, header, auth_session, profile, redis_*, nflow_endpoint)
+	ClearGlobals []string `toml:"clear_globals"`
+	// Modules scripts may require(); console is always allowed (default: console, util)
+	RequireModules []string `toml:"require_modules"`
+	// Uses after which a VM is discarded and replaced (default: 0, no limit)
+	MaxReusesPerVM int `toml:"max_reuses_per_vm"`
+	// Consecutive VM creation failures before creation fast-fails (default: 3)
+	CreateFailureThreshold int `toml:"create_failure_threshold"`
+	// Seconds VM creation fast-fails before trying again (default: 5)
+	CreateBackoffSeconds int `toml:"create_backoff_seconds"`
+	// Forked workflows (gorutine nodes) running at once (default: 100, -1 no limit)
+	MaxConcurrentForks int `toml:"max_concurrent_forks"`
+	// Workflows (processes) active at once, new requests get 503 (default: 10000, -1 no limit)
+	MaxActiveProcesses int `toml:"max_active_processes"`
+	// Goroutines one request may spawn, counting forks, plugin callbacks and
+	// the two of every node, before it is logged (default: 1000, -1 no limit)
+	MaxGoroutinesPerRequest int `toml:"max_goroutines_per_request"`
+	// "warn" only logs a request over the limit, "fail" also fails its
+	// gorutine nodes past the limit (default: warn)
+	GoroutineLimitAction string `toml:"goroutine_limit_action"`
+	// Milliseconds a request waits for a VM when the pool is full (default: 5000)
+	AcquireTimeoutMs int `toml:"acquire_timeout_ms"`
+	// Seconds in the Retry-After header of 503 capacity errors (default: 1)
+	RetryAfterSeconds int `toml:"retry_after_seconds"`
 
 	// Resource limits
 	MaxMemoryMB         int   `toml:"max_memory_mb"`         // Max memory per VM in MB (default: 128)
@@ -58,15 +109,26 @@ type TrackerConfig struct {
 	ChannelBuffer  int  `toml:"channel_buffer"`  // Channel buffer size (default: 100000)
 	VerboseLogging bool `toml:"verbose_logging"` // Enable verbose logging (default: false)
 	StatsInterval  int  `toml:"stats_interval"`  // Stats reporting interval in seconds (default: 300)
+	MaxFieldBytes  int  `toml:"max_field_bytes"` // Bytes kept of the URL, query and header fields of an entry (default: 1024)
+	// Pass the workflow ID (Nflow-Wid-1) as 17th parameter of QueryInsertLog (default: false)
+	IncludeWorkflowID bool `toml:"include_workflow_id"`
+	// Protection of the stored payloads: "sanitize" masks sensitive data
+	// with the log sanitizer, "encrypt" encrypts it with
+	// security.encryption_key, "none" stores them raw (default: sanitize
+	// when security.enable_log_sanitization is set)
+	PayloadProtection string `toml:"payload_protection"`
 }
 
 // DebugConfig configures debug endpoints availability and security.
 // When enabled, provides detailed system information for troubleshooting.
 type DebugConfig struct {
-	Enabled     bool   `toml:"enabled"`      // Enable debug endpoints (default: false)
-	AuthToken   string `toml:"auth_token"`   // Optional auth token for debug endpoints
-	AllowedIPs  string `toml:"allowed_ips"`  // Comma-separated list of allowed IPs (empty = all)
-	EnablePprof bool   `toml:"enable_pprof"` // Enable Go pprof endpoints (default: false)
+	Enabled     bool   `toml:"enabled"`                  // Enable debug endpoints (default: false)
+	AuthToken   string `toml:"auth_token" secret:"true"` // Optional auth token for debug endpoints
+	AllowedIPs  string `toml:"allowed_ips"`              // Comma-separated list of allowed IPs (empty = all)
+	EnablePprof bool   `toml:"enable_pprof"`             // Enable Go pprof endpoints (default: false)
+	// Detail of the 500 answering a panic: minimal, message or stack, the
+	// stack only for requests passing the debug auth (default: message)
+	PanicDetail string `toml:"panic_detail"`
 }
 
 // MonitorConfig configures monitoring and health check endpoints.
@@ -77,6 +139,18 @@ type MonitorConfig struct {
 	MetricsPath           string `toml:"metrics_path"`            // Prometheus metrics path (default: /metrics)
 	EnableDetailedMetrics bool   `toml:"enable_detailed_metrics"` // Include detailed metrics (default: false)
 	MetricsPort           string `toml:"metrics_port"`            // Separate port for metrics (empty = same port)
+	MaxEndpointLabels     int    `toml:"max_endpoint_labels"`     // Distinct endpoint labels in nflow_requests_total, the rest count as "_other" (default: 200)
+	SLOTargetMs           int    `toml:"slo_target_ms"`           // Requests slower than this count in nflow_requests_slo_breach_total (default: 0, disabled)
+
+	// Health thresholds: past the warn level a component is "warning" and
+	// past the critical one "critical", which answers 503 (-1 disables a level)
+	MemoryWarnMB      int `toml:"memory_warn_mb"`     // Heap allocated in MB (default: 1024)
+	MemoryCriticalMB  int `toml:"memory_critical_mb"` // Heap allocated in MB (default: 2048)
+	ProcessesWarn     int `toml:"processes_warn"`     // Active processes (default: 1000)
+	ProcessesCritical int `toml:"processes_critical"` // Active processes (default: 5000)
+
+	RequestDurationBuckets []float64 `toml:"request_duration_buckets"` // Buckets in seconds of nflow_request_duration_seconds (default: Prometheus defaults)
+	NodeDurationBuckets    []float64 `toml:"node_duration_buckets"`    // Buckets in seconds of nflow_node_duration_seconds (default: Prometheus defaults)
 }
 
 // RateLimitConfig configures IP-based rate limiting for API endpoints.
@@ -102,58 +176,265 @@ type RateLimitConfig struct {
 	ExcludedPaths string `toml:"excluded_paths"` // Comma-separated paths to exclude
 }
 
+// HTTPClientConfig configures the outbound HTTP plugin used by workflows.
+type HTTPClientConfig struct {
+	// Circuit breaker (per upstream host)
+	CircuitBreakerEnabled   bool `toml:"circuit_breaker_enabled"`   // Enable the per-host circuit breaker (default: false)
+	CircuitBreakerThreshold int  `toml:"circuit_breaker_threshold"` // Consecutive failures before opening (default: 5)
+	CircuitBreakerCooldown  int  `toml:"circuit_breaker_cooldown"`  // Seconds to fast-fail before a trial call (default: 30)
+
+	// Response size limits
+	MaxResponseBytes int64 `toml:"max_response_bytes"` // Max body size read into memory (default: 10MB)
+	MaxDownloadBytes int64 `toml:"max_download_bytes"` // Max body size streamed to disk (default: 0 = unlimited)
+
+	// TLS
+	AllowInsecureTLS bool `toml:"allow_insecure_tls"` // Allow tls.insecure_skip_verify in calls (default: false)
+
+	Timeout int `toml:"timeout"` // Seconds a call may take, reading the body included (default: 30)
+}
+
+// GrpcClientConfig configures the gRPC plugin. Calls are only allowed when
+// vm_pool.enable_network is true.
+type GrpcClientConfig struct {
+	DescriptorSet string `toml:"descriptor_set"` // FileDescriptorSet built with protoc --include_imports, empty to use server reflection
+	Timeout       int    `toml:"timeout"`        // Default call timeout in seconds (default: 10)
+}
+
+// QueueConfig configures the backend of the publish() plugin.
+type QueueConfig struct {
+	Backend      string `toml:"backend"`        // Publisher backend: "redis" or "" to disable (default: "")
+	RedisMode    string `toml:"redis_mode"`     // "pubsub" or "stream" (default: "pubsub")
+	StreamMaxLen int64  `toml:"stream_max_len"` // Approximate max stream length (default: 0 = unbounded)
+}
+
+// ExecConfig configures the exec node type. Exec nodes only run when
+// vm_pool.enable_process is true and the binary is allowlisted here.
+type ExecConfig struct {
+	AllowedCommands []string `toml:"allowed_commands"` // Binary names or absolute paths (default: none)
+	Timeout         int      `toml:"timeout"`          // Max execution time in seconds (default: 10)
+	MaxOutputBytes  int64    `toml:"max_output_bytes"` // Max captured bytes per stream (default: 1MB)
+}
+
+// FileSystemConfig configures the read_file/write_file/list_dir helpers.
+// They are only exposed when vm_pool.enable_filesystem is true.
+type FileSystemConfig struct {
+	BaseDir     string `toml:"base_dir"`      // Directory all paths are relative to (empty = helpers disabled)
+	MaxFileSize int64  `toml:"max_file_size"` // Max bytes read or written per call (default: 1MB)
+}
+
+// ResponseConfig configures the defaults of responses written by workflows.
+type ResponseConfig struct {
+	DefaultContentType string `toml:"default_content_type"` // Content type of c.String responses (default: text/plain)
+	Charset            string `toml:"charset"`              // Charset added to text/* content types (default: utf-8)
+	Unbuffered         bool   `toml:"unbuffered"`           // Flush every write() to the client, for streaming workflows (default: false)
+}
+
+// TestModeConfig configures test mode, where mail, HTTP, publish, S3
+// uploads, gRPC, Twilio OTP, exec nodes and tracker DB writes are recorded
+// for /debug/test-mode/calls instead of performed.
+// NFLOW_TEST_MODE=true turns it on regardless of the file.
+type TestModeConfig struct {
+	Enabled          bool `toml:"enabled"`            // Record side effects instead of performing them (default: false)
+	MaxRecordedCalls int  `toml:"max_recorded_calls"` // Calls kept, the oldest are dropped (default: 1000)
+	// Seed for workflow IDs, uuid() and crypto_random(), NFLOW_TEST_SEED
+	// overrides (default: 0, cryptographically random)
+	Seed int64 `toml:"seed"`
+}
+
+// GlobalsConfig configures the standard JS globals registered in every VM
+// (atob, btoa, uuid, now, sleep, crypto_random).
+type GlobalsConfig struct {
+	Disabled       []string `toml:"disabled"`         // Globals not to register (default: none)
+	MaxSleepMs     int      `toml:"max_sleep_ms"`     // Cap for a single sleep(ms) call (default: 5000)
+	MaxRandomBytes int      `toml:"max_random_bytes"` // Cap for crypto_random(n) (default: 1024)
+}
+
+// RequestConfig configures the request helpers of the VM (query, headers,
+// get_header).
+type RequestConfig struct {
+	MaskSensitiveHeaders bool     `toml:"mask_sensitive_headers"` // Hide sensitive header values from headers and get_header (default: false)
+	SensitiveHeaders     []string `toml:"sensitive_headers"`      // Headers to mask (default: Authorization, Proxy-Authorization, Cookie, X-Debug-Token)
+}
+
+// JSONConfig limits the JSON accepted from request bodies and safe_parse.
+type JSONConfig struct {
+	MaxDepth int `toml:"max_depth"` // Max nesting of objects and arrays (default: 100)
+	MaxBytes int `toml:"max_bytes"` // Max document size (default: 5MB)
+}
+
+// PlaybookConfig limits the playbooks accepted at load time and configures
+// how they are run and cached.
+type PlaybookConfig struct {
+	MaxNodes     int    `toml:"max_nodes"`     // Max nodes per playbook flow (default: 2000)
+	PayloadMerge string `toml:"payload_merge"` // session-wins, payload-wins or deep-merge, see payload.go (default: session-wins)
+	MaxHops      int    `toml:"max_hops"`      // Resumes of a multi-step workflow before it expires (default: 50, -1 no limit)
+	CleanWorkers int    `toml:"clean_workers"` // Goroutines validating the flows of a large app on a cold load (default: GOMAXPROCS)
+
+	SkipUnknownNodes bool `toml:"skip_unknown_nodes"` // Continue from output_1 of nodes whose type has no registered step instead of answering 422 (default: false)
+
+	// Kill switch, toggled at runtime through /debug/nodes/disabled
+	DisabledNodes      []string `toml:"disabled_nodes"`       // Node IDs or node types step() does not run (default: none)
+	DisabledNodeAction string   `toml:"disabled_node_action"` // "fail" answers 503, "skip" continues from disabled_node_output (default: fail)
+	DisabledNodeOutput string   `toml:"disabled_node_output"` // Output a skipped disabled node follows (default: output_1)
+
+	CacheWarmInterval int `toml:"cache_warm_interval"` // Seconds between reloads of the most accessed apps (default: 0, off)
+	CacheWarmCount    int `toml:"cache_warm_count"`    // Most accessed apps reloaded on each run (default: 10)
+}
+
+// S3Config configures the S3 compatible object storage plugin.
+// Calls are only allowed when vm_pool.enable_network is true.
+type S3Config struct {
+	Endpoint  string `toml:"endpoint"`                 // e.g. https://s3.amazonaws.com or http://minio:9000 (empty = disabled)
+	Region    string `toml:"region"`                   // Signing region (default: us-east-1)
+	AccessKey string `toml:"access_key" secret:"true"` // Access key ID
+	SecretKey string `toml:"secret_key" secret:"true"` // Secret access key
+	PathStyle bool   `toml:"path_style"`               // Use path-style addressing, required by MinIO (default: false)
+}
+
 type DatabaseNflow struct {
-	Driver                      string `tom:"driver"`
-	DSN                         string `tom:"dsn"`
-	Query                       string `tom:"query"`
-	QueryGetUser                string `tom:"QueryGetUser"`
-	QueryGetApp                 string `tom:"QueryGetApp"`
-	QueryGetModules             string `tom:"QueryGetModules"`
-	QueryCountModulesByName     string `tom:"QueryCountModulesByName"`
-	QueryGetModuleByName        string `tom:"QueryGetModuleByName"`
-	QueryUpdateModModuleByName  string `tom:"QueryUpdateModModuleByName"`
-	QueryUpdateFormModuleByName string `tom:"QueryUpdateFormModuleByName"`
-	QueryUpdateCodeModuleByName string `tom:"QueryUpdateCodeModuleByName"`
-	QueryUpdateApp              string `tom:"QueryUpdateApp"`
-	QueryInsertModule           string `tom:"QueryInsertModule"`
-	QueryDeleteModule           string `tom:"QueryDeleteModule"`
-	QueryInsertLog              string `tom:"QueryInsertLog"`
-	QueryGetToken               string `tom:"QueryGetToken"`
-	QueryGetTemplateCount       string `tom:"QueryGetTemplateCount"`
-	QueryGetTemplate            string `tom:"QueryGetTemplate"`
-	QueryGetTemplates           string `tom:"QueryGetTemplates"`
-	QueryUpdateTemplate         string `tom:"QueryUpdateTemplate"`
-	QueryInsertTemplate         string `tom:"QueryInsertTemplate"`
-	QueryDeleteTemplate         string `tom:"QueryDeleteTemplate"`
+	Driver                      string `toml:"driver"`
+	DSN                         string `toml:"dsn" secret:"true"`
+	Query                       string `toml:"query"`
+	QueryGetUser                string `toml:"QueryGetUser"`
+	QueryGetApp                 string `toml:"QueryGetApp"`
+	QueryGetModules             string `toml:"QueryGetModules"`
+	QueryCountModulesByName     string `toml:"QueryCountModulesByName"`
+	QueryGetModuleByName        string `toml:"QueryGetModuleByName"`
+	QueryUpdateModModuleByName  string `toml:"QueryUpdateModModuleByName"`
+	QueryUpdateFormModuleByName string `toml:"QueryUpdateFormModuleByName"`
+	QueryUpdateCodeModuleByName string `toml:"QueryUpdateCodeModuleByName"`
+	QueryUpdateApp              string `toml:"QueryUpdateApp"`
+	QueryInsertModule           string `toml:"QueryInsertModule"`
+	QueryDeleteModule           string `toml:"QueryDeleteModule"`
+	QueryInsertLog              string `toml:"QueryInsertLog"`
+	QueryGetToken               string `toml:"QueryGetToken"`
+	QueryGetTemplateCount       string `toml:"QueryGetTemplateCount"`
+	QueryGetTemplate            string `toml:"QueryGetTemplate"`
+	QueryGetTemplates           string `toml:"QueryGetTemplates"`
+	QueryUpdateTemplate         string `toml:"QueryUpdateTemplate"`
+	QueryInsertTemplate         string `toml:"QueryInsertTemplate"`
+	QueryDeleteTemplate         string `toml:"QueryDeleteTemplate"`
+
+	SlowQueryMs int `toml:"slow_query_ms"` // Log database calls taking at least this many milliseconds, 0 disables (default: 0)
 }
+
+// SecretsConfig selects where "secret:<name>" config values are read from
+type SecretsConfig struct {
+	Provider     string `toml:"provider"`      // env, file, vault or aws (default: env)
+	EnvPrefix    string `toml:"env_prefix"`    // Prefix of the env variables, env provider (default: none)
+	Dir          string `toml:"dir"`           // Directory with one file per secret, file provider (default: /run/secrets)
+	VaultAddress string `toml:"vault_address"` // Vault server, vault provider (not implemented yet)
+	VaultMount   string `toml:"vault_mount"`   // Vault KV mount, vault provider (not implemented yet)
+	AWSRegion    string `toml:"aws_region"`    // Region, aws provider (not implemented yet)
+}
+
+// AuditConfig configures the audit log of security-relevant events, a JSON
+// lines sink separate from the application log
+type AuditConfig struct {
+	Enabled     bool   `toml:"enabled"`     // Record audit events (default: false)
+	Destination string `toml:"destination"` // stdout, stderr or a file path (default: audit.log)
+}
+
+// I18nConfig configures the message catalogs used by t() and {{t "key"}}
+type I18nConfig struct {
+	Dir           string `toml:"dir"`            // Directory with one <locale>.json catalog per locale (default: locales)
+	DefaultLocale string `toml:"default_locale"` // Locale used when Accept-Language matches none (default: en)
+}
+
+// ServerConfig configures the HTTP listener
+type ServerConfig struct {
+	Address  string `toml:"address"`   // Listen address, overridden by the PORT env var (default: :8080)
+	BasePath string `toml:"base_path"` // Path prefix the runtime is mounted at behind a proxy, e.g. /api/workflows (default: none)
+
+	MaxHeaderCount int `toml:"max_header_count"` // Header values per request, larger requests get 431 (default: 100, -1 no limit)
+	MaxHeaderBytes int `toml:"max_header_bytes"` // Total size of the request headers, larger requests get 431 (default: 65536, -1 no limit)
+
+	RequestIDHeader string   `toml:"request_id_header"` // Header carrying the request ID, echoed in the response (default: X-Request-ID)
+	TrustedProxies  []string `toml:"trusted_proxies"`   // IPs or CIDRs whose request ID is kept, others get a fresh one (default: none)
+
+	AllowedMethods []string `toml:"allowed_methods"` // Methods served, others get 405 (default: GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS)
+}
+
+// HttpsConfig configures serving over TLS
 type HttpsConfig struct {
-	Enable      bool   `tom:"enable"`
-	Cert        string `tom:"cert"`
-	Key         string `tom:"key"`
-	Address     string `tom:"address"`
-	Description string `tom:"description"`
-	HTTPBasic   bool   `tom:"httpbasic"`
+	Enable       bool   `toml:"enable"`        // Serve over HTTPS (default: false)
+	Cert         string `toml:"cert"`          // Certificate file (PEM)
+	Key          string `toml:"key"`           // Private key file (PEM)
+	Address      string `toml:"address"`       // HTTPS listen address (default: :8443)
+	Description  string `toml:"description"`   // Free text
+	HTTPBasic    bool   `toml:"httpbasic"`     // Require HTTP basic auth on every route but the health check (default: false)
+	RedirectHTTP bool   `toml:"redirect_http"` // Keep the plain HTTP listener, redirecting to HTTPS (default: false)
+	// Credentials of the HTTP basic auth, required with httpbasic
+	BasicUser     string `toml:"basic_user"`
+	BasicPassword string `toml:"basic_password" secret:"true"`
 }
 
 type PgSessionConfig struct {
-	Url string `tom:"url"`
+	Url string `toml:"url" secret:"true"`
+}
+
+// SessionConfig sets the attributes of the session cookies. Deployments
+// behind HTTPS should use cookie_secure = true and cookie_same_site = "strict".
+type SessionConfig struct {
+	CookieSecure   bool   `toml:"cookie_secure"`    // Send cookies only over HTTPS (default: false)
+	CookieSameSite string `toml:"cookie_same_site"` // strict, lax or none (default: lax)
+	CookieHTTPOnly *bool  `toml:"cookie_http_only"` // Hide cookies from JavaScript (default: true)
+	CookieDomain   string `toml:"cookie_domain"`    // Cookie domain (default: request host)
+	CookiePath     string `toml:"cookie_path"`      // Cookie path (default: /)
+	CookieMaxAge   int    `toml:"cookie_max_age"`   // Lifetime in seconds (default: 2592000, 30 days)
+}
+
+// ContinuationConfig configures the signed tokens paused workflows resume
+// with. Every instance behind a load balancer needs the same secret.
+type ContinuationConfig struct {
+	Secret          string `toml:"secret" secret:"true"` // HMAC key of the tokens (default: random per process)
+	TTLSeconds      int    `toml:"ttl_seconds"`          // Seconds a token stays valid (default: 3600)
+	AllowPlainNodes bool   `toml:"allow_plain_nodes"`    // Also resume from plain node ids, for migration (default: false)
+}
+
+// CSRFConfig configures the CSRF protection of state-changing requests.
+type CSRFConfig struct {
+	Enabled        bool     `toml:"enabled"`          // Check CSRF tokens on POST/PUT/PATCH/DELETE (default: false)
+	Paths          []string `toml:"paths"`            // Protected path prefixes (default: all paths)
+	ExemptPaths    []string `toml:"exempt_paths"`     // Path prefixes never checked (default: none)
+	ExemptHeaders  []string `toml:"exempt_headers"`   // Requests with any of these headers are not checked (default: Authorization)
+	HeaderName     string   `toml:"header_name"`      // Header carrying the token (default: X-CSRF-Token)
+	FormField      string   `toml:"form_field"`       // Form field carrying the token (default: csrf_token)
+	CookieName     string   `toml:"cookie_name"`      // Cookie holding the token (default: _csrf)
+	CookieSecure   bool     `toml:"cookie_secure"`    // Send the token cookie only over HTTPS (default: false)
+	CookieSameSite string   `toml:"cookie_same_site"` // strict or lax (default: strict)
+}
+
+// SecurityHeadersConfig configures the security headers added to every
+// response. Empty values use the defaults and "off" removes a header.
+type SecurityHeadersConfig struct {
+	Enabled               bool   `toml:"enabled"`                 // Add the security headers (default: false)
+	ContentSecurityPolicy string `toml:"content_security_policy"` // Content-Security-Policy (default: not set)
+	CSPReportOnly         bool   `toml:"csp_report_only"`         // Send the CSP as report-only (default: false)
+	XFrameOptions         string `toml:"x_frame_options"`         // X-Frame-Options (default: SAMEORIGIN)
+	ContentTypeNosniff    string `toml:"content_type_nosniff"`    // X-Content-Type-Options (default: nosniff)
+	ReferrerPolicy        string `toml:"referrer_policy"`         // Referrer-Policy (default: strict-origin-when-cross-origin)
+	XSSProtection         string `toml:"xss_protection"`          // X-XSS-Protection (default: 0, the legacy filter is off)
+	HSTSMaxAge            int    `toml:"hsts_max_age"`            // HSTS max-age on HTTPS requests, negative disables (default: 31536000)
+	HSTSExcludeSubdomains bool   `toml:"hsts_exclude_subdomains"` // Omit includeSubDomains (default: false)
+	HSTSPreload           bool   `toml:"hsts_preload"`            // Add preload to HSTS (default: false)
 }
 
 type RedisConfig struct {
-	Host              string `tom:"host"`
-	Password          string `tom:"password"`
-	MaxConnectionPool int    `tom:"maxconnectionpool"`
+	Host              string `toml:"host"`
+	Password          string `toml:"password" secret:"true"`
+	MaxConnectionPool int    `toml:"maxconnectionpool"` // Connections of the shared client (default: 10 per CPU)
 }
 
 type TwilioConfig struct {
 	Enable          bool   `toml:"enable"`
 	AccountSid      string `toml:"account_sid"`
-	AuthToken       string `toml:"auth_token"`
+	AuthToken       string `toml:"auth_token" secret:"true"`
 	VerifyServiceID string `toml:"verify_service_id"`
 }
 
 type MongoConfig struct {
-	URL string `tom:"url"`
+	URL string `toml:"url" secret:"true"`
 }
 
 type PluginConfig struct {
@@ -166,7 +447,7 @@ type URLConfig struct {
 
 // ConfigBasedate is ...
 type ConfigBasedate struct {
-	DatabaseURL    string `toml:"url"`
+	DatabaseURL    string `toml:"url" secret:"true"`
 	DatabaseDriver string `toml:"driver"`
 	DatabaseInit   string `toml:"init"`
 }
@@ -176,7 +457,7 @@ type ConfigMail struct {
 	MailSMTP     string `toml:"smtp"`
 	MailSMTPPort string `toml:"port"`
 	MailFrom     string `toml:"from"`
-	MailPassword string `toml:"password"`
+	MailPassword string `toml:"password" secret:"true"`
 }
 
 func UpdateQueries() {
@@ -201,6 +482,7 @@ func UpdateQueries() {
 	}
 	defer conn.Close()
 	queries := make(map[string]string)
+	defer observeQuery("queries_load", config.DatabaseNflow.Query, time.Now())
 	rows, err := conn.QueryContext(context.Background(), config.DatabaseNflow.Query)
 	if err != nil {
 		log.Println(err)
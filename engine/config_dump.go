@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/arturoeanton/nflow-runtime/security/sanitizer"
+)
+
+// redactedValue replaces the value of fields tagged secret:"true"
+const redactedValue = "[REDACTED]"
+
+// RedactedConfig returns every field of config keyed by its toml name.
+// Fields tagged secret:"true" are replaced by [REDACTED] when set, and the
+// values of free-form maps such as [env] go through the log sanitizer, so
+// the result can be shown to operators.
+func RedactedConfig(config *ConfigWorkspace) map[string]interface{} {
+	ls := sanitizer.NewLogSanitizer(nil)
+	return redactStruct(reflect.ValueOf(*config), ls)
+}
+
+func redactStruct(v reflect.Value, ls *sanitizer.LogSanitizer) map[string]interface{} {
+	out := make(map[string]interface{}, v.NumField())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		value := v.Field(i)
+		if field.Tag.Get("secret") == "true" {
+			if value.IsZero() {
+				out[name] = ""
+			} else {
+				out[name] = redactedValue
+			}
+			continue
+		}
+		out[name] = redactValue(value, ls)
+	}
+	return out
+}
+
+func redactValue(v reflect.Value, ls *sanitizer.LogSanitizer) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		return redactStruct(v, ls)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), ls)
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			item := redactValue(iter.Value(), ls)
+			if s, ok := item.(string); ok {
+				item = ls.Sanitize(s)
+			}
+			out[iter.Key().String()] = item
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), ls)
+		}
+		return out
+	}
+	return v.Interface()
+}
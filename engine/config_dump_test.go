@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactedConfig(t *testing.T) {
+	config := ConfigWorkspace{}
+	config.DatabaseNflow.Driver = "postgres"
+	config.DatabaseNflow.DSN = "postgres://nflow:s3cr3t@db:5432/nflow"
+	config.RedisConfig.Host = "redis:6379"
+	config.RedisConfig.Password = "redis-pass"
+	config.DebugConfig.Enabled = true
+	config.DebugConfig.AuthToken = "debug-token"
+	config.S3Config.Region = "eu-west-1"
+	config.S3Config.SecretKey = "aws-secret"
+	config.ConfigMail.MailPassword = "mail-pass"
+	config.VMPoolConfig.MaxSize = 42
+	config.CSRFConfig.ExemptHeaders = []string{"Authorization"}
+	config.Env = map[string]string{"openid_base": "https://localhost:8443", "note": "password=hunter2"}
+
+	dump := RedactedConfig(&config)
+
+	data, err := json.Marshal(dump)
+	require.NoError(t, err)
+	for _, secret := range []string{"s3cr3t", "redis-pass", "debug-token", "aws-secret", "mail-pass", "hunter2"} {
+		assert.NotContains(t, string(data), secret)
+	}
+
+	db := dump["database_nflow"].(map[string]interface{})
+	assert.Equal(t, "postgres", db["driver"])
+	assert.Equal(t, redactedValue, db["dsn"])
+
+	redis := dump["redis"].(map[string]interface{})
+	assert.Equal(t, "redis:6379", redis["host"])
+	assert.Equal(t, redactedValue, redis["password"])
+
+	// Unset secrets show as empty so operators see they are missing
+	assert.Equal(t, "", dump["s3"].(map[string]interface{})["access_key"])
+	assert.Equal(t, "eu-west-1", dump["s3"].(map[string]interface{})["region"])
+
+	assert.Equal(t, 42, dump["vm_pool"].(map[string]interface{})["max_size"])
+	assert.Equal(t, true, dump["debug"].(map[string]interface{})["enabled"])
+	assert.Equal(t, []interface{}{"Authorization"}, dump["csrf"].(map[string]interface{})["exempt_headers"])
+	assert.Equal(t, "https://localhost:8443", dump["env"].(map[string]interface{})["openid_base"])
+
+	// Every section of ConfigWorkspace is present
+	assert.Len(t, dump, reflect.TypeOf(config).NumField())
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// envRefPattern matches ${VAR}, ${VAR:-default} and the $${ escape
+var envRefPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ExpandEnv replaces ${VAR} with the value of the environment variable VAR
+// and ${VAR:-default} with default when VAR is unset or empty. $${ is kept
+// as a literal ${. Variables without a default that are not set expand to
+// "" and are returned in missing.
+func ExpandEnv(value string) (expanded string, missing []string) {
+	expanded = envRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := envRefPattern.FindStringSubmatch(ref)
+		name := m[1]
+		hasDefault := len(ref) > len("${}")+len(name)
+		if v, ok := os.LookupEnv(name); ok && (v != "" || !hasDefault) {
+			return v
+		}
+		if hasDefault {
+			return m[2]
+		}
+		missing = append(missing, name)
+		return ""
+	})
+	return expanded, missing
+}
+
+// ExpandConfigEnv expands the environment references in every string of
+// config, so secrets such as dsn = "${DATABASE_URL}" stay out of the file.
+// It returns the referenced variables that were not set, sorted.
+func ExpandConfigEnv(config *ConfigWorkspace) []string {
+	seen := make(map[string]bool)
+	expandValue(reflect.ValueOf(config).Elem(), seen)
+
+	missing := make([]string, 0, len(seen))
+	for name := range seen {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func expandValue(v reflect.Value, missing map[string]bool) {
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() {
+			return
+		}
+		expanded, names := ExpandEnv(v.String())
+		for _, name := range names {
+			missing[name] = true
+		}
+		v.SetString(expanded)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				expandValue(v.Field(i), missing)
+			}
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			expandValue(v.Elem(), missing)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			expandValue(v.Index(i), missing)
+		}
+	case reflect.Map:
+		// Map values are not addressable, so they are replaced
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			expanded, names := ExpandEnv(iter.Value().String())
+			for _, name := range names {
+				missing[name] = true
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(expanded).Convert(v.Type().Elem()))
+		}
+	}
+}
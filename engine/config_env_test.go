@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("NFLOW_TEST_DSN", "postgres://u:p@db/nflow")
+	t.Setenv("NFLOW_TEST_EMPTY", "")
+
+	tests := []struct {
+		value    string
+		expected string
+		missing  []string
+	}{
+		{"${NFLOW_TEST_DSN}", "postgres://u:p@db/nflow", nil},
+		{"dsn=${NFLOW_TEST_DSN}?sslmode=disable", "dsn=postgres://u:p@db/nflow?sslmode=disable", nil},
+		{"${NFLOW_TEST_UNSET:-localhost:6379}", "localhost:6379", nil},
+		{"${NFLOW_TEST_EMPTY:-fallback}", "fallback", nil},
+		{"${NFLOW_TEST_EMPTY}", "", nil},
+		{"${NFLOW_TEST_UNSET:-}", "", nil},
+		{"${NFLOW_TEST_UNSET}", "", []string{"NFLOW_TEST_UNSET"}},
+		{"$${NFLOW_TEST_DSN}", "${NFLOW_TEST_DSN}", nil},
+		{"pa$$word $HOME", "pa$$word $HOME", nil},
+	}
+	for _, tt := range tests {
+		expanded, missing := ExpandEnv(tt.value)
+		assert.Equal(t, tt.expected, expanded, tt.value)
+		assert.Equal(t, tt.missing, missing, tt.value)
+	}
+}
+
+func TestExpandConfigEnv(t *testing.T) {
+	t.Setenv("NFLOW_TEST_DSN", "postgres://u:p@db/nflow")
+	t.Setenv("NFLOW_TEST_REDIS_PASSWORD", "r3dis")
+
+	config := ConfigWorkspace{}
+	config.DatabaseNflow.DSN = "${NFLOW_TEST_DSN}"
+	config.RedisConfig.Host = "${NFLOW_TEST_REDIS_HOST:-localhost:6379}"
+	config.RedisConfig.Password = "${NFLOW_TEST_REDIS_PASSWORD}"
+	config.S3Config.SecretKey = "${NFLOW_TEST_S3_SECRET}"
+	config.ExecConfig.AllowedCommands = []string{"${NFLOW_TEST_MISSING_CMD}", "ls"}
+	config.Env = map[string]string{"base": "${NFLOW_TEST_BASE:-https://localhost:8443}"}
+
+	missing := ExpandConfigEnv(&config)
+
+	assert.Equal(t, "postgres://u:p@db/nflow", config.DatabaseNflow.DSN)
+	assert.Equal(t, "localhost:6379", config.RedisConfig.Host)
+	assert.Equal(t, "r3dis", config.RedisConfig.Password)
+	assert.Equal(t, "", config.S3Config.SecretKey)
+	assert.Equal(t, []string{"", "ls"}, config.ExecConfig.AllowedCommands)
+	assert.Equal(t, "https://localhost:8443", config.Env["base"])
+	assert.Equal(t, []string{"NFLOW_TEST_MISSING_CMD", "NFLOW_TEST_S3_SECRET"}, missing)
+}
@@ -58,10 +58,22 @@ func (r *configRepository) SetConfig(config ConfigWorkspace) {
 	r.config = config
 }
 
-// GetRedisClient retrieves the Redis client in a thread-safe manner
+// GetRedisClient retrieves the Redis client, creating it from [redis] if
+// necessary. The rate limiter, the publish() backend and the redis_*
+// globals all share this client and its connection pool.
 func (r *configRepository) GetRedisClient() *redis.Client {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
+	client := r.redisClient
+	r.mu.RUnlock()
+	if client != nil {
+		return client
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.redisClient == nil {
+		r.redisClient = NewRedisClient(r.config.RedisConfig)
+	}
 	return r.redisClient
 }
 
@@ -72,6 +84,18 @@ func (r *configRepository) SetRedisClient(client *redis.Client) {
 	r.redisClient = client
 }
 
+// NewRedisClient creates a pooled Redis client, with at most
+// MaxConnectionPool connections (default: 10 per CPU). Use GetRedisClient
+// instead to share the connections of the application.
+func NewRedisClient(config RedisConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     config.Host,
+		Password: config.Password,
+		DB:       0, // use default DB
+		PoolSize: config.MaxConnectionPool,
+	})
+}
+
 // GetDB retrieves the database connection, creating it if necessary
 func (r *configRepository) GetDB() (*sql.DB, error) {
 	r.mu.Lock()
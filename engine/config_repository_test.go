@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRedisClientIsShared(t *testing.T) {
+	repo := &configRepository{}
+	repo.SetConfig(ConfigWorkspace{RedisConfig: RedisConfig{Host: "redis:6379", MaxConnectionPool: 7}})
+
+	client := repo.GetRedisClient()
+	defer client.Close()
+
+	assert.Same(t, client, repo.GetRedisClient(), "every consumer gets the same client")
+	assert.Equal(t, 7, client.Options().PoolSize)
+	assert.Equal(t, "redis:6379", client.Options().Addr)
+}
+
+func TestGetRedisClientDefaultPool(t *testing.T) {
+	client := NewRedisClient(RedisConfig{})
+	defer client.Close()
+
+	assert.Positive(t, client.Options().PoolSize)
+}
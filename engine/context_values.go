@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// contextValuesKey is the echo context key holding the values exposed to
+// workflows as the ctx_values object
+const contextValuesKey = "_nflow_ctx_values"
+
+// SetContextValue stores a request scoped value that workflow nodes can
+// read as ctx_values.<key>. It is meant for middleware enriching the
+// execution environment, e.g. with a tenant ID.
+func SetContextValue(c echo.Context, key string, value interface{}) {
+	values, ok := c.Get(contextValuesKey).(map[string]interface{})
+	if !ok {
+		values = make(map[string]interface{})
+		c.Set(contextValuesKey, values)
+	}
+	values[key] = value
+}
+
+// GetContextValues returns the values set with SetContextValue
+func GetContextValues(c echo.Context) map[string]interface{} {
+	values, _ := c.Get(contextValuesKey).(map[string]interface{})
+	return values
+}
+
+// AddFeatureContextValues exposes the request context values as the
+// ctx_values object; ctx stays the Go context. A new object is built per request so values never leak between
+// requests sharing a pooled VM.
+func AddFeatureContextValues(vm *goja.Runtime, c echo.Context) {
+	obj := vm.NewObject()
+	for key, value := range GetContextValues(c) {
+		obj.Set(key, value)
+	}
+	vm.Set("ctx_values", obj)
+}
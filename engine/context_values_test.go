@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextValuesFromMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			SetContextValue(c, "tenant", "acme")
+			SetContextValue(c, "foo", map[string]interface{}{"bar": 1})
+			return next(c)
+		}
+	})
+
+	vm := goja.New()
+	e.GET("/", func(c echo.Context) error {
+		AddFeatureContextValues(vm, c)
+		v, err := vm.RunString(`ctx_values.tenant + ":" + ctx_values.foo.bar`)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, v.String())
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "acme:1", rec.Body.String())
+
+	// A later request on the same VM does not see the previous values
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	AddFeatureContextValues(vm, c)
+	v, err := vm.RunString(`typeof ctx_values.tenant`)
+	require.NoError(t, err)
+	assert.Equal(t, "undefined", v.String())
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/syncsession"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// continuationNonceKey is the nflow_form session key holding the nonce the
+// continuation tokens of the session are bound to
+const continuationNonceKey = "nflow_continuation_nonce"
+
+const defaultContinuationTTL = time.Hour
+
+var (
+	errContinuationInvalid = errors.New("invalid continuation token")
+	errContinuationExpired = errors.New("continuation token expired")
+)
+
+var (
+	processContinuationSecret     []byte
+	processContinuationSecretOnce sync.Once
+)
+
+// continuation is the signed content of a continuation token
+type continuation struct {
+	Node    string `json:"n"`
+	Nonce   string `json:"s"`
+	Expires int64  `json:"e"`
+}
+
+// continuationSecret returns [continuation].secret, or a random key shared
+// by the tokens of this process when none is configured
+func continuationSecret() []byte {
+	if secret := GetConfig().ContinuationConfig.Secret; secret != "" {
+		return []byte(secret)
+	}
+	processContinuationSecretOnce.Do(func() {
+		processContinuationSecret = make([]byte, 32)
+		if _, err := rand.Read(processContinuationSecret); err != nil {
+			logger.Error("Failed to generate the continuation secret:", err)
+		}
+		logger.Info("[continuation] secret not configured, tokens are only valid on this instance until restart")
+	})
+	return processContinuationSecret
+}
+
+func continuationTTL() time.Duration {
+	if ttl := GetConfig().ContinuationConfig.TTLSeconds; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultContinuationTTL
+}
+
+func continuationSignature(payload string) string {
+	mac := hmac.New(sha256.New, continuationSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signContinuation builds the token "<payload>.<signature>", both base64url
+func signContinuation(cont continuation) string {
+	data, _ := json.Marshal(cont)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + continuationSignature(payload)
+}
+
+// parseContinuation verifies the signature of token and decodes it
+func parseContinuation(token string) (continuation, error) {
+	var cont continuation
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(continuationSignature(payload))) {
+		return cont, errContinuationInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &cont) != nil {
+		return cont, errContinuationInvalid
+	}
+	return cont, nil
+}
+
+// ContinuationToken returns the signed token a paused workflow resumes from
+// node with. Forms send it back as nflow_next_node_run. The token expires
+// after [continuation].ttl_seconds and is only valid in the session that
+// requested it.
+func ContinuationToken(c echo.Context, node string) string {
+	var nonce string
+	if _, isIsolated := c.(*IsolatedContext); !isIsolated {
+		EchoSessionsMutex.Lock()
+		s, err := syncsession.Manager.GetSession("nflow_form", c)
+		if err != nil {
+			logger.Error("Error reading continuation nonce:", err)
+		} else {
+			nonce, _ = s.Values[continuationNonceKey].(string)
+			if nonce == "" {
+				buf := make([]byte, 16)
+				rand.Read(buf)
+				nonce = hex.EncodeToString(buf)
+				s.Values[continuationNonceKey] = nonce
+				syncsession.Manager.SaveSession("nflow_form", c, s)
+			}
+		}
+		EchoSessionsMutex.Unlock()
+	}
+
+	return signContinuation(continuation{
+		Node:    node,
+		Nonce:   nonce,
+		Expires: time.Now().Add(continuationTTL()).Unix(),
+	})
+}
+
+// resolveContinuation returns the node a continuation token resumes from.
+// Plain node ids are returned as they are when [continuation].allow_plain_nodes
+// is set.
+func resolveContinuation(c echo.Context, value string) (string, error) {
+	if !strings.Contains(value, ".") && GetConfig().ContinuationConfig.AllowPlainNodes {
+		return value, nil
+	}
+
+	cont, err := parseContinuation(value)
+	if err != nil {
+		return "", err
+	}
+	if time.Now().Unix() > cont.Expires {
+		return "", errContinuationExpired
+	}
+
+	var nonce string
+	func() {
+		EchoSessionsMutex.Lock()
+		defer EchoSessionsMutex.Unlock()
+		if s, err := syncsession.Manager.GetSession("nflow_form", c); err == nil {
+			nonce, _ = s.Values[continuationNonceKey].(string)
+		}
+	}()
+	if nonce == "" || !hmac.Equal([]byte(nonce), []byte(cont.Nonce)) {
+		return "", errContinuationInvalid
+	}
+	return cont.Node, nil
+}
+
+// respondContinuationError answers 409 for a token resolveContinuation
+// rejected
+func respondContinuationError(c echo.Context, err error) {
+	message, code := "Invalid continuation token, please restart", "invalid_continuation"
+	if errors.Is(err, errContinuationExpired) {
+		message, code = "Continuation token expired, please restart", "continuation_expired"
+	}
+	c.JSON(http.StatusConflict, echo.Map{"error": message, "code": code})
+}
+
+// AddFeatureContinuation exposes continuation_token(node) to workflows
+func AddFeatureContinuation(vm *goja.Runtime, c echo.Context) {
+	vm.Set("continuation_token", func(node string) string {
+		return ContinuationToken(c, node)
+	})
+}
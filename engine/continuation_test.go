@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveContinuation(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+	config := original
+	config.ContinuationConfig = ContinuationConfig{Secret: "test-secret"}
+	repo.SetConfig(config)
+
+	// The paused workflow hands out a token for node_2
+	c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+	token := ContinuationToken(c, "node_2")
+	cookies := rec.Result().Cookies()
+	require.NotEmpty(t, cookies)
+
+	resumeContext := func() echo.Context {
+		c, _ := newTraceTestContext(t, "/form", DebugConfig{})
+		for _, cookie := range cookies {
+			c.Request().AddCookie(cookie)
+		}
+		return c
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		node, err := resolveContinuation(resumeContext(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "node_2", node)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		cont, err := parseContinuation(token)
+		require.NoError(t, err)
+		cont.Node = "node_3"
+		payload, _, _ := strings.Cut(signContinuation(cont), ".")
+		_, signature, _ := strings.Cut(token, ".")
+
+		_, err = resolveContinuation(resumeContext(), payload+"."+signature)
+		assert.ErrorIs(t, err, errContinuationInvalid, "the payload no longer matches the signature")
+		_, err = resolveContinuation(resumeContext(), "node_3")
+		assert.ErrorIs(t, err, errContinuationInvalid, "plain node ids are not accepted")
+	})
+
+	t.Run("other session", func(t *testing.T) {
+		other, _ := newTraceTestContext(t, "/form", DebugConfig{})
+		_, err := resolveContinuation(other, token)
+		assert.ErrorIs(t, err, errContinuationInvalid)
+	})
+
+	t.Run("other secret", func(t *testing.T) {
+		rotated := config
+		rotated.ContinuationConfig.Secret = "rotated-secret"
+		repo.SetConfig(rotated)
+		defer repo.SetConfig(config)
+
+		_, err := resolveContinuation(resumeContext(), token)
+		assert.ErrorIs(t, err, errContinuationInvalid)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		cont, err := parseContinuation(token)
+		require.NoError(t, err)
+		cont.Expires = time.Now().Add(-time.Second).Unix()
+
+		_, err = resolveContinuation(resumeContext(), signContinuation(cont))
+		assert.ErrorIs(t, err, errContinuationExpired)
+
+		rec := httptest.NewRecorder()
+		respondContinuationError(echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec), err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.JSONEq(t, `{"error":"Continuation token expired, please restart","code":"continuation_expired"}`, rec.Body.String())
+	})
+
+	t.Run("plain nodes during migration", func(t *testing.T) {
+		migrating := config
+		migrating.ContinuationConfig.AllowPlainNodes = true
+		repo.SetConfig(migrating)
+		defer repo.SetConfig(config)
+
+		node, err := resolveContinuation(resumeContext(), "node_2")
+		require.NoError(t, err)
+		assert.Equal(t, "node_2", node)
+		node, err = resolveContinuation(resumeContext(), token)
+		require.NoError(t, err, "tokens keep working")
+		assert.Equal(t, "node_2", node)
+	})
+}
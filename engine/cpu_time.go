@@ -0,0 +1,24 @@
+package engine
+
+import (
+	"runtime"
+	"time"
+)
+
+// measureCPU runs fn on a locked OS thread and returns the CPU time the
+// thread spent on it. Time blocked on I/O, sleeping or waiting on other
+// goroutines is not counted. It returns 0 where thread CPU time is not
+// available (see cpuTimeSupported).
+func measureCPU(fn func()) (cpu time.Duration) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	start, ok := threadCPUTime()
+	defer func() {
+		if end, endOk := threadCPUTime(); ok && endOk {
+			cpu = end - start
+		}
+	}()
+	fn()
+	return
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package engine
+
+import "time"
+
+// cpuTimeSupported reports whether measureCPU returns real values
+const cpuTimeSupported = false
+
+// threadCPUTime is not available on this platform
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// csrfContextKey is where the CSRF middleware stores the request token
+const csrfContextKey = "csrf"
+
+// CSRFMiddleware protects state-changing requests with a double-submit
+// cookie: unsafe methods must send back the cookie token in the header or
+// form field. Requests outside the configured paths and requests carrying
+// one of the exempt headers (token/JWT authentication, which browsers do not
+// attach cross-site) are not checked.
+func CSRFMiddleware(config *CSRFConfig) echo.MiddlewareFunc {
+	headerName := config.HeaderName
+	if headerName == "" {
+		headerName = "X-CSRF-Token"
+	}
+	formField := config.FormField
+	if formField == "" {
+		formField = "csrf_token"
+	}
+	exemptHeaders := config.ExemptHeaders
+	if exemptHeaders == nil {
+		exemptHeaders = []string{echo.HeaderAuthorization}
+	}
+
+	sameSite := http.SameSiteStrictMode
+	if strings.EqualFold(config.CookieSameSite, "lax") {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	return middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper: func(c echo.Context) bool {
+			if !config.Enabled || !csrfPathProtected(c.Request().URL.Path, config) {
+				return true
+			}
+			for _, header := range exemptHeaders {
+				if c.Request().Header.Get(header) != "" {
+					return true
+				}
+			}
+			return false
+		},
+		TokenLookup:    "header:" + headerName + ",form:" + formField,
+		ContextKey:     csrfContextKey,
+		CookieName:     config.CookieName,
+		CookiePath:     "/",
+		CookieSecure:   config.CookieSecure,
+		CookieHTTPOnly: true,
+		CookieSameSite: sameSite,
+		ErrorHandler: func(err error, c echo.Context) error {
+			status := http.StatusForbidden
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			}
+			return c.JSON(status, echo.Map{"error": "invalid or missing CSRF token"})
+		},
+	})
+}
+
+// csrfPathProtected reports whether path is under the protected prefixes
+// and not exempt. No configured paths means every path is protected.
+func csrfPathProtected(path string, config *CSRFConfig) bool {
+	for _, prefix := range config.ExemptPaths {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	if len(config.Paths) == 0 {
+		return true
+	}
+	for _, prefix := range config.Paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFeatureCSRF registers csrf_token(), which returns the token to embed
+// in forms as the csrf_token field (or send as the X-CSRF-Token header).
+// It is empty when the request is not protected.
+func AddFeatureCSRF(vm *goja.Runtime, c echo.Context) {
+	vm.Set("csrf_token", func() string {
+		token, _ := c.Get(csrfContextKey).(string)
+		return token
+	})
+}
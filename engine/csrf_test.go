@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCSRFServer(config *CSRFConfig) *echo.Echo {
+	e := echo.New()
+	e.Use(CSRFMiddleware(config))
+	e.Any("/*", func(c echo.Context) error {
+		vm := goja.New()
+		AddFeatureCSRF(vm, c)
+		v, err := vm.RunString(`csrf_token()`)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, v.String())
+	})
+	return e
+}
+
+func serveCSRF(e *echo.Echo, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	e := newCSRFServer(&CSRFConfig{Enabled: true, Paths: []string{"/forms"}})
+
+	// A safe request issues the token, available to the workflow
+	rec := serveCSRF(e, httptest.NewRequest(http.MethodGet, "/forms/contact", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	token := rec.Body.String()
+	require.NotEmpty(t, token)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, token, cookies[0].Value)
+	assert.True(t, cookies[0].HttpOnly)
+
+	post := func(body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/forms/contact", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.AddCookie(cookies[0])
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return serveCSRF(e, req)
+	}
+
+	t.Run("valid form token", func(t *testing.T) {
+		rec := post(url.Values{"csrf_token": {token}, "name": {"ana"}}.Encode(), nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("valid header token", func(t *testing.T) {
+		rec := post("name=ana", map[string]string{"X-CSRF-Token": token})
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		rec := post("name=ana", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "CSRF")
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		rec := post("name=ana", map[string]string{"X-CSRF-Token": "forged"})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("token authenticated requests are exempt", func(t *testing.T) {
+		rec := post("name=ana", map[string]string{echo.HeaderAuthorization: "Bearer abc"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("paths outside the protected prefixes are not checked", func(t *testing.T) {
+		rec := serveCSRF(e, httptest.NewRequest(http.MethodPost, "/api/hook", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+}
@@ -170,6 +170,7 @@ func QueryWithTimeout(ctx context.Context, timeout time.Duration, query string,
 	// Crear contexto con timeout
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
+	defer observeQuery("query", query, time.Now())
 
 	return db.QueryContext(ctx, query, args...)
 }
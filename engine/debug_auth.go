@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Reasons a request fails the debug auth
+var (
+	ErrDebugDisabled     = errors.New("debug endpoints are disabled")
+	ErrDebugTokenInvalid = errors.New("invalid or missing debug token")
+	ErrDebugIPNotAllowed = errors.New("ip not allowed")
+)
+
+// CheckDebugAuth checks a request against [debug]: the endpoints must be
+// enabled, the X-Debug-Token header (or debug_token query parameter) must
+// match auth_token when set, and the client IP must be in allowed_ips, a
+// comma-separated list of IPs and CIDR ranges, when set. It is shared by
+// the /debug endpoints, execution traces and panic stacks.
+func CheckDebugAuth(c echo.Context, config DebugConfig) error {
+	if !config.Enabled {
+		return ErrDebugDisabled
+	}
+
+	if config.AuthToken != "" {
+		token := c.Request().Header.Get("X-Debug-Token")
+		if token == "" {
+			token = c.QueryParam("debug_token")
+		}
+		if token != config.AuthToken {
+			return ErrDebugTokenInvalid
+		}
+	}
+
+	if config.AllowedIPs != "" {
+		clientIP := DebugClientIP(c.Request())
+		for _, allowedIP := range strings.Split(config.AllowedIPs, ",") {
+			allowedIP = strings.TrimSpace(allowedIP)
+			if allowedIP == clientIP {
+				return nil
+			}
+			// Check if it's a CIDR range
+			if strings.Contains(allowedIP, "/") {
+				_, ipNet, err := net.ParseCIDR(allowedIP)
+				if err == nil && ipNet.Contains(net.ParseIP(clientIP)) {
+					return nil
+				}
+			}
+		}
+		return ErrDebugIPNotAllowed
+	}
+	return nil
+}
+
+// debugAuthorized reports whether the request passes the debug auth
+func debugAuthorized(c echo.Context) bool {
+	return CheckDebugAuth(c, GetConfig().DebugConfig) == nil
+}
+
+// DebugClientIP extracts the client IP address checked against
+// [debug].allowed_ips
+func DebugClientIP(r *http.Request) string {
+	// Check X-Forwarded-For header
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		ips := strings.Split(xff, ",")
+		if len(ips) > 0 {
+			return strings.TrimSpace(ips[0])
+		}
+	}
+
+	// Check X-Real-IP header
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		return xri
+	}
+
+	// Fall back to RemoteAddr
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return ip
+}
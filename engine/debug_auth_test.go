@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDebugAuth(t *testing.T) {
+	request := func(remoteAddr, token string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("X-Debug-Token", token)
+		}
+		return echo.New().NewContext(req, httptest.NewRecorder())
+	}
+
+	cases := []struct {
+		name   string
+		config DebugConfig
+		c      echo.Context
+		err    error
+	}{
+		{"disabled", DebugConfig{}, request("10.1.2.3:1", ""), ErrDebugDisabled},
+		{"open", DebugConfig{Enabled: true}, request("10.1.2.3:1", ""), nil},
+		{"token", DebugConfig{Enabled: true, AuthToken: "s3cret"}, request("10.1.2.3:1", "s3cret"), nil},
+		{"wrong token", DebugConfig{Enabled: true, AuthToken: "s3cret"}, request("10.1.2.3:1", "nope"), ErrDebugTokenInvalid},
+		{"exact ip", DebugConfig{Enabled: true, AllowedIPs: "192.0.2.1, 10.1.2.3"}, request("10.1.2.3:1", ""), nil},
+		{"cidr", DebugConfig{Enabled: true, AllowedIPs: "10.0.0.0/8"}, request("10.1.2.3:1", ""), nil},
+		{"outside cidr", DebugConfig{Enabled: true, AllowedIPs: "10.0.0.0/8"}, request("192.0.2.1:1", ""), ErrDebugIPNotAllowed},
+	}
+	for _, tc := range cases {
+		err := CheckDebugAuth(tc.c, tc.config)
+		if tc.err == nil {
+			assert.NoError(t, err, tc.name)
+		} else {
+			assert.True(t, errors.Is(err, tc.err), "%s: %v", tc.name, err)
+		}
+	}
+}
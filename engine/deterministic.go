@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"crypto/rand"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// In test mode with a seed, workflow IDs, log IDs, uuid() and
+// crypto_random() come from a seeded generator so a workflow produces the
+// same output on every run. Otherwise they come from crypto/rand.
+var (
+	seededMu   sync.Mutex
+	seededRand *mathrand.Rand
+	seedValue  int64
+)
+
+// seededReader reads from the seeded generator
+type seededReader struct{}
+
+func (seededReader) Read(p []byte) (int, error) {
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	if seededRand == nil {
+		return rand.Read(p)
+	}
+	return seededRand.Read(p)
+}
+
+// configureSeed turns the seeded generator on when enabled and seed is not
+// 0, restarting its sequence
+func configureSeed(enabled bool, seed int64) {
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	seedValue = seed
+	if !enabled || seed == 0 {
+		seededRand = nil
+		return
+	}
+	seededRand = mathrand.New(mathrand.NewSource(seed))
+}
+
+// Reseed restarts the seeded sequence, so the next test case gets the same
+// IDs as the first one. It does nothing when no seed is in use.
+func Reseed() {
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	if seededRand != nil {
+		seededRand = mathrand.New(mathrand.NewSource(seedValue))
+	}
+}
+
+// Seeded reports whether IDs and random bytes come from the seeded generator
+func Seeded() bool {
+	seededMu.Lock()
+	defer seededMu.Unlock()
+	return seededRand != nil
+}
+
+// randomSource is the reader IDs and random bytes are taken from
+func randomSource() io.Reader {
+	if Seeded() {
+		return seededReader{}
+	}
+	return rand.Reader
+}
+
+// NewUUID returns a random UUID (v4), reproducible under a test mode seed
+func NewUUID() string {
+	id, err := uuid.NewRandomFromReader(randomSource())
+	if err != nil {
+		return uuid.New().String()
+	}
+	return id.String()
+}
+
+// readRandom fills buf with random bytes, reproducible under a test mode
+// seed
+func readRandom(buf []byte) error {
+	_, err := io.ReadFull(randomSource(), buf)
+	return err
+}
+
+// testModeSeed returns NFLOW_TEST_SEED when set, [test_mode].seed otherwise
+func testModeSeed(config *ConfigWorkspace) int64 {
+	if seed, err := strconv.ParseInt(os.Getenv("NFLOW_TEST_SEED"), 10, 64); err == nil {
+		return seed
+	}
+	return config.TestModeConfig.Seed
+}
@@ -3,8 +3,11 @@ package engine
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"sync"
@@ -12,19 +15,19 @@ import (
 	"time"
 
 	"github.com/arturoeanton/gocommons/utils"
+	"github.com/arturoeanton/nflow-runtime/audit"
 	"github.com/arturoeanton/nflow-runtime/logger"
 
 	"github.com/arturoeanton/nflow-runtime/model"
 	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/arturoeanton/nflow-runtime/syncsession"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/console"
 	"github.com/dop251/goja_nodejs/require"
 	"github.com/dop251/goja_nodejs/util"
-	"github.com/google/uuid"
 
 	"github.com/gorilla/sessions"
-	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
 
@@ -46,14 +49,22 @@ func getOutputKeys(outputs map[string]*model.Output) []string {
 	if outputs == nil {
 		return []string{"<nil map>"}
 	}
-	keys := make([]string, 0, len(outputs))
-	for k := range outputs {
-		keys = append(keys, k)
-	}
-	if len(keys) == 0 {
+	if len(outputs) == 0 {
 		return []string{"<empty map>"}
 	}
-	return keys
+	return slices.Sorted(maps.Keys(outputs))
+}
+
+// connectedNode returns the node connected to output of node, or "" when
+// the output is missing or has no connection
+func connectedNode(node *model.Node, output string) string {
+	if node == nil {
+		return ""
+	}
+	if o := node.Outputs[output]; o != nil && len(o.Connections) > 0 {
+		return o.Connections[0].Node
+	}
+	return ""
 }
 
 // GetRequireRegistry retorna el registry de require
@@ -85,11 +96,16 @@ func RunWithCallback(cc *model.Controller, c echo.Context, vars model.Vars, next
 func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, endpoint string, uuid1 string, payload goja.Value, fork bool) error {
 
 	var p *process.Process
+	var err error
 
 	// Si es un fork (goroutine), usar contexto aislado
 	if fork {
 		c = NewIsolatedContext(c)
-		p = process.CreateProcessWithCallback(uuid1)
+		p, err = process.TryCreateProcessWithCallback(uuid1, maxActiveProcesses())
+		if err != nil {
+			logger.Errorf("Fork %s rejected: %v", uuid1, err)
+			return err
+		}
 		go func(uuid2 string, currentProcess *process.Process) {
 			data := <-currentProcess.Callback
 			var p map[string]interface{}
@@ -99,14 +115,25 @@ func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, end
 			}
 
 		}(uuid1, p)
+		// Goroutines of forks count for the request that forked them
+		if parent, ok := c.Get(requestProcessKey).(*process.Process); ok {
+			p.SetParent(parent)
+		}
 	} else {
-		p = process.CreateProcess(uuid1)
+		p, err = process.TryCreateProcess(uuid1, maxActiveProcesses())
+		if err != nil {
+			logger.Errorf("Workflow %s rejected: %v", uuid1, err)
+			respondUnavailable(c, "Too many active workflows, retry later")
+			return nil
+		}
+		c.Set(requestProcessKey, p)
 	}
 
 	defer func() {
 		p.SendCallback(`{"error_exit":"exit"}`)
 		p.Close()
 	}()
+	p.SetTags(endpoint, cc.FlowName, GetProfile(c)["username"])
 
 	// Set workflow ID header for tracking
 	if _, isIsolated := c.(*IsolatedContext); !isIsolated {
@@ -116,6 +143,15 @@ func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, end
 			c.Response().Header().Add("Nflow-Wid-1", uuid1)
 			EchoSessionsMutex.Unlock()
 		}
+		if trace := startExecutionTrace(c); trace != nil {
+			defer finishExecutionTrace(c, trace)
+		}
+	}
+
+	// Pin the plugins so a reload does not change them mid-workflow
+	if pluginSet := acquirePlugins(); pluginSet != nil {
+		defer pluginSet.release()
+		c.Set(pluginSetKey, pluginSet)
 	}
 
 	// Use VM from pool for better performance
@@ -126,6 +162,10 @@ func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, end
 	vmInstance, err := vmManager.AcquireVM(c)
 	if err != nil {
 		logger.Errorf("Error acquiring VM from pool: %v", err)
+		if IsTransientError(err) {
+			respondUnavailable(c, "Server busy, retry later")
+			return nil
+		}
 		c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to acquire execution environment"})
 		return nil
 	}
@@ -149,9 +189,16 @@ func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, end
 
 	// Parse and expose POST data to the workflow
 	postData := make(map[string]interface{})
-	c.Bind(&postData)
+	if status, err := bindPostData(c, &postData); err != nil {
+		c.JSON(status, echo.Map{"error": err.Error()})
+		return nil
+	}
 	vm.Set("post_data", postData)
 
+	// Expose query parameters and the other request helpers
+	AddFeatureRequest(vm, c)
+	AddFeatureI18n(vm, c)
+
 	// Set path variables extracted from the URL
 	vm.Set("vars", vars)
 	vm.Set("path_vars", vars)
@@ -162,6 +209,7 @@ func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, end
 	// Provide workflow kill function to allow workflows to terminate other workflows
 	vm.Set("wkill", func(wid string) {
 		process.WKill(wid)
+		recordAudit(c, audit.EventProcessKilled, "workflow:"+uuid1, map[string]interface{}{"wid": wid})
 	})
 
 	// Get the playbook and determine the starting node
@@ -171,9 +219,34 @@ func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, end
 		return nil
 	}
 
+	// Requests resume paused workflows with a signed continuation token
+	if next != "" && !fork {
+		node, err := resolveContinuation(c, next)
+		if err != nil {
+			logger.Infof("Rejected continuation for workflow %s: %v", cc.FlowName, err)
+			respondContinuationError(c, err)
+			return nil
+		}
+		next = node
+	}
+
+	// Multi-step workflows resume against the playbook version they
+	// started with, from the node they paused at, a bounded number of times
+	if next != "" && !fork {
+		pinned, ok := pinnedController(c, cc)
+		if !ok {
+			return nil
+		}
+		cc = pinned
+	}
+
 	pb := *cc.Playbook
 	nodeAuth := pb[next]
 
+	if next != "" && !fork && (!checkResumeNode(c, pb, next) || !countWorkflowHop(c)) {
+		return nil
+	}
+
 	if next == "" {
 		if cc.Start == nil {
 			c.JSON(http.StatusInternalServerError, echo.Map{"error": "Start node not configured."})
@@ -231,50 +304,46 @@ func run(cc *model.Controller, c echo.Context, vars model.Vars, next string, end
 		nodeAuth = cc.Start
 
 		logger.Verbosef("DEBUG: Successfully found next node: %s", next)
+		if !fork {
+			pinPlaybookVersion(c, cc)
+		}
 	}
 
 	// Check if authentication is required for this node. The nflow_auth flag
-	// in node data determines if authentication should be enforced.
+	// in node data determines if authentication should be enforced; nodes
+	// without it never touch the auth session.
 	// No mutex needed since we're working with immutable data
-	flag, hasAuthFlag := nodeAuth.Data["nflow_auth"]
-
-	if hasAuthFlag {
-		flagString, ok := flag.(string)
-		if !ok {
-			flagBool := flag.(bool)
-			if flagBool {
-				flagString = "true"
-			} else {
-				flagString = "false"
-			}
+	if flagString, required := nodeAuthFlag(nodeAuth); required {
+		// Execute authentication from default.js
+		profile := getAuthProfile(c)
+		vm.Set("profile", profile)
+		vm.Set("next", next)
+		vm.Set("auth_flag", flagString)
+		vm.Set("url_access", StripBasePath(c.Request().URL.Path))
+
+		// Get auth code with caching
+		code := getCachedAuthCode()
+		if code == "" {
+			return nil
+		}
+		script := NewScriptSource("auth.js", "", code, "\nauth()")
+		_, err = vm.RunScript(script.Name, script.Code)
+		if err != nil {
+			respondJSError(c, http.StatusInternalServerError, "auth.js", script, err)
+			return nil
 		}
-		if flagString != "false" {
-			// Execute authentication from default.js
-			profile := getAuthProfile(c)
-			vm.Set("profile", profile)
-			vm.Set("next", next)
-			vm.Set("auth_flag", flagString)
-			vm.Set("url_access", c.Request().URL.Path)
-
-			// Get auth code with caching
-			code := getCachedAuthCode()
-			if code == "" {
-				return nil
-			}
-			_, err = vm.RunString(code)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
-				return nil
-			}
 
-			next = vm.Get("next").String()
-			logger.Verbose("Next node:", next)
-			if next == "login" {
-				return c.Redirect(http.StatusTemporaryRedirect, "/nflow_login")
-			}
-			if next == "break" {
-				return nil
-			}
+		next = vm.Get("next").String()
+		logger.Verbose("Next node:", next)
+		if next == "login" {
+			recordAudit(c, audit.EventAuthFailure, profileActor(profile), map[string]interface{}{
+				"path":      StripBasePath(c.Request().URL.Path),
+				"auth_flag": flagString,
+			})
+			return c.Redirect(http.StatusTemporaryRedirect, WithBasePath("/nflow_login"))
+		}
+		if next == "break" {
+			return nil
 		}
 	}
 
@@ -304,7 +373,7 @@ func step(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string, v
 
 		// If it's an isolated context, generate default values
 		if _, isIsolated := c.(*IsolatedContext); isIsolated {
-			logId = uuid.New().String()
+			logId = NewUUID()
 			orderBox = 1
 			return
 		}
@@ -313,23 +382,23 @@ func step(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string, v
 		EchoSessionsMutex.Lock()
 		defer EchoSessionsMutex.Unlock()
 
-		log_session, err := session.Get("log-session", c)
+		log_session, err := syncsession.Manager.GetSession("log-session", c)
 		if err != nil {
 			logger.Error("Error processing node:", err)
 			// En caso de error, usar valores por defecto
-			logId = uuid.New().String()
+			logId = NewUUID()
 			orderBox = 1
 			return
 		}
 		if log_session.Values["log_id"] == nil {
-			log_session.Values["log_id"] = uuid.New().String()
+			log_session.Values["log_id"] = NewUUID()
 			log_session.Values["order_box"] = 0
 		}
 
 		logId = log_session.Values["log_id"].(string)
 		orderBox = log_session.Values["order_box"].(int) + 1
 		log_session.Values["order_box"] = orderBox
-		log_session.Save(c.Request(), c.Response())
+		syncsession.Manager.SaveSession("log-session", c, log_session)
 
 	}()
 
@@ -337,71 +406,31 @@ func step(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string, v
 	var boxId string
 	var boxName string
 	var boxType string
+	attempt := 1
+	var cpuTime time.Duration
 	defer func() {
+		if boxType != "" {
+			observeNode(boxType, time.Since(t1))
+		}
+		traceStep(c, actor, boxId, boxName, boxType, connectionNext, time.Since(t1))
+
 		// Quick exit if tracker is disabled
 		if !IsTrackerEnabled() || trackerChannel == nil {
 			return
 		}
 
-		// Calculate execution time
-		diff := time.Since(t1)
-
-		// Create tracker entry with basic info
-		entry := TrackerEntry{
+		trackStep(c, TrackerEntry{
 			LogId:          logId,
+			WorkflowId:     currentProcess.UUID,
 			BoxId:          boxId,
 			BoxName:        boxName,
 			BoxType:        boxType,
 			ConnectionNext: connectionNext,
-			Diff:           diff,
+			Diff:           time.Since(t1),
+			CPUTime:        cpuTime,
 			OrderBox:       orderBox,
-		}
-
-		// Extract username from profile if available
-		if profile := GetProfile(c); profile != nil {
-			if username, ok := profile["username"]; ok {
-				entry.Username = username
-			}
-		}
-
-		// Marshal payload efficiently
-		if payload != nil {
-			PayloadSessionMutex.Lock()
-			if data, err := json.Marshal(payload.Export()); err == nil {
-				entry.JSONPayload = data
-			} else {
-				entry.JSONPayload = []byte("{}")
-			}
-			PayloadSessionMutex.Unlock()
-		} else {
-			entry.JSONPayload = []byte("{}")
-		}
-
-		// Extract request information safely
-		if req := c.Request(); req != nil {
-			entry.IP = req.RemoteAddr
-			entry.RealIP = c.RealIP()
-			entry.UserAgent = req.UserAgent()
-			entry.Host = req.Host
-
-			if reqURL := req.URL; reqURL != nil {
-				entry.URL = reqURL.RawPath
-				if entry.URL == "" {
-					entry.URL = reqURL.Path
-				}
-				entry.QueryParam = reqURL.Query().Encode()
-				entry.Hostname = reqURL.Hostname()
-			}
-		}
-
-		// Send to tracker channel (non-blocking)
-		select {
-		case trackerChannel <- entry:
-			// Successfully sent
-		default:
-			// Channel full, increment dropped counter
-			atomic.AddInt64(&trackerStats.Dropped, 1)
-		}
+			Attempt:        attempt,
+		}, payload)
 	}()
 	defer func() {
 		err := recover()
@@ -416,21 +445,35 @@ func step(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string, v
 		panic("FlagExit")
 	}
 
-	// Get the actor from the controller playbook
-	pb := *cc.Playbook
-	originalActor := pb[next]
+	// Get the actor from the controller playbook. A connection to a node
+	// missing from the flow, or saved as null, ends the workflow with 422.
+	var originalActor *model.Node
+	if cc.Playbook != nil {
+		originalActor = (*cc.Playbook)[next]
+	}
 
 	if originalActor == nil {
-		logger.Errorf("Node not found: %s", next)
+		logger.Errorf("Node not found: %s in workflow %s", next, cc.FlowName)
+		if !c.Response().Committed {
+			c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "Node not found", "node": next})
+		}
 		return "", nil, fmt.Errorf("node not found: %s", next)
 	}
 
-	// Create a copy to avoid shared state issues
+	// Nodes of cached playbooks are shared between requests, so the step
+	// always works on its own copy
+	copyStart := time.Now()
 	actor, err = originalActor.DeepCopy()
+	observeDeepCopy(time.Since(copyStart))
 	if err != nil {
 		logger.Errorf("Error creating actor copy: %v", err)
-		// If copy fails, use original (with potential race condition risk)
-		actor = originalActor
+		return "", payload, fmt.Errorf("copying node %s: %w", next, err)
+	}
+
+	// Nodes saved without data have no type and end up as unknown nodes,
+	// steps may still write to the data of their copy
+	if actor.Data == nil {
+		actor.Data = make(map[string]interface{})
 	}
 
 	sbLog.WriteString("- IDBox:" + next)
@@ -439,35 +482,93 @@ func step(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string, v
 
 	// Extract node name if available. Since we have a copy of the actor,
 	// we don't need mutex protection for accessing its data.
-	if nameBox, ok := actor.Data["name_box"]; ok {
-		boxName = nameBox.(string)
+	if nameBox, ok := actor.Data["name_box"].(string); ok {
+		boxName = nameBox
 		sbLog.WriteString("- NameBox:" + boxName)
 	}
 
-	currentProcess.Type = ""
-	if pType, ok := actor.Data["type"]; ok {
-		currentProcess.Type = pType.(string)
-	}
+	currentProcess.Type, _ = actor.Data["type"].(string)
 	boxType = currentProcess.Type
 
+	// Nodes switched off by an operator never run
+	if nodeDisabled(next, boxType) {
+		if output := disabledNodeOutput(); output != "" {
+			logger.Infof("Skipping disabled node %s (%s) of workflow %s", next, boxType, cc.FlowName)
+			sbLog.WriteString(" - Skipped: disabled")
+			return connectedNode(actor, output), payload, nil
+		}
+		logger.Errorf("Workflow %s reached disabled node %s (%s)", cc.FlowName, next, boxType)
+		if !c.Response().Committed {
+			c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "Node disabled", "node": next, "type": boxType})
+		}
+		sbLog.WriteString(" - Error: disabled")
+		return "", nil, nil
+	}
+
 	// Execute the node based on its type. Each node type has a specific
 	// implementation in the Steps registry that defines how it should be executed.
 	sbLog.WriteString(" - Type:" + currentProcess.Type)
 	if s, ok := Steps[currentProcess.Type]; ok {
-		connectionNext, payload, err = s.Run(cc, actor, c, vm, connectionNext, vars, currentProcess, payload)
+		// Failed attempts are tracked individually so retries show up in the log
+		onRetry := func(n int, retryErr error) {
+			sbLog.WriteString(" - Retry " + strconv.Itoa(n) + ": " + retryErr.Error())
+			attempt = n + 1
+			if !IsTrackerEnabled() || trackerChannel == nil {
+				return
+			}
+			trackStep(c, TrackerEntry{
+				LogId:          logId,
+				WorkflowId:     currentProcess.UUID,
+				BoxId:          boxId,
+				BoxName:        boxName,
+				BoxType:        boxType,
+				ConnectionNext: "retry_" + strconv.Itoa(n),
+				Diff:           time.Since(t1),
+				OrderBox:       orderBox,
+				Attempt:        n,
+			}, payload)
+		}
+		run := func() {
+			connectionNext, payload, err = runStepWithRetry(s, GetRetryPolicy(actor.Data), onRetry, cc, actor, c, vm, connectionNext, vars, currentProcess, payload)
+		}
+		// CPU time is only measured for the tracker, it locks the goroutine
+		// to its thread while the node runs
+		if IsTrackerEnabled() {
+			cpuTime = measureCPU(run)
+		} else {
+			run()
+		}
 		if err != nil {
 			sbLog.WriteString(" - Error: " + err.Error())
 			return "", nil, nil
 		}
 	} else {
 
+		// A connection into a starter is a mistake in the flow, not a server
+		// error: the response names the node to fix in the designer
 		if currentProcess.Type == "starter" {
-			c.JSON(http.StatusInternalServerError, echo.Map{"error": "Starter can not run with play button"})
+			starterReached.Add(1)
+			logger.Errorf("Workflow %s reached starter node %s through a connection", cc.FlowName, next)
+			c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "Starter can not run with play button", "node": next})
 			sbLog.WriteString(" - Error: Starter can not run with play button")
 			return "", nil, nil
 		}
 
-		c.JSON(http.StatusInternalServerError, echo.Map{"error": "Type node not found", "type": currentProcess.Type})
+		// Usually the plugin providing the type failed to load, so the
+		// response lists the types this instance does have
+		recordUnknownNodeType(currentProcess.Type)
+		if GetConfig().PlaybookConfig.SkipUnknownNodes {
+			logger.Errorf("Skipping node %s of workflow %s: unknown node type %q", next, cc.FlowName, currentProcess.Type)
+			sbLog.WriteString(" - Skipped: Not Found type")
+			return connectedNode(actor, "output_1"), payload, nil
+		}
+		logger.Errorf("Workflow %s reached node %s of unknown type %q", cc.FlowName, next, currentProcess.Type)
+		c.JSON(http.StatusUnprocessableEntity, echo.Map{
+			"error":     "Type node not found",
+			"type":      currentProcess.Type,
+			"node":      next,
+			"available": registeredStepTypes(),
+		})
 		sbLog.WriteString(" - Error: Not Found type")
 		return "", nil, nil
 	}
@@ -504,17 +605,20 @@ func Execute(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string
 		prevBox = next
 
 		wg.Add(1)
+		trackGoroutine(currentProcess)
 		go func() {
 			defer wg.Done()
 
-			payloadMap := make(map[string]interface{})
-
-			if payload != nil {
-				func() {
-					PayloadSessionMutex.Lock()
-					defer PayloadSessionMutex.Unlock()
-					payloadMap = payload.Export().(map[string]interface{})
-				}()
+			var payloadMap map[string]interface{}
+			isObject := false
+			func() {
+				PayloadSessionMutex.Lock()
+				defer PayloadSessionMutex.Unlock()
+				payloadMap, isObject = payloadObject(payload)
+			}()
+			// Arrays, strings and numbers reach the next node unchanged
+			if !isObject {
+				return
 			}
 
 			// Si es un contexto aislado, no acceder a la sesión real
@@ -523,16 +627,11 @@ func Execute(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string
 				defer EchoSessionsMutex.Unlock()
 
 				var s *sessions.Session
-				s, err = session.Get("nflow_form", c)
+				s, err = syncsession.Manager.GetSession("nflow_form", c)
 				if err != nil {
 					logger.Error("Error in start data:", err)
 				} else if s != nil && s.Values != nil {
-					for k, v := range s.Values {
-						if k == "break" {
-							continue
-						}
-						payloadMap[k.(string)] = v
-					}
+					mergeSessionValues(payloadMap, s.Values, payloadMergeStrategy(cc))
 				}
 			}
 
@@ -554,8 +653,9 @@ func Execute(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string
 
 		// cut
 		if payload != nil {
-			if rawPayload, ok := payload.Export().(map[string]interface{}); ok {
+			if rawPayload, ok := payloadObject(payload); ok {
 				wg.Add(1)
+				trackGoroutine(currentProcess)
 				go func() {
 					defer wg.Done()
 
@@ -567,16 +667,19 @@ func Execute(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string
 					EchoSessionsMutex.Lock()
 					defer EchoSessionsMutex.Unlock()
 
-					s, err := session.Get("nflow_form", c)
+					s, err := syncsession.Manager.GetSession("nflow_form", c)
 					if err != nil {
 						logger.Error("Error in start data:", err)
 						return
 					}
 					for k, v := range rawPayload {
+						if isWorkflowStateKey(k) {
+							continue
+						}
 						s.Values[k] = v
 					}
 
-					s.Save(c.Request(), c.Response())
+					syncsession.Manager.SaveSession("nflow_form", c, s)
 				}()
 				wg.Wait()
 
@@ -595,6 +698,20 @@ func Execute(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string
 			}
 		}
 
+		// A redirect from the node ends the workflow once the session is saved
+		if writeRequestedRedirect(c) {
+			break
+		}
+
+	}
+
+	if !fork {
+		recordSimulatedPayload(c, payload)
+	}
+
+	// A paused workflow may only resume from the node it stopped at
+	if next != "" && !fork && err == nil {
+		expectResumeNode(c, next)
 	}
 
 	if next == "" && !fork {
@@ -607,15 +724,13 @@ func Execute(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string
 			EchoSessionsMutex.Lock()
 			defer EchoSessionsMutex.Unlock()
 
-			s, err := session.Get("nflow_form", c)
-			if err != nil {
+			if err := syncsession.Manager.DeleteSession("nflow_form", c); err != nil {
 				logger.Error("Error processing node:", err)
-				return
 			}
-			s.Values = make(map[interface{}]interface{})
-			s.Save(c.Request(), c.Response())
 		}()
 
+		writeDefaultResponse(c)
+
 		currentProcess.State = "end"
 		currentProcess.Killeable = false
 		currentProcess.Close()
@@ -626,7 +741,61 @@ func Execute(cc *model.Controller, c echo.Context, vm *goja.Runtime, next string
 
 // Helper functions for better performance and code organization
 
-// getCachedAuthCode returns the auth.js code with caching to avoid repeated file reads
+// trackStep completes a tracker entry with the request and payload data and
+// sends it to the tracker channel without blocking.
+func trackStep(c echo.Context, entry TrackerEntry, payload goja.Value) {
+	// Extract username from profile if available
+	if profile := GetProfile(c); profile != nil {
+		if username, ok := profile["username"]; ok {
+			entry.Username = username
+		}
+	}
+
+	// Marshal payload efficiently
+	if payload != nil {
+		PayloadSessionMutex.Lock()
+		if data, err := SafeStringifyJSON(payload.Export(), GetJSONLimitsFromConfig()); err == nil {
+			entry.JSONPayload = data
+		} else {
+			entry.JSONPayload = []byte("{}")
+		}
+		PayloadSessionMutex.Unlock()
+	} else {
+		entry.JSONPayload = []byte("{}")
+	}
+
+	// Extract request information safely. Client controlled fields are
+	// capped so large headers or URLs do not pile up in the tracker queue.
+	if req := c.Request(); req != nil {
+		maxBytes := trackerMaxFieldBytes()
+		entry.IP = req.RemoteAddr
+		entry.RealIP = c.RealIP()
+		entry.UserAgent = truncateField(req.UserAgent(), maxBytes)
+		entry.Host = truncateField(req.Host, maxBytes)
+
+		if reqURL := req.URL; reqURL != nil {
+			entry.URL = reqURL.RawPath
+			if entry.URL == "" {
+				entry.URL = reqURL.Path
+			}
+			entry.URL = truncateField(entry.URL, maxBytes)
+			entry.QueryParam = truncateField(reqURL.Query().Encode(), maxBytes)
+			entry.Hostname = truncateField(reqURL.Hostname(), maxBytes)
+		}
+	}
+
+	// Send to tracker channel (non-blocking)
+	select {
+	case trackerChannel <- entry:
+		// Successfully sent
+	default:
+		// Channel full, increment dropped counter
+		atomic.AddInt64(&trackerStats.Dropped, 1)
+	}
+}
+
+// getCachedAuthCode returns the auth.js code with caching to avoid repeated
+// file reads. The caller appends the call of auth().
 func getCachedAuthCode() string {
 	// Check cache with read lock
 	authCodeCache.RLock()
@@ -667,14 +836,39 @@ func getCachedAuthCode() string {
 	}
 
 	// Update cache
-	authCodeCache.code = data + "\nauth()"
+	authCodeCache.code = data
 	authCodeCache.loaded = true
 	authCodeCache.lastCheck = time.Now()
 
 	return authCodeCache.code
 }
 
+// nodeAuthFlag returns the nflow_auth flag of node and whether it requires
+// authentication. Nodes without the flag, or with false, do not; flags of
+// any other type are passed to auth.js as text.
+func nodeAuthFlag(node *model.Node) (string, bool) {
+	if node == nil {
+		return "", false
+	}
+	flag, hasAuthFlag := node.Data["nflow_auth"]
+	if !hasAuthFlag || flag == nil {
+		return "", false
+	}
+	switch flag := flag.(type) {
+	case string:
+		return flag, flag != "false"
+	case bool:
+		if flag {
+			return "true", true
+		}
+		return "false", false
+	}
+	return fmt.Sprint(flag), true
+}
+
 // getAuthProfile extracts the user profile from session with proper locking
+// and stores the requested path as redirect_url for the login page. It is
+// only called for nodes that require authentication.
 func getAuthProfile(c echo.Context) interface{} {
 	// If it's an isolated context, don't access real session
 	if _, isIsolated := c.(*IsolatedContext); isIsolated {
@@ -684,31 +878,27 @@ func getAuthProfile(c echo.Context) interface{} {
 	EchoSessionsMutex.Lock()
 	defer EchoSessionsMutex.Unlock()
 
-	authSession, err := session.Get("auth-session", c)
+	authSession, err := syncsession.Manager.GetSession("auth-session", c)
 	if err != nil {
 		logger.Error("Error in start data:", err)
 		return nil
 	}
 
 	authSession.Values["redirect_url"] = c.Request().URL.Path
-	authSession.Save(c.Request(), c.Response())
+	syncsession.Manager.SaveSession("auth-session", c, authSession)
 
 	return authSession.Values["profile"]
 }
 
 // mergeSessionPayload merges session data with the current payload
 func mergeSessionPayload(c echo.Context, vm *goja.Runtime, payload goja.Value) goja.Value {
-	payloadMap := make(map[string]interface{})
-
 	// Extract existing payload
-	if payload != nil {
-		PayloadSessionMutex.Lock()
-		payloadMap = payload.Export().(map[string]interface{})
-		PayloadSessionMutex.Unlock()
-	}
+	PayloadSessionMutex.Lock()
+	payloadMap, isObject := payloadObject(payload)
+	PayloadSessionMutex.Unlock()
 
-	// Skip session merge for isolated contexts
-	if _, isIsolated := c.(*IsolatedContext); isIsolated {
+	// Skip session merge for isolated contexts and non object payloads
+	if _, isIsolated := c.(*IsolatedContext); isIsolated || !isObject {
 		return payload
 	}
 
@@ -716,15 +906,9 @@ func mergeSessionPayload(c echo.Context, vm *goja.Runtime, payload goja.Value) g
 	EchoSessionsMutex.Lock()
 	defer EchoSessionsMutex.Unlock()
 
-	s, err := session.Get("nflow_form", c)
+	s, err := syncsession.Manager.GetSession("nflow_form", c)
 	if err == nil && s != nil && s.Values != nil {
-		for k, v := range s.Values {
-			if k != "break" {
-				if key, ok := k.(string); ok {
-					payloadMap[key] = v
-				}
-			}
-		}
+		mergeSessionValues(payloadMap, s.Values, payloadMergeStrategy(nil))
 	}
 
 	// Convert back to goja value
@@ -733,13 +917,14 @@ func mergeSessionPayload(c echo.Context, vm *goja.Runtime, payload goja.Value) g
 	return vm.ToValue(payloadMap)
 }
 
-// savePayloadToSession saves the payload to session and returns true if break is requested
+// savePayloadToSession saves the payload to session, except the workflow state
+// kept by the engine, and returns true if break is requested
 func savePayloadToSession(c echo.Context, payload goja.Value) bool {
 	if payload == nil {
 		return false
 	}
 
-	rawPayload, ok := payload.Export().(map[string]interface{})
+	rawPayload, ok := payloadObject(payload)
 	if !ok {
 		return false
 	}
@@ -749,12 +934,15 @@ func savePayloadToSession(c echo.Context, payload goja.Value) bool {
 		EchoSessionsMutex.Lock()
 		defer EchoSessionsMutex.Unlock()
 
-		s, err := session.Get("nflow_form", c)
+		s, err := syncsession.Manager.GetSession("nflow_form", c)
 		if err == nil {
 			for k, v := range rawPayload {
+				if isWorkflowStateKey(k) {
+					continue
+				}
 				s.Values[k] = v
 			}
-			s.Save(c.Request(), c.Response())
+			syncsession.Manager.SaveSession("nflow_form", c, s)
 		}
 	}
 
@@ -781,9 +969,5 @@ func cleanupSession(c echo.Context) {
 	EchoSessionsMutex.Lock()
 	defer EchoSessionsMutex.Unlock()
 
-	s, err := session.Get("nflow_form", c)
-	if err == nil {
-		s.Values = make(map[interface{}]interface{})
-		s.Save(c.Request(), c.Response())
-	}
+	syncsession.Manager.DeleteSession("nflow_form", c)
 }
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteStarterReachedAnswers422(t *testing.T) {
+	var received []interface{}
+	Steps["test_starter_before"] = payloadTestStep{next: "second_start", received: &received}
+	defer delete(Steps, "test_starter_before")
+
+	pb := model.Playbook{
+		"node_1":       &model.Node{Data: map[string]interface{}{"type": "test_starter_before"}},
+		"second_start": &model.Node{Data: map[string]interface{}{"type": "starter", "urlpattern": "/other"}},
+	}
+	c, rec := newTraceTestContext(t, "/", DebugConfig{})
+	p := process.CreateProcess("starter-test")
+	defer p.Close()
+	before := StarterNodeReached()
+
+	Execute(&model.Controller{Playbook: &pb, FlowName: "Home"}, c, goja.New(), "node_1", nil, p, nil, false)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.JSONEq(t, `{"error":"Starter can not run with play button","node":"second_start"}`, rec.Body.String())
+	assert.Equal(t, before+1, StarterNodeReached())
+}
+
+func TestExecuteUnknownNodeType(t *testing.T) {
+	var received []interface{}
+	Steps["test_unknown_end"] = payloadTestStep{received: &received}
+	defer delete(Steps, "test_unknown_end")
+
+	skipped := &model.Output{}
+	skipped.Connections = append(skipped.Connections, struct {
+		Node   string `json:"node"`
+		Output string `json:"output"`
+	}{Node: "node_2", Output: "input_1"})
+	pb := model.Playbook{
+		"node_1": &model.Node{Data: map[string]interface{}{"type": "missing_plugin"}, Outputs: map[string]*model.Output{"output_1": skipped}},
+		"node_2": &model.Node{Data: map[string]interface{}{"type": "test_unknown_end"}},
+	}
+
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	t.Run("answers 422", func(t *testing.T) {
+		received = nil
+		before := UnknownNodeTypes()["missing_plugin"]
+		c, rec := newTraceTestContext(t, "/", DebugConfig{})
+		p := process.CreateProcess("unknown-test")
+		defer p.Close()
+
+		Execute(&model.Controller{Playbook: &pb, FlowName: "Home"}, c, goja.New(), "node_1", nil, p, nil, false)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		var body struct {
+			Error     string   `json:"error"`
+			Type      string   `json:"type"`
+			Node      string   `json:"node"`
+			Available []string `json:"available"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "Type node not found", body.Error)
+		assert.Equal(t, "missing_plugin", body.Type)
+		assert.Equal(t, "node_1", body.Node)
+		assert.Contains(t, body.Available, "js")
+		assert.Contains(t, body.Available, "test_unknown_end")
+		assert.True(t, sort.StringsAreSorted(body.Available))
+		assert.Empty(t, received)
+		assert.Equal(t, before+1, UnknownNodeTypes()["missing_plugin"])
+	})
+
+	t.Run("skips the node when configured", func(t *testing.T) {
+		received = nil
+		cfg := original
+		cfg.PlaybookConfig.SkipUnknownNodes = true
+		repo.SetConfig(cfg)
+		before := UnknownNodeTypes()["missing_plugin"]
+		c, rec := newTraceTestContext(t, "/", DebugConfig{})
+		p := process.CreateProcess("unknown-skip-test")
+		defer p.Close()
+
+		Execute(&model.Controller{Playbook: &pb, FlowName: "Home"}, c, goja.New(), "node_1", nil, p, nil, false)
+
+		assert.NotEqual(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Len(t, received, 1)
+		assert.Equal(t, before+1, UnknownNodeTypes()["missing_plugin"])
+	})
+}
+
+func TestExecuteNilNodes(t *testing.T) {
+	var received []interface{}
+	Steps["test_nil_before"] = payloadTestStep{next: "node_2", received: &received}
+	defer delete(Steps, "test_nil_before")
+
+	cases := map[string]struct {
+		node     *model.Node
+		expected string
+	}{
+		"null node":         {nil, `{"error":"Node not found","node":"node_2"}`},
+		"node without data": {&model.Node{}, `{"error":"Type node not found","type":"","node":"node_2","available":` + availableTypesJSON(t) + `}`},
+		"type not a string": {&model.Node{Data: map[string]interface{}{"type": 42, "name_box": 7}}, `{"error":"Type node not found","type":"","node":"node_2","available":` + availableTypesJSON(t) + `}`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			pb := model.Playbook{
+				"node_1": &model.Node{Data: map[string]interface{}{"type": "test_nil_before"}},
+				"node_2": tc.node,
+			}
+			c, rec := newTraceTestContext(t, "/", DebugConfig{})
+			p := process.CreateProcess("nil-node-test")
+			defer p.Close()
+
+			require.NotPanics(t, func() {
+				Execute(&model.Controller{Playbook: &pb, FlowName: "Home"}, c, goja.New(), "node_1", nil, p, nil, false)
+			})
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+			assert.JSONEq(t, tc.expected, rec.Body.String())
+		})
+	}
+
+	t.Run("missing node", func(t *testing.T) {
+		pb := model.Playbook{"node_1": &model.Node{Data: map[string]interface{}{"type": "test_nil_before"}}}
+		c, rec := newTraceTestContext(t, "/", DebugConfig{})
+		p := process.CreateProcess("nil-node-test")
+		defer p.Close()
+
+		Execute(&model.Controller{Playbook: &pb, FlowName: "Home"}, c, goja.New(), "node_1", nil, p, nil, false)
+		assert.JSONEq(t, `{"error":"Node not found","node":"node_2"}`, rec.Body.String())
+	})
+
+	t.Run("nil playbook", func(t *testing.T) {
+		c, rec := newTraceTestContext(t, "/", DebugConfig{})
+		p := process.CreateProcess("nil-node-test")
+		defer p.Close()
+
+		require.NotPanics(t, func() {
+			Execute(&model.Controller{FlowName: "Home"}, c, goja.New(), "node_1", nil, p, nil, false)
+		})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
+
+func availableTypesJSON(t *testing.T) string {
+	data, err := json.Marshal(registeredStepTypes())
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestConnectedNode(t *testing.T) {
+	connected := &model.Output{}
+	connected.Connections = append(connected.Connections, struct {
+		Node   string `json:"node"`
+		Output string `json:"output"`
+	}{Node: "node_2", Output: "input_1"})
+	node := &model.Node{Outputs: map[string]*model.Output{
+		"output_1": connected,
+		"output_2": {},
+		"output_3": nil,
+	}}
+
+	assert.Equal(t, "node_2", connectedNode(node, "output_1"))
+	assert.Equal(t, "", connectedNode(node, "output_2"), "no connections")
+	assert.Equal(t, "", connectedNode(node, "output_3"), "null output")
+	assert.Equal(t, "", connectedNode(node, "output_4"), "missing output")
+	assert.Equal(t, "", connectedNode(&model.Node{}, "output_1"), "no outputs")
+	assert.Equal(t, "", connectedNode(nil, "output_1"))
+}
+
+// processTagsStep records the tags of the process running it
+type processTagsStep struct {
+	seen *process.Process
+}
+
+func (s processTagsStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	s.seen.Endpoint, s.seen.FlowName, s.seen.Username = currentProcess.Endpoint, currentProcess.FlowName, currentProcess.Username
+	return "", payload, nil
+}
+
+func TestRunTagsProcess(t *testing.T) {
+	useVMManager(t, newTestVMManager(2, nil))
+	repo := GetConfigRepository()
+	previousRedis := repo.GetRedisClient()
+	repo.SetRedisClient(redis.NewClient(&redis.Options{}))
+	t.Cleanup(func() { repo.SetRedisClient(previousRedis) })
+
+	var seen process.Process
+	Steps["test_process_tags"] = processTagsStep{seen: &seen}
+	defer delete(Steps, "test_process_tags")
+
+	output := &model.Output{}
+	output.Connections = append(output.Connections, struct {
+		Node   string `json:"node"`
+		Output string `json:"output"`
+	}{Node: "node_1", Output: "input_1"})
+	start := &model.Node{Data: map[string]interface{}{"type": "starter"}, Outputs: map[string]*model.Output{"output_1": output}}
+	pb := model.Playbook{
+		"start":  start,
+		"node_1": &model.Node{Data: map[string]interface{}{"type": "test_process_tags"}},
+	}
+	c, _ := newTraceTestContext(t, "/orders/42", DebugConfig{})
+	require.NoError(t, run(&model.Controller{Playbook: &pb, Start: start, FlowName: "Orders"}, c, model.Vars{}, "", "/orders/42", uuid.New().String(), nil, false))
+
+	assert.Equal(t, "/orders/42", seen.Endpoint)
+	assert.Equal(t, "Orders", seen.FlowName)
+	assert.Empty(t, seen.Username, "anonymous request")
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/labstack/echo/v4"
+)
+
+// A request with ?nflow_trace=true gets the list of executed nodes in the
+// Nflow-Trace HTTP trailer. It needs the debug endpoints enabled and the
+// debug token (X-Debug-Token or debug_token), like /debug.
+
+// ExecutionTraceHeader is the trailer carrying the JSON encoded trace
+const ExecutionTraceHeader = "Nflow-Trace"
+
+const executionTraceKey = "_execution_trace"
+
+// TraceStep is one executed node
+type TraceStep struct {
+	NodeID     string  `json:"node_id"`
+	Name       string  `json:"name,omitempty"`
+	Type       string  `json:"type"`
+	Output     string  `json:"output,omitempty"` // Output taken, e.g. output_2
+	Next       string  `json:"next,omitempty"`   // Node connected to the output
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// ExecutionTrace collects the steps of a request in execution order
+type ExecutionTrace struct {
+	mu    sync.Mutex
+	steps []TraceStep
+}
+
+// Steps returns a copy of the recorded steps
+func (t *ExecutionTrace) Steps() []TraceStep {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceStep(nil), t.steps...)
+}
+
+func (t *ExecutionTrace) add(step TraceStep) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = append(t.steps, step)
+}
+
+// traceRequested reports whether the request asked for a trace and passes
+// the debug auth
+func traceRequested(c echo.Context) bool {
+	return c.QueryParam("nflow_trace") == "true" && debugAuthorized(c)
+}
+
+// startExecutionTrace attaches a trace to the request when it was asked
+// for. The trailer is declared now because the workflow usually writes the
+// response before it ends.
+func startExecutionTrace(c echo.Context) *ExecutionTrace {
+	if !traceRequested(c) {
+		return nil
+	}
+	trace := &ExecutionTrace{}
+	c.Set(executionTraceKey, trace)
+	c.Response().Header().Add("Trailer", ExecutionTraceHeader)
+	return trace
+}
+
+// finishExecutionTrace sets the trailer with the steps recorded
+func finishExecutionTrace(c echo.Context, trace *ExecutionTrace) {
+	data, err := json.Marshal(trace.Steps())
+	if err != nil {
+		logger.Error("Error encoding execution trace:", err)
+		return
+	}
+	c.Response().Header().Set(ExecutionTraceHeader, string(data))
+}
+
+// GetExecutionTrace returns the trace of the request, nil when not tracing
+func GetExecutionTrace(c echo.Context) *ExecutionTrace {
+	trace, _ := c.Get(executionTraceKey).(*ExecutionTrace)
+	return trace
+}
+
+// traceStep records a finished step when the request is traced
+func traceStep(c echo.Context, actor *model.Node, nodeID, name, nodeType, next string, duration time.Duration) {
+	trace := GetExecutionTrace(c)
+	if trace == nil || nodeID == "" {
+		return
+	}
+	trace.add(TraceStep{
+		NodeID:     nodeID,
+		Name:       name,
+		Type:       nodeType,
+		Output:     outputFor(actor, next),
+		Next:       next,
+		DurationMs: float64(duration.Microseconds()) / 1000,
+	})
+}
+
+// outputFor finds the output of actor connected to next
+func outputFor(actor *model.Node, next string) string {
+	if actor == nil || next == "" {
+		return ""
+	}
+	for _, name := range slices.Sorted(maps.Keys(actor.Outputs)) {
+		output := actor.Outputs[name]
+		if output == nil {
+			continue
+		}
+		for _, conn := range output.Connections {
+			if conn.Node == next {
+				return name
+			}
+		}
+	}
+	return ""
+}
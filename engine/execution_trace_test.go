@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// traceTestStep answers with the next node configured for its type
+type traceTestStep struct {
+	next string
+}
+
+func (s traceTestStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	if s.next == "" {
+		return "", payload, c.JSON(http.StatusOK, echo.Map{"ok": true})
+	}
+	return actor.Outputs[s.next].Connections[0].Node, payload, nil
+}
+
+func newTraceTestContext(t *testing.T, target string, debug DebugConfig) (echo.Context, *httptest.ResponseRecorder) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.DebugConfig = debug
+	repo.SetConfig(config)
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, target, nil), rec)
+	c.Set("_session_store", sessions.NewCookieStore([]byte("trace-test")))
+	return c, rec
+}
+
+func TestExecutionTrace(t *testing.T) {
+	Steps["test_trace_branch"] = traceTestStep{next: "output_2"}
+	Steps["test_trace_end"] = traceTestStep{}
+	defer delete(Steps, "test_trace_branch")
+	defer delete(Steps, "test_trace_end")
+
+	output := func(node string) *model.Output {
+		o := &model.Output{}
+		o.Connections = append(o.Connections, struct {
+			Node   string `json:"node"`
+			Output string `json:"output"`
+		}{Node: node, Output: "input_1"})
+		return o
+	}
+	pb := model.Playbook{
+		"node_1": &model.Node{
+			Data:    map[string]interface{}{"type": "test_trace_branch", "name_box": "check"},
+			Outputs: map[string]*model.Output{"output_1": output("node_3"), "output_2": output("node_2")},
+		},
+		"node_2": &model.Node{Data: map[string]interface{}{"type": "test_trace_end", "name_box": "reply"}},
+	}
+	cc := &model.Controller{Playbook: &pb}
+
+	c, rec := newTraceTestContext(t, "/flow?nflow_trace=true", DebugConfig{Enabled: true, AuthToken: "t0k"})
+	c.Request().Header.Set("X-Debug-Token", "t0k")
+	trace := startExecutionTrace(c)
+	require.NotNil(t, trace)
+
+	p := process.CreateProcess("trace-test")
+	defer p.Close()
+	Execute(cc, c, goja.New(), "node_1", nil, p, nil, false)
+	finishExecutionTrace(c, trace)
+
+	var steps []TraceStep
+	require.NoError(t, json.Unmarshal([]byte(rec.Result().Trailer.Get(ExecutionTraceHeader)), &steps))
+	require.Len(t, steps, 2)
+	assert.Equal(t, "node_1", steps[0].NodeID)
+	assert.Equal(t, "check", steps[0].Name)
+	assert.Equal(t, "test_trace_branch", steps[0].Type)
+	assert.Equal(t, "output_2", steps[0].Output)
+	assert.Equal(t, "node_2", steps[0].Next)
+	assert.Equal(t, "node_2", steps[1].NodeID)
+	assert.Equal(t, "test_trace_end", steps[1].Type)
+	assert.Empty(t, steps[1].Next)
+	assert.GreaterOrEqual(t, steps[0].DurationMs, 0.0)
+}
+
+func TestExecutionTraceRequiresDebugAuth(t *testing.T) {
+	c, _ := newTraceTestContext(t, "/flow?nflow_trace=true", DebugConfig{Enabled: true, AuthToken: "t0k"})
+	assert.Nil(t, startExecutionTrace(c), "missing token")
+
+	c, _ = newTraceTestContext(t, "/flow?nflow_trace=true&debug_token=t0k", DebugConfig{Enabled: false, AuthToken: "t0k"})
+	assert.Nil(t, startExecutionTrace(c), "debug disabled")
+
+	c, _ = newTraceTestContext(t, "/flow?debug_token=t0k", DebugConfig{Enabled: true, AuthToken: "t0k"})
+	assert.Nil(t, startExecutionTrace(c), "not requested")
+
+	c, rec := newTraceTestContext(t, "/flow?nflow_trace=true&debug_token=t0k", DebugConfig{Enabled: true, AuthToken: "t0k"})
+	assert.NotNil(t, startExecutionTrace(c))
+	assert.Equal(t, ExecutionTraceHeader, rec.Header().Get("Trailer"))
+}
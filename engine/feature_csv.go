@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// CSVOptions controls render_csv
+type CSVOptions struct {
+	Delimiter string   // Field separator (default: ",")
+	Header    bool     // Write a header row (default: true; array rows need Columns for it)
+	Columns   []string // Column order and selection for object rows (default: keys of the first rows in order)
+	CRLF      bool     // Terminate lines with \r\n as in RFC 4180 (default: true)
+	Filename  string   // When set, the response is marked as a CSV download with this name
+}
+
+// AddFeatureCSV registers render_csv(rows, options) in the VM. rows is an
+// array of objects or arrays; the CSV text is returned.
+func AddFeatureCSV(vm *goja.Runtime, c echo.Context) {
+	vm.Set("render_csv", func(call goja.FunctionCall) goja.Value {
+		opts := parseCSVOptions(vm, call.Argument(1))
+		out, err := renderCSV(vm, call.Argument(0), opts)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		if opts.Filename != "" {
+			SetResponseContentType(c, "text/csv")
+			c.Response().Header().Set(echo.HeaderContentDisposition,
+				mime.FormatMediaType("attachment", map[string]string{"filename": opts.Filename}))
+		}
+		return vm.ToValue(out)
+	})
+}
+
+func parseCSVOptions(vm *goja.Runtime, value goja.Value) CSVOptions {
+	opts := CSVOptions{Delimiter: ",", Header: true, CRLF: true}
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return opts
+	}
+	obj := value.ToObject(vm)
+
+	if v := obj.Get("delimiter"); v != nil && !goja.IsUndefined(v) {
+		opts.Delimiter = v.String()
+	}
+	if v := obj.Get("header"); v != nil && !goja.IsUndefined(v) {
+		opts.Header = v.ToBoolean()
+	}
+	if v := obj.Get("crlf"); v != nil && !goja.IsUndefined(v) {
+		opts.CRLF = v.ToBoolean()
+	}
+	if v := obj.Get("filename"); v != nil && !goja.IsUndefined(v) {
+		opts.Filename = v.String()
+	}
+	if v := obj.Get("columns"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+		var columns []string
+		if err := vm.ExportTo(v, &columns); err == nil {
+			opts.Columns = columns
+		}
+	}
+	return opts
+}
+
+// renderCSV writes rows as CSV. Object keys keep their JS insertion order.
+func renderCSV(vm *goja.Runtime, rowsValue goja.Value, opts CSVOptions) (string, error) {
+	if rowsValue == nil || goja.IsUndefined(rowsValue) || goja.IsNull(rowsValue) {
+		return "", fmt.Errorf("render_csv expects an array of rows")
+	}
+	rowsObj := rowsValue.ToObject(vm)
+	if rowsObj.ClassName() != "Array" {
+		return "", fmt.Errorf("render_csv expects an array of rows")
+	}
+	length := int(rowsObj.Get("length").ToInteger())
+
+	delimiter, size := utf8.DecodeRuneInString(opts.Delimiter)
+	if size != len(opts.Delimiter) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' {
+		return "", fmt.Errorf("invalid csv delimiter %q", opts.Delimiter)
+	}
+
+	rows := make([]*goja.Object, 0, length)
+	objectRows := false
+	for i := 0; i < length; i++ {
+		row := rowsObj.Get(strconv.Itoa(i)).ToObject(vm)
+		if row.ClassName() != "Array" {
+			objectRows = true
+		}
+		rows = append(rows, row)
+	}
+
+	columns := opts.Columns
+	if objectRows && columns == nil {
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			for _, key := range row.Keys() {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+	w.UseCRLF = opts.CRLF
+
+	if opts.Header && columns != nil {
+		if err := w.Write(columns); err != nil {
+			return "", err
+		}
+	}
+	for _, row := range rows {
+		var record []string
+		if row.ClassName() == "Array" {
+			n := int(row.Get("length").ToInteger())
+			record = make([]string, n)
+			for i := 0; i < n; i++ {
+				record[i] = csvField(row.Get(strconv.Itoa(i)))
+			}
+		} else {
+			record = make([]string, len(columns))
+			for i, column := range columns {
+				record[i] = csvField(row.Get(column))
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// csvField formats a JS value as a CSV field. null and undefined are empty
+// and nested objects are written as JSON.
+func csvField(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return ""
+	}
+	switch exported := v.Export().(type) {
+	case string:
+		return exported
+	case bool:
+		return strconv.FormatBool(exported)
+	case int64:
+		return strconv.FormatInt(exported, 10)
+	case float64:
+		return strconv.FormatFloat(exported, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(exported)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return v.String()
+}
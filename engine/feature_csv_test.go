@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCSVVM() (*goja.Runtime, *httptest.ResponseRecorder) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	vm := goja.New()
+	AddFeatureCSV(vm, c)
+	return vm, rec
+}
+
+func TestRenderCSVQuoting(t *testing.T) {
+	vm, _ := newCSVVM()
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{
+			"objects keep key order",
+			`render_csv([{name: "Ana", age: 30}, {name: "Bob", age: 4.5}])`,
+			"name,age\r\nAna,30\r\nBob,4.5\r\n",
+		},
+		{
+			"delimiters, quotes and newlines are quoted",
+			`render_csv([{text: 'say "hi"', list: "a,b", note: "line1\nline2"}])`,
+			"text,list,note\r\n\"say \"\"hi\"\"\",\"a,b\",\"line1\r\nline2\"\r\n",
+		},
+		{
+			"leading spaces and empty values",
+			`render_csv([[" padded", null, undefined, ""]])`,
+			"\" padded\",,,\r\n",
+		},
+		{
+			"custom delimiter and columns",
+			`render_csv([{a: 1, b: "x;y", c: true}], {delimiter: ";", columns: ["c", "b"], crlf: false})`,
+			"c;b\ntrue;\"x;y\"\n",
+		},
+		{
+			"arrays without header and nested values as JSON",
+			`render_csv([[1, {k: "v"}], [2, [1, 2]]], {header: false})`,
+			"1,\"{\"\"k\"\":\"\"v\"\"}\"\r\n2,\"[1,2]\"\r\n",
+		},
+		{
+			"missing keys are empty",
+			`render_csv([{a: 1}, {b: 2}])`,
+			"a,b\r\n1,\r\n,2\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := vm.RunString(tt.script)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+}
+
+func TestRenderCSVDownloadAndErrors(t *testing.T) {
+	vm, rec := newCSVVM()
+
+	_, err := vm.RunString(`render_csv([{a: 1}], {filename: "report 2024.csv"})`)
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `attachment; filename="report 2024.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+
+	_, err = vm.RunString(`render_csv("not rows")`)
+	assert.Error(t, err)
+	_, err = vm.RunString(`render_csv([{a: 1}], {delimiter: '"'})`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// Standard globals available in every workflow VM:
+//
+//	atob(s)           decodes base64, returns "" when s is not valid base64
+//	btoa(s)           encodes the bytes of s as base64
+//	uuid()            returns a new random UUID (v4), seeded in test mode
+//	now()             returns the current time in milliseconds since the epoch
+//	sleep(ms)         pauses the script, capped by [globals].max_sleep_ms and
+//	                  by the time left to the node (vm_pool.max_execution_seconds)
+//	crypto_random(n)  returns n cryptographically random bytes hex encoded,
+//	                  seeded in test mode ([test_mode].seed)
+//
+// Any of them can be turned off with [globals].disabled.
+
+// nodeDeadlineKey is the echo context key holding the deadline of the
+// script node being run
+const nodeDeadlineKey = "_node_deadline"
+
+const (
+	defaultMaxSleep       = 5 * time.Second
+	defaultMaxRandomBytes = 1024
+)
+
+// AddFeatureGlobals registers the standard globals in the VM
+func AddFeatureGlobals(vm *goja.Runtime, c echo.Context) {
+	config := GetConfig().GlobalsConfig
+
+	maxSleep := defaultMaxSleep
+	if config.MaxSleepMs > 0 {
+		maxSleep = time.Duration(config.MaxSleepMs) * time.Millisecond
+	}
+	maxRandom := defaultMaxRandomBytes
+	if config.MaxRandomBytes > 0 {
+		maxRandom = config.MaxRandomBytes
+	}
+
+	globals := map[string]interface{}{
+		"atob": func(value string) string {
+			if d, err := base64.StdEncoding.DecodeString(value); err == nil {
+				return string(d)
+			}
+			return ""
+		},
+		"btoa": func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		},
+		"uuid": func() string {
+			return NewUUID()
+		},
+		"now": func() int64 {
+			return time.Now().UnixMilli()
+		},
+		"sleep": func(ms int64) {
+			if err := sleepWithDeadline(c, time.Duration(ms)*time.Millisecond, maxSleep); err != nil {
+				panic(vm.NewGoError(err))
+			}
+		},
+		"crypto_random": func(n int) (string, error) {
+			if n <= 0 || n > maxRandom {
+				return "", fmt.Errorf("crypto_random: size must be between 1 and %d", maxRandom)
+			}
+			buf := make([]byte, n)
+			if err := readRandom(buf); err != nil {
+				return "", err
+			}
+			return hex.EncodeToString(buf), nil
+		},
+	}
+
+	for _, name := range config.Disabled {
+		delete(globals, name)
+	}
+	for name, fx := range globals {
+		vm.Set(name, fx)
+	}
+}
+
+// setNodeDeadline records when the node being run must finish so blocking
+// globals such as sleep do not outlive it
+func setNodeDeadline(c echo.Context) {
+	limit := GetLimitsFromConfig().MaxExecutionTime
+	if limit > 0 {
+		c.Set(nodeDeadlineKey, time.Now().Add(limit))
+	}
+}
+
+// sleepWithDeadline sleeps d, capped by maxSleep. It fails with
+// ErrTimeLimitExceeded when the node deadline is reached first and stops
+// early when the request is cancelled.
+func sleepWithDeadline(c echo.Context, d, maxSleep time.Duration) error {
+	if d > maxSleep {
+		d = maxSleep
+	}
+	var exceeded bool
+	if deadline, ok := c.Get(nodeDeadlineKey).(time.Time); ok {
+		if remaining := time.Until(deadline); remaining < d {
+			d, exceeded = remaining, true
+		}
+	}
+
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.Request().Context().Done():
+			return c.Request().Context().Err()
+		}
+	}
+	if exceeded {
+		return ErrTimeLimitExceeded
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGlobalsVM(t *testing.T, config GlobalsConfig) (*goja.Runtime, echo.Context) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+
+	updated := original
+	updated.GlobalsConfig = config
+	repo.SetConfig(updated)
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	vm := goja.New()
+	AddFeatureGlobals(vm, c)
+	return vm, c
+}
+
+func TestFeatureGlobals_Functional(t *testing.T) {
+	vm, _ := newGlobalsVM(t, GlobalsConfig{})
+
+	for _, name := range []string{"atob", "btoa", "uuid", "now", "sleep", "crypto_random"} {
+		v := vm.Get(name)
+		require.NotNil(t, v, name)
+		_, ok := goja.AssertFunction(v)
+		assert.True(t, ok, "%s should be a function", name)
+	}
+
+	v, err := vm.RunString(`atob(btoa("Hello, World!"))`)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, World!", v.String())
+
+	v, err = vm.RunString(`btoa("Hello, World!")`)
+	require.NoError(t, err)
+	assert.Equal(t, "SGVsbG8sIFdvcmxkIQ==", v.String())
+
+	v, err = vm.RunString(`uuid() !== uuid()`)
+	require.NoError(t, err)
+	assert.True(t, v.ToBoolean(), "uuid() must return a new value on each call")
+	v, _ = vm.RunString(`uuid()`)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), v.String())
+
+	before := time.Now().UnixMilli()
+	v, err = vm.RunString(`now()`)
+	require.NoError(t, err)
+	assert.InDelta(t, before, v.ToInteger(), 1000)
+
+	v, err = vm.RunString(`crypto_random(16)`)
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{32}$`), v.String())
+
+	_, err = vm.RunString(`crypto_random(4096)`)
+	assert.Error(t, err)
+
+	start := time.Now()
+	_, err = vm.RunString(`sleep(20)`)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestFeatureGlobals_SleepLimits(t *testing.T) {
+	vm, c := newGlobalsVM(t, GlobalsConfig{MaxSleepMs: 50})
+
+	start := time.Now()
+	_, err := vm.RunString(`sleep(60000)`)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "sleep is capped by max_sleep_ms")
+
+	// The node deadline wins over the requested time and fails the script
+	c.Set(nodeDeadlineKey, time.Now().Add(10*time.Millisecond))
+	start = time.Now()
+	_, err = vm.RunString(`sleep(500)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrTimeLimitExceeded.Error())
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestFeatureGlobals_Disabled(t *testing.T) {
+	vm, _ := newGlobalsVM(t, GlobalsConfig{Disabled: []string{"sleep", "uuid"}})
+
+	assert.Nil(t, vm.Get("sleep"))
+	assert.Nil(t, vm.Get("uuid"))
+	assert.NotNil(t, vm.Get("btoa"))
+}
+
+func TestFeatureGlobals_SeededInTestMode(t *testing.T) {
+	configureSeed(true, 42)
+	defer configureSeed(false, 0)
+
+	vm, _ := newGlobalsVM(t, GlobalsConfig{})
+	run := func() []string {
+		Reseed()
+		var out []string
+		for _, script := range []string{`uuid()`, `uuid()`, `crypto_random(8)`} {
+			v, err := vm.RunString(script)
+			require.NoError(t, err)
+			out = append(out, v.String())
+		}
+		out = append(out, NewUUID())
+		return out
+	}
+
+	first := run()
+	assert.Equal(t, first, run(), "the same seed must produce the same IDs")
+	assert.NotEqual(t, first[0], first[1])
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), first[0])
+
+	configureSeed(true, 7)
+	assert.NotEqual(t, first[0], NewUUID(), "another seed must produce other IDs")
+
+	// Outside test mode the seed is ignored
+	configureSeed(false, 42)
+	assert.False(t, Seeded())
+	assert.NotEqual(t, NewUUID(), NewUUID())
+}
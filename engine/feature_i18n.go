@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"github.com/arturoeanton/nflow-runtime/i18n"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// Internationalization helpers available in every workflow VM:
+//
+//	locale                the catalog locale matching the Accept-Language
+//	                      header, [i18n].default_locale when none matches
+//	t(key, args, locale)  the message of key in locale (default: the
+//	                      request locale) with {name} placeholders replaced
+//	                      from args; falls back to the base language, the
+//	                      default locale and finally the key itself
+//
+// Pass locale to render_template({engine: "go", locale: locale, ...}) so
+// {{t "key"}} in the template uses the request language.
+
+// AddFeatureI18n registers the i18n helpers in the VM
+func AddFeatureI18n(vm *goja.Runtime, c echo.Context) {
+	catalog := i18n.Default()
+	locale := catalog.Match(c.Request().Header.Get("Accept-Language"))
+	vm.Set("locale", locale)
+
+	vm.Set("t", func(call goja.FunctionCall) goja.Value {
+		key := call.Argument(0).String()
+		var args map[string]interface{}
+		if value := call.Argument(1); !goja.IsUndefined(value) && !goja.IsNull(value) {
+			args, _ = value.Export().(map[string]interface{})
+		}
+		target := locale
+		if value := call.Argument(2); !goja.IsUndefined(value) && !goja.IsNull(value) && value.String() != "" {
+			target = value.String()
+		}
+		return vm.ToValue(catalog.Translate(target, key, args))
+	})
+}
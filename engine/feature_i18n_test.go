@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/i18n"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureI18n(t *testing.T) {
+	catalog := i18n.NewCatalog("en")
+	catalog.Add("en", map[string]string{"greeting": "Hello {name}", "bye": "Bye"})
+	catalog.Add("es", map[string]string{"greeting": "Hola {name}"})
+	previous := i18n.SetDefault(catalog)
+	t.Cleanup(func() { i18n.SetDefault(previous) })
+
+	run := func(acceptLanguage, script string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		vm := goja.New()
+		AddFeatureI18n(vm, echo.New().NewContext(req, httptest.NewRecorder()))
+		v, err := vm.RunString(script)
+		require.NoError(t, err)
+		return v.String()
+	}
+
+	assert.Equal(t, "es", run("es-AR,es;q=0.9", `locale`))
+	assert.Equal(t, "Hola Ana", run("es-AR,es;q=0.9", `t("greeting", {name: "Ana"})`))
+	assert.Equal(t, "Bye", run("es", `t("bye")`), "missing keys fall back to the default locale")
+	assert.Equal(t, "Hello Ana", run("", `t("greeting", {name: "Ana"})`))
+	assert.Equal(t, "en", run("fr", `locale`))
+	assert.Equal(t, "Hello Ana", run("es", `t("greeting", {name: "Ana"}, "en")`), "an explicit locale wins over the header")
+	assert.Equal(t, "Hola {name}", run("en", `t("greeting", null, "es")`))
+}
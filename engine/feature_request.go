@@ -0,0 +1,301 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// Request helpers available in every workflow VM:
+//
+//	query            the query parameters, a string or, when repeated, a
+//	                 list of strings, e.g. query.page for ?page=2
+//	headers          the request headers by lower case name, repeated
+//	                 values joined with ", "
+//	get_header(name) one header, case insensitive, "" when missing
+//	get_cookie(name) a request cookie, "" when missing; sees the cookies
+//	                 set or deleted earlier in the same request
+//	set_cookie(name, value, options)
+//	                 sets a cookie. options: path ("/"), domain, max_age
+//	                 (seconds, 0 = session), secure (false), http_only
+//	                 (true), same_site ("lax", "strict" or "none")
+//	delete_cookie(name, options)
+//	                 expires a cookie; path and domain must match set_cookie
+//	set_status(code) the status of the response: replaces the 200 of a
+//	                 later body writing call and is answered, with no body,
+//	                 when the workflow ends without writing a response
+//	redirect(url, permanent)
+//	                 stops the workflow after the current node and answers
+//	                 with a redirect: 301 when permanent, otherwise 302 for
+//	                 GET and HEAD and 307 for the other methods
+//
+// With [request].mask_sensitive_headers the values of the sensitive
+// headers (Authorization, Cookie...) read as maskedHeaderValue.
+
+const maskedHeaderValue = "[REDACTED]"
+
+// responseStatusKey is the echo context key holding the status set with
+// set_status
+const responseStatusKey = "_response_status"
+
+// redirectKey is the echo context key holding the redirect requested with
+// redirect(url, permanent)
+const redirectKey = "_redirect"
+
+type redirectTarget struct {
+	status int
+	url    string
+}
+
+var defaultSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Debug-Token"}
+
+// AddFeatureRequest registers the request helpers in the VM
+func AddFeatureRequest(vm *goja.Runtime, c echo.Context) {
+	vm.Set("query", queryParams(c))
+
+	headers := requestHeaders(c.Request().Header, GetConfig().RequestConfig)
+	vm.Set("headers", headers)
+	vm.Set("get_header", func(name string) string {
+		return headers[strings.ToLower(name)]
+	})
+
+	addCookieHelpers(vm, c)
+
+	vm.Set("set_status", func(code int) error {
+		return setResponseStatus(c, code)
+	})
+
+	vm.Set("redirect", func(target string, permanent bool) error {
+		return requestRedirect(c, target, permanent)
+	})
+}
+
+// requestRedirect validates target and records the redirect; Execute
+// writes it once the node ends and the session is saved
+func requestRedirect(c echo.Context, target string, permanent bool) error {
+	if target == "" || strings.ContainsAny(target, "\r\n") {
+		return fmt.Errorf("redirect: invalid url %q", target)
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("redirect: invalid url %q", target)
+	}
+
+	status := http.StatusFound
+	switch method := c.Request().Method; {
+	case permanent:
+		status = http.StatusMovedPermanently
+	case method != http.MethodGet && method != http.MethodHead:
+		status = http.StatusTemporaryRedirect
+	}
+	c.Set(redirectKey, redirectTarget{status: status, url: target})
+	return nil
+}
+
+// writeRequestedRedirect answers with the redirect requested by the node
+// that just ran. It reports whether the workflow must stop.
+func writeRequestedRedirect(c echo.Context) bool {
+	target, ok := c.Get(redirectKey).(redirectTarget)
+	if !ok {
+		return false
+	}
+	c.Set(redirectKey, nil)
+	if !c.Response().Committed {
+		c.Redirect(target.status, target.url)
+	}
+	return true
+}
+
+// setResponseStatus records the status for the response. Error and
+// redirect statuses written by the engine or the node are kept.
+func setResponseStatus(c echo.Context, code int) error {
+	if code < 100 || code > 599 {
+		return fmt.Errorf("set_status: invalid HTTP status %d", code)
+	}
+	if c.Response().Committed {
+		return fmt.Errorf("set_status: response already sent")
+	}
+	if _, ok := c.Get(responseStatusKey).(int); !ok {
+		c.Response().Before(func() {
+			if status, ok := c.Get(responseStatusKey).(int); ok && c.Response().Status == http.StatusOK {
+				c.Response().Status = status
+			}
+		})
+	}
+	c.Set(responseStatusKey, code)
+	return nil
+}
+
+// writeDefaultResponse answers with the status set with set_status when
+// the workflow ended without writing a response
+func writeDefaultResponse(c echo.Context) {
+	if status, ok := c.Get(responseStatusKey).(int); ok && !c.Response().Committed {
+		c.NoContent(status)
+	}
+}
+
+// addCookieHelpers registers get_cookie, set_cookie and delete_cookie.
+// Invalid names, values or options throw in the script.
+func addCookieHelpers(vm *goja.Runtime, c echo.Context) {
+	// Cookies written during the request, nil when deleted
+	written := make(map[string]*http.Cookie)
+
+	vm.Set("get_cookie", func(name string) string {
+		if cookie, ok := written[name]; ok {
+			if cookie == nil {
+				return ""
+			}
+			return cookie.Value
+		}
+		if cookie, err := c.Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	})
+
+	vm.Set("set_cookie", func(call goja.FunctionCall) goja.Value {
+		cookie, err := newCookie(call.Argument(0).String(), call.Argument(1).String(), exportOptions(call.Argument(2)))
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		c.SetCookie(cookie)
+		written[cookie.Name] = cookie
+		return goja.Undefined()
+	})
+
+	vm.Set("delete_cookie", func(call goja.FunctionCall) goja.Value {
+		cookie, err := newCookie(call.Argument(0).String(), "", exportOptions(call.Argument(1)))
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		cookie.MaxAge = -1
+		c.SetCookie(cookie)
+		written[cookie.Name] = nil
+		return goja.Undefined()
+	})
+}
+
+func exportOptions(value goja.Value) map[string]interface{} {
+	if goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil
+	}
+	options, _ := value.Export().(map[string]interface{})
+	return options
+}
+
+// newCookie builds a cookie from the set_cookie arguments
+func newCookie(name, value string, options map[string]interface{}) (*http.Cookie, error) {
+	if !validCookieName(name) {
+		return nil, fmt.Errorf("invalid cookie name %q", name)
+	}
+	if !validCookieValue(value) {
+		return nil, fmt.Errorf("invalid value for cookie %s, encode it with encodeURIComponent", name)
+	}
+
+	cookie := &http.Cookie{Name: name, Value: value, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	for key, option := range options {
+		switch key {
+		case "path":
+			cookie.Path = fmt.Sprint(option)
+		case "domain":
+			cookie.Domain = fmt.Sprint(option)
+		case "max_age":
+			maxAge, ok := option.(int64)
+			if f, isFloat := option.(float64); isFloat {
+				maxAge, ok = int64(f), true
+			}
+			if !ok || maxAge < 0 {
+				return nil, fmt.Errorf("cookie %s: max_age must be a number of seconds", name)
+			}
+			cookie.MaxAge = int(maxAge)
+		case "secure":
+			cookie.Secure = option == true
+		case "http_only":
+			cookie.HttpOnly = option == true
+		case "same_site":
+			switch strings.ToLower(fmt.Sprint(option)) {
+			case "lax":
+				cookie.SameSite = http.SameSiteLaxMode
+			case "strict":
+				cookie.SameSite = http.SameSiteStrictMode
+			case "none":
+				cookie.SameSite = http.SameSiteNoneMode
+			default:
+				return nil, fmt.Errorf("cookie %s: same_site must be lax, strict or none", name)
+			}
+		default:
+			return nil, fmt.Errorf("cookie %s: unknown option %s", name, key)
+		}
+	}
+	if cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure {
+		return nil, fmt.Errorf("cookie %s: same_site none requires secure", name)
+	}
+	return cookie, nil
+}
+
+// validCookieName checks name is an RFC 6265 token
+func validCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`()<>@,;:\"/[]?={}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validCookieValue checks value only has RFC 6265 cookie-octets
+func validCookieValue(value string) bool {
+	for _, r := range value {
+		if r <= ' ' || r >= 0x7f || r == '"' || r == ',' || r == ';' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// queryParams returns the query string with the same shape as post_data:
+// single values are strings, repeated keys are lists
+func queryParams(c echo.Context) map[string]interface{} {
+	query := make(map[string]interface{})
+	for key, values := range c.QueryParams() {
+		if len(values) == 1 {
+			query[key] = values[0]
+			continue
+		}
+		query[key] = values
+	}
+	return query
+}
+
+// requestHeaders flattens header by lower case name, masking the sensitive
+// ones when configured
+func requestHeaders(header http.Header, config RequestConfig) map[string]string {
+	sensitive := make(map[string]bool)
+	if config.MaskSensitiveHeaders {
+		names := config.SensitiveHeaders
+		if len(names) == 0 {
+			names = defaultSensitiveHeaders
+		}
+		for _, name := range names {
+			sensitive[strings.ToLower(name)] = true
+		}
+	}
+
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		key := strings.ToLower(name)
+		if sensitive[key] {
+			headers[key] = maskedHeaderValue
+			continue
+		}
+		headers[key] = strings.Join(values, ", ")
+	}
+	return headers
+}
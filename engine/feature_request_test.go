@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequestVM(t *testing.T, req *http.Request) (*goja.Runtime, echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	vm := goja.New()
+	AddFeatureRequest(vm, c)
+	return vm, c, rec
+}
+
+func TestFeatureRequestQuery(t *testing.T) {
+	vm, _, _ := newRequestVM(t, httptest.NewRequest(http.MethodGet, "/orders?page=2&tag=a&tag=b&q=caf%C3%A9", nil))
+
+	v, err := vm.RunString(`query.page`)
+	require.NoError(t, err)
+	assert.Equal(t, "2", v.String())
+
+	v, err = vm.RunString(`query.tag.length + ":" + query.tag[1]`)
+	require.NoError(t, err)
+	assert.Equal(t, "2:b", v.String())
+
+	v, err = vm.RunString(`query.q`)
+	require.NoError(t, err)
+	assert.Equal(t, "café", v.String())
+
+	v, err = vm.RunString(`query.missing === undefined`)
+	require.NoError(t, err)
+	assert.True(t, v.ToBoolean())
+}
+
+func TestFeatureRequestHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant-Id", "acme")
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+
+	vm, _, _ := newRequestVM(t, req)
+
+	v, err := vm.RunString(`get_header("x-tenant-id") + "|" + headers["x-tenant-id"] + "|" + headers.accept`)
+	require.NoError(t, err)
+	assert.Equal(t, "acme|acme|text/html, application/json", v.String())
+
+	v, err = vm.RunString(`get_header("Authorization")`)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer s3cr3t", v.String(), "not masked by default")
+
+	v, err = vm.RunString(`get_header("X-Missing")`)
+	require.NoError(t, err)
+	assert.Equal(t, "", v.String())
+}
+
+func TestFeatureRequestMaskedHeaders(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+	config := original
+	config.RequestConfig = RequestConfig{MaskSensitiveHeaders: true}
+	repo.SetConfig(config)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	req.Header.Set("Cookie", "sid=1")
+	req.Header.Set("X-Tenant-Id", "acme")
+	vm, _, _ := newRequestVM(t, req)
+
+	v, err := vm.RunString(`[get_header("authorization"), headers.cookie, get_header("X-Tenant-Id")].join("|")`)
+	require.NoError(t, err)
+	assert.Equal(t, maskedHeaderValue+"|"+maskedHeaderValue+"|acme", v.String())
+
+	config.RequestConfig = RequestConfig{MaskSensitiveHeaders: true, SensitiveHeaders: []string{"X-Tenant-Id"}}
+	repo.SetConfig(config)
+	vm, _, _ = newRequestVM(t, req)
+	v, err = vm.RunString(`get_header("authorization") + "|" + get_header("x-tenant-id")`)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer s3cr3t|"+maskedHeaderValue, v.String())
+}
+
+func TestFeatureRequestClearedOnRelease(t *testing.T) {
+	manager := newTestVMManager(1, &VMPoolConfig{PreloadSize: 1})
+	req := httptest.NewRequest(http.MethodGet, "/?page=1", nil)
+	req.Header.Set("X-Tenant-Id", "acme")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	instance, err := manager.AcquireVM(c)
+	require.NoError(t, err)
+	AddFeatureRequest(instance.VM, c)
+	manager.ReleaseVM(instance)
+
+	instance, err = manager.AcquireVM(createTestContext())
+	require.NoError(t, err)
+	defer manager.ReleaseVM(instance)
+	for _, key := range []string{"query", "headers", "get_header"} {
+		val := instance.VM.Get(key)
+		assert.True(t, val == nil || goja.IsUndefined(val), "%s should be cleared", key)
+	}
+}
+
+func TestFeatureRequestCookies(t *testing.T) {
+	// First request: a node sets the cookies, a later node reads them back
+	vm, _, rec := newRequestVM(t, httptest.NewRequest(http.MethodGet, "/login", nil))
+	v, err := vm.RunString(`
+		set_cookie("session", "abc123", {max_age: 3600, secure: true, same_site: "strict"});
+		set_cookie("theme", "dark", {http_only: false, path: "/app"});
+		get_cookie("session") + "|" + get_cookie("theme")`)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123|dark", v.String())
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, 3600, cookies[0].MaxAge)
+	assert.True(t, cookies[0].Secure)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+	assert.Equal(t, "/app", cookies[1].Path)
+	assert.False(t, cookies[1].HttpOnly)
+
+	// Next request sends the cookie back
+	req := httptest.NewRequest(http.MethodGet, "/home", nil)
+	req.AddCookie(cookies[0])
+	vm, _, rec = newRequestVM(t, req)
+	v, err = vm.RunString(`var before = get_cookie("session"); delete_cookie("session"); before + "|" + get_cookie("session") + "|" + get_cookie("missing")`)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123||", v.String())
+	deleted := rec.Result().Cookies()
+	require.Len(t, deleted, 1)
+	assert.Equal(t, -1, deleted[0].MaxAge)
+}
+
+func TestFeatureRequestCookieValidation(t *testing.T) {
+	vm, _, rec := newRequestVM(t, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	for _, script := range []string{
+		`set_cookie("", "v")`,
+		`set_cookie("bad name", "v")`,
+		`set_cookie("a;b", "v")`,
+		`set_cookie("name", "a;b=c")`,
+		`set_cookie("name", "with space")`,
+		`set_cookie("name", "v", {same_site: "none"})`,
+		`set_cookie("name", "v", {same_site: "sometimes"})`,
+		`set_cookie("name", "v", {max_age: -5})`,
+		`set_cookie("name", "v", {expires_in: 5})`,
+	} {
+		_, err := vm.RunString(script)
+		assert.Error(t, err, script)
+	}
+	assert.Empty(t, rec.Result().Cookies())
+
+	_, err := vm.RunString(`set_cookie("name", encodeURIComponent("a;b c"), {same_site: "none", secure: true})`)
+	assert.NoError(t, err)
+}
+
+func TestFeatureRequestSetStatus(t *testing.T) {
+	vm, c, rec := newRequestVM(t, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	_, err := vm.RunString(`set_status(201)`)
+	require.NoError(t, err)
+	require.NoError(t, c.JSON(http.StatusOK, echo.Map{"id": 7}))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"id":7}`, rec.Body.String())
+
+	// Errors written after set_status keep their own status
+	vm, c, rec = newRequestVM(t, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	_, err = vm.RunString(`set_status(201)`)
+	require.NoError(t, err)
+	require.NoError(t, c.JSON(http.StatusInternalServerError, echo.Map{"error": "boom"}))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	for _, script := range []string{`set_status(99)`, `set_status(600)`, `set_status("abc")`} {
+		_, err = vm.RunString(script)
+		assert.Error(t, err, script)
+	}
+}
+
+// statusTestStep sets the status from the node script and writes no body
+type statusTestStep struct{}
+
+func (statusTestStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	_, err := vm.RunString(`set_status(422)`)
+	return "", payload, err
+}
+
+func TestExecuteAnswersWithSetStatus(t *testing.T) {
+	Steps["test_set_status"] = statusTestStep{}
+	defer delete(Steps, "test_set_status")
+
+	pb := model.Playbook{"node_1": &model.Node{Data: map[string]interface{}{"type": "test_set_status"}}}
+	c, rec := newTraceTestContext(t, "/validate", DebugConfig{})
+	vm := goja.New()
+	AddFeatureRequest(vm, c)
+
+	p := process.CreateProcess("status-test")
+	defer p.Close()
+	Execute(&model.Controller{Playbook: &pb}, c, vm, "node_1", nil, p, nil, false)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+// redirectTestStep redirects from the node script and goes on to node_2
+type redirectTestStep struct{}
+
+func (redirectTestStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	_, err := vm.RunString(`redirect("/thanks?order=7", false)`)
+	return "node_2", payload, err
+}
+
+func TestExecuteStopsOnRedirect(t *testing.T) {
+	Steps["test_redirect"] = redirectTestStep{}
+	Steps["test_trace_end"] = traceTestStep{}
+	defer delete(Steps, "test_redirect")
+	defer delete(Steps, "test_trace_end")
+
+	pb := model.Playbook{
+		"node_1": &model.Node{Data: map[string]interface{}{"type": "test_redirect"}},
+		"node_2": &model.Node{Data: map[string]interface{}{"type": "test_trace_end"}},
+	}
+	c, rec := newTraceTestContext(t, "/checkout", DebugConfig{})
+	vm := goja.New()
+	AddFeatureRequest(vm, c)
+
+	p := process.CreateProcess("redirect-test")
+	defer p.Close()
+	Execute(&model.Controller{Playbook: &pb}, c, vm, "node_1", nil, p, nil, false)
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/thanks?order=7", rec.Header().Get(echo.HeaderLocation))
+	assert.NotContains(t, rec.Body.String(), "ok", "the workflow stops at the redirect")
+	assert.Contains(t, strings.Join(rec.Header().Values("Set-Cookie"), ";"), "nflow_form=", "session saved before redirecting")
+}
+
+func TestFeatureRequestRedirectStatus(t *testing.T) {
+	cases := []struct {
+		method    string
+		permanent bool
+		status    int
+	}{
+		{http.MethodGet, false, http.StatusFound},
+		{http.MethodGet, true, http.StatusMovedPermanently},
+		{http.MethodPost, false, http.StatusTemporaryRedirect},
+	}
+	for _, tc := range cases {
+		vm, c, rec := newRequestVM(t, httptest.NewRequest(tc.method, "/", nil))
+		_, err := vm.RunString(`redirect("https://example.com/next", ` + strconv.FormatBool(tc.permanent) + `)`)
+		require.NoError(t, err)
+		assert.True(t, writeRequestedRedirect(c))
+		assert.Equal(t, tc.status, rec.Code, "%s permanent=%v", tc.method, tc.permanent)
+		assert.Equal(t, "https://example.com/next", rec.Header().Get(echo.HeaderLocation))
+		assert.False(t, writeRequestedRedirect(c), "the redirect is written once")
+	}
+
+	vm, _, _ := newRequestVM(t, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, script := range []string{`redirect("")`, `redirect("javascript:alert(1)")`, `redirect("/a\r\nSet-Cookie: x=1")`} {
+		_, err := vm.RunString(script)
+		assert.Error(t, err, script)
+	}
+}
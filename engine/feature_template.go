@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/arturoeanton/nflow-runtime/logger"
 	"github.com/dop251/goja"
@@ -152,6 +153,7 @@ func getTemplateFromDB(paramName string) (string, bool) {
 	}
 	defer conn.Close()
 	config := GetConfig()
+	start := time.Now()
 	row := conn.QueryRowContext(context.Background(), config.DatabaseNflow.QueryGetTemplate, paramName)
 
 	var id int
@@ -159,6 +161,7 @@ func getTemplateFromDB(paramName string) (string, bool) {
 	var content string
 
 	err = row.Scan(&id, &name, &content)
+	observeQuery("template_load", config.DatabaseNflow.QueryGetTemplate, start)
 	if err != nil {
 		log.Println(err)
 		return "", false
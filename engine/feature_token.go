@@ -23,6 +23,7 @@ func GetTokenFromDB(paramName string) []map[string]interface{} {
 	}
 	defer conn.Close()
 	config := GetConfig()
+	defer observeQuery("token_load", config.DatabaseNflow.QueryGetToken, time.Now())
 	rows, err := conn.QueryContext(context.Background(), config.DatabaseNflow.QueryGetToken, paramName)
 	if err != nil {
 		log.Println(err)
@@ -6,7 +6,9 @@ import (
 	"crypto/subtle"
 	"encoding/hex"
 	"log"
+	"time"
 
+	"github.com/arturoeanton/nflow-runtime/audit"
 	"github.com/dop251/goja"
 	"github.com/labstack/echo/v4"
 )
@@ -45,6 +47,7 @@ func GetUserFromDB(paramUsername string) map[string]interface{} {
 	}
 	defer conn.Close()
 	config := GetConfig()
+	defer observeQuery("user_load", config.DatabaseNflow.QueryGetUser, time.Now())
 	rows, err := conn.QueryContext(context.Background(), config.DatabaseNflow.QueryGetUser, paramUsername)
 	if err != nil {
 		log.Println(err)
@@ -96,7 +99,11 @@ func ValidateUserDB(username string, password string) bool {
 
 func AddFeatureUsers(vm *goja.Runtime, c echo.Context) {
 	vm.Set("validate_user", func(username string, password string) bool {
-		return ValidateUserDB(username, password)
+		valid := ValidateUserDB(username, password)
+		if !valid {
+			recordAudit(c, audit.EventAuthFailure, username, map[string]interface{}{"reason": "invalid credentials"})
+		}
+		return valid
 	})
 	vm.Set("get_user", func(username string) map[string]interface{} {
 		return GetUserFromDB(username)
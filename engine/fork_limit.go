@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrForkLimitReached is returned by a gorutine node when
+// vm_pool.max_concurrent_forks forked workflows are already running
+var ErrForkLimitReached = errors.New("concurrent fork limit reached")
+
+const defaultMaxConcurrentForks = 100
+
+var (
+	activeForks   atomic.Int64
+	rejectedForks atomic.Int64
+)
+
+// ForkStats returns the forked workflows running and the ones rejected
+// since startup
+func ForkStats() (active, rejected int64) {
+	return activeForks.Load(), rejectedForks.Load()
+}
+
+func maxConcurrentForks() int64 {
+	limit := GetConfig().VMPoolConfig.MaxConcurrentForks
+	if limit == 0 {
+		return defaultMaxConcurrentForks
+	}
+	return int64(limit)
+}
+
+// acquireForkSlot reserves a slot for a forked workflow. Every successful
+// call must be paired with releaseForkSlot.
+func acquireForkSlot() error {
+	limit := maxConcurrentForks()
+	if n := activeForks.Add(1); limit > 0 && n > limit {
+		activeForks.Add(-1)
+		rejectedForks.Add(1)
+		return ErrForkLimitReached
+	}
+	return nil
+}
+
+func releaseForkSlot() {
+	activeForks.Add(-1)
+}
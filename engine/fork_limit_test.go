@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setMaxConcurrentForks(t *testing.T, limit int) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.VMPoolConfig.MaxConcurrentForks = limit
+	repo.SetConfig(config)
+}
+
+func TestForkLimitSaturation(t *testing.T) {
+	setMaxConcurrentForks(t, 10)
+	_, rejectedBefore := ForkStats()
+
+	var acquired atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if acquireForkSlot() == nil {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	defer func() {
+		for i := int64(0); i < acquired.Load(); i++ {
+			releaseForkSlot()
+		}
+	}()
+
+	active, rejected := ForkStats()
+	assert.EqualValues(t, 10, acquired.Load())
+	assert.EqualValues(t, 10, active)
+	assert.EqualValues(t, 40, rejected-rejectedBefore)
+
+	// A gorutine node fails cleanly while the limit is reached
+	output := func(node string) *model.Output {
+		o := &model.Output{}
+		o.Connections = append(o.Connections, struct {
+			Node   string `json:"node"`
+			Output string `json:"output"`
+		}{Node: node})
+		return o
+	}
+	actor := &model.Node{Outputs: map[string]*model.Output{"output_1": output("main"), "output_2": output("forked")}}
+	c := createTestContext()
+	p := process.CreateProcess("fork-limit")
+	defer p.Close()
+
+	vm := goja.New()
+	next, _, err := (&StepGorutine{}).Run(&model.Controller{}, actor, c, vm, "output_1", nil, p, vm.ToValue(map[string]interface{}{}))
+	assert.True(t, errors.Is(err, ErrForkLimitReached))
+	assert.Empty(t, next)
+	assert.Equal(t, http.StatusServiceUnavailable, c.Response().Status)
+
+	// Slots are available again once forks end
+	releaseForkSlot()
+	acquired.Add(-1)
+	require.NoError(t, acquireForkSlot())
+	acquired.Add(1)
+}
+
+func TestForkLimitDisabled(t *testing.T) {
+	setMaxConcurrentForks(t, -1)
+	for i := 0; i < defaultMaxConcurrentForks+10; i++ {
+		require.NoError(t, acquireForkSlot())
+	}
+	for i := 0; i < defaultMaxConcurrentForks+10; i++ {
+		releaseForkSlot()
+	}
+	active, _ := ForkStats()
+	assert.EqualValues(t, 0, active)
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/process"
+)
+
+// ErrGoroutineLimitReached is returned by a gorutine or plugin callback
+// node, which answer 500, when its request has spawned more than vm_pool.max_goroutines_per_request goroutines and
+// vm_pool.goroutine_limit_action is "fail"
+var ErrGoroutineLimitReached = errors.New("goroutine limit per request reached")
+
+const defaultMaxGoroutinesPerRequest = 1000
+
+// requestProcessKey is the echo context key holding the process a request
+// started, which forks count their goroutines on
+const requestProcessKey = "_request_process"
+
+// goroutineLimitExceeded counts the requests that went over the limit
+var goroutineLimitExceeded atomic.Uint64
+
+// GoroutineLimitExceeded returns how many requests spawned more goroutines
+// than vm_pool.max_goroutines_per_request since startup
+func GoroutineLimitExceeded() uint64 {
+	return goroutineLimitExceeded.Load()
+}
+
+// maxGoroutinesPerRequest returns vm_pool.max_goroutines_per_request, 0
+// when unlimited
+func maxGoroutinesPerRequest() int64 {
+	switch limit := GetConfig().VMPoolConfig.MaxGoroutinesPerRequest; {
+	case limit == 0:
+		return defaultMaxGoroutinesPerRequest
+	case limit < 0:
+		return 0
+	default:
+		return int64(limit)
+	}
+}
+
+// trackGoroutine counts a goroutine spawned for the request of p and logs
+// a warning the first time the request goes over the limit. Past the
+// limit it returns ErrGoroutineLimitReached when the action is "fail";
+// callers that cannot skip their goroutine ignore it.
+func trackGoroutine(p *process.Process) error {
+	limit := maxGoroutinesPerRequest()
+	total := p.AddGoroutine()
+	if limit <= 0 || total <= limit {
+		return nil
+	}
+	if total == limit+1 {
+		goroutineLimitExceeded.Add(1)
+		logger.Errorf("Workflow %s (%s) spawned more than %d goroutines, check for runaway forks",
+			p.UUID, p.Endpoint, limit)
+	}
+	if GetConfig().VMPoolConfig.GoroutineLimitAction == "fail" {
+		return ErrGoroutineLimitReached
+	}
+	return nil
+}
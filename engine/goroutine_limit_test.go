@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forkLeafStep counts the forks that reached it
+type forkLeafStep struct {
+	runs *atomic.Int64
+}
+
+func (s forkLeafStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	s.runs.Add(1)
+	return "", payload, nil
+}
+
+// runForkingWorkflow runs a chain of forks gorutine nodes, each forking
+// to a leaf, and waits for the forks that were started to end
+func runForkingWorkflow(t *testing.T, forks, limit int, action string) (*process.Process, int64, int) {
+	useVMManager(t, newTestVMManager(4, nil))
+	repo := GetConfigRepository()
+	previousRedis := repo.GetRedisClient()
+	repo.SetRedisClient(redis.NewClient(&redis.Options{}))
+	t.Cleanup(func() { repo.SetRedisClient(previousRedis) })
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.VMPoolConfig.MaxGoroutinesPerRequest = limit
+	config.VMPoolConfig.GoroutineLimitAction = action
+	repo.SetConfig(config)
+
+	var runs atomic.Int64
+	Steps["test_fork_leaf"] = forkLeafStep{runs: &runs}
+	defer delete(Steps, "test_fork_leaf")
+
+	output := func(node string) *model.Output {
+		o := &model.Output{}
+		o.Connections = append(o.Connections, struct {
+			Node   string `json:"node"`
+			Output string `json:"output"`
+		}{Node: node, Output: "input_1"})
+		return o
+	}
+	start := &model.Node{Data: map[string]interface{}{"type": "starter"}, Outputs: map[string]*model.Output{"output_1": output("fork_0")}}
+	pb := model.Playbook{"start": start, "leaf": &model.Node{Data: map[string]interface{}{"type": "test_fork_leaf"}}}
+	for i := 0; i < forks; i++ {
+		outputs := map[string]*model.Output{"output_2": output("leaf")}
+		if i < forks-1 {
+			outputs["output_1"] = output(fmt.Sprintf("fork_%d", i+1))
+		}
+		pb[fmt.Sprintf("fork_%d", i)] = &model.Node{Data: map[string]interface{}{"type": "gorutine"}, Outputs: outputs}
+	}
+
+	c, rec := newTraceTestContext(t, "/fanout", DebugConfig{})
+	require.NoError(t, run(&model.Controller{Playbook: &pb, Start: start, FlowName: "Fanout"}, c, model.Vars{}, "", "/fanout", uuid.New().String(), nil, false))
+
+	// Forks end on their own, wait until no more leaves run
+	deadline := time.Now().Add(5 * time.Second)
+	for last := int64(-1); runs.Load() != last && time.Now().Before(deadline); {
+		last = runs.Load()
+		time.Sleep(100 * time.Millisecond)
+	}
+	root, ok := c.Get(requestProcessKey).(*process.Process)
+	require.True(t, ok)
+	return root, runs.Load(), rec.Code
+}
+
+func TestGoroutineLimitWarns(t *testing.T) {
+	before := GoroutineLimitExceeded()
+	root, leaves, code := runForkingWorkflow(t, 30, 20, "")
+
+	assert.EqualValues(t, 30, leaves, "warn mode lets every fork run")
+	assert.Equal(t, http.StatusOK, code)
+	assert.GreaterOrEqual(t, root.SpawnedGoroutines(), int64(60), "forks and their nodes count for the request")
+	assert.Equal(t, before+1, GoroutineLimitExceeded(), "a request is reported once")
+}
+
+func TestGoroutineLimitFails(t *testing.T) {
+	before := GoroutineLimitExceeded()
+	_, leaves, code := runForkingWorkflow(t, 30, 20, "fail")
+
+	assert.Equal(t, http.StatusInternalServerError, code, "the client learns the workflow stopped")
+	assert.Less(t, leaves, int64(30), "forks past the limit must not run")
+	assert.Greater(t, leaves, int64(0))
+	assert.Equal(t, before+1, GoroutineLimitExceeded())
+}
+
+// callbackTestPlugin counts the runs of a plugin callback node
+type callbackTestPlugin struct {
+	runs *atomic.Int64
+}
+
+func (p callbackTestPlugin) Run(c echo.Context, vars map[string]string, payloadIn interface{}, dromedary_data string, callback chan string) (interface{}, string, error) {
+	p.runs.Add(1)
+	callback <- `{"error_exit": true}`
+	return payloadIn, "output_1", nil
+}
+
+func (p callbackTestPlugin) Name() string { return "test_callback" }
+
+func (p callbackTestPlugin) AddFeatureJS() map[string]interface{} { return nil }
+
+func TestGoroutineLimitFailsPluginCallbacks(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.VMPoolConfig.MaxGoroutinesPerRequest = 1
+	config.VMPoolConfig.GoroutineLimitAction = "fail"
+	repo.SetConfig(config)
+
+	var runs atomic.Int64
+	c, rec := newTraceTestContext(t, "/callback", DebugConfig{})
+	c.Set(pluginSetKey, newPluginSet(map[string]NflowPlugin{"test_callback": callbackTestPlugin{runs: &runs}}))
+
+	p := process.CreateProcess("callback-limit")
+	defer p.Close()
+	require.NoError(t, trackGoroutine(p), "the request is at the limit")
+
+	output := &model.Output{}
+	output.Connections = append(output.Connections, struct {
+		Node   string `json:"node"`
+		Output string `json:"output"`
+	}{Node: "node_2", Output: "input_1"})
+	actor := &model.Node{
+		Data:    map[string]interface{}{"type": "dromedary_callback", "dromedary_name": "test_callback"},
+		Outputs: map[string]*model.Output{"output_1": output, "output_2": output},
+	}
+	_, _, err := (&StepPluginCallback{}).Run(&model.Controller{}, actor, c, goja.New(), "output_1", model.Vars{}, p, nil)
+
+	assert.True(t, errors.Is(err, ErrGoroutineLimitReached))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, runs.Load(), "the callbacks must not start")
+}
+
+func TestTrackGoroutine(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.VMPoolConfig.MaxGoroutinesPerRequest = 2
+	config.VMPoolConfig.GoroutineLimitAction = "fail"
+	repo.SetConfig(config)
+
+	root := process.CreateProcess("goroutines-root")
+	defer root.Close()
+	fork := process.CreateProcess("goroutines-fork")
+	defer fork.Close()
+	fork.SetParent(root)
+
+	require.NoError(t, trackGoroutine(root))
+	require.NoError(t, trackGoroutine(fork))
+	assert.True(t, errors.Is(trackGoroutine(fork), ErrGoroutineLimitReached))
+	assert.EqualValues(t, 3, root.SpawnedGoroutines())
+	assert.EqualValues(t, 3, fork.SpawnedGoroutines())
+
+	config.VMPoolConfig.MaxGoroutinesPerRequest = -1
+	repo.SetConfig(config)
+	assert.NoError(t, trackGoroutine(root))
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Defaults of [server].max_header_count and [server].max_header_bytes
+const (
+	defaultMaxHeaderCount = 100
+	defaultMaxHeaderBytes = 64 * 1024
+)
+
+// headerLimit returns the configured limit, the default when 0 and no
+// limit (0) when negative
+func headerLimit(value, defaultValue int) int {
+	switch {
+	case value == 0:
+		return defaultValue
+	case value < 0:
+		return 0
+	}
+	return value
+}
+
+// HeaderLimitsMiddleware rejects with 431 the requests with more header
+// values than max_header_count or whose headers add up to more than
+// max_header_bytes. Every value of a repeated header counts.
+func HeaderLimitsMiddleware(config *ServerConfig) echo.MiddlewareFunc {
+	maxCount := headerLimit(config.MaxHeaderCount, defaultMaxHeaderCount)
+	maxBytes := headerLimit(config.MaxHeaderBytes, defaultMaxHeaderBytes)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			count, size := 0, 0
+			for name, values := range c.Request().Header {
+				count += len(values)
+				for _, value := range values {
+					// "Name: value\r\n"
+					size += len(name) + len(value) + 4
+				}
+			}
+			if maxCount > 0 && count > maxCount {
+				return c.JSON(http.StatusRequestHeaderFieldsTooLarge, echo.Map{"error": "Too many request headers"})
+			}
+			if maxBytes > 0 && size > maxBytes {
+				return c.JSON(http.StatusRequestHeaderFieldsTooLarge, echo.Map{"error": "Request headers too large"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveWithHeaderLimits(config *ServerConfig, req *http.Request) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(HeaderLimitsMiddleware(config))
+	e.GET("/", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"ok": true})
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHeaderLimitsCount(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 10; i++ {
+		req.Header.Add("X-Many", fmt.Sprint(i))
+	}
+
+	assert.Equal(t, http.StatusOK, serveWithHeaderLimits(&ServerConfig{MaxHeaderCount: 10}, req).Code)
+
+	req.Header.Add("X-Extra", "1")
+	rec := serveWithHeaderLimits(&ServerConfig{MaxHeaderCount: 10}, req)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Too many request headers")
+
+	assert.Equal(t, http.StatusOK, serveWithHeaderLimits(&ServerConfig{MaxHeaderCount: -1}, req).Code)
+}
+
+func TestHeaderLimitsSize(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Big", strings.Repeat("a", defaultMaxHeaderBytes))
+
+	rec := serveWithHeaderLimits(&ServerConfig{}, req)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, rec.Code, "the default limit applies")
+	assert.Contains(t, rec.Body.String(), "Request headers too large")
+
+	assert.Equal(t, http.StatusOK, serveWithHeaderLimits(&ServerConfig{MaxHeaderBytes: 2 * defaultMaxHeaderBytes}, req).Code)
+	assert.Equal(t, http.StatusOK, serveWithHeaderLimits(&ServerConfig{MaxHeaderBytes: -1}, req).Code)
+
+	small := httptest.NewRequest(http.MethodGet, "/", nil)
+	small.Header.Set("User-Agent", "test")
+	assert.Equal(t, http.StatusOK, serveWithHeaderLimits(&ServerConfig{}, small).Code)
+}
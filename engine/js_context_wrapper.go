@@ -25,9 +25,9 @@ func (w *JSContextWrapper) JSON(code int, i interface{}) error {
 	return w.context.JSON(code, i)
 }
 
-// String sends a string response - exposed to JavaScript
+// String sends a string response with the request content type - exposed to JavaScript
 func (w *JSContextWrapper) String(code int, s string) error {
-	return w.context.String(code, s)
+	return w.context.Blob(code, ResponseContentType(w.context), []byte(s))
 }
 
 // Redirect performs an HTTP redirect - exposed to JavaScript
@@ -93,15 +93,19 @@ func SetupJSContext(vm *goja.Runtime, c echo.Context) {
 	})
 
 	obj.Set("String", func(code int, s string) error {
-		return c.String(code, s)
+		return c.Blob(code, ResponseContentType(c), []byte(s))
 	})
 
 	obj.Set("HTML", func(code int, html string) error {
-		return c.HTML(code, html)
+		return c.Blob(code, withCharset(echo.MIMETextHTML), []byte(html))
 	})
 
 	obj.Set("HTMLBlob", func(code int, b []byte) error {
-		return c.HTMLBlob(code, b)
+		return c.Blob(code, withCharset(echo.MIMETextHTML), b)
+	})
+
+	obj.Set("SetContentType", func(contentType string) {
+		SetResponseContentType(c, contentType)
 	})
 
 	obj.Set("XML", func(code int, data interface{}) error {
@@ -307,8 +311,26 @@ func SetupJSContext(vm *goja.Runtime, c echo.Context) {
 		c.Response().Header().Set(key, value)
 	})
 
+	// Incremental responses, see writeChunk
+	obj.Set("Write", func(chunk string) error {
+		return writeChunk(c, chunk)
+	})
+
+	obj.Set("Flush", func() error {
+		return flushResponse(c)
+	})
+
 	vm.Set("c", obj)
 	vm.Set("echo_context", obj)
+	vm.Set("set_content_type", func(contentType string) {
+		SetResponseContentType(c, contentType)
+	})
+	vm.Set("write", func(chunk string) error {
+		return writeChunk(c, chunk)
+	})
+	vm.Set("flush", func() error {
+		return flushResponse(c)
+	})
 
 	// Debug: verify the object is set correctly
 	val := vm.Get("c")
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// parserPositionPattern finds the position in goja parser messages, e.g.
+// "workflow: Line 2:9 Unexpected token ;"
+var parserPositionPattern = regexp.MustCompile(`Line (\d+):(\d+)`)
+
+// JSError is the detail of an error raised by the code of a node. With
+// the debug endpoints enabled it is returned to the client; otherwise the
+// client only gets the correlation ID and the detail goes to the log.
+type JSError struct {
+	NodeID        string      `json:"node_id"`
+	Name          string      `json:"name,omitempty"` // Error, TypeError, SyntaxError...
+	Message       string      `json:"message"`
+	Line          int         `json:"line,omitempty"`
+	Column        int         `json:"column,omitempty"`
+	Value         interface{} `json:"value,omitempty"` // Thrown value when it is not an Error
+	Stack         string      `json:"stack,omitempty"`
+	CorrelationID string      `json:"correlation_id"`
+}
+
+// NewJSError extracts the message, position and stack of a goja exception
+// or compile error
+func NewJSError(nodeID string, err error) *JSError {
+	jsErr := &JSError{NodeID: nodeID, Message: err.Error(), CorrelationID: NewUUID()}
+
+	var exception *goja.Exception
+	var syntaxErr *goja.CompilerSyntaxError
+	switch {
+	case errors.As(err, &exception):
+		jsErr.Stack = exception.String()
+		if obj, ok := exception.Value().(*goja.Object); ok && obj.ClassName() == "Error" {
+			jsErr.Name = obj.Get("name").String()
+			jsErr.Message = obj.Get("message").String()
+		} else if value := exception.Value(); value != nil {
+			jsErr.Message = value.String()
+			jsErr.Value = value.Export()
+		}
+		for _, frame := range exception.Stack() {
+			if pos := frame.Position(); pos.Line > 0 {
+				jsErr.Line, jsErr.Column = pos.Line, pos.Column
+				break
+			}
+		}
+	case errors.As(err, &syntaxErr):
+		jsErr.Name = "SyntaxError"
+		jsErr.Message = syntaxErr.Message
+		if syntaxErr.File != nil {
+			pos := syntaxErr.File.Position(syntaxErr.Offset)
+			jsErr.Line, jsErr.Column = pos.Line, pos.Column
+		} else if m := parserPositionPattern.FindStringSubmatch(syntaxErr.Message); m != nil {
+			// Parser errors only carry the position in the message
+			jsErr.Line, _ = strconv.Atoi(m[1])
+			jsErr.Column, _ = strconv.Atoi(m[2])
+		}
+	}
+	return jsErr
+}
+
+// respondJSError logs the full detail of err, with positions in the
+// author's code of script, and answers with it in debug mode or with a
+// generic error and the correlation ID otherwise
+func respondJSError(c echo.Context, status int, nodeID string, script ScriptSource, err error) *JSError {
+	jsErr := NewJSError(nodeID, err)
+	if id := RequestID(c); id != "" {
+		jsErr.CorrelationID = id
+	}
+	script.Translate(jsErr)
+	logger.Errorf("Workflow error %s in node %s: %s (line %d, column %d)\n%s",
+		jsErr.CorrelationID, nodeID, jsErr.Message, jsErr.Line, jsErr.Column, jsErr.Stack)
+
+	if GetConfig().DebugConfig.Enabled {
+		c.JSON(status, echo.Map{"error": jsErr})
+		return jsErr
+	}
+	message := "Workflow execution failed"
+	if status == http.StatusRequestTimeout {
+		message = "Workflow execution exceeded resource limits"
+	}
+	c.JSON(status, echo.Map{"error": message, "correlation_id": jsErr.CorrelationID})
+	return jsErr
+}
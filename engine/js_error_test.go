@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const throwingNode = `function main() {
+	var order = payload.order;
+	throw new TypeError("order " + order + " has no items");
+}
+main()`
+
+func runThrowingNode(t *testing.T, debug bool) (*httptest.ResponseRecorder, *JSError) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	config := original
+	config.DebugConfig = DebugConfig{Enabled: debug}
+	repo.SetConfig(config)
+
+	vm := goja.New()
+	vm.Set("payload", map[string]interface{}{"order": 7})
+	_, err := vm.RunScript("workflow", throwingNode)
+	require.Error(t, err)
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	return rec, respondJSError(c, http.StatusInternalServerError, "node_42", NewScriptSource("workflow", "", throwingNode, ""), err)
+}
+
+func TestJSErrorDebugMode(t *testing.T) {
+	rec, jsErr := runThrowingNode(t, true)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	var body struct {
+		Error JSError `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "node_42", body.Error.NodeID)
+	assert.Equal(t, "TypeError", body.Error.Name)
+	assert.Equal(t, "order 7 has no items", body.Error.Message)
+	assert.Equal(t, 3, body.Error.Line)
+	assert.Contains(t, body.Error.Stack, "main")
+	assert.Equal(t, jsErr.CorrelationID, body.Error.CorrelationID)
+}
+
+func TestJSErrorProductionMode(t *testing.T) {
+	rec, jsErr := runThrowingNode(t, false)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "Workflow execution failed", body["error"])
+	assert.Equal(t, jsErr.CorrelationID, body["correlation_id"])
+	assert.NotContains(t, rec.Body.String(), "order 7", "no detail leaks to the client")
+	assert.NotContains(t, rec.Body.String(), "node_42")
+
+	// The detail is kept for the log
+	assert.Equal(t, "order 7 has no items", jsErr.Message)
+}
+
+func TestNewJSErrorThrownValuesAndSyntaxErrors(t *testing.T) {
+	_, err := goja.New().RunString(`throw {code: "E_STOCK", sku: "A1"}`)
+	require.Error(t, err)
+	jsErr := NewJSError("n1", err)
+	assert.Equal(t, map[string]interface{}{"code": "E_STOCK", "sku": "A1"}, jsErr.Value)
+	assert.Equal(t, 1, jsErr.Line)
+
+	_, err = goja.Compile("workflow", "var a = 1;\nvar b = ;", false)
+	require.Error(t, err)
+	jsErr = NewJSError("n1", err)
+	assert.Equal(t, "SyntaxError", jsErr.Name)
+	assert.Equal(t, 2, jsErr.Line)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"sync"
+	"time"
 )
 
 var (
@@ -70,11 +71,13 @@ func (r *RepositoryModules) GetModuleWithFallback(name string, ctx context.Conte
 	}
 
 	config := GetConfig()
+	start := time.Now()
 	row := conn.QueryRowContext(ctx, config.DatabaseNflow.QueryGetModuleByName, name)
 	var form string
 	var mod string
 	var code string
 	err := row.Scan(&form, &mod, &code)
+	observeQuery("module_load", config.DatabaseNflow.QueryGetModuleByName, start)
 	if err == nil {
 		code = babelTransform(code)
 	}
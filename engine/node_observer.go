@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// NodeObserver receives the type and duration of every node run by step()
+type NodeObserver func(nodeType string, duration time.Duration)
+
+var (
+	nodeObserverMu sync.RWMutex
+	nodeObserver   NodeObserver
+)
+
+// SetNodeObserver installs the observer notified after each node, e.g. to
+// feed duration metrics. nil removes it.
+func SetNodeObserver(observer NodeObserver) {
+	nodeObserverMu.Lock()
+	defer nodeObserverMu.Unlock()
+	nodeObserver = observer
+}
+
+// observeNode reports a node run to the observer. Types without a
+// registered step are reported as "unknown" to keep the set bounded.
+func observeNode(nodeType string, duration time.Duration) {
+	nodeObserverMu.RLock()
+	observer := nodeObserver
+	nodeObserverMu.RUnlock()
+	if observer == nil {
+		return
+	}
+	if _, ok := Steps[nodeType]; !ok {
+		nodeType = "unknown"
+	}
+	observer(nodeType, duration)
+}
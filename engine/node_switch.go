@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+)
+
+// Node kill switch: playbook.disabled_nodes lists node IDs or node types
+// step() does not run. Operators toggle entries at runtime through the
+// debug endpoints; a toggle overrides the config until it is cleared.
+var (
+	nodeSwitchMutex     sync.RWMutex
+	nodeSwitchOverrides = make(map[string]bool) // key -> disabled
+)
+
+// DisableNode disables the node ID or node type key at runtime
+func DisableNode(key string) {
+	nodeSwitchMutex.Lock()
+	defer nodeSwitchMutex.Unlock()
+	nodeSwitchOverrides[key] = true
+}
+
+// EnableNode enables the node ID or node type key at runtime, even when
+// playbook.disabled_nodes lists it
+func EnableNode(key string) {
+	nodeSwitchMutex.Lock()
+	defer nodeSwitchMutex.Unlock()
+	nodeSwitchOverrides[key] = false
+}
+
+// ResetNodeSwitches drops the runtime toggles, playbook.disabled_nodes
+// applies again
+func ResetNodeSwitches() {
+	nodeSwitchMutex.Lock()
+	defer nodeSwitchMutex.Unlock()
+	nodeSwitchOverrides = make(map[string]bool)
+}
+
+// DisabledNodes returns the node IDs and types currently disabled, sorted
+func DisabledNodes() []string {
+	nodeSwitchMutex.RLock()
+	defer nodeSwitchMutex.RUnlock()
+
+	disabled := make(map[string]bool)
+	for _, key := range GetConfig().PlaybookConfig.DisabledNodes {
+		disabled[key] = true
+	}
+	for key, off := range nodeSwitchOverrides {
+		disabled[key] = off
+	}
+
+	keys := make([]string, 0, len(disabled))
+	for key, off := range disabled {
+		if off {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// nodeDisabled reports whether the node id of type nodeType is switched off
+func nodeDisabled(id, nodeType string) bool {
+	return keyDisabled(id) || (nodeType != "" && keyDisabled(nodeType))
+}
+
+func keyDisabled(key string) bool {
+	nodeSwitchMutex.RLock()
+	off, ok := nodeSwitchOverrides[key]
+	nodeSwitchMutex.RUnlock()
+	if ok {
+		return off
+	}
+	for _, disabled := range GetConfig().PlaybookConfig.DisabledNodes {
+		if disabled == key {
+			return true
+		}
+	}
+	return false
+}
+
+// disabledNodeOutput returns the output a skipped disabled node follows,
+// empty when the workflow must fail instead
+func disabledNodeOutput() string {
+	cfg := GetConfig().PlaybookConfig
+	if cfg.DisabledNodeAction != "skip" {
+		return ""
+	}
+	if cfg.DisabledNodeOutput == "" {
+		return "output_1"
+	}
+	return cfg.DisabledNodeOutput
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteDisabledNode(t *testing.T) {
+	var disabledRuns, endRuns []interface{}
+	Steps["test_disabled_mid"] = payloadTestStep{received: &disabledRuns}
+	Steps["test_disabled_end"] = payloadTestStep{received: &endRuns}
+	defer delete(Steps, "test_disabled_mid")
+	defer delete(Steps, "test_disabled_end")
+
+	output := &model.Output{}
+	output.Connections = append(output.Connections, struct {
+		Node   string `json:"node"`
+		Output string `json:"output"`
+	}{Node: "node_2", Output: "input_1"})
+	pb := model.Playbook{
+		"node_1": &model.Node{Data: map[string]interface{}{"type": "test_disabled_mid"}, Outputs: map[string]*model.Output{"output_1": output}},
+		"node_2": &model.Node{Data: map[string]interface{}{"type": "test_disabled_end"}},
+	}
+
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+	defer ResetNodeSwitches()
+
+	execute := func(t *testing.T) int {
+		disabledRuns, endRuns = nil, nil
+		c, rec := newTraceTestContext(t, "/", DebugConfig{})
+		p := process.CreateProcess("disabled-node-test")
+		defer p.Close()
+		Execute(&model.Controller{Playbook: &pb, FlowName: "Home"}, c, goja.New(), "node_1", nil, p, nil, false)
+		return rec.Code
+	}
+
+	t.Run("runs when enabled", func(t *testing.T) {
+		execute(t)
+		assert.Len(t, disabledRuns, 1)
+		assert.Len(t, endRuns, 1)
+	})
+
+	t.Run("fails fast by node id", func(t *testing.T) {
+		DisableNode("node_1")
+		defer ResetNodeSwitches()
+
+		assert.Equal(t, http.StatusServiceUnavailable, execute(t))
+		assert.Empty(t, disabledRuns)
+		assert.Empty(t, endRuns)
+		assert.Equal(t, []string{"node_1"}, DisabledNodes())
+	})
+
+	t.Run("skips by node type", func(t *testing.T) {
+		cfg := original
+		cfg.PlaybookConfig.DisabledNodes = []string{"test_disabled_mid"}
+		cfg.PlaybookConfig.DisabledNodeAction = "skip"
+		repo.SetConfig(cfg)
+		defer repo.SetConfig(original)
+
+		assert.NotEqual(t, http.StatusServiceUnavailable, execute(t))
+		assert.Empty(t, disabledRuns)
+		assert.Len(t, endRuns, 1)
+
+		// A runtime toggle overrides the config
+		EnableNode("test_disabled_mid")
+		defer ResetNodeSwitches()
+		execute(t)
+		assert.Len(t, disabledRuns, 1)
+		assert.Empty(t, DisabledNodes())
+	})
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/dop251/goja"
+)
+
+// payloadObject returns the payload as an object. A node may also produce
+// an array, string, number or boolean: ok is false then and the payload
+// must be passed on unchanged. Missing, undefined and null payloads are
+// empty objects.
+func payloadObject(payload goja.Value) (object map[string]interface{}, ok bool) {
+	if payload == nil || goja.IsUndefined(payload) || goja.IsNull(payload) {
+		return make(map[string]interface{}), true
+	}
+	object, ok = payload.Export().(map[string]interface{})
+	return object, ok
+}
+
+// Strategies to merge the values saved in the nflow_form session into the
+// payload before each node, set with [playbook].payload_merge or with the
+// payload_merge field of the starter node
+const (
+	// PayloadMergeSessionWins overwrites payload keys with the session values
+	PayloadMergeSessionWins = "session-wins"
+	// PayloadMergePayloadWins only adds the session keys missing in the payload
+	PayloadMergePayloadWins = "payload-wins"
+	// PayloadMergeDeep merges nested objects key by key; on other
+	// conflicts the payload wins
+	PayloadMergeDeep = "deep-merge"
+)
+
+// payloadMergeStrategy returns the strategy of the starter of cc or the
+// configured one, session-wins when unset or unknown
+func payloadMergeStrategy(cc *model.Controller) string {
+	strategy := GetConfig().PlaybookConfig.PayloadMerge
+	if cc != nil && cc.Start != nil {
+		if s, ok := cc.Start.Data["payload_merge"].(string); ok && s != "" {
+			strategy = s
+		}
+	}
+	switch strategy {
+	case PayloadMergePayloadWins, PayloadMergeDeep:
+		return strategy
+	}
+	return PayloadMergeSessionWins
+}
+
+// mergeSessionValues merges the session values into payload. The break
+// flag and the workflow state kept in the session (pinned playbook version,
+// expected resume node, continuation nonce) are never merged.
+func mergeSessionValues(payload map[string]interface{}, values map[interface{}]interface{}, strategy string) {
+	for k, v := range values {
+		key, ok := k.(string)
+		if !ok || key == "break" || isWorkflowStateKey(key) {
+			continue
+		}
+		current, exists := payload[key]
+		switch {
+		case !exists || strategy == PayloadMergeSessionWins:
+			payload[key] = v
+		case strategy == PayloadMergeDeep:
+			payload[key] = deepMerge(current, v)
+		}
+	}
+}
+
+// deepMerge merges the session value into the payload value: objects key
+// by key, anything else keeps the payload value
+func deepMerge(payloadValue, sessionValue interface{}) interface{} {
+	payloadObj, ok1 := payloadValue.(map[string]interface{})
+	sessionObj, ok2 := sessionValue.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return payloadValue
+	}
+	merged := make(map[string]interface{}, len(payloadObj)+len(sessionObj))
+	for k, v := range sessionObj {
+		merged[k] = v
+	}
+	for k, v := range payloadObj {
+		if sv, exists := sessionObj[k]; exists {
+			merged[k] = deepMerge(v, sv)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadTestStep returns a fixed payload and records the one it received
+type payloadTestStep struct {
+	produce  string // JS expression of the payload to return
+	next     string
+	received *[]interface{}
+}
+
+func (s payloadTestStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	if payload == nil {
+		*s.received = append(*s.received, nil)
+	} else {
+		*s.received = append(*s.received, payload.Export())
+	}
+	if s.produce == "" {
+		return s.next, payload, nil
+	}
+	value, err := vm.RunString(s.produce)
+	return s.next, value, err
+}
+
+func TestExecuteNonObjectPayloads(t *testing.T) {
+	cases := map[string]interface{}{
+		`[1, "two", {three: 3}]`: []interface{}{int64(1), "two", map[string]interface{}{"three": int64(3)}},
+		`"plain text"`:           "plain text",
+		`42`:                     int64(42),
+		`3.5`:                    3.5,
+		`true`:                   true,
+	}
+	for produce, expected := range cases {
+		t.Run(produce, func(t *testing.T) {
+			var received []interface{}
+			Steps["test_payload_produce"] = payloadTestStep{produce: produce, next: "node_2", received: &received}
+			Steps["test_payload_pass"] = payloadTestStep{next: "node_3", received: &received}
+			Steps["test_payload_end"] = payloadTestStep{received: &received}
+			defer delete(Steps, "test_payload_produce")
+			defer delete(Steps, "test_payload_pass")
+			defer delete(Steps, "test_payload_end")
+
+			pb := model.Playbook{
+				"node_1": &model.Node{Data: map[string]interface{}{"type": "test_payload_produce"}},
+				"node_2": &model.Node{Data: map[string]interface{}{"type": "test_payload_pass"}},
+				"node_3": &model.Node{Data: map[string]interface{}{"type": "test_payload_end"}},
+			}
+			c, _ := newTraceTestContext(t, "/", DebugConfig{})
+			p := process.CreateProcess("payload-test")
+			defer p.Close()
+
+			require.NotPanics(t, func() {
+				Execute(&model.Controller{Playbook: &pb}, c, goja.New(), "node_1", nil, p, nil, false)
+			})
+
+			require.Len(t, received, 3)
+			assert.Equal(t, map[string]interface{}{}, received[0])
+			assert.Equal(t, expected, received[1], "the payload reaches the next node unchanged")
+			assert.Equal(t, expected, received[2], "and the one after it")
+		})
+	}
+}
+
+func TestPayloadObject(t *testing.T) {
+	vm := goja.New()
+
+	object, ok := payloadObject(nil)
+	assert.True(t, ok)
+	assert.Empty(t, object)
+
+	object, ok = payloadObject(goja.Null())
+	assert.True(t, ok)
+	assert.Empty(t, object)
+
+	object, ok = payloadObject(vm.ToValue(map[string]interface{}{"a": 1}))
+	assert.True(t, ok)
+	assert.Equal(t, 1, object["a"])
+
+	value, _ := vm.RunString(`[1, 2]`)
+	_, ok = payloadObject(value)
+	assert.False(t, ok)
+}
+
+func TestMergeSessionValues(t *testing.T) {
+	newPayload := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name":    "from node",
+			"address": map[string]interface{}{"city": "Rosario", "zip": "2000"},
+			"only":    "payload",
+		}
+	}
+	session := map[interface{}]interface{}{
+		"name":    "from session",
+		"address": map[string]interface{}{"city": "Córdoba", "street": "San Martín"},
+		"step":    int64(2),
+		"break":   true,
+		1:         "not a string key",
+	}
+
+	cases := map[string]map[string]interface{}{
+		PayloadMergeSessionWins: {
+			"name":    "from session",
+			"address": map[string]interface{}{"city": "Córdoba", "street": "San Martín"},
+			"only":    "payload",
+			"step":    int64(2),
+		},
+		PayloadMergePayloadWins: {
+			"name":    "from node",
+			"address": map[string]interface{}{"city": "Rosario", "zip": "2000"},
+			"only":    "payload",
+			"step":    int64(2),
+		},
+		PayloadMergeDeep: {
+			"name":    "from node",
+			"address": map[string]interface{}{"city": "Rosario", "zip": "2000", "street": "San Martín"},
+			"only":    "payload",
+			"step":    int64(2),
+		},
+	}
+	for strategy, expected := range cases {
+		t.Run(strategy, func(t *testing.T) {
+			payload := newPayload()
+			mergeSessionValues(payload, session, strategy)
+			assert.Equal(t, expected, payload)
+		})
+	}
+}
+
+func TestPayloadMergeStrategy(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	config := original
+	config.PlaybookConfig.PayloadMerge = ""
+	repo.SetConfig(config)
+	assert.Equal(t, PayloadMergeSessionWins, payloadMergeStrategy(nil), "defaults to the historical behavior")
+
+	config.PlaybookConfig.PayloadMerge = "unknown"
+	repo.SetConfig(config)
+	assert.Equal(t, PayloadMergeSessionWins, payloadMergeStrategy(nil))
+
+	config.PlaybookConfig.PayloadMerge = PayloadMergePayloadWins
+	repo.SetConfig(config)
+	assert.Equal(t, PayloadMergePayloadWins, payloadMergeStrategy(nil))
+	assert.Equal(t, PayloadMergePayloadWins, payloadMergeStrategy(&model.Controller{}))
+
+	cc := &model.Controller{Start: &model.Node{Data: map[string]interface{}{"payload_merge": PayloadMergeDeep}}}
+	assert.Equal(t, PayloadMergeDeep, payloadMergeStrategy(cc), "the starter overrides the configuration")
+}
@@ -6,14 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/arturoeanton/nflow-runtime/logger"
 	"github.com/arturoeanton/nflow-runtime/model"
 	"github.com/arturoeanton/nflow-runtime/syncsession"
-	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
 
@@ -36,8 +38,10 @@ func GetPlaybookRepository() PlaybookRepository {
 
 func GetPlaybook(ctx context.Context, conn *sql.Conn, pbName string) (map[string]map[string]*model.Playbook, error) {
 	config := GetConfig()
+	start := time.Now()
 	rows, err := conn.QueryContext(ctx, config.DatabaseNflow.QueryGetApp, pbName)
 	if err != nil {
+		observeQuery("playbook_load", config.DatabaseNflow.QueryGetApp, start)
 		log.Println(err)
 		return nil, err
 	}
@@ -51,6 +55,7 @@ func GetPlaybook(ctx context.Context, conn *sql.Conn, pbName string) (map[string
 			return nil, err
 		}
 	}
+	observeQuery("playbook_load", config.DatabaseNflow.QueryGetApp, start)
 	if err := rows.Err(); err != nil {
 		log.Println(err)
 		return nil, err
@@ -97,10 +102,26 @@ func comparePath(template string, real string) (bool, model.Vars) {
 	return true, vars
 }
 
+// EndpointPatternKey is the echo context key holding the urlpattern of the
+// starter resolved for the request, a bounded label for metrics
+const EndpointPatternKey = "_endpoint_pattern"
+
+// FallbackURLPattern marks the starter that handles the requests no other
+// starter of the app matches, e.g. a custom 404 page or a proxy. Apps
+// without such a starter keep answering 404. The unmatched path is
+// available in vars["*"].
+const FallbackURLPattern = "*"
+
 func GetWorkflow(c echo.Context, playbooks map[string]map[string]*model.Playbook, wfPath string, method string, appName string) (model.Runeable, model.Vars, int, string, error) {
-	for key, flows := range playbooks {
-		for _, pb := range flows {
-			for _, item := range *pb {
+	var fallback *model.Controller
+	// Flows and nodes are visited in key order so the same starter wins
+	// every time when several match
+	for _, key := range slices.Sorted(maps.Keys(playbooks)) {
+		flows := playbooks[key]
+		for _, flowKey := range slices.Sorted(maps.Keys(flows)) {
+			pb := flows[flowKey]
+			for _, nodeID := range slices.Sorted(maps.Keys(*pb)) {
+				item := (*pb)[nodeID]
 				data := item.Data
 				typeItem := data["type"].(string)
 
@@ -130,8 +151,21 @@ func GetWorkflow(c echo.Context, playbooks map[string]map[string]*model.Playbook
 						}
 					}
 					urlpattern := data["urlpattern"].(string)
+					if urlpattern == FallbackURLPattern {
+						if fallback == nil {
+							fallback = &model.Controller{
+								Methods:  []string{method},
+								Start:    item,
+								Playbook: pb,
+								FlowName: key,
+								AppName:  appName,
+							}
+						}
+						continue
+					}
 					flag, vars := comparePath(urlpattern, wfPath)
 					if flag {
+						c.Set(EndpointPatternKey, urlpattern)
 						if method == "GET" {
 							if reset_order_box, ok := data["reset_order_box"]; ok {
 								if reset_order_box == "true" {
@@ -140,12 +174,13 @@ func GetWorkflow(c echo.Context, playbooks map[string]map[string]*model.Playbook
 										func() {
 											syncsession.EchoSessionsMutex.Lock()
 											defer syncsession.EchoSessionsMutex.Unlock()
-											log_session, err := session.Get("log-session", c)
+											log_session, err := syncsession.Manager.GetSession("log-session", c)
 											if err != nil {
 												log.Println(err)
+												return
 											}
 											log_session.Values["order_box"] = 0
-											log_session.Save(c.Request(), c.Response())
+											syncsession.Manager.SaveSession("log-session", c, log_session)
 										}()
 									}
 								}
@@ -171,6 +206,12 @@ func GetWorkflow(c echo.Context, playbooks map[string]map[string]*model.Playbook
 		}
 	}
 
+	if fallback != nil {
+		logger.Verbosef("DEBUG: No starter matches %s, using the fallback starter of flow %s", wfPath, fallback.FlowName)
+		c.Set(EndpointPatternKey, FallbackURLPattern)
+		return CreateRuntimeController(fallback), model.Vars{"*": wfPath}, http.StatusOK, "starter", nil
+	}
+
 	/*
 		for key, c := range pb.Controllers {
 			flag, vars := comparePath(key, wfPath)
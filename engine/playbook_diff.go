@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+)
+
+// PlaybookDiff is the difference between two versions of a playbook
+type PlaybookDiff struct {
+	Added              []string     `json:"added"`               // Nodes only in the candidate
+	Removed            []string     `json:"removed"`             // Nodes only in the current version
+	Modified           []NodeChange `json:"modified"`            // Nodes whose data changed
+	AddedConnections   []Connection `json:"added_connections"`   // Connections only in the candidate
+	RemovedConnections []Connection `json:"removed_connections"` // Connections only in the current version
+}
+
+// NodeChange lists the data fields of a node that were added, removed or
+// changed
+type NodeChange struct {
+	Node   string   `json:"node"`
+	Type   string   `json:"type"`
+	Fields []string `json:"fields"`
+}
+
+// Connection links an output of a node to an input of another
+type Connection struct {
+	From   string `json:"from"`
+	Output string `json:"output"`
+	To     string `json:"to"`
+	Input  string `json:"input"`
+}
+
+// Empty reports whether both versions are the same
+func (d PlaybookDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0 &&
+		len(d.AddedConnections) == 0 && len(d.RemovedConnections) == 0
+}
+
+// DiffPlaybooks compares the current version of a playbook with a candidate.
+// Data values are compared by their JSON encoding, so a playbook decoded
+// from the same JSON has no differences. All lists are sorted.
+func DiffPlaybooks(current, candidate model.Playbook) PlaybookDiff {
+	diff := PlaybookDiff{
+		Added:              []string{},
+		Removed:            []string{},
+		Modified:           []NodeChange{},
+		AddedConnections:   []Connection{},
+		RemovedConnections: []Connection{},
+	}
+
+	for nodeID, node := range candidate {
+		previous, exists := current[nodeID]
+		if !exists {
+			diff.Added = append(diff.Added, nodeID)
+			continue
+		}
+		if fields := changedFields(nodeData(previous), nodeData(node)); len(fields) > 0 {
+			nodeType, _ := nodeData(node)["type"].(string)
+			diff.Modified = append(diff.Modified, NodeChange{Node: nodeID, Type: nodeType, Fields: fields})
+		}
+	}
+	for nodeID := range current {
+		if _, exists := candidate[nodeID]; !exists {
+			diff.Removed = append(diff.Removed, nodeID)
+		}
+	}
+
+	currentConnections := playbookConnections(current)
+	candidateConnections := playbookConnections(candidate)
+	for connection := range candidateConnections {
+		if !currentConnections[connection] {
+			diff.AddedConnections = append(diff.AddedConnections, connection)
+		}
+	}
+	for connection := range currentConnections {
+		if !candidateConnections[connection] {
+			diff.RemovedConnections = append(diff.RemovedConnections, connection)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Modified, func(i, j int) bool { return diff.Modified[i].Node < diff.Modified[j].Node })
+	sortConnections(diff.AddedConnections)
+	sortConnections(diff.RemovedConnections)
+	return diff
+}
+
+func nodeData(node *model.Node) map[string]interface{} {
+	if node == nil {
+		return nil
+	}
+	return node.Data
+}
+
+// changedFields returns the sorted keys that differ between two node data
+func changedFields(previous, current map[string]interface{}) []string {
+	var fields []string
+	for key, value := range current {
+		old, exists := previous[key]
+		if !exists || !sameJSON(old, value) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range previous {
+		if _, exists := current[key]; !exists {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func sameJSON(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// playbookConnections returns the set of connections of a playbook
+func playbookConnections(pb model.Playbook) map[Connection]bool {
+	connections := make(map[Connection]bool)
+	for nodeID, node := range pb {
+		if node == nil {
+			continue
+		}
+		for outputName, output := range node.Outputs {
+			if output == nil {
+				continue
+			}
+			for _, conn := range output.Connections {
+				connections[Connection{From: nodeID, Output: outputName, To: conn.Node, Input: conn.Output}] = true
+			}
+		}
+	}
+	return connections
+}
+
+func sortConnections(connections []Connection) {
+	sort.Slice(connections, func(i, j int) bool {
+		a, b := connections[i], connections[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.Output != b.Output {
+			return a.Output < b.Output
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Input < b.Input
+	})
+}
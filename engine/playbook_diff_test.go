@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const diffTestPlaybook = `{
+	"start":  {"data": {"type": "starter", "urlpattern": "/signup"}, "outputs": {"output_1": {"connections": [{"node": "form", "output": "input_1"}]}}},
+	"form":   {"data": {"type": "js", "code": "render()", "options": {"retries": 1}}, "outputs": {"output_1": {"connections": [{"node": "save", "output": "input_1"}]}}},
+	"save":   {"data": {"type": "js", "code": "save()"}, "outputs": {}}
+}`
+
+func decodeDiffTestPlaybook(t *testing.T, data string) model.Playbook {
+	var pb model.Playbook
+	require.NoError(t, json.Unmarshal([]byte(data), &pb))
+	return pb
+}
+
+func TestDiffPlaybooks(t *testing.T) {
+	current := decodeDiffTestPlaybook(t, diffTestPlaybook)
+
+	diff := DiffPlaybooks(current, decodeDiffTestPlaybook(t, diffTestPlaybook))
+	assert.True(t, diff.Empty(), "the same JSON has no differences")
+
+	candidate := decodeDiffTestPlaybook(t, diffTestPlaybook)
+	candidate["form"].Data["code"] = "render(v2)"
+	candidate["form"].Data["options"] = map[string]interface{}{"retries": 3}
+	candidate["form"].Data["name_box"] = "Signup form"
+	delete(candidate["save"].Data, "code")
+	candidate["notify"] = &model.Node{Data: map[string]interface{}{"type": "mail"}}
+	candidate["form"].Outputs["output_1"].Connections[0].Node = "notify"
+	delete(candidate, "start")
+
+	diff = DiffPlaybooks(current, candidate)
+	assert.False(t, diff.Empty())
+	assert.Equal(t, []string{"notify"}, diff.Added)
+	assert.Equal(t, []string{"start"}, diff.Removed)
+	assert.Equal(t, []NodeChange{
+		{Node: "form", Type: "js", Fields: []string{"code", "name_box", "options"}},
+		{Node: "save", Type: "js", Fields: []string{"code"}},
+	}, diff.Modified)
+	assert.Equal(t, []Connection{{From: "form", Output: "output_1", To: "notify", Input: "input_1"}}, diff.AddedConnections)
+	assert.Equal(t, []Connection{
+		{From: "form", Output: "output_1", To: "save", Input: "input_1"},
+		{From: "start", Output: "output_1", To: "form", Input: "input_1"},
+	}, diff.RemovedConnections)
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+)
+
+// DeepCopyObserver receives the duration of every node copy made by step()
+// before running the node
+type DeepCopyObserver func(duration time.Duration)
+
+var (
+	deepCopyObserverMu sync.RWMutex
+	deepCopyObserver   DeepCopyObserver
+
+	// cacheHitNodes is the node count of the playbooks returned by the last
+	// cache hit, shared with the request instead of copied
+	cacheHitNodes atomic.Int64
+
+	// starterReached counts the workflows that reached a starter node
+	// through a connection
+	starterReached atomic.Uint64
+
+	// corruptedStarters counts the corrupted starter nodes removed by
+	// cleanPlaybooksForCache per app
+	corruptedStarters sync.Map // app name -> *atomic.Uint64
+
+	// unknownNodeTypes counts the nodes step() found without a registered
+	// step per type, up to maxUnknownNodeTypes types
+	unknownNodeTypes sync.Map // node type -> *atomic.Uint64
+)
+
+// maxUnknownNodeTypes bounds the labels of the unknown node type metric,
+// further types are counted as "other"
+const maxUnknownNodeTypes = 100
+
+// SetDeepCopyObserver installs the observer notified after each node copy,
+// e.g. to feed duration metrics. nil removes it.
+func SetDeepCopyObserver(observer DeepCopyObserver) {
+	deepCopyObserverMu.Lock()
+	defer deepCopyObserverMu.Unlock()
+	deepCopyObserver = observer
+}
+
+// observeDeepCopy reports a node copy to the observer
+func observeDeepCopy(duration time.Duration) {
+	deepCopyObserverMu.RLock()
+	observer := deepCopyObserver
+	deepCopyObserverMu.RUnlock()
+	if observer != nil {
+		observer(duration)
+	}
+}
+
+// CacheHitNodes returns the node count of the playbooks returned by the
+// last LoadPlaybook cache hit
+func CacheHitNodes() int64 {
+	return cacheHitNodes.Load()
+}
+
+// addLabeledCount adds n to the counter of label in counters
+func addLabeledCount(counters *sync.Map, label string, n uint64) {
+	counter, ok := counters.Load(label)
+	if !ok {
+		counter, _ = counters.LoadOrStore(label, new(atomic.Uint64))
+	}
+	counter.(*atomic.Uint64).Add(n)
+}
+
+// labeledCounts returns a snapshot of counters
+func labeledCounts(counters *sync.Map) map[string]uint64 {
+	counts := make(map[string]uint64)
+	counters.Range(func(key, value interface{}) bool {
+		counts[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
+
+// recordCorruptedStarters adds removed to the corrupted starters of app
+func recordCorruptedStarters(appName string, removed int) {
+	addLabeledCount(&corruptedStarters, appName, uint64(removed))
+}
+
+// CorruptedStartersRemoved returns per app the corrupted starter nodes
+// removed from loaded playbooks since startup
+func CorruptedStartersRemoved() map[string]uint64 {
+	return labeledCounts(&corruptedStarters)
+}
+
+// recordUnknownNodeType counts a node of a type without a registered step
+func recordUnknownNodeType(nodeType string) {
+	if _, ok := unknownNodeTypes.Load(nodeType); !ok && len(labeledCounts(&unknownNodeTypes)) >= maxUnknownNodeTypes {
+		nodeType = "other"
+	}
+	addLabeledCount(&unknownNodeTypes, nodeType, 1)
+}
+
+// UnknownNodeTypes returns per node type how many nodes were reached
+// without a registered step since startup
+func UnknownNodeTypes() map[string]uint64 {
+	return labeledCounts(&unknownNodeTypes)
+}
+
+// StarterNodeReached returns how many workflows reached a starter node
+// through a connection since startup
+func StarterNodeReached() uint64 {
+	return starterReached.Load()
+}
+
+// countNodes returns the nodes of all the playbooks of an app
+func countNodes(playbooks map[string]map[string]*model.Playbook) int {
+	count := 0
+	for _, outerValue := range playbooks {
+		for _, playbook := range outerValue {
+			if playbook != nil {
+				count += len(*playbook)
+			}
+		}
+	}
+	return count
+}
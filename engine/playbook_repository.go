@@ -3,12 +3,25 @@ package engine
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/arturoeanton/nflow-runtime/logger"
 	"github.com/arturoeanton/nflow-runtime/model"
 )
 
+// ErrPlaybookTooLarge is returned when a playbook has more nodes than
+// [playbook].max_nodes
+var ErrPlaybookTooLarge = errors.New("playbook exceeds the maximum number of nodes")
+
+// defaultMaxNodesPerPlaybook applies when [playbook].max_nodes is not set
+const defaultMaxNodesPerPlaybook = 2000
+
 // PlaybookRepository maneja el acceso thread-safe a los playbooks
 type PlaybookRepository interface {
 	Get(appName string) (map[string]map[string]*model.Playbook, error)
@@ -19,6 +32,9 @@ type PlaybookRepository interface {
 	InvalidateCache(appName string)
 	InvalidateAllCache()
 	GetCacheSize() int
+	AccessCount(appName string) uint64
+	MostAccessed(n int) []string
+	WarmMostAccessed(ctx context.Context, n int) (int, error)
 }
 
 // playbookRepository implementación concreta del repository
@@ -27,15 +43,25 @@ type playbookRepository struct {
 	playbooks   map[string]map[string]map[string]*model.Playbook
 	needsReload map[string]bool
 	db          *sql.DB
+
+	// accessCounts counts successful LoadPlaybook calls per app:
+	// app name -> *atomic.Uint64
+	accessCounts sync.Map
+
+	// load reads the playbooks of an app from the source, the database
+	// unless replaced in tests
+	load func(ctx context.Context, appName string) (map[string]map[string]*model.Playbook, error)
 }
 
 // NewPlaybookRepository crea una nueva instancia del repository
 func NewPlaybookRepository(db *sql.DB) PlaybookRepository {
-	return &playbookRepository{
+	r := &playbookRepository{
 		playbooks:   make(map[string]map[string]map[string]*model.Playbook),
 		needsReload: make(map[string]bool),
 		db:          db,
 	}
+	r.load = r.loadFromDB
+	return r
 }
 
 // Get obtiene los playbooks para una aplicación
@@ -80,16 +106,27 @@ func (r *playbookRepository) LoadPlaybook(ctx context.Context, appName string) (
 	// Check cache first (now that JSON unmarshaling is thread-safe)
 	if !r.NeedsReload(appName) {
 		if playbooks, err := r.Get(appName); err == nil && playbooks != nil {
-			// CRITICAL: Create deep copy to avoid concurrent modification of shared objects
-			// This prevents race conditions when multiple requests access the same workflow
-			copiedPlaybooks := deepCopyPlaybooks(playbooks)
-			logger.Verbosef("DEBUG: Returned cached playbook %s (deep copy)", appName)
-			return copiedPlaybooks, nil
+			// The cached playbooks are shared between requests and never
+			// mutated: step() deep copies each node before running it, which
+			// is the only place node data is written
+			logger.Verbosef("DEBUG: Returned cached playbook %s (shared)", appName)
+			cacheHitNodes.Store(int64(countNodes(playbooks)))
+			r.countAccess(appName)
+			return playbooks, nil
 		}
 	}
 
 	logger.Verbosef("DEBUG: Loading playbook %s from source (cache miss or reload needed)", appName)
+	playbooks, err := r.refresh(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+	r.countAccess(appName)
+	return playbooks, nil
+}
 
+// loadFromDB reads the playbooks of an app from the database
+func (r *playbookRepository) loadFromDB(ctx context.Context, appName string) (map[string]map[string]*model.Playbook, error) {
 	conn, err := r.db.Conn(ctx)
 	if err != nil {
 		logger.Error("Failed to get database connection:", err)
@@ -102,14 +139,30 @@ func (r *playbookRepository) LoadPlaybook(ctx context.Context, appName string) (
 		logger.Error("Failed to load playbook from database:", err)
 		return nil, err
 	}
+	return playbooks, nil
+}
+
+// refresh loads the playbooks of an app from the source, validates and
+// cleans them and replaces the cached ones
+func (r *playbookRepository) refresh(ctx context.Context, appName string) (map[string]map[string]*model.Playbook, error) {
+	playbooks, err := r.load(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
 
-	// DEBUG: Validate the freshly loaded playbooks
-	validatePlaybooksIntegrity(playbooks, appName)
+	// Reject oversized playbooks before they are cached, copied or executed
+	if err := validatePlaybooksSize(playbooks, appName, maxNodesPerPlaybook()); err != nil {
+		logger.Error("Rejected playbook:", err)
+		return nil, err
+	}
 
-	// CRITICAL: Clean playbooks BEFORE caching to prevent corrupted data from entering cache
+	// CRITICAL: Validate and clean playbooks BEFORE caching to prevent corrupted data from entering cache
 	cleanedPlaybooks := cleanPlaybooksForCache(playbooks, appName)
 
 	// Save cleaned playbooks to cache
+	if previous, _ := r.Get(appName); previous != nil {
+		forgetPlaybookVersions(previous)
+	}
 	r.Set(appName, cleanedPlaybooks)
 	r.SetReloaded(appName)
 
@@ -117,6 +170,95 @@ func (r *playbookRepository) LoadPlaybook(ctx context.Context, appName string) (
 
 }
 
+// countAccess records a successful LoadPlaybook call for appName
+func (r *playbookRepository) countAccess(appName string) {
+	counter, ok := r.accessCounts.Load(appName)
+	if !ok {
+		counter, _ = r.accessCounts.LoadOrStore(appName, new(atomic.Uint64))
+	}
+	counter.(*atomic.Uint64).Add(1)
+}
+
+// AccessCount returns the number of successful LoadPlaybook calls for appName
+func (r *playbookRepository) AccessCount(appName string) uint64 {
+	if counter, ok := r.accessCounts.Load(appName); ok {
+		return counter.(*atomic.Uint64).Load()
+	}
+	return 0
+}
+
+// MostAccessed returns up to n app names by decreasing access count, ties
+// by name
+func (r *playbookRepository) MostAccessed(n int) []string {
+	type appCount struct {
+		name  string
+		count uint64
+	}
+	var apps []appCount
+	r.accessCounts.Range(func(key, value interface{}) bool {
+		apps = append(apps, appCount{key.(string), value.(*atomic.Uint64).Load()})
+		return true
+	})
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].count != apps[j].count {
+			return apps[i].count > apps[j].count
+		}
+		return apps[i].name < apps[j].name
+	})
+	if n < len(apps) {
+		apps = apps[:n]
+	}
+	names := make([]string, len(apps))
+	for i, app := range apps {
+		names[i] = app.name
+	}
+	return names
+}
+
+// WarmMostAccessed reloads the n most accessed apps from the source so
+// their cache is fresh and never cold when invalidated. It returns how many
+// were reloaded; failures are logged and joined in the error.
+func (r *playbookRepository) WarmMostAccessed(ctx context.Context, n int) (int, error) {
+	var errs []error
+	warmed := 0
+	for _, appName := range r.MostAccessed(n) {
+		if _, err := r.refresh(ctx, appName); err != nil {
+			logger.Errorf("Failed to warm playbook cache of %s: %v", appName, err)
+			errs = append(errs, fmt.Errorf("%s: %w", appName, err))
+			continue
+		}
+		warmed++
+	}
+	return warmed, errors.Join(errs...)
+}
+
+// defaultCacheWarmCount applies when [playbook].cache_warm_count is not set
+const defaultCacheWarmCount = 10
+
+// StartPlaybookCacheWarmer reloads the count most accessed apps of repo
+// every interval until stop is called
+func StartPlaybookCacheWarmer(repo PlaybookRepository, interval time.Duration, count int) (stop func()) {
+	if count <= 0 {
+		count = defaultCacheWarmCount
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if warmed, _ := repo.WarmMostAccessed(ctx, count); warmed > 0 {
+					logger.Verbosef("Playbook cache warmer reloaded %d apps", warmed)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
 // InvalidateCache invalida el cache para forzar recarga
 func (r *playbookRepository) InvalidateCache(appName string) {
 	r.mu.Lock()
@@ -143,245 +285,180 @@ func (r *playbookRepository) GetCacheSize() int {
 	return len(r.playbooks)
 }
 
-// deepCopyPlaybooks creates a deep copy of playbooks to prevent concurrent modification
-func deepCopyPlaybooks(original map[string]map[string]*model.Playbook) map[string]map[string]*model.Playbook {
-	if original == nil {
-		return nil
+// maxNodesPerPlaybook returns the configured node limit per playbook
+func maxNodesPerPlaybook() int {
+	if maxNodes := GetConfig().PlaybookConfig.MaxNodes; maxNodes > 0 {
+		return maxNodes
 	}
+	return defaultMaxNodesPerPlaybook
+}
 
-	result := make(map[string]map[string]*model.Playbook, len(original))
-
-	for outerKey, outerValue := range original {
-		if outerValue == nil {
-			result[outerKey] = nil
-			continue
-		}
-
-		innerMap := make(map[string]*model.Playbook, len(outerValue))
+// validatePlaybooksSize checks that no playbook of the app has more than
+// maxNodes nodes. The error reports the offending flow and its node count.
+func validatePlaybooksSize(playbooks map[string]map[string]*model.Playbook, appName string, maxNodes int) error {
+	for outerKey, outerValue := range playbooks {
 		for innerKey, playbook := range outerValue {
 			if playbook == nil {
-				innerMap[innerKey] = nil
 				continue
 			}
-
-			// Deep copy the playbook (map of nodes)
-			copiedPlaybook := make(model.Playbook, len(*playbook))
-			for nodeID, node := range *playbook {
-				if node == nil {
-					copiedPlaybook[nodeID] = nil
-					continue
-				}
-
-				// Deep copy the node
-				copiedNode := &model.Node{
-					Data:    make(map[string]interface{}, len(node.Data)),
-					Outputs: make(map[string]*model.Output, len(node.Outputs)),
-				}
-
-				// Copy data map
-				for dataKey, dataValue := range node.Data {
-					copiedNode.Data[dataKey] = dataValue
-				}
-
-				// Copy outputs map
-				for outputKey, output := range node.Outputs {
-					if output == nil {
-						copiedNode.Outputs[outputKey] = nil
-						continue
-					}
-
-					// Deep copy the output and its connections
-					copiedOutput := &model.Output{
-						Connections: make([]struct {
-							Node   string `json:"node"`
-							Output string `json:"output"`
-						}, len(output.Connections)),
-					}
-
-					// Copy connections slice
-					copy(copiedOutput.Connections, output.Connections)
-
-					// DEBUG: Log the copy operation for starter nodes
-					if nodeType, ok := node.Data["type"]; ok && nodeType == "starter" && outputKey == "output_1" {
-						logger.Verbosef("DEBUG: Deep copying starter node %s: original connections=%d, copied connections=%d",
-							nodeID, len(output.Connections), len(copiedOutput.Connections))
-						if len(output.Connections) != len(copiedOutput.Connections) {
-							logger.Errorf("DEBUG: DEEP COPY CORRUPTION! Original had %d connections, copy has %d",
-								len(output.Connections), len(copiedOutput.Connections))
-						}
-					}
-
-					copiedNode.Outputs[outputKey] = copiedOutput
-				}
-
-				copiedPlaybook[nodeID] = copiedNode
+			if count := len(*playbook); count > maxNodes {
+				return fmt.Errorf("%w: %s/%s/%s has %d nodes (max %d)",
+					ErrPlaybookTooLarge, appName, outerKey, innerKey, count, maxNodes)
 			}
-
-			innerMap[innerKey] = &copiedPlaybook
 		}
-
-		result[outerKey] = innerMap
 	}
-
-	logger.Verbose("Created deep copy of playbooks to prevent race conditions")
-	return result
+	return nil
 }
 
-// validatePlaybooksIntegrity checks if the loaded playbooks have all required connections
-func validatePlaybooksIntegrity(playbooks map[string]map[string]*model.Playbook, appName string) {
-	if playbooks == nil {
-		logger.Error("DEBUG: Loaded playbooks is nil for app:", appName)
-		return
-	}
-
-	for outerKey, outerValue := range playbooks {
-		if outerValue == nil {
-			continue
-		}
-
-		for innerKey, playbook := range outerValue {
-			if playbook == nil {
-				continue
-			}
-
-			logger.Verbosef("DEBUG: Validating playbook %s/%s", outerKey, innerKey)
+// parallelCleanMinNodes is the app size from which flows are cleaned in
+// parallel; below it the goroutines cost more than they save
+const parallelCleanMinNodes = 5000
 
-			for nodeID, node := range *playbook {
-				if node == nil {
-					continue
-				}
-
-				// Check for starter nodes
-				if nodeType, ok := node.Data["type"]; ok && nodeType == "starter" {
-					// Extract additional info about the starter
-					urlpattern := "unknown"
-					method := "unknown"
-					if pattern, ok := node.Data["urlpattern"]; ok {
-						urlpattern = pattern.(string)
-					}
-					if m, ok := node.Data["method"]; ok {
-						method = m.(string)
-					}
-
-					logger.Verbosef("DEBUG: Found starter node %s in %s/%s - URL: %s, Method: %s",
-						nodeID, outerKey, innerKey, urlpattern, method)
-
-					if node.Outputs == nil {
-						logger.Errorf("DEBUG: CORRUPTION! Starter node %s (%s %s) has nil Outputs", nodeID, method, urlpattern)
-						continue
-					}
-
-					if output1, exists := node.Outputs["output_1"]; exists {
-						if output1 == nil {
-							logger.Errorf("DEBUG: CORRUPTION! Starter node %s (%s %s) has nil output_1", nodeID, method, urlpattern)
-						} else if output1.Connections == nil {
-							logger.Errorf("DEBUG: CORRUPTION! Starter node %s (%s %s) has nil Connections", nodeID, method, urlpattern)
-						} else if len(output1.Connections) == 0 {
-							logger.Errorf("DEBUG: CORRUPTION! Starter node %s (%s %s) has empty Connections array", nodeID, method, urlpattern)
-						} else {
-							logger.Verbosef("DEBUG: VALID! Starter node %s (%s %s) has %d connections", nodeID, method, urlpattern, len(output1.Connections))
-							for i, conn := range output1.Connections {
-								logger.Verbosef("DEBUG: Connection %d: Node=%s, Output=%s", i, conn.Node, conn.Output)
-							}
-						}
-					} else {
-						logger.Errorf("DEBUG: CORRUPTION! Starter node %s (%s %s) missing output_1", nodeID, method, urlpattern)
-					}
-				}
-			}
-		}
+// playbookCleanWorkers returns [playbook].clean_workers
+func playbookCleanWorkers() int {
+	if workers := GetConfig().PlaybookConfig.CleanWorkers; workers > 0 {
+		return workers
 	}
+	return runtime.GOMAXPROCS(0)
 }
 
-// cleanPlaybooksForCache removes corrupted starter nodes before caching to optimize performance
+// cleanPlaybooksForCache validates the loaded playbooks and removes the
+// corrupted starter nodes (without output_1 connections) before caching, in
+// a single pass over every node. Large apps are cleaned with up to
+// [playbook].clean_workers goroutines, one flow at a time each.
 func cleanPlaybooksForCache(playbooks map[string]map[string]*model.Playbook, appName string) map[string]map[string]*model.Playbook {
 	if playbooks == nil {
+		logger.Error("Loaded playbooks are nil for app:", appName)
 		return nil
 	}
 
-	cleanedPlaybooks := make(map[string]map[string]*model.Playbook)
-	totalRemoved := 0
+	type flow struct {
+		outerKey, innerKey string
+		playbook           *model.Playbook
+		cleaned            *model.Playbook
+		removed            int
+	}
 
+	cleanedPlaybooks := make(map[string]map[string]*model.Playbook, len(playbooks))
+	var flows []*flow
+	totalNodes := 0
 	for outerKey, outerValue := range playbooks {
 		if outerValue == nil {
 			cleanedPlaybooks[outerKey] = nil
 			continue
 		}
-
-		cleanedFlows := make(map[string]*model.Playbook)
+		cleanedFlows := make(map[string]*model.Playbook, len(outerValue))
 		for innerKey, playbook := range outerValue {
-			if playbook == nil {
-				cleanedFlows[innerKey] = nil
-				continue
+			cleanedFlows[innerKey] = nil
+			if playbook != nil {
+				flows = append(flows, &flow{outerKey: outerKey, innerKey: innerKey, playbook: playbook})
+				totalNodes += len(*playbook)
 			}
+		}
+		cleanedPlaybooks[outerKey] = cleanedFlows
+	}
 
-			cleanedPlaybook := make(model.Playbook)
-			removedFromFlow := 0
-
-			for nodeID, node := range *playbook {
-				if node == nil || node.Data == nil {
-					cleanedPlaybook[nodeID] = node
-					continue
-				}
-
-				// Check if this is a corrupted starter node
-				if nodeType, ok := node.Data["type"]; ok && nodeType == "starter" {
-					// Extract debugging info
-					urlpattern := "unknown"
-					method := "unknown"
-					if pattern, ok := node.Data["urlpattern"]; ok {
-						if patternStr, ok := pattern.(string); ok {
-							urlpattern = patternStr
-						}
-					}
-					if m, ok := node.Data["method"]; ok {
-						if methodStr, ok := m.(string); ok {
-							method = methodStr
-						}
-					}
-
-					// Check if it has proper connections
-					if node.Outputs == nil {
-						logger.Verbosef("DEBUG: Pre-cache cleanup removing starter node %s (%s %s) - no outputs", nodeID, method, urlpattern)
-						removedFromFlow++
-						continue
-					}
-
-					output1, exists := node.Outputs["output_1"]
-					if !exists || output1 == nil {
-						logger.Verbosef("DEBUG: Pre-cache cleanup removing starter node %s (%s %s) - no output_1", nodeID, method, urlpattern)
-						removedFromFlow++
-						continue
-					}
-
-					if output1.Connections == nil || len(output1.Connections) == 0 {
-						logger.Verbosef("DEBUG: Pre-cache cleanup removing starter node %s (%s %s) - empty connections", nodeID, method, urlpattern)
-						removedFromFlow++
-						continue
-					}
-
-					// Node is valid, keep it
-					logger.Verbosef("DEBUG: Pre-cache cleanup keeping valid starter node %s (%s %s) with %d connections", nodeID, method, urlpattern, len(output1.Connections))
+	clean := func(f *flow) {
+		f.cleaned, f.removed = cleanPlaybook(f.playbook, f.outerKey+"/"+f.innerKey)
+	}
+	workers := playbookCleanWorkers()
+	if workers > len(flows) {
+		workers = len(flows)
+	}
+	if workers > 1 && totalNodes >= parallelCleanMinNodes {
+		jobs := make(chan *flow)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for f := range jobs {
+					clean(f)
 				}
-
-				// Node is valid (not a corrupted starter), keep it
-				cleanedPlaybook[nodeID] = node
-			}
-
-			if removedFromFlow > 0 {
-				logger.Verbosef("DEBUG: Pre-cache cleanup removed %d corrupted starter nodes from flow %s/%s", removedFromFlow, outerKey, innerKey)
-				totalRemoved += removedFromFlow
-			}
-
-			cleanedFlows[innerKey] = &cleanedPlaybook
+			}()
+		}
+		for _, f := range flows {
+			jobs <- f
+		}
+		close(jobs)
+		wg.Wait()
+	} else {
+		for _, f := range flows {
+			clean(f)
 		}
-
-		cleanedPlaybooks[outerKey] = cleanedFlows
 	}
 
+	totalRemoved := 0
+	for _, f := range flows {
+		cleanedPlaybooks[f.outerKey][f.innerKey] = f.cleaned
+		totalRemoved += f.removed
+	}
 	if totalRemoved > 0 {
+		recordCorruptedStarters(appName, totalRemoved)
 		logger.Verbosef("DEBUG: Pre-cache cleanup completed for app %s - removed %d corrupted starter nodes total", appName, totalRemoved)
 	}
 
 	return cleanedPlaybooks
 }
+
+// cleanPlaybook returns a copy of playbook without its corrupted starter
+// nodes and how many were removed. Corruptions are logged as errors; the
+// details of valid starters only with -v.
+func cleanPlaybook(playbook *model.Playbook, flowPath string) (*model.Playbook, int) {
+	verbose := logger.GetLevel() >= logger.LevelVerbose
+	if verbose {
+		logger.Verbosef("DEBUG: Validating playbook %s", flowPath)
+	}
+
+	cleaned := make(model.Playbook, len(*playbook))
+	removed := 0
+	for nodeID, node := range *playbook {
+		if node == nil || node.Data == nil {
+			cleaned[nodeID] = node
+			continue
+		}
+		if nodeType, ok := node.Data["type"]; !ok || nodeType != "starter" {
+			cleaned[nodeID] = node
+			continue
+		}
+
+		urlpattern := "unknown"
+		method := "unknown"
+		if pattern, ok := node.Data["urlpattern"].(string); ok {
+			urlpattern = pattern
+		}
+		if m, ok := node.Data["method"].(string); ok {
+			method = m
+		}
+
+		problem := ""
+		output1, exists := node.Outputs["output_1"]
+		switch {
+		case node.Outputs == nil:
+			problem = "has nil Outputs"
+		case !exists:
+			problem = "missing output_1"
+		case output1 == nil:
+			problem = "has nil output_1"
+		case len(output1.Connections) == 0:
+			problem = "has empty Connections"
+		}
+		if problem != "" {
+			logger.Errorf("CORRUPTION! Removing starter node %s (%s %s) of %s: %s", nodeID, method, urlpattern, flowPath, problem)
+			removed++
+			continue
+		}
+
+		if verbose {
+			logger.Verbosef("DEBUG: VALID! Starter node %s (%s %s) of %s has %d connections", nodeID, method, urlpattern, flowPath, len(output1.Connections))
+			for i, conn := range output1.Connections {
+				logger.Verbosef("DEBUG: Connection %d: Node=%s, Output=%s", i, conn.Node, conn.Output)
+			}
+		}
+		cleaned[nodeID] = node
+	}
+	if removed > 0 {
+		logger.Verbosef("DEBUG: Pre-cache cleanup removed %d corrupted starter nodes from flow %s", removed, flowPath)
+	}
+	return &cleaned, removed
+}
@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func playbookWithNodes(n int) *model.Playbook {
+	pb := make(model.Playbook, n)
+	for i := 0; i < n; i++ {
+		pb[fmt.Sprint(i)] = &model.Node{Data: map[string]interface{}{"type": "js"}}
+	}
+	return &pb
+}
+
+func TestValidatePlaybooksSize(t *testing.T) {
+	playbooks := map[string]map[string]*model.Playbook{
+		"Home": {"data": playbookWithNodes(10)},
+	}
+	assert.NoError(t, validatePlaybooksSize(playbooks, "app", 10))
+
+	playbooks["Big"] = map[string]*model.Playbook{"data": playbookWithNodes(11)}
+	err := validatePlaybooksSize(playbooks, "app", 10)
+	assert.True(t, errors.Is(err, ErrPlaybookTooLarge))
+	assert.Contains(t, err.Error(), "app/Big/data has 11 nodes (max 10)")
+}
+
+// appWithFlows builds an app of flows flows, each with a valid starter and
+// nodes js nodes
+func appWithFlows(flows, nodes int) map[string]map[string]*model.Playbook {
+	app := make(map[string]map[string]*model.Playbook, flows)
+	for f := 0; f < flows; f++ {
+		pb := playbookWithNodes(nodes)
+		output := &model.Output{}
+		output.Connections = append(output.Connections, struct {
+			Node   string `json:"node"`
+			Output string `json:"output"`
+		}{Node: "0", Output: "input_1"})
+		(*pb)["start"] = &model.Node{
+			Data:    map[string]interface{}{"type": "starter", "urlpattern": fmt.Sprint("/flow", f), "method": "GET"},
+			Outputs: map[string]*model.Output{"output_1": output},
+		}
+		app[fmt.Sprint("Flow", f)] = map[string]*model.Playbook{"data": pb}
+	}
+	return app
+}
+
+func TestCleanPlaybooksForCache(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	for _, workers := range []int{1, 4} {
+		config := original
+		config.PlaybookConfig.CleanWorkers = workers
+		repo.SetConfig(config)
+
+		// Large enough to be cleaned in parallel with 4 workers
+		app := appWithFlows(20, parallelCleanMinNodes/20)
+		corrupted := app["Flow3"]["data"]
+		(*corrupted)["no_outputs"] = &model.Node{Data: map[string]interface{}{"type": "starter"}}
+		(*corrupted)["no_connections"] = &model.Node{
+			Data:    map[string]interface{}{"type": "starter"},
+			Outputs: map[string]*model.Output{"output_1": {}},
+		}
+		app["Empty"] = nil
+		app["Flow5"]["nil"] = nil
+
+		cleaned := cleanPlaybooksForCache(app, "app")
+		require.Len(t, cleaned, 21, "workers=%d", workers)
+		assert.Nil(t, cleaned["Empty"])
+		assert.Contains(t, cleaned["Flow5"], "nil")
+		assert.Nil(t, cleaned["Flow5"]["nil"])
+
+		flow := *cleaned["Flow3"]["data"]
+		assert.Len(t, flow, parallelCleanMinNodes/20+1, "workers=%d", workers)
+		assert.NotContains(t, flow, "no_outputs")
+		assert.NotContains(t, flow, "no_connections")
+		assert.Contains(t, flow, "start")
+		assert.Len(t, *corrupted, parallelCleanMinNodes/20+3, "the loaded playbook is not modified")
+		for name, flows := range app {
+			if flows != nil && name != "Flow3" {
+				assert.Len(t, *cleaned[name]["data"], len(*flows["data"]), name)
+			}
+		}
+	}
+	assert.Nil(t, cleanPlaybooksForCache(nil, "app"))
+}
+
+// BenchmarkCleanPlaybooksForCache measures the validation and cleanup of a
+// cold load of a large multi-flow app
+func BenchmarkCleanPlaybooksForCache(b *testing.B) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	app := appWithFlows(50, 2000)
+	workerCounts := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		workerCounts = append(workerCounts, n)
+	}
+	for _, workers := range workerCounts {
+		b.Run(fmt.Sprint("workers=", workers), func(b *testing.B) {
+			config := original
+			config.PlaybookConfig.CleanWorkers = workers
+			repo.SetConfig(config)
+			for i := 0; i < b.N; i++ {
+				cleanPlaybooksForCache(app, "app")
+			}
+		})
+	}
+}
+
+// TestLoadPlaybookSharedCacheConcurrency reads the shared cached playbook from
+// many goroutines while each one copies and mutates nodes the way step()
+// does. Run with -race: the cache must never be written.
+func TestLoadPlaybookSharedCacheConcurrency(t *testing.T) {
+	repo := NewPlaybookRepository(nil)
+	cached := map[string]map[string]*model.Playbook{"Home": {"data": playbookWithNodes(50)}}
+	repo.Set("app", cached)
+	repo.SetReloaded("app")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				playbooks, err := repo.LoadPlaybook(context.Background(), "app")
+				if !assert.NoError(t, err) {
+					return
+				}
+				pb := *playbooks["Home"]["data"]
+				actor, err := pb[fmt.Sprint(j)].DeepCopy()
+				if !assert.NoError(t, err) {
+					return
+				}
+				actor.Data["compile"] = fmt.Sprintf("worker %d", id)
+				actor.Data["storage_id"] = j
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	playbooks, err := repo.LoadPlaybook(context.Background(), "app")
+	assert.NoError(t, err)
+	for _, node := range *playbooks["Home"]["data"] {
+		assert.Equal(t, map[string]interface{}{"type": "js"}, node.Data)
+	}
+}
+
+// newCountingRepository returns a repository loading from a fake source that
+// counts the loads per app; apps named "broken" fail to load
+func newCountingRepository() (*playbookRepository, *sync.Map) {
+	repo := NewPlaybookRepository(nil).(*playbookRepository)
+	loads := &sync.Map{}
+	repo.load = func(ctx context.Context, appName string) (map[string]map[string]*model.Playbook, error) {
+		if appName == "broken" {
+			return nil, errors.New("source unavailable")
+		}
+		n, _ := loads.LoadOrStore(appName, new(atomic.Int64))
+		n.(*atomic.Int64).Add(1)
+		return map[string]map[string]*model.Playbook{"Home": {"data": playbookWithNodes(1)}}, nil
+	}
+	return repo, loads
+}
+
+func loadCount(loads *sync.Map, appName string) int64 {
+	if n, ok := loads.Load(appName); ok {
+		return n.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+func TestPlaybookRepositoryAccessCounts(t *testing.T) {
+	repo, loads := newCountingRepository()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := repo.LoadPlaybook(ctx, "hot")
+		assert.NoError(t, err)
+	}
+	_, err := repo.LoadPlaybook(ctx, "warm")
+	assert.NoError(t, err)
+	_, err = repo.LoadPlaybook(ctx, "broken")
+	assert.Error(t, err)
+
+	assert.Equal(t, uint64(3), repo.AccessCount("hot"), "cache hits count as accesses")
+	assert.Equal(t, int64(1), loadCount(loads, "hot"))
+	assert.Equal(t, uint64(0), repo.AccessCount("broken"), "failed loads are not counted")
+	assert.Equal(t, []string{"hot", "warm"}, repo.MostAccessed(5))
+	assert.Equal(t, []string{"hot"}, repo.MostAccessed(1))
+}
+
+func TestPlaybookCacheWarmerKeepsHotAppsWarm(t *testing.T) {
+	repo, loads := newCountingRepository()
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err := repo.LoadPlaybook(ctx, "hot")
+		assert.NoError(t, err)
+	}
+	_, err := repo.LoadPlaybook(ctx, "cold")
+	assert.NoError(t, err)
+
+	repo.InvalidateAllCache()
+	assert.True(t, repo.NeedsReload("hot"))
+
+	stop := StartPlaybookCacheWarmer(repo, 10*time.Millisecond, 1)
+	defer stop()
+
+	assert.Eventually(t, func() bool { return !repo.NeedsReload("hot") }, time.Second, 5*time.Millisecond,
+		"the most accessed app is reloaded in the background")
+	assert.Eventually(t, func() bool { return loadCount(loads, "hot") >= 3 }, time.Second, 5*time.Millisecond,
+		"and kept fresh on every run")
+	assert.True(t, repo.NeedsReload("cold"), "apps outside the top count stay invalidated")
+	assert.Equal(t, int64(1), loadCount(loads, "cold"))
+}
+
+func TestWarmMostAccessedReportsFailures(t *testing.T) {
+	repo, _ := newCountingRepository()
+	ctx := context.Background()
+	_, err := repo.LoadPlaybook(ctx, "ok")
+	assert.NoError(t, err)
+	// broken loaded fine once, then its source fails
+	repo.countAccess("broken")
+
+	warmed, err := repo.WarmMostAccessed(ctx, 10)
+	assert.Equal(t, 1, warmed)
+	assert.ErrorContains(t, err, "broken: source unavailable")
+}
+
+func TestLoadPlaybookCacheHitRecordsNodes(t *testing.T) {
+	repo := NewPlaybookRepository(nil).(*playbookRepository)
+	repo.load = func(ctx context.Context, appName string) (map[string]map[string]*model.Playbook, error) {
+		return map[string]map[string]*model.Playbook{
+			"Home":  {"data": playbookWithNodes(3)},
+			"Admin": {"data": playbookWithNodes(4)},
+		}, nil
+	}
+	ctx := context.Background()
+	cacheHitNodes.Store(0)
+
+	_, err := repo.LoadPlaybook(ctx, "app")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), CacheHitNodes(), "a load from the source is not a cache hit")
+
+	_, err = repo.LoadPlaybook(ctx, "app")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), CacheHitNodes())
+}
+
+func TestLoadPlaybookCountsCorruptedStarters(t *testing.T) {
+	repo := NewPlaybookRepository(nil).(*playbookRepository)
+	repo.load = func(ctx context.Context, appName string) (map[string]map[string]*model.Playbook, error) {
+		app := appWithFlows(2, 3)
+		(*app["Flow0"]["data"])["broken"] = &model.Node{Data: map[string]interface{}{"type": "starter"}}
+		return app, nil
+	}
+	before := CorruptedStartersRemoved()["corrupted_app"]
+
+	_, err := repo.LoadPlaybook(context.Background(), "corrupted_app")
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, CorruptedStartersRemoved()["corrupted_app"])
+
+	// Cache hits do not clean again
+	_, err = repo.LoadPlaybook(context.Background(), "corrupted_app")
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, CorruptedStartersRemoved()["corrupted_app"])
+
+	repo.InvalidateCache("corrupted_app")
+	_, err = repo.LoadPlaybook(context.Background(), "corrupted_app")
+	assert.NoError(t, err)
+	assert.Equal(t, before+2, CorruptedStartersRemoved()["corrupted_app"], "every cold load counts")
+}
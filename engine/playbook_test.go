@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStarter(method, urlpattern, next string) *model.Node {
+	output := &model.Output{}
+	output.Connections = append(output.Connections, struct {
+		Node   string `json:"node"`
+		Output string `json:"output"`
+	}{Node: next, Output: "input_1"})
+	return &model.Node{
+		Data:    map[string]interface{}{"type": "starter", "method": method, "urlpattern": urlpattern},
+		Outputs: map[string]*model.Output{"output_1": output},
+	}
+}
+
+func getTestWorkflow(t *testing.T, playbooks map[string]map[string]*model.Playbook, path string) (*RuntimeController, model.Vars, int, echo.Context) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, path, nil), httptest.NewRecorder())
+	runeable, vars, code, _, _ := GetWorkflow(c, playbooks, path, http.MethodPost, "app")
+	if runeable == nil {
+		return nil, vars, code, c
+	}
+	rc, ok := runeable.(*RuntimeController)
+	require.True(t, ok)
+	return rc, vars, code, c
+}
+
+func TestGetWorkflowFallbackStarter(t *testing.T) {
+	api := model.Playbook{"1": testStarter("ANY", "/api/orders/:id", "orders")}
+	catchAll := model.Playbook{"1": testStarter("ANY", FallbackURLPattern, "not_found")}
+	playbooks := map[string]map[string]*model.Playbook{
+		"Home": {"data": &api},
+		"404":  {"data": &catchAll},
+	}
+
+	rc, vars, code, c := getTestWorkflow(t, playbooks, "/api/orders/7")
+	require.NotNil(t, rc)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Home", rc.FlowName)
+	assert.Equal(t, "7", vars["id"])
+	assert.Equal(t, "/api/orders/:id", c.Get(EndpointPatternKey))
+
+	rc, vars, code, c = getTestWorkflow(t, playbooks, "/missing/page")
+	require.NotNil(t, rc)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "404", rc.FlowName)
+	assert.Equal(t, "/missing/page", vars["*"])
+	assert.Equal(t, FallbackURLPattern, c.Get(EndpointPatternKey))
+}
+
+func TestGetWorkflowWithoutFallbackStarter(t *testing.T) {
+	api := model.Playbook{"1": testStarter("GET", "/api/orders/:id", "orders")}
+	playbooks := map[string]map[string]*model.Playbook{"Home": {"data": &api}}
+
+	rc, _, code, _ := getTestWorkflow(t, playbooks, "/missing/page")
+	assert.Nil(t, rc)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// The fallback also honours the method of its starter
+	catchAll := model.Playbook{"1": testStarter("GET", FallbackURLPattern, "not_found")}
+	playbooks["404"] = map[string]*model.Playbook{"data": &catchAll}
+	rc, _, code, _ = getTestWorkflow(t, playbooks, "/missing/page")
+	assert.Nil(t, rc)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestGetWorkflowDeterministicStarter(t *testing.T) {
+	// Several starters match /orders/7; the first flow and node in key order win
+	byID := model.Playbook{"2": testStarter("ANY", "/orders/:id", "by_id"), "1": testStarter("POST", "/orders/:id", "by_id_post")}
+	byName := model.Playbook{"1": testStarter("ANY", "/orders/:name", "by_name")}
+	playbooks := map[string]map[string]*model.Playbook{
+		"Orders": {"data": &byID},
+		"Legacy": {"data": &byName},
+		"Zeta":   {"data": &byName},
+	}
+
+	for i := 0; i < 200; i++ {
+		rc, vars, _, _ := getTestWorkflow(t, playbooks, "/orders/7")
+		require.NotNil(t, rc)
+		require.Equal(t, "Legacy", rc.FlowName)
+		require.Equal(t, "7", vars["name"])
+	}
+
+	delete(playbooks, "Legacy")
+	delete(playbooks, "Zeta")
+	for i := 0; i < 200; i++ {
+		rc, _, _, _ := getTestWorkflow(t, playbooks, "/orders/7")
+		require.NotNil(t, rc)
+		require.Equal(t, "by_id_post", rc.Start.Outputs["output_1"].Connections[0].Node)
+	}
+}
+
+func TestGetOutputKeysSorted(t *testing.T) {
+	outputs := map[string]*model.Output{"output_3": {}, "output_1": {}, "output_2": {}}
+	for i := 0; i < 50; i++ {
+		require.Equal(t, []string{"output_1", "output_2", "output_3"}, getOutputKeys(outputs))
+	}
+	assert.Equal(t, []string{"<empty map>"}, getOutputKeys(map[string]*model.Output{}))
+}
@@ -1,7 +1,16 @@
 package engine
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/arturoeanton/nflow-runtime/plugins"
 	"github.com/labstack/echo/v4"
@@ -13,36 +22,335 @@ type NflowPlugin interface {
 	AddFeatureJS() map[string]interface{}
 }
 
-var Plugins map[string]NflowPlugin
+// PluginShutdowner is implemented by plugins holding resources that must be
+// released when the plugins are reloaded
+type PluginShutdowner interface {
+	Shutdown() error
+}
 
-func LoadPlugins() {
-	Plugins = make(map[string]NflowPlugin)
+// PluginHealthChecker is implemented by plugins depending on external
+// services (SMTP, S3, databases); HealthCheck returns why the plugin can
+// not work right now
+type PluginHealthChecker interface {
+	HealthCheck() error
+}
 
-	pluing1 := plugins.ClientHTTP("client_http")
-	Plugins[pluing1.Name()] = pluing1
+// PluginRequestFeatures is implemented by plugins whose JS functions depend
+// on the request, like calls that stop when the client disconnects. They
+// replace the functions of AddFeatureJS with the same name.
+type PluginRequestFeatures interface {
+	AddFeatureJSRequest(c echo.Context) map[string]interface{}
+}
 
-	pluing2 := plugins.GojaPlugin("goja")
-	Plugins[pluing2.Name()] = pluing2
+// PluginFactory creates a plugin from the configuration
+type PluginFactory func(config *ConfigWorkspace) NflowPlugin
 
-	pluing3 := plugins.TemplatePluings("template")
-	Plugins[pluing3.Name()] = pluing3
+// pluginFactory is a plugin name with its factory, in load order
+type pluginFactory struct {
+	name    string
+	factory PluginFactory
+}
 
-	pluing4 := plugins.MailPlugin("mail")
-	Plugins[pluing4.Name()] = pluing4
+var (
+	pluginFactoriesMu sync.RWMutex
+	pluginFactories   = []pluginFactory{
+		{"client_http", func(config *ConfigWorkspace) NflowPlugin { return plugins.ClientHTTP("client_http") }},
+		{"goja", func(config *ConfigWorkspace) NflowPlugin { return plugins.GojaPlugin("goja") }},
+		{"template", func(config *ConfigWorkspace) NflowPlugin { return plugins.TemplatePluings("template") }},
+		{"mail", func(config *ConfigWorkspace) NflowPlugin { return plugins.MailPlugin("mail") }},
+		{"rules", func(config *ConfigWorkspace) NflowPlugin { return plugins.RulePlugin("rule") }},
+		{"twilio", func(config *ConfigWorkspace) NflowPlugin {
+			plugin := plugins.TwilioPlugin("twilio")
+			plugin.Initialize(config.TwilioConfig.Enable, config.TwilioConfig.AccountSid, config.TwilioConfig.AuthToken, config.TwilioConfig.VerifyServiceID)
+			return plugin
+		}},
+		{"ia", func(config *ConfigWorkspace) NflowPlugin { return plugins.IAnFlow("ia") }},
+		{"grpc", func(config *ConfigWorkspace) NflowPlugin {
+			plugin := plugins.GrpcPlugin("grpc")
+			plugin.Initialize(config.VMPoolConfig.EnableNetwork, config.GrpcClientConfig.DescriptorSet, time.Duration(config.GrpcClientConfig.Timeout)*time.Second)
+			return plugin
+		}},
+		{"queue", func(config *ConfigWorkspace) NflowPlugin {
+			plugin := plugins.QueuePlugin("queue")
+			plugin.Initialize(newPublisher(config.QueueConfig))
+			return plugin
+		}},
+		{"files", func(config *ConfigWorkspace) NflowPlugin {
+			plugin := plugins.FilesPlugin("files")
+			if err := plugin.Initialize(config.VMPoolConfig.EnableFileSystem, config.FileSystemConfig.BaseDir, config.FileSystemConfig.MaxFileSize); err != nil {
+				log.Println("File helpers disabled:", err)
+			}
+			return plugin
+		}},
+		{"s3", func(config *ConfigWorkspace) NflowPlugin {
+			plugin := plugins.S3Plugin("s3")
+			if err := plugin.Initialize(config.VMPoolConfig.EnableNetwork, plugins.S3Options{
+				Endpoint:  config.S3Config.Endpoint,
+				Region:    config.S3Config.Region,
+				AccessKey: config.S3Config.AccessKey,
+				SecretKey: config.S3Config.SecretKey,
+				PathStyle: config.S3Config.PathStyle,
+			}); err != nil {
+				log.Println("S3 plugin disabled:", err)
+			}
+			return plugin
+		}},
+	}
+)
 
-	pluing5 := plugins.RulePlugin("rule")
-	Plugins[pluing5.Name()] = pluing5
+// RegisterPluginFactory adds a plugin loaded by LoadPlugins and
+// ReloadPlugins, replacing the factory with the same name. A nil factory
+// removes it.
+func RegisterPluginFactory(name string, factory PluginFactory) {
+	pluginFactoriesMu.Lock()
+	defer pluginFactoriesMu.Unlock()
+	for i, f := range pluginFactories {
+		if f.name == name {
+			if factory == nil {
+				pluginFactories = slices.Delete(pluginFactories, i, i+1)
+				return
+			}
+			pluginFactories[i].factory = factory
+			return
+		}
+	}
+	if factory != nil {
+		pluginFactories = append(pluginFactories, pluginFactory{name, factory})
+	}
+}
 
-	pluing6 := plugins.TwilioPlugin("twilio")
-	config := GetConfig()
-	pluing6.Initialize(config.TwilioConfig.Enable, config.TwilioConfig.AccountSid, config.TwilioConfig.AuthToken, config.TwilioConfig.VerifyServiceID)
-	Plugins[pluing6.Name()] = pluing6
+// pluginSet is a loaded generation of plugins. Requests pin the set they
+// started with, so a reload never changes the plugins of a running workflow;
+// a retired set is drained when its last request releases it.
+type pluginSet struct {
+	plugins map[string]NflowPlugin
 
-	pluing7 := plugins.IAnFlow("ia")
-	Plugins[pluing7.Name()] = pluing7
+	refs      atomic.Int64
+	retired   atomic.Bool
+	drained   chan struct{}
+	drainOnce sync.Once
+}
 
-	log.Println("Plugins loaded: ", len(Plugins))
+func newPluginSet(loaded map[string]NflowPlugin) *pluginSet {
+	return &pluginSet{plugins: loaded, drained: make(chan struct{})}
+}
+
+// pin adds a user to a set already pinned by the caller, e.g. for work
+// outliving the request
+func (s *pluginSet) pin() {
+	s.refs.Add(1)
+}
 
+// release unpins the set from a request
+func (s *pluginSet) release() {
+	if s.refs.Add(-1) == 0 && s.retired.Load() {
+		s.drainOnce.Do(func() { close(s.drained) })
+	}
 }
 
-//
+// retire marks the set as replaced; drained is closed once no request
+// uses it
+func (s *pluginSet) retire() {
+	s.retired.Store(true)
+	if s.refs.Load() == 0 {
+		s.drainOnce.Do(func() { close(s.drained) })
+	}
+}
+
+// shutdown calls the Shutdown hook of the plugins implementing it
+func (s *pluginSet) shutdown() {
+	for name, plugin := range s.plugins {
+		if shutdowner, ok := plugin.(PluginShutdowner); ok {
+			if err := shutdowner.Shutdown(); err != nil {
+				log.Printf("Plugin %s shutdown failed: %v\n", name, err)
+			}
+		}
+	}
+}
+
+var (
+	currentPlugins atomic.Pointer[pluginSet]
+	emptyPlugins   = newPluginSet(map[string]NflowPlugin{})
+	reloadMu       sync.Mutex
+)
+
+// acquirePlugins pins the current plugin set; the caller must release it
+func acquirePlugins() *pluginSet {
+	for {
+		set := currentPlugins.Load()
+		if set == nil {
+			return nil
+		}
+		set.refs.Add(1)
+		if currentPlugins.Load() == set {
+			return set
+		}
+		// Replaced while pinning it, try again with the new set
+		set.release()
+	}
+}
+
+// pluginSetKey is the echo context key holding the plugin set pinned by
+// the request
+const pluginSetKey = "_nflow_plugins"
+
+// requestPlugins returns the plugin set pinned by the request, the current
+// one when the request did not pin any
+func requestPlugins(c echo.Context) *pluginSet {
+	if c != nil {
+		if set, ok := c.Get(pluginSetKey).(*pluginSet); ok {
+			return set
+		}
+	}
+	if set := currentPlugins.Load(); set != nil {
+		return set
+	}
+	return emptyPlugins
+}
+
+// GetPlugin returns the plugin named name of the current plugin set
+func GetPlugin(name string) (NflowPlugin, bool) {
+	plugin, ok := requestPlugins(nil).plugins[name]
+	return plugin, ok
+}
+
+// PluginNames returns the names of the loaded plugins, sorted
+func PluginNames() []string {
+	return slices.Sorted(maps.Keys(requestPlugins(nil).plugins))
+}
+
+// CheckPluginsHealth runs the health checks of the loaded plugins at once
+// and returns the result per plugin name. Plugins without HealthCheck are
+// healthy (nil); checks still running when ctx is done report its error.
+func CheckPluginsHealth(ctx context.Context) map[string]error {
+	type result struct {
+		name string
+		err  error
+	}
+	loaded := requestPlugins(nil).plugins
+	results := make(map[string]error, len(loaded))
+	done := make(chan result, len(loaded))
+	pending := 0
+	for name, plugin := range loaded {
+		checker, ok := plugin.(PluginHealthChecker)
+		if !ok {
+			results[name] = nil
+			continue
+		}
+		pending++
+		go func(name string, checker PluginHealthChecker) {
+			done <- result{name, checker.HealthCheck()}
+		}(name, checker)
+	}
+	for ; pending > 0; pending-- {
+		select {
+		case r := <-done:
+			results[r.name] = r.err
+		case <-ctx.Done():
+			for name, plugin := range loaded {
+				if _, checked := results[name]; !checked {
+					if _, ok := plugin.(PluginHealthChecker); ok {
+						results[name] = fmt.Errorf("health check did not finish: %w", ctx.Err())
+					}
+				}
+			}
+			return results
+		}
+	}
+	return results
+}
+
+// testModeEnabled reports whether [test_mode] or NFLOW_TEST_MODE turn
+// test mode on
+func testModeEnabled(config *ConfigWorkspace) bool {
+	if enabled, err := strconv.ParseBool(os.Getenv("NFLOW_TEST_MODE")); err == nil {
+		return enabled
+	}
+	return config.TestModeConfig.Enabled
+}
+
+// buildPlugins creates the plugins listed in [plugin].plugins, all the
+// registered ones when the list is empty
+func buildPlugins(config *ConfigWorkspace) map[string]NflowPlugin {
+	plugins.ConfigureHTTPCircuitBreaker(
+		config.HTTPClientConfig.CircuitBreakerEnabled,
+		config.HTTPClientConfig.CircuitBreakerThreshold,
+		time.Duration(config.HTTPClientConfig.CircuitBreakerCooldown)*time.Second,
+	)
+	plugins.ConfigureHTTPLimits(config.HTTPClientConfig.MaxResponseBytes, config.HTTPClientConfig.MaxDownloadBytes)
+	plugins.AllowInsecureTLS(config.HTTPClientConfig.AllowInsecureTLS)
+	plugins.ConfigureHTTPTimeout(time.Duration(config.HTTPClientConfig.Timeout) * time.Second)
+	plugins.ConfigureTestMode(testModeEnabled(config), config.TestModeConfig.MaxRecordedCalls)
+	configureSeed(testModeEnabled(config), testModeSeed(config))
+
+	pluginFactoriesMu.RLock()
+	defer pluginFactoriesMu.RUnlock()
+	loaded := make(map[string]NflowPlugin)
+	for _, f := range pluginFactories {
+		if len(config.PluginConfig.Plugins) > 0 && !slices.Contains(config.PluginConfig.Plugins, f.name) {
+			continue
+		}
+		plugin := f.factory(config)
+		loaded[plugin.Name()] = plugin
+	}
+	return loaded
+}
+
+// LoadPlugins creates the configured plugins
+func LoadPlugins() {
+	currentPlugins.Store(newPluginSet(buildPlugins(GetConfig())))
+	log.Println("Plugins loaded: ", len(requestPlugins(nil).plugins))
+}
+
+// ReloadPlugins creates the configured plugins again and makes them the
+// ones used by new requests. Requests already running keep the previous
+// plugins; their Shutdown hooks run once the last of those requests ends.
+// It waits for that until ctx is done and returns the number of plugins
+// loaded; an error means the old plugins are still draining and will be
+// shut down in the background.
+func ReloadPlugins(ctx context.Context) (int, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next := newPluginSet(buildPlugins(GetConfig()))
+	old := currentPlugins.Swap(next)
+	log.Println("Plugins reloaded: ", len(next.plugins))
+	if old == nil {
+		return len(next.plugins), nil
+	}
+
+	old.retire()
+	select {
+	case <-old.drained:
+		old.shutdown()
+		return len(next.plugins), nil
+	case <-ctx.Done():
+		go func() {
+			<-old.drained
+			old.shutdown()
+		}()
+		return len(next.plugins), fmt.Errorf("previous plugins still in use: %w", ctx.Err())
+	}
+}
+
+// newPublisher creates the publish() backend described by config, or nil
+func newPublisher(config QueueConfig) plugins.Publisher {
+	switch config.Backend {
+	case "":
+		return nil
+	case "redis":
+		if GetConfig().RedisConfig.Host == "" {
+			log.Println("Queue publisher disabled: redis host is not configured")
+			return nil
+		}
+		publisher, err := plugins.NewRedisPublisher(GetRedisClient(), config.RedisMode, config.StreamMaxLen)
+		if err != nil {
+			log.Println("Queue publisher disabled:", err)
+			return nil
+		}
+		return publisher
+	default:
+		log.Println("Queue publisher disabled: unknown backend", config.Backend)
+		return nil
+	}
+}
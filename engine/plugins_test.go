@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reloadTestPlugin exposes reload_version() returning the generation that
+// created it and counts its shutdowns
+type reloadTestPlugin struct {
+	version  int64
+	shutdown *atomic.Int64
+}
+
+func (p *reloadTestPlugin) Run(c echo.Context, vars map[string]string, payloadIn interface{}, dromedary_data string, callback chan string) (interface{}, string, error) {
+	return payloadIn, "output_1", nil
+}
+
+func (p *reloadTestPlugin) Name() string { return "test_reload" }
+
+func (p *reloadTestPlugin) AddFeatureJS() map[string]interface{} {
+	return map[string]interface{}{
+		"reload_version": func() int64 { return p.version },
+	}
+}
+
+func (p *reloadTestPlugin) Shutdown() error {
+	p.shutdown.Add(1)
+	return nil
+}
+
+// pluginVersion runs reload_version() with the features of set
+func pluginVersion(t *testing.T, set *pluginSet) int64 {
+	vm := goja.New()
+	for key, fx := range set.plugins["test_reload"].AddFeatureJS() {
+		vm.Set(key, fx)
+	}
+	v, err := vm.RunString("reload_version()")
+	require.NoError(t, err)
+	return v.ToInteger()
+}
+
+func TestReloadPlugins(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+	config := original
+	config.PluginConfig.Plugins = []string{"test_reload"}
+	repo.SetConfig(config)
+
+	pluginFactoriesMu.RLock()
+	originalFactories := append([]pluginFactory(nil), pluginFactories...)
+	pluginFactoriesMu.RUnlock()
+	originalSet := currentPlugins.Load()
+	defer func() {
+		pluginFactoriesMu.Lock()
+		pluginFactories = originalFactories
+		pluginFactoriesMu.Unlock()
+		currentPlugins.Store(originalSet)
+	}()
+
+	var generation, shutdowns atomic.Int64
+	RegisterPluginFactory("test_reload", func(config *ConfigWorkspace) NflowPlugin {
+		return &reloadTestPlugin{version: generation.Add(1), shutdown: &shutdowns}
+	})
+
+	LoadPlugins()
+	assert.Equal(t, []string{"test_reload"}, PluginNames())
+
+	// A request in flight keeps the plugins it started with
+	c := createTestContext()
+	inFlight := acquirePlugins()
+	c.Set(pluginSetKey, inFlight)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	loaded, err := ReloadPlugins(ctx)
+	assert.Error(t, err, "the previous plugins are still in use")
+	assert.Equal(t, 1, loaded)
+
+	assert.Equal(t, int64(2), pluginVersion(t, requestPlugins(nil)), "new requests get the reloaded plugins")
+	assert.Equal(t, int64(1), pluginVersion(t, requestPlugins(c)), "the running request keeps its plugins")
+	assert.Equal(t, int64(0), shutdowns.Load())
+
+	inFlight.release()
+	assert.Eventually(t, func() bool { return shutdowns.Load() == 1 }, time.Second, 5*time.Millisecond,
+		"the previous plugins are shut down when the last request ends")
+
+	// Without requests in flight the reload shuts the old plugins down at once
+	_, err = ReloadPlugins(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), shutdowns.Load())
+	assert.Equal(t, int64(3), pluginVersion(t, requestPlugins(nil)))
+}
+
+// healthTestPlugin reports err from HealthCheck after delay
+type healthTestPlugin struct {
+	reloadTestPlugin
+	name  string
+	err   error
+	delay time.Duration
+}
+
+func (p *healthTestPlugin) Name() string { return p.name }
+
+func (p *healthTestPlugin) HealthCheck() error {
+	time.Sleep(p.delay)
+	return p.err
+}
+
+func TestCheckPluginsHealth(t *testing.T) {
+	originalSet := currentPlugins.Load()
+	defer currentPlugins.Store(originalSet)
+
+	smtpDown := errors.New("dial tcp smtp.example.com:587: connection refused")
+	currentPlugins.Store(newPluginSet(map[string]NflowPlugin{
+		"plain": &reloadTestPlugin{},
+		"mail":  &healthTestPlugin{name: "mail", err: smtpDown},
+		"s3":    &healthTestPlugin{name: "s3"},
+		"slow":  &healthTestPlugin{name: "slow", delay: time.Second},
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results := CheckPluginsHealth(ctx)
+
+	require.Len(t, results, 4)
+	assert.NoError(t, results["plain"], "plugins without a health check are healthy")
+	assert.NoError(t, results["s3"])
+	assert.ErrorIs(t, results["mail"], smtpDown)
+	assert.ErrorIs(t, results["slow"], context.DeadlineExceeded)
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/arturoeanton/nflow-runtime/audit"
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/security/sanitizer"
+	"github.com/labstack/echo/v4"
+)
+
+// Detail levels of the response to a panic, [debug].panic_detail
+const (
+	PanicDetailMinimal = "minimal" // Generic error and correlation ID
+	PanicDetailMessage = "message" // Plus the panic value
+	PanicDetailStack   = "stack"   // Plus the stack
+)
+
+// panicsRecovered counts the panics answered by RecoverMiddleware
+var panicsRecovered atomic.Uint64
+
+// PanicCount returns the number of panics recovered while serving requests
+func PanicCount() uint64 {
+	return panicsRecovered.Load()
+}
+
+// panicDetail returns the detail level for the request: panic_detail,
+// message by default. The stack is only shown to requests passing the debug
+// auth; others get the message.
+func panicDetail(c echo.Context, config DebugConfig) string {
+	switch config.PanicDetail {
+	case PanicDetailMinimal:
+		return PanicDetailMinimal
+	case PanicDetailStack:
+		if debugAuthorized(c) {
+			return PanicDetailStack
+		}
+	}
+	return PanicDetailMessage
+}
+
+// RecoverMiddleware answers a panic in a handler with a 500 carrying a
+// correlation ID. The panic and its stack are logged sanitized under that
+// ID and recorded in the audit log; the client gets them as well depending
+// on [debug].panic_detail and the debug auth.
+func RecoverMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				err = respondPanic(c, r, debug.Stack())
+			}()
+			return next(c)
+		}
+	}
+}
+
+// respondPanic logs and counts the panic r and answers it
+func respondPanic(c echo.Context, r interface{}, stack []byte) error {
+	panicsRecovered.Add(1)
+	correlationID := requestCorrelationID(c)
+	ls := sanitizer.NewLogSanitizer(nil)
+	message := ls.Sanitize(fmt.Sprint(r))
+	sanitizedStack := ls.Sanitize(string(stack))
+
+	req := c.Request()
+	logger.Errorf("Panic %s in %s %s: %s\n%s", correlationID, req.Method, req.URL.Path, message, sanitizedStack)
+	recordAudit(c, audit.EventPanic, "", map[string]interface{}{
+		"correlation_id": correlationID,
+		"method":         req.Method,
+		"path":           req.URL.Path,
+		"message":        message,
+	})
+
+	if c.Response().Committed {
+		return nil
+	}
+	body := echo.Map{"error": "Internal server error", "correlation_id": correlationID}
+	switch panicDetail(c, GetConfig().DebugConfig) {
+	case PanicDetailStack:
+		body["stack"] = sanitizedStack
+		fallthrough
+	case PanicDetailMessage:
+		body["panic"] = message
+	}
+	return c.JSON(http.StatusInternalServerError, body)
+}
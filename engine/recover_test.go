@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func servePanic(t *testing.T, debug DebugConfig, token string) (int, map[string]interface{}) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() { repo.SetConfig(original) })
+	updated := original
+	updated.DebugConfig = debug
+	repo.SetConfig(updated)
+
+	e := echo.New()
+	e.Use(RecoverMiddleware())
+	e.GET("/panic", func(c echo.Context) error {
+		panic("lookup failed for ana@example.com")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	if token != "" {
+		req.Header.Set("X-Debug-Token", token)
+	}
+	e.ServeHTTP(rec, req)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec.Code, body
+}
+
+func TestRecoverMiddlewareProduction(t *testing.T) {
+	before := PanicCount()
+	code, body := servePanic(t, DebugConfig{}, "")
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "Internal server error", body["error"])
+	assert.NotEmpty(t, body["correlation_id"])
+	assert.Contains(t, body["panic"], "lookup failed for", "message is the default")
+	assert.NotContains(t, body["panic"], "ana@example.com", "the panic value is sanitized")
+	assert.NotContains(t, body, "stack")
+	assert.Equal(t, before+1, PanicCount())
+
+	_, body = servePanic(t, DebugConfig{PanicDetail: PanicDetailMinimal}, "")
+	assert.NotContains(t, body, "panic")
+	assert.NotContains(t, body, "stack")
+
+	// The stack needs the debug auth
+	_, body = servePanic(t, DebugConfig{PanicDetail: PanicDetailStack}, "")
+	assert.Contains(t, body, "panic")
+	assert.NotContains(t, body, "stack", "debug endpoints are disabled")
+}
+
+func TestRecoverMiddlewareDebug(t *testing.T) {
+	debug := DebugConfig{Enabled: true, AuthToken: "s3cret", PanicDetail: PanicDetailStack}
+	code, body := servePanic(t, debug, "s3cret")
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.NotEmpty(t, body["correlation_id"])
+	assert.Contains(t, body["panic"], "lookup failed for")
+	assert.Contains(t, body["stack"], "recover_test.go")
+
+	_, body = servePanic(t, debug, "wrong")
+	assert.Contains(t, body, "panic")
+	assert.NotContains(t, body, "stack", "the token does not match")
+
+	_, body = servePanic(t, DebugConfig{Enabled: true}, "")
+	assert.NotContains(t, body, "stack", "enabling debug alone keeps the default")
+
+	// allowed_ips ranges apply like on the debug endpoints; the test
+	// request comes from 192.0.2.1
+	_, body = servePanic(t, DebugConfig{Enabled: true, AllowedIPs: "192.0.2.0/24", PanicDetail: PanicDetailStack}, "")
+	assert.Contains(t, body, "stack")
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"net"
+	"strings"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultRequestIDHeader applies when [server].request_id_header is not set
+const defaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the IDs accepted from upstream
+const maxRequestIDLength = 128
+
+const requestIDKey = "_request_id"
+
+// RequestID returns the ID of the request, empty when RequestIDMiddleware
+// is not installed
+func RequestID(c echo.Context) string {
+	id, _ := c.Get(requestIDKey).(string)
+	return id
+}
+
+// requestCorrelationID ties an error answered to the client to the log: the
+// request ID when there is one, a fresh ID otherwise
+func requestCorrelationID(c echo.Context) string {
+	if id := RequestID(c); id != "" {
+		return id
+	}
+	return NewUUID()
+}
+
+// RequestIDMiddleware gives every request an ID, answered in the
+// request_id_header response header and used as correlation ID of its
+// errors. The ID sent by the client is kept when the request comes
+// straight from one of the trusted_proxies, so a trace spans the services
+// behind a gateway; anyone else gets a fresh one.
+func RequestIDMiddleware(config *ServerConfig) echo.MiddlewareFunc {
+	header := config.RequestIDHeader
+	if header == "" {
+		header = defaultRequestIDHeader
+	}
+	trusted := parseTrustedProxies(config.TrustedProxies)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(header)
+			if id == "" || !validRequestID(id) || !trustedPeer(req.RemoteAddr, trusted) {
+				id = NewUUID()
+			}
+			req.Header.Set(header, id)
+			c.Set(requestIDKey, id)
+			c.Response().Header().Set(header, id)
+			return next(c)
+		}
+	}
+}
+
+// parseTrustedProxies parses IPs and CIDRs, skipping invalid entries
+func parseTrustedProxies(entries []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		// A single address is a network of one
+		if ip := net.ParseIP(entry); ip != nil {
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			logger.Errorf("Ignoring invalid server.trusted_proxies entry %q", entry)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// trustedPeer reports whether the connection comes from a trusted proxy.
+// Only the peer address counts, forwarding headers are set by the client.
+func trustedPeer(remoteAddr string, trusted []*net.IPNet) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validRequestID keeps IDs that are safe to log and echo back: up to
+// maxRequestIDLength printable ASCII characters without spaces
+func validRequestID(id string) bool {
+	if len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
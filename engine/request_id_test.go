@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveWithRequestID answers the ID the handler saw
+func serveWithRequestID(config *ServerConfig, req *http.Request) (*httptest.ResponseRecorder, string) {
+	e := echo.New()
+	e.Use(RequestIDMiddleware(config))
+	var seen string
+	e.GET("/", func(c echo.Context) error {
+		seen = RequestID(c)
+		return c.NoContent(http.StatusOK)
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec, seen
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	rec, id := serveWithRequestID(&ServerConfig{}, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, id)
+	assert.Equal(t, id, rec.Header().Get("X-Request-ID"))
+
+	_, other := serveWithRequestID(&ServerConfig{}, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEqual(t, id, other, "every request gets its own ID")
+
+	// Without trusted proxies the ID of the client is never kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "upstream-1")
+	rec, id = serveWithRequestID(&ServerConfig{}, req)
+	assert.NotEqual(t, "upstream-1", id)
+	assert.Equal(t, id, rec.Header().Get("X-Request-ID"))
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	config := &ServerConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.7"}}
+	request := func(remoteAddr, id string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Request-ID", id)
+		return req
+	}
+
+	for _, remoteAddr := range []string{"10.1.2.3:4000", "192.0.2.7:4000"} {
+		rec, id := serveWithRequestID(config, request(remoteAddr, "trace-abc-123"))
+		assert.Equal(t, "trace-abc-123", id, remoteAddr)
+		assert.Equal(t, "trace-abc-123", rec.Header().Get("X-Request-ID"), remoteAddr)
+	}
+
+	_, id := serveWithRequestID(config, request("192.0.2.8:4000", "trace-abc-123"))
+	assert.NotEqual(t, "trace-abc-123", id, "peer is not a trusted proxy")
+
+	for _, invalid := range []string{"has space", "line\nbreak", strings.Repeat("x", maxRequestIDLength+1)} {
+		_, id := serveWithRequestID(config, request("10.1.2.3:4000", invalid))
+		assert.NotEqual(t, invalid, id)
+		assert.NotEmpty(t, id)
+	}
+}
+
+func TestRequestIDHeaderName(t *testing.T) {
+	config := &ServerConfig{RequestIDHeader: "X-Correlation-ID", TrustedProxies: []string{"192.0.2.1"}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	req.Header.Set("X-Correlation-ID", "corr-1")
+
+	rec, id := serveWithRequestID(config, req)
+	assert.Equal(t, "corr-1", id)
+	assert.Equal(t, "corr-1", rec.Header().Get("X-Correlation-ID"))
+	assert.Empty(t, rec.Header().Get("X-Request-ID"))
+}
+
+func TestRequestIDIsPanicCorrelationID(t *testing.T) {
+	e := echo.New()
+	e.Use(RequestIDMiddleware(&ServerConfig{}))
+	e.Use(RecoverMiddleware())
+	e.GET("/", func(c echo.Context) error {
+		panic("boom")
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, rec.Header().Get("X-Request-ID"), body["correlation_id"])
+}
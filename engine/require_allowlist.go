@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/console"
+	"github.com/dop251/goja_nodejs/require"
+)
+
+// defaultRequireModules applies when [vm_pool].require_modules is not set
+var defaultRequireModules = []string{"console", "util"}
+
+// requireAllowlist returns the set of module names scripts may require.
+// console is always allowed: the console global is installed in every VM.
+func requireAllowlist(modules []string) map[string]bool {
+	if modules == nil {
+		modules = defaultRequireModules
+	}
+	allowed := make(map[string]bool, len(modules)+1)
+	for _, name := range modules {
+		allowed[name] = true
+	}
+	allowed["console"] = true
+	return allowed
+}
+
+// enableRequire adds require() and the console global to vm through
+// registry. require() is restricted to the allowed modules: any other name,
+// including file paths, throws an Error in the script. console is enabled
+// first because it loads util internally.
+func enableRequire(registry *require.Registry, vm *goja.Runtime, allowed map[string]bool) {
+	module := registry.Enable(vm)
+	console.Enable(vm)
+	vm.Set("require", func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0).String()
+		if !allowed[name] {
+			panic(vm.NewGoError(fmt.Errorf("require: module %q is not allowed", name)))
+		}
+		exports, err := module.Require(name)
+		if err != nil {
+			if exception, ok := err.(*goja.Exception); ok {
+				panic(exception)
+			}
+			panic(vm.NewGoError(err))
+		}
+		return exports
+	})
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contentTypeKey stores the content type chosen by set_content_type in the echo context
+const contentTypeKey = "_nflow_content_type"
+
+// responseCharset returns the configured charset for text responses
+func responseCharset() string {
+	if charset := GetConfig().ResponseConfig.Charset; charset != "" {
+		return charset
+	}
+	return "utf-8"
+}
+
+// withCharset appends the configured charset to text/* content types that do
+// not declare one
+func withCharset(contentType string) string {
+	contentType = strings.TrimSpace(contentType)
+	if !strings.HasPrefix(contentType, "text/") || strings.Contains(strings.ToLower(contentType), "charset=") {
+		return contentType
+	}
+	return contentType + "; charset=" + responseCharset()
+}
+
+// SetResponseContentType sets the content type used by later string responses
+// of the request
+func SetResponseContentType(c echo.Context, contentType string) {
+	contentType = withCharset(contentType)
+	c.Set(contentTypeKey, contentType)
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+}
+
+// ResponseContentType returns the content type for string responses: the one
+// set by set_content_type, else [response].default_content_type, else
+// text/plain with the configured charset.
+func ResponseContentType(c echo.Context) string {
+	if contentType, ok := c.Get(contentTypeKey).(string); ok && contentType != "" {
+		return contentType
+	}
+	if contentType := GetConfig().ResponseConfig.DefaultContentType; contentType != "" {
+		return withCharset(contentType)
+	}
+	return withCharset(echo.MIMETextPlain)
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runResponseScript runs script with the JS context helpers and returns the recorder
+func runResponseScript(t *testing.T, script string) *httptest.ResponseRecorder {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	vm := goja.New()
+	SetupJSContext(vm, c)
+	_, err := vm.RunString(script)
+	require.NoError(t, err)
+	return rec
+}
+
+func TestResponseContentTypeHelpers(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{"string defaults to text/plain", `c.String(200, "hello")`, "text/plain; charset=utf-8"},
+		{"html", `c.HTML(200, "<b>hi</b>")`, "text/html; charset=utf-8"},
+		{"csv via set_content_type", `set_content_type("text/csv"); c.String(200, "a,b")`, "text/csv; charset=utf-8"},
+		{"explicit charset is kept", `set_content_type("text/csv; charset=iso-8859-1"); c.String(200, "a,b")`, "text/csv; charset=iso-8859-1"},
+		{"non text types have no charset", `c.SetContentType("application/pdf"); c.String(200, "%PDF")`, "application/pdf"},
+		{"json is unchanged", `c.JSON(200, {a: 1})`, echo.MIMEApplicationJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := runResponseScript(t, tt.script)
+			assert.Equal(t, tt.expected, rec.Header().Get(echo.HeaderContentType))
+		})
+	}
+}
+
+func TestResponseContentTypeConfigDefaults(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	config := original
+	config.ResponseConfig = ResponseConfig{DefaultContentType: "text/html", Charset: "iso-8859-1"}
+	repo.SetConfig(config)
+
+	rec := runResponseScript(t, `c.String(200, "<p>fragment</p>")`)
+	assert.Equal(t, "text/html; charset=iso-8859-1", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "<p>fragment</p>", rec.Body.String())
+}
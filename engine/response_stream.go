@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// writeChunk appends chunk to the response body. The first chunk commits
+// the response with status 200 and the content type of string responses.
+// In [response].unbuffered mode every chunk is flushed to the client.
+func writeChunk(c echo.Context, chunk string) error {
+	response := c.Response()
+	if !response.Committed {
+		if response.Header().Get(echo.HeaderContentType) == "" {
+			response.Header().Set(echo.HeaderContentType, ResponseContentType(c))
+		}
+		response.WriteHeader(http.StatusOK)
+	}
+	if _, err := response.Write([]byte(chunk)); err != nil {
+		return err
+	}
+	if GetConfig().ResponseConfig.Unbuffered {
+		return flushResponse(c)
+	}
+	return nil
+}
+
+// flushResponse sends what was written so far to the client. Writers that
+// can not flush, like the one of isolated contexts, keep the output until
+// the request ends.
+func flushResponse(c echo.Context) error {
+	err := http.NewResponseController(c.Response().Writer).Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamScript serves script and returns whether its first chunk reached
+// the client while the script was still waiting in wait(), and the body
+func streamScript(t *testing.T, script string) (bool, string) {
+	release := make(chan struct{})
+	timedOut := make(chan bool, 1)
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		vm := goja.New()
+		SetupJSContext(vm, c)
+		vm.Set("wait", func() {
+			select {
+			case <-release:
+				timedOut <- false
+			case <-time.After(2 * time.Second):
+				timedOut <- true
+			}
+		})
+		_, err := vm.RunString(script)
+		return err
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	first := make([]byte, len("first"))
+	_, err = io.ReadFull(resp.Body, first)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(first))
+	close(release)
+
+	rest, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return !<-timedOut, string(first) + string(rest)
+}
+
+func TestWriteFlush(t *testing.T) {
+	incremental, body := streamScript(t, `write("first"); flush(); wait(); write("second")`)
+	assert.True(t, incremental, "first chunk should arrive before the script ends")
+	assert.Equal(t, "firstsecond", body)
+}
+
+func TestWriteUnbuffered(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	config := original
+	config.ResponseConfig.Unbuffered = true
+	repo.SetConfig(config)
+
+	incremental, body := streamScript(t, `c.Write("first"); wait(); c.Write("second")`)
+	assert.True(t, incremental, "first chunk should arrive before the script ends")
+	assert.Equal(t, "firstsecond", body)
+}
+
+func TestWriteCommitsResponse(t *testing.T) {
+	rec := runResponseScript(t, `set_content_type("text/csv"); write("a,b\n"); write("1,2\n")`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "a,b\n1,2\n", rec.Body.String())
+
+	// Isolated contexts keep the output, flush() is a no-op
+	c := NewIsolatedContext(createTestContext())
+	vm := goja.New()
+	SetupJSContext(vm, c)
+	_, err := vm.RunString(`write("chunk"); flush()`)
+	require.NoError(t, err)
+	assert.Equal(t, "chunk", c.GetOutput())
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"net/http"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/syncsession"
+	"github.com/labstack/echo/v4"
+)
+
+// resumeNodeKey is the nflow_form session key holding the node a paused
+// workflow is allowed to resume from
+const resumeNodeKey = "nflow_resume_node"
+
+// workflowHopsKey is the nflow_form session key counting the requests a
+// multi-step workflow has resumed with
+const workflowHopsKey = "nflow_workflow_hops"
+
+const defaultMaxWorkflowHops = 50
+
+// ErrWorkflowExpiredMessage is answered with 409 when a workflow resumes
+// more times than [playbook].max_hops allows
+const ErrWorkflowExpiredMessage = "Workflow expired, please restart"
+
+// ErrUnexpectedNodeMessage is answered with 409 when a request resumes a
+// workflow from a node it did not pause at
+const ErrUnexpectedNodeMessage = "Unexpected workflow step, please restart"
+
+// isWorkflowStateKey reports whether key is session state of the engine
+// that form values and payloads must not overwrite or see
+func isWorkflowStateKey(key string) bool {
+	return key == resumeNodeKey || key == playbookVersionKey || key == continuationNonceKey || key == workflowHopsKey
+}
+
+// expectResumeNode records the node a paused workflow continues from
+func expectResumeNode(c echo.Context, next string) {
+	if _, isIsolated := c.(*IsolatedContext); isIsolated {
+		return
+	}
+
+	EchoSessionsMutex.Lock()
+	defer EchoSessionsMutex.Unlock()
+	s, err := syncsession.Manager.GetSession("nflow_form", c)
+	if err != nil {
+		logger.Error("Error recording resume node:", err)
+		return
+	}
+	s.Values[resumeNodeKey] = next
+	syncsession.Manager.SaveSession("nflow_form", c, s)
+}
+
+// checkResumeNode answers 409 and returns false unless next is the node the
+// workflow in the session paused at and it exists in the playbook. This
+// keeps crafted nflow_next_node_run values from jumping over earlier steps.
+func checkResumeNode(c echo.Context, pb model.Playbook, next string) bool {
+	if _, isIsolated := c.(*IsolatedContext); isIsolated {
+		return true
+	}
+
+	var expected string
+	func() {
+		EchoSessionsMutex.Lock()
+		defer EchoSessionsMutex.Unlock()
+		if s, err := syncsession.Manager.GetSession("nflow_form", c); err == nil {
+			expected, _ = s.Values[resumeNodeKey].(string)
+		}
+	}()
+
+	if _, exists := pb[next]; exists && next == expected {
+		return true
+	}
+	logger.Infof("Rejected resume from node %q, expected %q", next, expected)
+	c.JSON(http.StatusConflict, echo.Map{
+		"error": ErrUnexpectedNodeMessage,
+		"code":  "unexpected_node",
+	})
+	return false
+}
+
+// maxWorkflowHops returns [playbook].max_hops, 0 meaning no limit
+func maxWorkflowHops() int {
+	switch limit := GetConfig().PlaybookConfig.MaxHops; {
+	case limit == 0:
+		return defaultMaxWorkflowHops
+	case limit < 0:
+		return 0
+	default:
+		return limit
+	}
+}
+
+// countWorkflowHop counts a resume of the workflow in the session. Past
+// [playbook].max_hops the workflow is expired: the session is cleared and
+// the request answered with 409.
+func countWorkflowHop(c echo.Context) bool {
+	if _, isIsolated := c.(*IsolatedContext); isIsolated {
+		return true
+	}
+
+	EchoSessionsMutex.Lock()
+	defer EchoSessionsMutex.Unlock()
+	s, err := syncsession.Manager.GetSession("nflow_form", c)
+	if err != nil {
+		logger.Error("Error counting workflow hop:", err)
+		return true
+	}
+	hops, _ := s.Values[workflowHopsKey].(int)
+	hops++
+	if limit := maxWorkflowHops(); limit > 0 && hops > limit {
+		logger.Infof("Workflow expired after %d resumes", limit)
+		syncsession.Manager.DeleteSession("nflow_form", c)
+		c.JSON(http.StatusConflict, echo.Map{
+			"error": ErrWorkflowExpiredMessage,
+			"code":  "workflow_expired",
+		})
+		return false
+	}
+	s.Values[workflowHopsKey] = hops
+	syncsession.Manager.SaveSession("nflow_form", c, s)
+	return true
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResumeNode(t *testing.T) {
+	var received []interface{}
+	Steps["test_resume_ask"] = payloadTestStep{produce: `({"break": true})`, next: "node_2", received: &received}
+	Steps["test_resume_pass"] = payloadTestStep{next: "node_3", received: &received}
+	defer delete(Steps, "test_resume_ask")
+	defer delete(Steps, "test_resume_pass")
+
+	pb := model.Playbook{
+		"node_1": &model.Node{Data: map[string]interface{}{"type": "test_resume_ask"}},
+		"node_2": &model.Node{Data: map[string]interface{}{"type": "test_resume_pass"}},
+		"node_3": &model.Node{Data: map[string]interface{}{"type": "test_resume_pass"}},
+	}
+
+	// The workflow pauses after node_1 and waits to resume from node_2
+	c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+	p := process.CreateProcess("resume-test")
+	defer p.Close()
+	Execute(&model.Controller{Playbook: &pb}, c, goja.New(), "node_1", nil, p, nil, false)
+	require.Len(t, received, 1)
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	require.Contains(t, cookies, "nflow_form")
+
+	resume := func(next string, withSession bool) (bool, int, string) {
+		c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+		if withSession {
+			for _, cookie := range cookies {
+				c.Request().AddCookie(cookie)
+			}
+		}
+		ok := checkResumeNode(c, pb, next)
+		return ok, rec.Code, rec.Body.String()
+	}
+
+	ok, _, _ := resume("node_2", true)
+	assert.True(t, ok, "the node the workflow paused at may resume")
+
+	ok, code, body := resume("node_3", true)
+	assert.False(t, ok, "jumping over node_2 is rejected")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.JSONEq(t, `{"error":"`+ErrUnexpectedNodeMessage+`","code":"unexpected_node"}`, body)
+
+	ok, code, _ = resume("node_2", false)
+	assert.False(t, ok, "a resume without a paused workflow is rejected")
+	assert.Equal(t, http.StatusConflict, code)
+
+	ok, _, _ = resume("node_9", true)
+	assert.False(t, ok)
+
+	assert.True(t, checkResumeNode(NewIsolatedContext(createTestContext()), pb, "node_3"), "forks run from any node")
+}
+
+func TestCountWorkflowHopExpiresWorkflow(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+	config := original
+	config.PlaybookConfig.MaxHops = 2
+	repo.SetConfig(config)
+
+	c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+	expectResumeNode(c, "node_2")
+	cookies := rec.Result().Cookies()
+
+	// Every resume carries the session saved by the previous one
+	hop := func() (bool, *httptest.ResponseRecorder) {
+		c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+		for _, cookie := range cookies {
+			c.Request().AddCookie(cookie)
+		}
+		ok := countWorkflowHop(c)
+		if saved := rec.Result().Cookies(); len(saved) > 0 {
+			cookies = saved
+		}
+		return ok, rec
+	}
+
+	ok, _ := hop()
+	assert.True(t, ok)
+	ok, _ = hop()
+	assert.True(t, ok)
+
+	ok, rec = hop()
+	assert.False(t, ok, "the third resume exceeds max_hops")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.JSONEq(t, `{"error":"`+ErrWorkflowExpiredMessage+`","code":"workflow_expired"}`, rec.Body.String())
+
+	// The expired workflow can no longer be resumed
+	c, _ = newTraceTestContext(t, "/form", DebugConfig{})
+	for _, cookie := range cookies {
+		c.Request().AddCookie(cookie)
+	}
+	assert.False(t, checkResumeNode(c, model.Playbook{"node_2": &model.Node{}}, "node_2"))
+}
+
+func TestPayloadCannotOverwriteWorkflowState(t *testing.T) {
+	var received []interface{}
+	Steps["test_resume_forge"] = payloadTestStep{produce: `({"break": true, "nflow_resume_node": "node_3", "answer": 42})`, next: "node_2", received: &received}
+	Steps["test_resume_pass"] = payloadTestStep{next: "node_3", received: &received}
+	defer delete(Steps, "test_resume_forge")
+	defer delete(Steps, "test_resume_pass")
+
+	pb := model.Playbook{
+		"node_1": &model.Node{Data: map[string]interface{}{"type": "test_resume_forge"}},
+		"node_2": &model.Node{Data: map[string]interface{}{"type": "test_resume_pass"}},
+		"node_3": &model.Node{Data: map[string]interface{}{"type": "test_resume_pass"}},
+	}
+
+	c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+	p := process.CreateProcess("resume-forge-test")
+	defer p.Close()
+	Execute(&model.Controller{Playbook: &pb}, c, goja.New(), "node_1", nil, p, nil, false)
+	require.Len(t, received, 1)
+	cookies := rec.Result().Cookies()
+
+	resume := func(next string) bool {
+		c, _ := newTraceTestContext(t, "/form", DebugConfig{})
+		for _, cookie := range cookies {
+			c.Request().AddCookie(cookie)
+		}
+		return checkResumeNode(c, pb, next)
+	}
+	assert.True(t, resume("node_2"), "the session keeps the node the workflow paused at")
+	assert.False(t, resume("node_3"), "the payload cannot choose the resume node")
+
+	// The same holds for payloads saved outside Execute
+	c, rec = newTraceTestContext(t, "/form", DebugConfig{})
+	expectResumeNode(c, "node_2")
+	cookies = rec.Result().Cookies()
+	c, rec = newTraceTestContext(t, "/form", DebugConfig{})
+	for _, cookie := range cookies {
+		c.Request().AddCookie(cookie)
+	}
+	vm := goja.New()
+	payload, err := vm.RunString(`({"break": true, "nflow_resume_node": "node_3", "answer": 42})`)
+	require.NoError(t, err)
+	assert.True(t, savePayloadToSession(c, payload))
+	if saved := rec.Result().Cookies(); len(saved) > 0 {
+		cookies = saved
+	}
+	assert.True(t, resume("node_2"))
+	assert.False(t, resume("node_3"))
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// JSON limit errors
+var (
+	ErrJSONTooDeep  = errors.New("json nesting depth limit exceeded")
+	ErrJSONTooLarge = errors.New("json size limit exceeded")
+)
+
+const (
+	defaultJSONMaxDepth = 100
+	defaultJSONMaxBytes = 5 * 1024 * 1024
+)
+
+// JSONLimits bounds the JSON documents accepted from untrusted input
+type JSONLimits struct {
+	MaxDepth int // Maximum nesting of objects and arrays
+	MaxBytes int // Maximum document size in bytes
+}
+
+// GetJSONLimitsFromConfig gets the JSON limits from configuration
+func GetJSONLimitsFromConfig() JSONLimits {
+	config := GetConfig()
+	limits := JSONLimits{MaxDepth: defaultJSONMaxDepth, MaxBytes: defaultJSONMaxBytes}
+	if config.JSONConfig.MaxDepth > 0 {
+		limits.MaxDepth = config.JSONConfig.MaxDepth
+	}
+	if config.JSONConfig.MaxBytes > 0 {
+		limits.MaxBytes = config.JSONConfig.MaxBytes
+	}
+	return limits
+}
+
+// CheckJSON validates size and nesting depth of a JSON document without
+// decoding it, so hostile input never reaches a recursive parser.
+func CheckJSON(data []byte, limits JSONLimits) error {
+	if limits.MaxBytes > 0 && len(data) > limits.MaxBytes {
+		return fmt.Errorf("%w: %d bytes, max %d", ErrJSONTooLarge, len(data), limits.MaxBytes)
+	}
+	depth := 0
+	inString, escaped := false, false
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+				return fmt.Errorf("%w: max %d", ErrJSONTooDeep, limits.MaxDepth)
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// SafeParseJSON decodes data after checking it against limits
+func SafeParseJSON(data []byte, limits JSONLimits) (interface{}, error) {
+	if err := CheckJSON(data, limits); err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SafeStringifyJSON encodes v, failing when it is nested deeper than the
+// limit (which also catches cyclic values) or the output is too large.
+func SafeStringifyJSON(v interface{}, limits JSONLimits) ([]byte, error) {
+	if err := checkValueDepth(v, 0, limits.MaxDepth); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && len(data) > limits.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, max %d", ErrJSONTooLarge, len(data), limits.MaxBytes)
+	}
+	return data, nil
+}
+
+func checkValueDepth(v interface{}, depth, maxDepth int) error {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		depth++
+		if maxDepth > 0 && depth > maxDepth {
+			return fmt.Errorf("%w: max %d", ErrJSONTooDeep, maxDepth)
+		}
+		for _, item := range val {
+			if err := checkValueDepth(item, depth, maxDepth); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		depth++
+		if maxDepth > 0 && depth > maxDepth {
+			return fmt.Errorf("%w: max %d", ErrJSONTooDeep, maxDepth)
+		}
+		for _, item := range val {
+			if err := checkValueDepth(item, depth, maxDepth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AddFeatureSafeJSON registers safe_parse(str, maxDepth) and
+// safe_stringify(obj). maxDepth is optional and can only lower the
+// configured [json].max_depth. Violations throw instead of exhausting the
+// stack.
+func AddFeatureSafeJSON(vm *goja.Runtime) {
+	vm.Set("safe_parse", func(call goja.FunctionCall) goja.Value {
+		limits := GetJSONLimitsFromConfig()
+		if depth := call.Argument(1); !goja.IsUndefined(depth) && !goja.IsNull(depth) {
+			if d := int(depth.ToInteger()); d > 0 && d < limits.MaxDepth {
+				limits.MaxDepth = d
+			}
+		}
+		text := call.Argument(0).String()
+		if err := CheckJSON([]byte(text), limits); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		// The document is bounded now, so the JS parser builds native objects
+		parse, ok := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+		if !ok {
+			panic(vm.NewTypeError("JSON.parse is not available"))
+		}
+		result, err := parse(goja.Undefined(), vm.ToValue(text))
+		if err != nil {
+			panic(err)
+		}
+		return result
+	})
+
+	vm.Set("safe_stringify", func(call goja.FunctionCall) goja.Value {
+		data, err := SafeStringifyJSON(call.Argument(0).Export(), GetJSONLimitsFromConfig())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(string(data))
+	})
+}
+
+// bindPostData binds the request body like c.Bind, checking JSON bodies
+// against the configured limits first. The returned status is the one to
+// answer with when err is not nil.
+func bindPostData(c echo.Context, postData *map[string]interface{}) (int, error) {
+	req := c.Request()
+	if req.Body != nil && strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		limits := GetJSONLimitsFromConfig()
+		body, err := io.ReadAll(io.LimitReader(req.Body, int64(limits.MaxBytes)+1))
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if err := CheckJSON(body, limits); err != nil {
+			if errors.Is(err, ErrJSONTooLarge) {
+				return http.StatusRequestEntityTooLarge, err
+			}
+			return http.StatusBadRequest, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	// Binding errors are ignored as before: the workflow sees an empty post_data
+	c.Bind(postData)
+	return 0, nil
+}
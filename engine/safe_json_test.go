@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nestedJSON(depth int) string {
+	return strings.Repeat(`{"a":`, depth) + "1" + strings.Repeat("}", depth)
+}
+
+func TestCheckJSON(t *testing.T) {
+	limits := JSONLimits{MaxDepth: 10, MaxBytes: 1024}
+
+	assert.NoError(t, CheckJSON([]byte(nestedJSON(10)), limits))
+	assert.True(t, errors.Is(CheckJSON([]byte(nestedJSON(11)), limits), ErrJSONTooDeep))
+	assert.True(t, errors.Is(CheckJSON([]byte(strings.Repeat("[", 1000)), limits), ErrJSONTooDeep))
+
+	// Brackets inside strings do not count
+	assert.NoError(t, CheckJSON([]byte(`{"a":"[[[[[[[[[[[[[[[[\"{{{{{{{{{{{{"}`), limits))
+
+	big := `"` + strings.Repeat("x", 2000) + `"`
+	assert.True(t, errors.Is(CheckJSON([]byte(big), limits), ErrJSONTooLarge))
+}
+
+func TestSafeStringifyJSON(t *testing.T) {
+	limits := JSONLimits{MaxDepth: 3, MaxBytes: 64}
+
+	data, err := SafeStringifyJSON(map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": 1}}}, limits)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":[{"b":1}]}`, string(data))
+
+	_, err = SafeStringifyJSON(map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": []interface{}{}}}}, limits)
+	assert.True(t, errors.Is(err, ErrJSONTooDeep))
+
+	_, err = SafeStringifyJSON(map[string]interface{}{"a": strings.Repeat("x", 100)}, limits)
+	assert.True(t, errors.Is(err, ErrJSONTooLarge))
+}
+
+func TestSafeJSONHelpers(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+	config := original
+	config.JSONConfig = JSONConfig{MaxDepth: 20, MaxBytes: 4096}
+	repo.SetConfig(config)
+
+	vm := goja.New()
+	AddFeatureSafeJSON(vm)
+
+	v, err := vm.RunString(`var o = safe_parse('{"user":{"name":"ana","tags":["a","b"]}}'); o.user.tags.length`)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, v.ToInteger())
+
+	v, err = vm.RunString(`safe_stringify({a: [1, {b: "x"}]})`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":[1,{"b":"x"}]}`, v.String())
+
+	// Errors are catchable in the workflow
+	v, err = vm.RunString(`var msg; try { safe_parse('` + nestedJSON(5) + `', 3) } catch (e) { msg = e.message }; msg`)
+	require.NoError(t, err)
+	assert.Contains(t, v.String(), ErrJSONTooDeep.Error())
+
+	_, err = vm.RunString(`safe_parse('` + nestedJSON(100) + `')`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrJSONTooDeep.Error())
+
+	_, err = vm.RunString(`safe_parse('"` + strings.Repeat("x", 5000) + `"')`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrJSONTooLarge.Error())
+
+	_, err = vm.RunString(`var d = {}; var cur = d; for (var i = 0; i < 50; i++) { cur.n = {}; cur = cur.n }; safe_stringify(d)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrJSONTooDeep.Error())
+}
+
+func TestBindPostDataLimits(t *testing.T) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+	config := original
+	config.JSONConfig = JSONConfig{MaxDepth: 10, MaxBytes: 256}
+	repo.SetConfig(config)
+
+	bind := func(body string) (map[string]interface{}, int, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		postData := make(map[string]interface{})
+		status, err := bindPostData(c, &postData)
+		return postData, status, err
+	}
+
+	postData, _, err := bind(`{"name":"ana","n":1}`)
+	require.NoError(t, err)
+	assert.Equal(t, "ana", postData["name"])
+
+	_, status, err := bind(nestedJSON(20))
+	assert.True(t, errors.Is(err, ErrJSONTooDeep))
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	_, status, err = bind(`{"data":"` + strings.Repeat("x", 1000) + `"}`)
+	assert.True(t, errors.Is(err, ErrJSONTooLarge))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+}
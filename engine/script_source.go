@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ScriptSource is a script as run by the VM: the author's code with the
+// wrapper the engine adds around it, such as the call of main() or
+// auth(). Babel keeps the author's lines (retainLines), so the wrapper is
+// the only thing moving them.
+type ScriptSource struct {
+	Name       string // Name given to the VM, shown in stacks
+	Code       string // Code run by the VM
+	LineOffset int    // Lines added before the author's code
+	Lines      int    // Lines of the author's code
+}
+
+// NewScriptSource wraps code with prefix and suffix and records where the
+// author's lines end up
+func NewScriptSource(name, prefix, code, suffix string) ScriptSource {
+	return ScriptSource{
+		Name:       name,
+		Code:       prefix + code + suffix,
+		LineOffset: strings.Count(prefix, "\n"),
+		Lines:      strings.Count(code, "\n") + 1,
+	}
+}
+
+// OriginalLine converts a line of Code to the line of the author's code.
+// Lines of the wrapper give 0.
+func (s ScriptSource) OriginalLine(line int) int {
+	line -= s.LineOffset
+	if line < 1 || line > s.Lines {
+		return 0
+	}
+	return line
+}
+
+// Translate moves the position, message and stack of e to the author's
+// coordinates
+func (s ScriptSource) Translate(e *JSError) {
+	if e.Line > 0 {
+		e.Line = s.OriginalLine(e.Line)
+		if e.Line == 0 {
+			e.Column = 0
+		}
+	}
+	e.Message = s.translateText(e.Message)
+	e.Stack = s.translateText(e.Stack)
+}
+
+// translateText rewrites the "name:line:column" positions of stacks and
+// the "Line line:column" positions of parser messages
+func (s ScriptSource) translateText(text string) string {
+	if s.LineOffset == 0 || text == "" {
+		return text
+	}
+	pattern := regexp.MustCompile(`(` + regexp.QuoteMeta(s.Name) + `:|Line )(\d+):(\d+)`)
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := pattern.FindStringSubmatch(match)
+		line, _ := strconv.Atoi(m[2])
+		return m[1] + strconv.Itoa(s.OriginalLine(line)) + ":" + m[3]
+	})
+}
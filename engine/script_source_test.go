@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorNode throws on line 9; babel rewrites most lines before it
+const authorNode = `// Validates the order
+
+function main() {
+  const items = payload.items || [];
+  const total = items.map((i) => i.price * i.qty)
+    .reduce((a, b) => a + b, 0);
+  let {currency, country} = payload;
+
+  if (total <= 0) throw new Error(` + "`empty order in ${currency}`" + `);
+  return total;
+}`
+
+func runNodeScript(t *testing.T, script ScriptSource) *JSError {
+	vm := goja.New()
+	vm.Set("payload", map[string]interface{}{"currency": "EUR"})
+	program, err := goja.Compile(script.Name, script.Code, false)
+	require.NoError(t, err)
+	_, err = vm.RunProgram(program)
+	require.Error(t, err)
+
+	jsErr := NewJSError("node_1", err)
+	script.Translate(jsErr)
+	return jsErr
+}
+
+func TestScriptSourceReportsAuthorLines(t *testing.T) {
+	// Same preparation as StepJS
+	script := NewScriptSource("workflow", "", babelTransform(authorNode), "\nmain()")
+	jsErr := runNodeScript(t, script)
+	assert.Equal(t, "empty order in EUR", jsErr.Message)
+	assert.Equal(t, 9, jsErr.Line)
+	assert.Contains(t, jsErr.Stack, "workflow:9:")
+
+	// Lines added before the code are taken off
+	script = NewScriptSource("workflow", "var __wrapped = true;\n\n", babelTransform(authorNode), "\nmain()")
+	jsErr = runNodeScript(t, script)
+	assert.Equal(t, 9, jsErr.Line)
+	assert.Contains(t, jsErr.Stack, "workflow:9:")
+	assert.NotContains(t, jsErr.Stack, "workflow:11:")
+}
+
+func TestScriptSourceSyntaxErrorLine(t *testing.T) {
+	script := NewScriptSource("workflow", "\"use strict\";\n", "var a = 1;\nvar b = ;", "\nmain()")
+	_, err := goja.Compile(script.Name, script.Code, false)
+	require.Error(t, err)
+
+	jsErr := NewJSError("node_1", err)
+	script.Translate(jsErr)
+	assert.Equal(t, 2, jsErr.Line)
+	assert.Contains(t, jsErr.Message, "Line 2:")
+}
+
+func TestScriptSourceOriginalLine(t *testing.T) {
+	script := NewScriptSource("auth.js", "// wrapper\n", "a()\nb()\nc()", "\nauth()")
+	assert.Equal(t, 0, script.OriginalLine(1), "wrapper prefix")
+	assert.Equal(t, 1, script.OriginalLine(2))
+	assert.Equal(t, 3, script.OriginalLine(4))
+	assert.Equal(t, 0, script.OriginalLine(5), "wrapper suffix")
+}
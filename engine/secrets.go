@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Secrets errors
+var (
+	ErrSecretNotFound                = errors.New("secret not found")
+	ErrSecretsProviderNotImplemented = errors.New("secrets provider not implemented")
+)
+
+// secretRefPrefix marks a config value to be read from the secrets
+// provider, e.g. dsn = "secret:nflow_db_dsn"
+const secretRefPrefix = "secret:"
+
+// SecretsProvider resolves secret names to their values
+type SecretsProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSecretsProvider reads secrets from environment variables, optionally
+// prefixed: with Prefix "NFLOW_" the secret db_dsn is NFLOW_DB_DSN
+type EnvSecretsProvider struct {
+	Prefix string
+}
+
+// GetSecret implements SecretsProvider
+func (p EnvSecretsProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	key := p.Prefix + strings.ToUpper(name)
+	if value, ok := os.LookupEnv(key); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("%w: env %s", ErrSecretNotFound, key)
+}
+
+// FileSecretsProvider reads each secret from a file named after it in Dir,
+// as mounted by Docker and Kubernetes secrets. The trailing newline is
+// removed.
+type FileSecretsProvider struct {
+	Dir string
+}
+
+// GetSecret implements SecretsProvider
+func (p FileSecretsProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if name == "" || filepath.Base(name) != name || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// VaultSecretsProvider is the extension point for HashiCorp Vault. It is
+// not implemented yet and fails every lookup.
+type VaultSecretsProvider struct {
+	Address string
+	Mount   string
+}
+
+// GetSecret implements SecretsProvider
+func (p VaultSecretsProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	return "", fmt.Errorf("%w: vault", ErrSecretsProviderNotImplemented)
+}
+
+// AWSSecretsManagerProvider is the extension point for AWS Secrets
+// Manager. It is not implemented yet and fails every lookup.
+type AWSSecretsManagerProvider struct {
+	Region string
+}
+
+// GetSecret implements SecretsProvider
+func (p AWSSecretsManagerProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	return "", fmt.Errorf("%w: aws", ErrSecretsProviderNotImplemented)
+}
+
+// NewSecretsProvider creates the provider selected in [secrets]
+func NewSecretsProvider(config SecretsConfig) (SecretsProvider, error) {
+	switch config.Provider {
+	case "", "env":
+		return EnvSecretsProvider{Prefix: config.EnvPrefix}, nil
+	case "file":
+		dir := config.Dir
+		if dir == "" {
+			dir = "/run/secrets"
+		}
+		return FileSecretsProvider{Dir: dir}, nil
+	case "vault":
+		return VaultSecretsProvider{Address: config.VaultAddress, Mount: config.VaultMount}, nil
+	case "aws":
+		return AWSSecretsManagerProvider{Region: config.AWSRegion}, nil
+	}
+	return nil, fmt.Errorf("unknown secrets provider %q", config.Provider)
+}
+
+// ResolveConfigSecrets replaces the "secret:<name>" values of the fields
+// tagged secret:"true" (DSNs, passwords, tokens, the encryption key) with
+// the value from provider. Other values are left as they are.
+func ResolveConfigSecrets(ctx context.Context, config *ConfigWorkspace, provider SecretsProvider) error {
+	return resolveSecrets(ctx, reflect.ValueOf(config).Elem(), "", provider)
+}
+
+func resolveSecrets(ctx context.Context, v reflect.Value, path string, provider SecretsProvider) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := v.Field(i)
+		name := path + field.Name
+
+		if value.Kind() == reflect.Struct {
+			if err := resolveSecrets(ctx, value, name+".", provider); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.Tag.Get("secret") != "true" || value.Kind() != reflect.String {
+			continue
+		}
+		ref, ok := strings.CutPrefix(value.String(), secretRefPrefix)
+		if !ok {
+			continue
+		}
+		secret, err := provider.GetSecret(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		value.SetString(secret)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvSecretsProvider(t *testing.T) {
+	t.Setenv("NFLOW_DB_DSN", "postgres://app:pw@db/nflow")
+	provider := EnvSecretsProvider{Prefix: "NFLOW_"}
+
+	value, err := provider.GetSecret(context.Background(), "db_dsn")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://app:pw@db/nflow", value)
+
+	_, err = provider.GetSecret(context.Background(), "missing")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
+
+func TestFileSecretsProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "encryption_key"), []byte("0123456789abcdef0123456789abcdef\n"), 0600))
+	provider := FileSecretsProvider{Dir: dir}
+
+	value, err := provider.GetSecret(context.Background(), "encryption_key")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", value)
+
+	_, err = provider.GetSecret(context.Background(), "missing")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	// Names cannot leave the secrets directory
+	for _, name := range []string{"../passwd", "a/b", "..", ""} {
+		_, err = provider.GetSecret(context.Background(), name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestNewSecretsProvider(t *testing.T) {
+	provider, err := NewSecretsProvider(SecretsConfig{})
+	require.NoError(t, err)
+	assert.IsType(t, EnvSecretsProvider{}, provider)
+
+	provider, err = NewSecretsProvider(SecretsConfig{Provider: "file"})
+	require.NoError(t, err)
+	assert.Equal(t, FileSecretsProvider{Dir: "/run/secrets"}, provider)
+
+	provider, err = NewSecretsProvider(SecretsConfig{Provider: "vault"})
+	require.NoError(t, err)
+	_, err = provider.GetSecret(context.Background(), "db_dsn")
+	assert.True(t, errors.Is(err, ErrSecretsProviderNotImplemented))
+
+	_, err = NewSecretsProvider(SecretsConfig{Provider: "nope"})
+	assert.Error(t, err)
+}
+
+func TestResolveConfigSecrets(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db_dsn"), []byte("postgres://app:pw@db/nflow\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "encryption_key"), []byte("k3y"), 0600))
+
+	var config ConfigWorkspace
+	config.DatabaseNflow.DSN = "secret:db_dsn"
+	config.SecurityConfig.EncryptionKey = "secret:encryption_key"
+	config.RedisConfig.Password = "inline"
+	config.DatabaseNflow.Driver = "secret:db_dsn" // not a sensitive field
+
+	require.NoError(t, ResolveConfigSecrets(context.Background(), &config, FileSecretsProvider{Dir: dir}))
+	assert.Equal(t, "postgres://app:pw@db/nflow", config.DatabaseNflow.DSN)
+	assert.Equal(t, "k3y", config.SecurityConfig.EncryptionKey)
+	assert.Equal(t, "inline", config.RedisConfig.Password)
+	assert.Equal(t, "secret:db_dsn", config.DatabaseNflow.Driver)
+
+	config.MongoConfig.URL = "secret:mongo_url"
+	err := ResolveConfigSecrets(context.Background(), &config, FileSecretsProvider{Dir: dir})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MongoConfig.URL")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
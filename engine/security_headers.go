@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// headerOff disables a security header that has a default value
+const headerOff = "off"
+
+// SecurityHeadersMiddleware sets the security headers on every response,
+// workflow output included. Empty values use the defaults; "off" removes a
+// header. HSTS is only sent on HTTPS requests (TLS or X-Forwarded-Proto).
+func SecurityHeadersMiddleware(config *SecurityHeadersConfig) echo.MiddlewareFunc {
+	hstsMaxAge := config.HSTSMaxAge
+	if hstsMaxAge == 0 {
+		hstsMaxAge = 31536000
+	}
+	if hstsMaxAge < 0 {
+		hstsMaxAge = 0
+	}
+
+	return middleware.SecureWithConfig(middleware.SecureConfig{
+		XSSProtection:         headerValue(config.XSSProtection, "0"),
+		ContentTypeNosniff:    headerValue(config.ContentTypeNosniff, "nosniff"),
+		XFrameOptions:         headerValue(config.XFrameOptions, "SAMEORIGIN"),
+		ReferrerPolicy:        headerValue(config.ReferrerPolicy, "strict-origin-when-cross-origin"),
+		ContentSecurityPolicy: headerValue(config.ContentSecurityPolicy, ""),
+		CSPReportOnly:         config.CSPReportOnly,
+		HSTSMaxAge:            hstsMaxAge,
+		HSTSExcludeSubdomains: config.HSTSExcludeSubdomains,
+		HSTSPreloadEnabled:    config.HSTSPreload,
+	})
+}
+
+func headerValue(value, defaultValue string) string {
+	switch value {
+	case "":
+		return defaultValue
+	case headerOff:
+		return ""
+	}
+	return value
+}
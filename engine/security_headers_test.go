@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveWithSecurityHeaders(config *SecurityHeadersConfig, req *http.Request) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(SecurityHeadersMiddleware(config))
+	e.GET("/", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"ok": true})
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	rec := serveWithSecurityHeaders(&SecurityHeadersConfig{Enabled: true}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "SAMEORIGIN", rec.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", rec.Header().Get("Referrer-Policy"))
+	assert.Empty(t, rec.Header().Get("Content-Security-Policy"))
+	assert.Empty(t, rec.Header().Get("Strict-Transport-Security"), "no HSTS over plain HTTP")
+}
+
+func TestSecurityHeadersConfigured(t *testing.T) {
+	config := &SecurityHeadersConfig{
+		Enabled:               true,
+		ContentSecurityPolicy: "default-src 'self'",
+		XFrameOptions:         "DENY",
+		ReferrerPolicy:        headerOff,
+		HSTSMaxAge:            600,
+		HSTSPreload:           true,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := serveWithSecurityHeaders(config, req)
+	assert.Equal(t, "default-src 'self'", rec.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	assert.Empty(t, rec.Header().Get("Referrer-Policy"))
+	assert.Empty(t, rec.Header().Get("Strict-Transport-Security"))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXForwardedProto, "https")
+	rec = serveWithSecurityHeaders(config, req)
+	assert.Equal(t, "max-age=600; includeSubdomains; preload", rec.Header().Get("Strict-Transport-Security"))
+
+	config.CSPReportOnly = true
+	config.HSTSMaxAge = -1
+	rec = serveWithSecurityHeaders(config, req)
+	assert.Equal(t, "default-src 'self'", rec.Header().Get("Content-Security-Policy-Report-Only"))
+	assert.Empty(t, rec.Header().Get("Strict-Transport-Security"))
+}
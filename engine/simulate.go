@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+)
+
+// simulationKey is the echo context key holding the result of a simulated
+// workflow, which Execute fills with the final payload
+const simulationKey = "_simulation"
+
+// SimulationResult is the outcome of a workflow run by SimulateWorkflow
+type SimulationResult struct {
+	Status  int                    `json:"status"`
+	Headers http.Header            `json:"headers"`
+	Body    string                 `json:"body"`
+	Payload map[string]interface{} `json:"payload"` // Payload after the last node, nil when it is not an object
+}
+
+// SimulateWorkflow runs the workflow of appName answering method endpoint
+// without an HTTP server. payload is sent as the JSON body, so the
+// workflow sees it in post_data as with a real request. The request gets
+// its own session, so nothing leaks between simulations.
+//
+// Workflow failures are answered like any request and show up in the
+// Status and Body of the result; the error is only set when the workflow
+// could not be resolved.
+func SimulateWorkflow(appName, endpoint, method string, payload map[string]interface{}) (*SimulationResult, []TraceStep, error) {
+	repo := GetPlaybookRepository()
+	if repo == nil {
+		return nil, nil, errors.New("playbook repository not initialized")
+	}
+	playbooks, err := repo.LoadPlaybook(context.Background(), appName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading playbooks of %s: %w", appName, err)
+	}
+
+	c, w, err := newSimulationContext(method, endpoint, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	runeable, vars, _, _, err := GetWorkflow(c, playbooks, endpoint, method, appName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+
+	trace := &ExecutionTrace{}
+	c.Set(executionTraceKey, trace)
+	result := &SimulationResult{}
+	c.Set(simulationKey, result)
+
+	if err := runeable.Run(c, vars, "", endpoint, NewUUID(), nil); err != nil {
+		return nil, trace.Steps(), err
+	}
+
+	result.Status = w.status
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+	result.Headers = w.header
+	result.Body = w.body.String()
+	return result, trace.Steps(), nil
+}
+
+// newSimulationContext builds the echo context of a simulated request,
+// with a session store of its own
+func newSimulationContext(method, endpoint string, payload map[string]interface{}) (echo.Context, *simulatedResponseWriter, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, nil, fmt.Errorf("encoding payload: %w", err)
+		}
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	req.RequestURI = endpoint
+	req.RemoteAddr = "127.0.0.1:0"
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+
+	w := &simulatedResponseWriter{header: make(http.Header)}
+	c := echo.New().NewContext(req, w)
+	c.Set("_session_store", sessions.NewCookieStore(key))
+	return c, w, nil
+}
+
+// recordSimulatedPayload keeps the final payload of a simulated workflow
+func recordSimulatedPayload(c echo.Context, payload goja.Value) {
+	result, ok := c.Get(simulationKey).(*SimulationResult)
+	if !ok {
+		return
+	}
+	PayloadSessionMutex.Lock()
+	defer PayloadSessionMutex.Unlock()
+	result.Payload, _ = payloadObject(payload)
+}
+
+// simulatedResponseWriter captures the response of a simulated request
+type simulatedResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (w *simulatedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *simulatedResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *simulatedResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
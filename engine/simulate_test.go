@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/go-redis/redis"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// simulateTestStep runs script with the payload of the node and follows
+// output_1
+type simulateTestStep struct {
+	script string
+}
+
+func (s simulateTestStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	vm.Set("payload", payload)
+	value, err := vm.RunString(s.script)
+	return connectedNode(actor, "output_1"), value, err
+}
+
+func TestSimulateWorkflow(t *testing.T) {
+	useVMManager(t, newTestVMManager(2, nil))
+	configRepo := GetConfigRepository()
+	previousRedis := configRepo.GetRedisClient()
+	configRepo.SetRedisClient(redis.NewClient(&redis.Options{}))
+	t.Cleanup(func() { configRepo.SetRedisClient(previousRedis) })
+
+	Steps["test_simulate_sum"] = simulateTestStep{script: `({sum: post_data.a + post_data.b})`}
+	Steps["test_simulate_double"] = simulateTestStep{script: `({sum: payload.sum, doubled: payload.sum * 2})`}
+	defer delete(Steps, "test_simulate_sum")
+	defer delete(Steps, "test_simulate_double")
+
+	output := func(node string) map[string]*model.Output {
+		o := &model.Output{}
+		o.Connections = append(o.Connections, struct {
+			Node   string `json:"node"`
+			Output string `json:"output"`
+		}{Node: node, Output: "input_1"})
+		return map[string]*model.Output{"output_1": o}
+	}
+	pb := model.Playbook{
+		"start":  &model.Node{Data: map[string]interface{}{"type": "starter", "method": "POST", "urlpattern": "/calc"}, Outputs: output("node_1")},
+		"node_1": &model.Node{Data: map[string]interface{}{"type": "test_simulate_sum", "name_box": "sum"}, Outputs: output("node_2")},
+		"node_2": &model.Node{Data: map[string]interface{}{"type": "test_simulate_double"}},
+	}
+
+	previousRepo := playbookRepo
+	t.Cleanup(func() { playbookRepo = previousRepo })
+	playbookRepo = NewPlaybookRepository(nil)
+	playbookRepo.Set("simapp", map[string]map[string]*model.Playbook{"Calc": {"main": &pb}})
+	playbookRepo.SetReloaded("simapp")
+
+	result, trace, err := SimulateWorkflow("simapp", "/calc", http.MethodPost, map[string]interface{}{"a": 2, "b": 3})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, result.Status)
+	assert.Equal(t, map[string]interface{}{"sum": int64(5), "doubled": int64(10)}, result.Payload)
+	require.Len(t, trace, 2)
+	assert.Equal(t, "node_1", trace[0].NodeID)
+	assert.Equal(t, "sum", trace[0].Name)
+	assert.Equal(t, "node_2", trace[0].Next)
+	assert.Equal(t, "node_2", trace[1].NodeID)
+	assert.Equal(t, "test_simulate_double", trace[1].Type)
+
+	_, _, err = SimulateWorkflow("simapp", "/calc", http.MethodGet, nil)
+	assert.Error(t, err, "no starter answers GET /calc")
+}
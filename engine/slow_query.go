@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+)
+
+// QueryObserver receives the operation name and duration of every database
+// call made by the engine
+type QueryObserver func(operation string, duration time.Duration)
+
+var (
+	queryObserverMu sync.RWMutex
+	queryObserver   QueryObserver
+
+	// slowQueries counts the database calls logged as slow
+	slowQueries atomic.Uint64
+)
+
+// maxLoggedQueryLength bounds the query text of a slow query log line
+const maxLoggedQueryLength = 120
+
+var (
+	quotedLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$])\d+(?:\.\d+)?\b`) // $1 placeholders are kept
+)
+
+// SetQueryObserver installs the observer notified after each database
+// call, e.g. to feed query metrics. nil removes it.
+func SetQueryObserver(observer QueryObserver) {
+	queryObserverMu.Lock()
+	defer queryObserverMu.Unlock()
+	queryObserver = observer
+}
+
+// observeQuery reports a database call started at start to the observer
+// and logs it when it took at least [database_nflow].slow_query_ms
+func observeQuery(operation, query string, start time.Time) {
+	duration := time.Since(start)
+
+	queryObserverMu.RLock()
+	observer := queryObserver
+	queryObserverMu.RUnlock()
+	if observer != nil {
+		observer(operation, duration)
+	}
+
+	threshold := GetConfig().DatabaseNflow.SlowQueryMs
+	if threshold > 0 && duration >= time.Duration(threshold)*time.Millisecond {
+		slowQueries.Add(1)
+		logger.Infof("[slow-query] %s took %dms: %s", operation, duration.Milliseconds(), sanitizeQuery(query))
+	}
+}
+
+// SlowQueries returns how many database calls took at least
+// [database_nflow].slow_query_ms since startup
+func SlowQueries() uint64 {
+	return slowQueries.Load()
+}
+
+// sanitizeQuery identifies a query in the logs without the values it
+// carries: literals become ?, whitespace is collapsed and long queries
+// are cut
+func sanitizeQuery(query string) string {
+	query = quotedLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLoggedQueryLength {
+		query = query[:maxLoggedQueryLength] + "..."
+	}
+	return query
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowAppQuery spends a few dozen milliseconds counting before returning
+// an empty app
+const slowAppQuery = `WITH RECURSIVE counter(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM counter WHERE x < 300000)
+	SELECT '{}', 'secret-' || ? FROM (SELECT max(x) FROM counter)`
+
+func TestSlowQueryLog(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	previousLevel := logger.GetLevel()
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		logger.SetLevel(previousLevel)
+		repo.SetConfig(original)
+		SetQueryObserver(nil)
+	})
+	logger.SetLevel(logger.LevelInfo)
+
+	cfg := original
+	cfg.DatabaseNflow.QueryGetApp = slowAppQuery
+	cfg.DatabaseNflow.SlowQueryMs = 1
+	repo.SetConfig(cfg)
+
+	var observed []string
+	SetQueryObserver(func(operation string, duration time.Duration) {
+		observed = append(observed, operation)
+	})
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	before := SlowQueries()
+	_, err = GetPlaybook(context.Background(), conn, "app")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"playbook_load"}, observed)
+	assert.Equal(t, before+1, SlowQueries())
+	assert.Contains(t, out.String(), "[slow-query] playbook_load took ")
+	assert.Contains(t, out.String(), "WITH RECURSIVE counter(x) AS (SELECT ? UNION ALL")
+	assert.NotContains(t, out.String(), "300000", "literals are not logged")
+
+	t.Run("fast queries are not logged", func(t *testing.T) {
+		out.Reset()
+		cfg.DatabaseNflow.SlowQueryMs = 60000
+		repo.SetConfig(cfg)
+
+		_, err = GetPlaybook(context.Background(), conn, "app")
+		require.NoError(t, err)
+		assert.NotContains(t, out.String(), "[slow-query]")
+	})
+}
+
+func TestSanitizeQuery(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM users WHERE name = ? AND id = ? AND token = $1",
+		sanitizeQuery("SELECT *\n  FROM users WHERE name = 'o''brien' AND id = 42 AND token = $1"))
+	assert.Len(t, sanitizeQuery("SELECT "+string(bytes.Repeat([]byte("x, "), 100))+"y FROM t"), maxLoggedQueryLength+len("..."))
+}
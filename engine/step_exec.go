@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/plugins"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/arturoeanton/nflow-runtime/security/analyzer"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrExecDisabled is returned when an exec node runs without vm_pool.enable_process
+var ErrExecDisabled = errors.New("exec nodes are disabled (vm_pool.enable_process = false)")
+
+// StepExec runs an allowlisted local binary with arguments. The command never
+// goes through a shell. Node data:
+//
+//	command    binary name or absolute path listed in [exec].allowed_commands
+//	args       array of arguments
+//	timeout_ms optional timeout, capped by [exec].timeout
+//
+// The result is stored in payload.exec as {stdout, stderr, exit_code,
+// duration_ms}. A non-zero exit code follows output_2 when it is connected.
+// In test mode the command is recorded instead of run and exits with 0.
+type StepExec struct {
+}
+
+func (s *StepExec) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	currentProcess.State = "run"
+	currentProcess.Killeable = true
+
+	config := GetConfig()
+	command, _ := actor.Data["command"].(string)
+	args := execArgs(actor.Data["args"])
+
+	path, err := resolveExecCommand(config, command, args)
+	if err != nil {
+		c.JSON(http.StatusForbidden, echo.Map{"message": err.Error()})
+		currentProcess.State = "error"
+		return "", payload, err
+	}
+
+	timeout := execTimeout(config)
+	if ms := dataInt(actor.Data, "timeout_ms"); ms > 0 && time.Duration(ms)*time.Millisecond < timeout {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+	defer cancel()
+
+	maxOutput := config.ExecConfig.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = 1024 * 1024
+	}
+	stdout := &cappedBuffer{limit: int(maxOutput)}
+	stderr := &cappedBuffer{limit: int(maxOutput)}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Do not leak the runtime environment (credentials, tokens) to commands
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+
+	start := time.Now()
+	if plugins.TestModeEnabled() {
+		plugins.RecordCall("exec", command, map[string]interface{}{"args": args})
+	} else {
+		err = cmd.Run()
+	}
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("command %s timed out after %s", command, timeout)
+		} else if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+			err = nil
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, echo.Map{"message": err.Error()})
+		currentProcess.State = "error"
+		return "", payload, err
+	}
+
+	result := map[string]interface{}{
+		"stdout":      stdout.String(),
+		"stderr":      stderr.String(),
+		"exit_code":   exitCode,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"truncated":   stdout.truncated || stderr.truncated,
+	}
+	obj, ok := payload.(*goja.Object)
+	if !ok || obj == nil {
+		obj = vm.NewObject()
+	}
+	obj.Set("exec", result)
+	payload = obj
+	currentProcess.Payload = payload
+	currentProcess.State = "end"
+
+	next := "output_1"
+	if exitCode != 0 && actor.Outputs["output_2"] != nil {
+		next = "output_2"
+	}
+	if actor.Outputs != nil && actor.Outputs[next] != nil {
+		next = connectedNode(actor, next)
+	}
+	return next, payload, nil
+}
+
+// resolveExecCommand checks the sandbox flag, the allowlist and the arguments
+// and returns the path of the binary to run
+func resolveExecCommand(config *ConfigWorkspace, command string, args []string) (string, error) {
+	if !config.VMPoolConfig.EnableProcess {
+		return "", ErrExecDisabled
+	}
+	if command == "" {
+		return "", fmt.Errorf("exec node has no command")
+	}
+	if issues := analyzer.AnalyzeCommand(command, args); analyzer.HasHighSeverityIssues(issues) {
+		return "", fmt.Errorf("exec command rejected: %s", issues[0].Description)
+	}
+
+	for _, allowed := range config.ExecConfig.AllowedCommands {
+		switch {
+		case allowed == command && filepath.IsAbs(allowed):
+			return allowed, nil
+		case allowed == command:
+			return exec.LookPath(command)
+		case filepath.IsAbs(allowed) && !strings.Contains(command, "/") && filepath.Base(allowed) == command:
+			return allowed, nil
+		}
+	}
+	return "", fmt.Errorf("command %s is not in exec.allowed_commands", command)
+}
+
+func execTimeout(config *ConfigWorkspace) time.Duration {
+	if config.ExecConfig.Timeout > 0 {
+		return time.Duration(config.ExecConfig.Timeout) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// execArgs reads the args of an exec node
+func execArgs(raw interface{}) []string {
+	switch v := raw.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		args := make([]string, 0, len(v))
+		for _, arg := range v {
+			args = append(args, fmt.Sprint(arg))
+		}
+		return args
+	}
+	return nil
+}
+
+// cappedBuffer keeps the first limit bytes written and discards the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/plugins"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withExecConfig installs a config allowing exec nodes for the duration of a test
+func withExecConfig(t *testing.T, enableProcess bool, allowed ...string) {
+	repo := GetConfigRepository()
+	original := *repo.GetConfig()
+	config := original
+	config.VMPoolConfig.EnableProcess = enableProcess
+	config.ExecConfig = ExecConfig{AllowedCommands: allowed, Timeout: 5}
+	repo.SetConfig(config)
+	t.Cleanup(func() { repo.SetConfig(original) })
+}
+
+func runExecNode(t *testing.T, data map[string]interface{}) (string, goja.Value, error) {
+	p := process.CreateProcess("exec-test")
+	t.Cleanup(p.Close)
+	vm := goja.New()
+	actor := &model.Node{Data: data}
+	return (&StepExec{}).Run(&model.Controller{}, actor, createTestContext(), vm, "output_1", nil, p, vm.ToValue(map[string]interface{}{"id": 1}))
+}
+
+func TestStepExecAllowedCommand(t *testing.T) {
+	withExecConfig(t, true, "echo")
+
+	_, payload, err := runExecNode(t, map[string]interface{}{
+		"command": "echo",
+		"args":    []interface{}{"hello", "nflow"},
+	})
+	require.NoError(t, err)
+
+	result := payload.Export().(map[string]interface{})
+	assert.EqualValues(t, 1, result["id"], "payload is kept")
+	exec := result["exec"].(map[string]interface{})
+	assert.Equal(t, "hello nflow\n", exec["stdout"])
+	assert.EqualValues(t, 0, exec["exit_code"])
+}
+
+func TestStepExecTestMode(t *testing.T) {
+	withExecConfig(t, true, "echo")
+	plugins.ConfigureTestMode(true, 0)
+	defer plugins.ConfigureTestMode(false, 0)
+
+	_, payload, err := runExecNode(t, map[string]interface{}{
+		"command": "echo",
+		"args":    []interface{}{"hello"},
+	})
+	require.NoError(t, err)
+	exec := payload.Export().(map[string]interface{})["exec"].(map[string]interface{})
+	assert.Equal(t, "", exec["stdout"], "the command does not run")
+	assert.EqualValues(t, 0, exec["exit_code"])
+
+	calls := plugins.RecordedCalls("exec")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "echo", calls[0].Target)
+	assert.Equal(t, []string{"hello"}, calls[0].Data["args"])
+
+	_, _, err = runExecNode(t, map[string]interface{}{"command": "ls"})
+	assert.Error(t, err, "the allowlist still applies")
+}
+
+func TestStepExecDeniedCommands(t *testing.T) {
+	withExecConfig(t, true, "echo")
+
+	_, _, err := runExecNode(t, map[string]interface{}{"command": "ls"})
+	assert.Error(t, err, "commands outside the allowlist are rejected")
+
+	_, _, err = runExecNode(t, map[string]interface{}{"command": "/bin/echo"})
+	assert.Error(t, err, "paths must be allowlisted explicitly")
+
+	_, _, err = runExecNode(t, map[string]interface{}{
+		"command": "echo",
+		"args":    []interface{}{"hi; rm -rf /"},
+	})
+	assert.Error(t, err, "shell metacharacters are rejected")
+
+	withExecConfig(t, false, "echo")
+	_, _, err = runExecNode(t, map[string]interface{}{"command": "echo"})
+	assert.True(t, errors.Is(err, ErrExecDisabled))
+}
+
+func TestStepExecTimeoutAndExitCode(t *testing.T) {
+	withExecConfig(t, true, "sleep", "false")
+
+	_, _, err := runExecNode(t, map[string]interface{}{
+		"command":    "sleep",
+		"args":       []interface{}{"5"},
+		"timeout_ms": float64(50),
+	})
+	assert.Error(t, err)
+
+	_, payload, err := runExecNode(t, map[string]interface{}{"command": "false"})
+	require.NoError(t, err)
+	exec := payload.Export().(map[string]interface{})["exec"].(map[string]interface{})
+	assert.EqualValues(t, 1, exec["exit_code"])
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/arturoeanton/nflow-runtime/model"
 	"github.com/arturoeanton/nflow-runtime/process"
 	"github.com/dop251/goja"
-	"github.com/google/uuid"
 	babel "github.com/jvatic/goja-babel"
 	"github.com/labstack/echo/v4"
 )
@@ -47,7 +46,7 @@ func (s *StepJS) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm
 	code := "function main(){}"
 
 	// Ya no necesitamos mutex porque cada step tiene su propia copia del actor
-	actor.Data["storage_id"] = uuid.New().String()
+	actor.Data["storage_id"] = NewUUID()
 
 	_, hasCompile := actor.Data["compile"]
 
@@ -77,7 +76,8 @@ func (s *StepJS) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm
 	if compileCode, ok := actor.Data["compile"]; ok {
 		code = compileCode.(string)
 	}
-	code = code + "\nmain()"
+	script := NewScriptSource("workflow", "", code, "\nmain()")
+	code = script.Code
 
 	outputs := make(map[string]string)
 	for key, o := range actor.Outputs {
@@ -115,12 +115,9 @@ func (s *StepJS) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm
 	if !hasProgram {
 		// Compile the program
 		var err error
-		program, err = goja.Compile("workflow", code, false)
+		program, err = goja.Compile(script.Name, code, false)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, echo.Map{
-				"message": "Script compilation error: " + err.Error(),
-				"actor":   actor,
-			})
+			respondJSError(c, http.StatusInternalServerError, currentProcess.UUIDBoxCurrent, script, err)
 			currentProcess.State = "error"
 			return "", payload, err
 		}
@@ -142,6 +139,7 @@ func (s *StepJS) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm
 			}
 		}()
 		semVM <- 1
+		setNodeDeadline(c)
 		_, err := vm.RunProgram(program)
 		<-semVM
 		return err
@@ -150,21 +148,14 @@ func (s *StepJS) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm
 	if err != nil {
 		// Verificar si es un error de límite de recursos
 		statusCode := http.StatusInternalServerError
-		errorMessage := err.Error()
-
 		if IsResourceLimitError(err) {
 			statusCode = http.StatusRequestTimeout
-			errorMessage = "Script execution exceeded resource limits: " + errorMessage
 			log.Printf("Resource limit exceeded in workflow: %v", err)
 		}
 
-		c.JSON(statusCode, echo.Map{
-			"message": errorMessage,
-			"actor":   actor,
-		})
+		respondJSError(c, statusCode, currentProcess.UUIDBoxCurrent, script, err)
 		currentProcess.State = "error"
 		return "", payload, err
-
 	}
 	payload = vm.Get("payload")
 	currentProcess.Payload = payload.Export()
@@ -172,7 +163,7 @@ func (s *StepJS) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm
 	currentProcess.State = "end"
 	if actor.Outputs != nil {
 		if actor.Outputs[connection_next] != nil {
-			connection_next = actor.Outputs[connection_next].Connections[0].Node
+			connection_next = connectedNode(actor, connection_next)
 		} else {
 			connection_next = ""
 		}
@@ -194,6 +185,7 @@ func babelTransform(code string) string {
 	res, err := babel.TransformString(
 		code,
 		map[string]interface{}{
+			"retainLines": true,
 			"plugins": []string{
 				"transform-block-scoping",
 				"transform-block-scoped-functions",
@@ -2,11 +2,11 @@ package engine
 
 import (
 	"encoding/json"
+	"net/http"
 
 	"github.com/arturoeanton/nflow-runtime/model"
 	"github.com/arturoeanton/nflow-runtime/process"
 	"github.com/dop251/goja"
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -37,19 +37,40 @@ func CloneValue(value goja.Value, vm *goja.Runtime) goja.Value {
 	return runtime.ToValue(clonedValue)
 }
 
+// respondGoroutineLimit answers a request whose fork was refused by the
+// goroutine limit, unless the workflow already answered it
+func respondGoroutineLimit(c echo.Context, err error) {
+	if c.Response().Committed {
+		return
+	}
+	c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+}
+
 func (s *StepGorutine) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
 	currentProcess.State = "run"
 	payloadClone1 := CloneValue(payload, vm)
 	payloadClone2 := CloneValue(payload, vm)
-	if actor.Outputs["output_2"] != nil {
-		next2 := actor.Outputs["output_2"].Connections[0].Node
-		uuid2 := uuid.New().String()
+	if next2 := connectedNode(actor, "output_2"); next2 != "" {
+		if err := trackGoroutine(currentProcess); err != nil {
+			currentProcess.State = "error"
+			respondGoroutineLimit(c, err)
+			return "", payload, err
+		}
+		if err := acquireForkSlot(); err != nil {
+			currentProcess.State = "error"
+			respondUnavailable(c, err.Error())
+			return "", payload, err
+		}
+		uuid2 := NewUUID()
 		c.Response().Header().Add("Dromedary-Wid-2", uuid2)
 		// fmt.Println("gorutine")
 		// fmt.Printf("%+v\n", payloadClone1.Export())
-		go RunWithCallback(cc, c, vars, next2, "go_rutine_"+uuid2, uuid2, payloadClone1)
+		go func() {
+			defer releaseForkSlot()
+			RunWithCallback(cc, c, vars, next2, "go_rutine_"+uuid2, uuid2, payloadClone1)
+		}()
 	}
-	connectionNext = actor.Outputs[connectionNext].Connections[0].Node
+	connectionNext = connectedNode(actor, connectionNext)
 	currentProcess.State = "end"
 
 	// fmt.Println("gorutine2")
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/arturoeanton/nflow-runtime/model"
@@ -25,4 +26,15 @@ func init() {
 	Steps["js"] = &StepJS{}
 	Steps["dromedary"] = &StepPlugin{}
 	Steps["dromedary_callback"] = &StepPluginCallback{}
+	Steps["exec"] = &StepExec{}
+}
+
+// registeredStepTypes returns the sorted node types with a registered step
+func registeredStepTypes() []string {
+	types := make([]string, 0, len(Steps))
+	for nodeType := range Steps {
+		types = append(types, nodeType)
+	}
+	sort.Strings(types)
+	return types
 }
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/arturoeanton/nflow-runtime/model"
@@ -18,11 +19,20 @@ func (s *StepPlugin) Run(cc *model.Controller, actor *model.Node, c echo.Context
 	currentProcess.Killeable = true
 
 	// Ya no necesitamos mutex porque el actor es una copia
-	name := actor.Data["dromedary_name"].(string)
+	name, _ := actor.Data["dromedary_name"].(string)
 
 	var payloadOut interface{}
 	dataJs, _ := json.Marshal(actor.Data)
-	payloadOut, next, err := Plugins[name].Run(c, vars, &payload, string(dataJs), nil)
+	plugin, ok := requestPlugins(c).plugins[name]
+	if !ok {
+		err := fmt.Errorf("plugin not found: %s", name)
+		c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": err.Error(),
+		})
+		currentProcess.State = "error"
+		return "", payload, err
+	}
+	payloadOut, next, err := plugin.Run(c, vars, &payload, string(dataJs), nil)
 
 	payload = vm.ToValue(payloadOut)
 	currentProcess.Payload = payload
@@ -36,7 +46,7 @@ func (s *StepPlugin) Run(cc *model.Controller, actor *model.Node, c echo.Context
 	currentProcess.State = "end"
 	if actor.Outputs != nil {
 		if actor.Outputs[next] != nil {
-			next = actor.Outputs[next].Connections[0].Node
+			next = connectedNode(actor, next)
 		}
 	}
 	return next, payload, err
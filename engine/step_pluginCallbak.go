@@ -2,13 +2,15 @@ package engine
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/arturoeanton/nflow-runtime/logger"
 	"github.com/arturoeanton/nflow-runtime/model"
 	"github.com/arturoeanton/nflow-runtime/process"
 	"github.com/dop251/goja"
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -20,7 +22,7 @@ func (s *StepPluginCallback) Run(cc *model.Controller, actor *model.Node, c echo
 	time.Sleep(1 * time.Second)
 
 	// Ya no necesitamos mutex porque el actor es una copia
-	name := actor.Data["dromedary_name"].(string)
+	name, _ := actor.Data["dromedary_name"].(string)
 
 	dataJs, _ := json.Marshal(actor.Data)
 
@@ -28,28 +30,55 @@ func (s *StepPluginCallback) Run(cc *model.Controller, actor *model.Node, c echo
 	if len(actor.Outputs) == 1 {
 		output = "output_1"
 	}
-	if actor.Outputs[output] != nil {
-		next2 := actor.Outputs[output].Connections[0].Node
+	pluginSet := requestPlugins(c)
+	dromedary, ok := pluginSet.plugins[name]
+	if !ok {
+		err := fmt.Errorf("plugin not found: %s", name)
+		c.JSON(http.StatusInternalServerError, echo.Map{"message": err.Error()})
+		currentProcess.State = "error"
+		return "", payload, err
+	}
+
+	if next2 := connectedNode(actor, output); next2 != "" {
+		if err := trackGoroutine(currentProcess); err != nil {
+			currentProcess.State = "error"
+			respondGoroutineLimit(c, err)
+			return "", payload, err
+		}
+		// The callbacks outlive the request, keep the plugins pinned until
+		// they end
+		pluginSet.pin()
 		//processFather := process
 		go func() {
-			uuid2 := uuid.New().String()
+			uuid2 := NewUUID()
 			secondProcess := process.CreateProcessWithCallback(uuid2)
+			secondProcess.SetParent(currentProcess)
 			defer func() {
 				secondProcess.Close()
+				pluginSet.release()
 			}()
-			dromedary := Plugins[name]
+			if err := trackGoroutine(secondProcess); err != nil {
+				logger.Errorf("Plugin %s callbacks not started: %v", name, err)
+				return
+			}
 			go dromedary.Run(c, vars, &payload, string(dataJs), secondProcess.Callback)
 			for {
 				data := <-secondProcess.Callback
 				var p map[string]interface{}
 				json.Unmarshal([]byte(data), &p)
 				payload = vm.ToValue(p)
-				if _, ok := p["next"]; ok {
-					next2 = actor.Outputs[p["next"].(string)].Connections[0].Node
+				if nextOutput, ok := p["next"].(string); ok {
+					next2 = connectedNode(actor, nextOutput)
 				}
 				if _, ok := p["error_exit"]; ok {
 					break
 				}
+				// Past the limit the callback is dropped, the plugin keeps
+				// sending the next ones
+				if err := trackGoroutine(secondProcess); err != nil {
+					logger.Errorf("Plugin %s callback to %s dropped: %v", name, next2, err)
+					continue
+				}
 				var wg sync.WaitGroup
 				wg.Add(1)
 				go func() {
@@ -62,7 +91,7 @@ func (s *StepPluginCallback) Run(cc *model.Controller, actor *model.Node, c echo
 	}
 
 	if len(actor.Outputs) > 1 {
-		connection_next = actor.Outputs[connection_next].Connections[0].Node
+		connection_next = connectedNode(actor, connection_next)
 	}
 	return connection_next, payload, nil
 }
@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRetryBackoffShift caps the exponential backoff so a large retry_count
+// cannot overflow the delay.
+const maxRetryBackoffShift = 10
+
+// maxRetryCount caps retry_count, a node can not hold its request forever
+const maxRetryCount = 10
+
+// RetryPolicy describes how a node is re-run when its step returns an error.
+// It is read from the node data keys retry_count, retry_delay_ms and retry_on.
+type RetryPolicy struct {
+	Count int           // Extra attempts after the first one (0 = no retry, at most maxRetryCount)
+	Delay time.Duration // Base delay, doubled after every failed attempt
+	On    []string      // Error substrings that trigger a retry (empty = any error)
+}
+
+// GetRetryPolicy builds the retry policy from node data. Values coming from
+// the designer may be numbers or strings, both are accepted.
+func GetRetryPolicy(data map[string]interface{}) RetryPolicy {
+	policy := RetryPolicy{
+		Count: dataInt(data, "retry_count"),
+		Delay: time.Duration(dataInt(data, "retry_delay_ms")) * time.Millisecond,
+	}
+	if policy.Count < 0 {
+		policy.Count = 0
+	}
+	if policy.Count > maxRetryCount {
+		policy.Count = maxRetryCount
+	}
+	if policy.Delay < 0 {
+		policy.Delay = 0
+	}
+
+	switch on := data["retry_on"].(type) {
+	case string:
+		for _, term := range strings.Split(on, ",") {
+			if term = strings.TrimSpace(term); term != "" {
+				policy.On = append(policy.On, strings.ToLower(term))
+			}
+		}
+	case []interface{}:
+		for _, item := range on {
+			if term, ok := item.(string); ok && strings.TrimSpace(term) != "" {
+				policy.On = append(policy.On, strings.ToLower(strings.TrimSpace(term)))
+			}
+		}
+	}
+
+	return policy
+}
+
+// Matches reports whether err should trigger another attempt
+func (p RetryPolicy) Matches(err error) bool {
+	if err == nil {
+		return false
+	}
+	if len(p.On) == 0 {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, term := range p.On {
+		if term == "*" || term == "any" || strings.Contains(message, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before the given retry attempt (1-based)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	shift := attempt - 1
+	if shift < 0 {
+		shift = 0
+	}
+	if shift > maxRetryBackoffShift {
+		shift = maxRetryBackoffShift
+	}
+	return p.Delay * time.Duration(1<<shift)
+}
+
+// retryAttemptWriter buffers the response of an attempt that may still be
+// retried, so a failing step does not commit anything to the client. The
+// response is replayed when the attempt is kept: it succeeded or the engine
+// gave up retrying.
+type retryAttemptWriter struct {
+	original http.ResponseWriter
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+}
+
+// holdResponse routes the response of c to a buffer until release is called
+func holdResponse(c echo.Context) *retryAttemptWriter {
+	res := c.Response()
+	w := &retryAttemptWriter{original: res.Writer, header: res.Header().Clone()}
+	res.Writer = w
+	return w
+}
+
+// release restores the writer of c and, when keep is set, replays the held
+// response on it. A discarded response leaves c as it was before the attempt.
+func (w *retryAttemptWriter) release(c echo.Context, keep bool) {
+	res := c.Response()
+	if res.Writer != w {
+		return
+	}
+	res.Writer = w.original
+	if !keep {
+		res.Committed = false
+		res.Status = http.StatusOK
+		res.Size = 0
+		return
+	}
+
+	header := res.Writer.Header()
+	for key := range header {
+		delete(header, key)
+	}
+	for key, values := range w.header {
+		header[key] = values
+	}
+	if w.status != 0 {
+		res.Writer.WriteHeader(w.status)
+	}
+	if w.body.Len() > 0 {
+		res.Writer.Write(w.body.Bytes())
+	}
+}
+
+func (w *retryAttemptWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *retryAttemptWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *retryAttemptWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+// Flush is a no-op, the response is written when the attempt is kept
+func (w *retryAttemptWriter) Flush() {}
+
+// runStepWithRetry runs a step honoring the retry policy. onRetry is called
+// for every failed attempt that is followed by another one. Waiting between
+// attempts stops when the client goes away.
+func runStepWithRetry(s Step, policy RetryPolicy, onRetry func(attempt int, err error), cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	if policy.Count == 0 {
+		return s.Run(cc, actor, c, vm, connectionNext, vars, currentProcess, payload)
+	}
+
+	var (
+		next string
+		out  goja.Value
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		if attempt > policy.Count {
+			return s.Run(cc, actor, c, vm, connectionNext, vars, currentProcess, payload)
+		}
+
+		held := holdResponse(c)
+		next, out, err = s.Run(cc, actor, c, vm, connectionNext, vars, currentProcess, payload)
+		if err == nil || !policy.Matches(err) || currentProcess.GetFlagExit() == 1 {
+			held.release(c, true)
+			return next, out, err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		delay := policy.Backoff(attempt)
+		logger.Verbosef("Retrying node after error (attempt %d/%d, delay %v): %v", attempt, policy.Count, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-c.Request().Context().Done():
+			timer.Stop()
+			held.release(c, true)
+			return next, out, err
+		case <-timer.C:
+		}
+		held.release(c, false)
+	}
+}
+
+// dataInt reads an integer value from node data
+func dataInt(data map[string]interface{}, key string) int {
+	switch v := data[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err == nil {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStep fails a fixed number of times before succeeding
+type flakyStep struct {
+	failures int
+	calls    int
+	err      error
+}
+
+func (s *flakyStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		c.JSON(http.StatusInternalServerError, echo.Map{"message": s.err.Error()})
+		return "", payload, s.err
+	}
+	return "node_2", payload, nil
+}
+
+func TestGetRetryPolicy(t *testing.T) {
+	policy := GetRetryPolicy(map[string]interface{}{
+		"retry_count":    float64(3),
+		"retry_delay_ms": "50",
+		"retry_on":       "timeout, Connection Refused",
+	})
+	assert.Equal(t, 3, policy.Count)
+	assert.Equal(t, 50*time.Millisecond, policy.Delay)
+	assert.Equal(t, []string{"timeout", "connection refused"}, policy.On)
+
+	assert.True(t, policy.Matches(errors.New("dial tcp: connection refused")))
+	assert.False(t, policy.Matches(errors.New("syntax error")))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(3))
+
+	capped := GetRetryPolicy(map[string]interface{}{"retry_count": float64(100000)})
+	assert.Equal(t, maxRetryCount, capped.Count)
+
+	empty := GetRetryPolicy(map[string]interface{}{})
+	assert.Equal(t, 0, empty.Count)
+	assert.True(t, empty.Matches(errors.New("anything")))
+}
+
+func TestRunStepWithRetrySucceedsAfterFailures(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	s := &flakyStep{failures: 2, err: errors.New("upstream timeout")}
+	policy := RetryPolicy{Count: 3, Delay: time.Millisecond}
+	p := process.CreateProcess("retry-success")
+	defer p.Close()
+
+	var retried []int
+	next, _, err := runStepWithRetry(s, policy, func(attempt int, err error) {
+		retried = append(retried, attempt)
+	}, &model.Controller{}, &model.Node{}, c, goja.New(), "output_1", nil, p, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "node_2", next)
+	assert.Equal(t, 3, s.calls)
+	assert.Equal(t, []int{1, 2}, retried)
+	assert.False(t, c.Response().Committed, "error responses of retried attempts must not reach the client")
+}
+
+// textStep answers text on every attempt, an error on the failing ones
+type textStep struct {
+	failures int
+	calls    int
+}
+
+func (s *textStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		c.Response().Header().Set("X-Attempt", "failed")
+		c.String(http.StatusBadGateway, "upstream timeout")
+		return "", payload, errors.New("upstream timeout")
+	}
+	c.String(http.StatusOK, "done")
+	return "node_2", payload, nil
+}
+
+func TestRunStepWithRetryHoldsEveryResponse(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	s := &textStep{failures: 2}
+	p := process.CreateProcess("retry-text")
+	defer p.Close()
+
+	_, _, err := runStepWithRetry(s, RetryPolicy{Count: 3}, nil, &model.Controller{}, &model.Node{}, c, goja.New(), "output_1", nil, p, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.calls)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "done", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("X-Attempt"), "headers of failed attempts are discarded")
+}
+
+func TestRunStepWithRetryStopsWhenClientLeaves(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), rec)
+
+	s := &textStep{failures: 5}
+	p := process.CreateProcess("retry-cancel")
+	defer p.Close()
+
+	start := time.Now()
+	_, _, err := runStepWithRetry(s, RetryPolicy{Count: 3, Delay: time.Hour}, nil, &model.Controller{}, &model.Node{}, c, goja.New(), "output_1", nil, p, nil)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.Equal(t, 1, s.calls)
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestRunStepWithRetryGivesUp(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	s := &flakyStep{failures: 5, err: errors.New("upstream timeout")}
+	p := process.CreateProcess("retry-exhausted")
+	defer p.Close()
+
+	_, _, err := runStepWithRetry(s, RetryPolicy{Count: 2}, nil, &model.Controller{}, &model.Node{}, c, goja.New(), "output_1", nil, p, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 3, s.calls)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestRunStepWithRetrySkipsNonMatchingErrors(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	s := &flakyStep{failures: 2, err: errors.New("syntax error")}
+	p := process.CreateProcess("retry-nomatch")
+	defer p.Close()
+
+	_, _, err := runStepWithRetry(s, RetryPolicy{Count: 3, On: []string{"timeout"}}, nil, &model.Controller{}, &model.Node{}, c, goja.New(), "output_1", nil, p, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, s.calls)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "held error response must be replayed")
+}
+
+func TestStepTracksEachRetryAttempt(t *testing.T) {
+	Steps["test_flaky"] = &flakyStep{failures: 2, err: errors.New("upstream timeout")}
+	defer delete(Steps, "test_flaky")
+
+	originalChannel := trackerChannel
+	trackerChannel = make(chan TrackerEntry, 10)
+	atomic.StoreInt32(&trackerEnabled, 1)
+	defer func() {
+		trackerChannel = originalChannel
+		atomic.StoreInt32(&trackerEnabled, 0)
+	}()
+
+	pb := model.Playbook{
+		"node_1": &model.Node{Data: map[string]interface{}{
+			"type":           "test_flaky",
+			"retry_count":    float64(3),
+			"retry_delay_ms": float64(1),
+		}},
+	}
+	cc := &model.Controller{Playbook: &pb}
+	c := NewIsolatedContext(createTestContext())
+	p := process.CreateProcess("retry-tracker")
+	defer p.Close()
+
+	next, _, err := step(cc, c, goja.New(), "node_1", nil, p, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "node_2", next)
+
+	close(trackerChannel)
+	var entries []TrackerEntry
+	for entry := range trackerChannel {
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+	assert.Equal(t, "retry_1", entries[0].ConnectionNext)
+	assert.Equal(t, "retry_2", entries[1].ConnectionNext)
+	assert.Equal(t, 3, entries[2].Attempt)
+	assert.Equal(t, "node_2", entries[2].ConnectionNext)
+}
@@ -7,16 +7,21 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/plugins"
 )
 
 type TrackerEntry struct {
 	LogId, BoxId, BoxName, BoxType        string
+	WorkflowId                            string // Process UUID, sent to the client as Nflow-Wid-1
 	Username, IP, RealIP, URL             string
 	ConnectionNext                        string
 	Diff                                  time.Duration
+	CPUTime                               time.Duration // CPU burned by the node, without time waiting on I/O (Linux only)
 	OrderBox                              int
+	Attempt                               int // Execution attempt of the node (1 = first run)
 	JSONPayload                           []byte
 	UserAgent, QueryParam, Hostname, Host string
 }
@@ -36,6 +41,10 @@ type BatchProcessor struct {
 	ticker    *time.Ticker
 	db        *sql.DB
 	config    *ConfigWorkspace
+
+	// Sanitizes or encrypts the payloads before they are stored, nil when
+	// they are stored raw
+	protectPayload func([]byte) []byte
 }
 
 var (
@@ -53,6 +62,30 @@ var (
 	trackerConfig        *TrackerConfig
 )
 
+// defaultTrackerMaxFieldBytes applies when [tracker].max_field_bytes is
+// not set
+const defaultTrackerMaxFieldBytes = 1024
+
+func trackerMaxFieldBytes() int {
+	if limit := GetConfig().TrackerConfig.MaxFieldBytes; limit > 0 {
+		return limit
+	}
+	return defaultTrackerMaxFieldBytes
+}
+
+// truncateField cuts value to at most maxBytes without splitting a UTF-8
+// sequence
+func truncateField(value string, maxBytes int) string {
+	if len(value) <= maxBytes {
+		return value
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut]
+}
+
 // StartTracker initializes the high-performance tracker system
 func StartTracker(numWorkers int) {
 	// Get config and check if tracker is enabled
@@ -108,13 +141,16 @@ func StartTracker(numWorkers int) {
 		flushInterval = trackerConfig.FlushInterval
 	}
 
+	protectPayload := newTrackerPayloadProtector(config)
+
 	for i := 0; i < numWorkers; i++ {
 		bp := &BatchProcessor{
-			batch:     make([]TrackerEntry, 0, batchSize),
-			batchSize: batchSize,
-			ticker:    time.NewTicker(time.Duration(flushInterval) * time.Millisecond),
-			db:        db,
-			config:    config,
+			batch:          make([]TrackerEntry, 0, batchSize),
+			batchSize:      batchSize,
+			ticker:         time.NewTicker(time.Duration(flushInterval) * time.Millisecond),
+			db:             db,
+			config:         config,
+			protectPayload: protectPayload,
 		}
 
 		batchProcessors[i] = bp
@@ -203,6 +239,12 @@ func (bp *BatchProcessor) processBatch(batch []TrackerEntry) {
 		return // Skip if no query configured
 	}
 
+	if plugins.TestModeEnabled() {
+		recordTrackerBatch(batch)
+		atomic.AddInt64(&trackerStats.Processed, int64(len(batch)))
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -231,10 +273,28 @@ func (bp *BatchProcessor) processBatch(batch []TrackerEntry) {
 	}
 }
 
+// recordTrackerBatch captures the rows insertBatch would write, for test mode
+func recordTrackerBatch(batch []TrackerEntry) {
+	for _, entry := range batch {
+		plugins.RecordCall("db_write", "tracker", map[string]interface{}{
+			"log_id":      entry.LogId,
+			"workflow_id": entry.WorkflowId,
+			"box_id":      entry.BoxId,
+			"box_name":    entry.BoxName,
+			"box_type":    entry.BoxType,
+			"url":         entry.URL,
+			"username":    entry.Username,
+			"next":        entry.ConnectionNext,
+			"order_box":   entry.OrderBox,
+		})
+	}
+}
+
 func (bp *BatchProcessor) insertBatch(ctx context.Context, batch []TrackerEntry) error {
 	if len(batch) == 0 {
 		return nil
 	}
+	defer observeQuery("tracker_insert", bp.config.DatabaseNflow.QueryInsertLog, time.Now())
 
 	// Use transaction for batch insert
 	tx, err := bp.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
@@ -258,7 +318,12 @@ func (bp *BatchProcessor) insertBatch(ctx context.Context, batch []TrackerEntry)
 		// Format time more efficiently
 		diffStr = fmt.Sprintf("%dm", entry.Diff.Milliseconds())
 
-		_, err = stmt.ExecContext(ctx,
+		payload := entry.JSONPayload
+		if bp.protectPayload != nil {
+			payload = bp.protectPayload(payload)
+		}
+
+		args := []interface{}{
 			entry.LogId,
 			entry.BoxId,
 			entry.BoxName,
@@ -268,14 +333,19 @@ func (bp *BatchProcessor) insertBatch(ctx context.Context, batch []TrackerEntry)
 			entry.ConnectionNext,
 			diffStr,
 			entry.OrderBox,
-			entry.JSONPayload, // Already []byte, no need to convert to string
+			payload, // Already []byte, no need to convert to string
 			entry.IP,
 			entry.RealIP,
 			entry.UserAgent,
 			entry.QueryParam,
 			entry.Hostname,
 			entry.Host,
-		)
+		}
+		// Opt-in so existing QueryInsertLog statements keep their parameters
+		if bp.config.TrackerConfig.IncludeWorkflowID {
+			args = append(args, entry.WorkflowId)
+		}
+		_, err = stmt.ExecContext(ctx, args...)
 		if err != nil {
 			return fmt.Errorf("failed to execute statement: %w", err)
 		}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/security"
+	"github.com/arturoeanton/nflow-runtime/security/encryption"
+	"github.com/arturoeanton/nflow-runtime/security/interceptor"
+	"github.com/arturoeanton/nflow-runtime/security/sanitizer"
+)
+
+// Values of [tracker].payload_protection
+const (
+	// TrackerPayloadDefault sanitizes payloads when
+	// security.enable_log_sanitization is set
+	TrackerPayloadDefault = ""
+	// TrackerPayloadNone stores payloads as the workflow left them
+	TrackerPayloadNone = "none"
+	// TrackerPayloadSanitize masks sensitive data with the log sanitizer
+	TrackerPayloadSanitize = "sanitize"
+	// TrackerPayloadEncrypt encrypts sensitive data with
+	// security.encryption_key, so authorized tools can still read it
+	TrackerPayloadEncrypt = "encrypt"
+)
+
+// emptyTrackerPayload is stored when a payload can not be protected
+var emptyTrackerPayload = []byte("{}")
+
+// newTrackerPayloadProtector returns the function applied to the payloads
+// of tracker entries before they are stored, nil when they are stored raw.
+// When encryption is asked for but can not be set up, payloads are dropped
+// rather than stored readable.
+func newTrackerPayloadProtector(config *ConfigWorkspace) func([]byte) []byte {
+	sec := config.SecurityConfig
+	switch config.TrackerConfig.PayloadProtection {
+	case TrackerPayloadSanitize:
+	case TrackerPayloadDefault:
+		if !sec.EnableLogSanitization {
+			return nil
+		}
+	case TrackerPayloadEncrypt:
+		encrypt, err := newTrackerPayloadEncrypter(&sec)
+		if err != nil {
+			logger.Errorf("Tracker payloads will not be stored: %v", err)
+			return func([]byte) []byte { return emptyTrackerPayload }
+		}
+		return encrypt
+	case TrackerPayloadNone:
+		return nil
+	default:
+		logger.Errorf("Unknown tracker.payload_protection %q, payloads are stored raw", config.TrackerConfig.PayloadProtection)
+		return nil
+	}
+	ls := sanitizer.NewLogSanitizer(logSanitizerConfig(&sec))
+	return func(payload []byte) []byte {
+		return sanitizeTrackerPayload(ls, payload)
+	}
+}
+
+// logSanitizerConfig maps the log_* settings of [security] to the sanitizer
+func logSanitizerConfig(sec *security.Config) *sanitizer.Config {
+	return &sanitizer.Config{
+		Enabled:        true,
+		MaskingChar:    sec.LogMaskingChar,
+		PreserveLength: sec.LogPreserveLength,
+		ShowType:       sec.LogShowType,
+		CustomPatterns: sec.LogCustomPatterns,
+		MaxDepth:       sec.MaxDepth,
+	}
+}
+
+// sanitizeTrackerPayload masks the sensitive values of a JSON payload.
+// Objects are sanitized value by value so the result stays valid JSON;
+// anything else is sanitized as text.
+func sanitizeTrackerPayload(ls *sanitizer.LogSanitizer, payload []byte) []byte {
+	object, ok := decodeTrackerPayload(payload).(map[string]interface{})
+	if !ok {
+		return []byte(ls.Sanitize(string(payload)))
+	}
+	data, err := json.Marshal(ls.SanitizeMap(object))
+	if err != nil {
+		return emptyTrackerPayload
+	}
+	return data
+}
+
+// newTrackerPayloadEncrypter encrypts the values of security.always_encrypt_fields
+// and those the sensitive data interceptor detects, as
+// "[ENCRYPTED_<type>:<ciphertext>]" strings
+func newTrackerPayloadEncrypter(sec *security.Config) (func([]byte) []byte, error) {
+	if sec.EncryptionKey == "" {
+		return nil, errors.New("tracker.payload_protection is encrypt but security.encryption_key is not set")
+	}
+	service, err := encryption.NewEncryptionService(sec.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("initializing encryption: %w", err)
+	}
+	sdi := interceptor.NewSensitiveDataInterceptor(service, &interceptor.Config{
+		Enabled:        true,
+		EncryptInPlace: true,
+		CustomPatterns: sec.CustomPatterns,
+		MaxDepth:       sec.MaxDepth,
+
+		PatternPriorities: sec.PatternPriorities,
+		ContextKeywords:   sec.PatternContext,
+		ContextWindow:     sec.PatternContextWindow,
+	})
+
+	return func(payload []byte) []byte {
+		value := decodeTrackerPayload(payload)
+		if value == nil {
+			return emptyTrackerPayload
+		}
+		value = encryptTrackerFields(service, sec.AlwaysEncryptFields, value)
+		processed, err := sdi.ProcessResponse(value)
+		if err != nil {
+			logger.Error("Error encrypting tracker payload:", err)
+			return emptyTrackerPayload
+		}
+		data, err := json.Marshal(processed)
+		if err != nil {
+			return emptyTrackerPayload
+		}
+		return data
+	}, nil
+}
+
+// encryptTrackerFields encrypts the string values stored under one of
+// fields, at any depth
+func encryptTrackerFields(service *encryption.EncryptionService, fields []string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok && slices.Contains(fields, key) {
+				if encrypted, err := service.Encrypt(s); err == nil {
+					v[key] = "[ENCRYPTED_field:" + encrypted + "]"
+				} else {
+					v[key] = ""
+				}
+				continue
+			}
+			v[key] = encryptTrackerFields(service, fields, item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = encryptTrackerFields(service, fields, item)
+		}
+	}
+	return value
+}
+
+// decodeTrackerPayload decodes a JSON payload keeping numbers as written,
+// nil when it is not valid JSON
+func decodeTrackerPayload(payload []byte) interface{} {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil
+	}
+	return value
+}
@@ -1,9 +1,26 @@
 package engine
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/plugins"
+	"github.com/arturoeanton/nflow-runtime/process"
+	"github.com/arturoeanton/nflow-runtime/security/encryption"
+	"github.com/dop251/goja"
+	"github.com/labstack/echo/v4"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTrackerConfiguration(t *testing.T) {
@@ -90,3 +107,233 @@ func TestTrackerPerformance(t *testing.T) {
 		t.Errorf("Tracker performance issue: took %v for 10k entries", elapsed)
 	}
 }
+
+// cpuTestStep keeps the node busy for duration, spinning when busy is set
+// and sleeping as if waiting on a slow API otherwise
+type cpuTestStep struct {
+	busy     bool
+	duration time.Duration
+}
+
+func (s cpuTestStep) Run(cc *model.Controller, actor *model.Node, c echo.Context, vm *goja.Runtime, connectionNext string, vars model.Vars, currentProcess *process.Process, payload goja.Value) (string, goja.Value, error) {
+	if !s.busy {
+		time.Sleep(s.duration)
+		return "", payload, nil
+	}
+	for deadline := time.Now().Add(s.duration); time.Now().Before(deadline); {
+	}
+	return "", payload, nil
+}
+
+func TestTrackerCPUTimeSeparatesCPUFromIO(t *testing.T) {
+	if !cpuTimeSupported {
+		t.Skip("thread CPU time is not available on this platform")
+	}
+	Steps["test_cpu_bound"] = cpuTestStep{busy: true, duration: 50 * time.Millisecond}
+	Steps["test_io_bound"] = cpuTestStep{duration: 50 * time.Millisecond}
+	defer delete(Steps, "test_cpu_bound")
+	defer delete(Steps, "test_io_bound")
+
+	originalChannel := trackerChannel
+	trackerChannel = make(chan TrackerEntry, 10)
+	atomic.StoreInt32(&trackerEnabled, 1)
+	defer func() {
+		trackerChannel = originalChannel
+		atomic.StoreInt32(&trackerEnabled, 0)
+	}()
+
+	pb := model.Playbook{
+		"cpu": &model.Node{Data: map[string]interface{}{"type": "test_cpu_bound"}},
+		"io":  &model.Node{Data: map[string]interface{}{"type": "test_io_bound"}},
+	}
+	cc := &model.Controller{Playbook: &pb}
+	c := NewIsolatedContext(createTestContext())
+	p := process.CreateProcess("cpu-time-tracker")
+	defer p.Close()
+
+	entries := make(map[string]TrackerEntry)
+	for _, node := range []string{"cpu", "io"} {
+		if _, _, err := step(cc, c, goja.New(), node, nil, p, nil); err != nil {
+			t.Fatalf("step %s: %v", node, err)
+		}
+		entry := <-trackerChannel
+		entries[entry.BoxId] = entry
+	}
+
+	cpu, io := entries["cpu"], entries["io"]
+	if cpu.Diff < 50*time.Millisecond || io.Diff < 50*time.Millisecond {
+		t.Fatalf("both nodes should take at least 50ms, got cpu=%v io=%v", cpu.Diff, io.Diff)
+	}
+	if cpu.CPUTime < 25*time.Millisecond {
+		t.Errorf("CPU-bound node should burn most of its time on CPU, got %v of %v", cpu.CPUTime, cpu.Diff)
+	}
+	if io.CPUTime > 10*time.Millisecond {
+		t.Errorf("I/O-bound node should burn almost no CPU, got %v of %v", io.CPUTime, io.Diff)
+	}
+}
+
+func TestTrackStepCapsClientFields(t *testing.T) {
+	originalChannel := trackerChannel
+	trackerChannel = make(chan TrackerEntry, 1)
+	defer func() { trackerChannel = originalChannel }()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/flow?q="+strings.Repeat("x", 4000), nil)
+	req.Header.Set("User-Agent", strings.Repeat("é", 2000))
+	c := NewIsolatedContext(e.NewContext(req, httptest.NewRecorder()))
+
+	trackStep(c, TrackerEntry{LogId: "cap"}, nil)
+	entry := <-trackerChannel
+
+	assert.LessOrEqual(t, len(entry.UserAgent), defaultTrackerMaxFieldBytes)
+	assert.True(t, utf8.ValidString(entry.UserAgent), "truncation keeps whole characters")
+	assert.LessOrEqual(t, len(entry.QueryParam), defaultTrackerMaxFieldBytes)
+	assert.Equal(t, "/flow", entry.URL)
+}
+
+func TestTrackerEntriesCarryWorkflowID(t *testing.T) {
+	originalChannel := trackerChannel
+	trackerChannel = make(chan TrackerEntry, 10)
+	atomic.StoreInt32(&trackerEnabled, 1)
+	defer func() {
+		trackerChannel = originalChannel
+		atomic.StoreInt32(&trackerEnabled, 0)
+	}()
+
+	var received []interface{}
+	Steps["test_tracker_wid"] = payloadTestStep{received: &received}
+	defer delete(Steps, "test_tracker_wid")
+
+	pb := model.Playbook{"node_1": &model.Node{Data: map[string]interface{}{"type": "test_tracker_wid"}}}
+	p := process.CreateProcess("tracker-wid-1")
+	defer p.Close()
+	_, _, err := step(&model.Controller{Playbook: &pb}, NewIsolatedContext(createTestContext()), goja.New(), "node_1", nil, p, nil)
+	require.NoError(t, err)
+
+	entry := <-trackerChannel
+	assert.Equal(t, "tracker-wid-1", entry.WorkflowId)
+	assert.NotEmpty(t, entry.LogId)
+
+	// The workflow ID is stored when [tracker].include_workflow_id is set
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE log (log_id, box_id, box_name, box_type, url, username, connection_next, diff,
+		order_box, payload, ip, real_ip, user_agent, query_param, hostname, host, workflow_id)`)
+	require.NoError(t, err)
+
+	config := &ConfigWorkspace{}
+	config.DatabaseNflow.QueryInsertLog = `INSERT INTO log VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	config.TrackerConfig.IncludeWorkflowID = true
+	bp := &BatchProcessor{db: db, config: config}
+	require.NoError(t, bp.insertBatch(context.Background(), []TrackerEntry{entry}))
+
+	var logID, workflowID string
+	require.NoError(t, db.QueryRow(`SELECT log_id, workflow_id FROM log`).Scan(&logID, &workflowID))
+	assert.Equal(t, entry.LogId, logID)
+	assert.Equal(t, "tracker-wid-1", workflowID)
+}
+
+func TestTrackerTestModeRecordsWrites(t *testing.T) {
+	plugins.ConfigureTestMode(true, 0)
+	defer plugins.ConfigureTestMode(false, 0)
+
+	// No database: in test mode the batch must not reach it
+	config := &ConfigWorkspace{}
+	config.DatabaseNflow.QueryInsertLog = `INSERT INTO log VALUES (?)`
+	bp := &BatchProcessor{config: config}
+	bp.processBatch([]TrackerEntry{{LogId: "log-1", WorkflowId: "wid-1", BoxName: "Start"}})
+
+	calls := plugins.RecordedCalls("db_write")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "tracker", calls[0].Target)
+	assert.Equal(t, "log-1", calls[0].Data["log_id"])
+	assert.Equal(t, "wid-1", calls[0].Data["workflow_id"])
+}
+
+func TestTestModeFromEnv(t *testing.T) {
+	config := &ConfigWorkspace{}
+	assert.False(t, testModeEnabled(config))
+
+	t.Setenv("NFLOW_TEST_MODE", "true")
+	assert.True(t, testModeEnabled(config))
+
+	config.TestModeConfig.Enabled = true
+	t.Setenv("NFLOW_TEST_MODE", "false")
+	assert.False(t, testModeEnabled(config))
+}
+
+func TestTrackerSanitizesStoredPayloads(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE log (log_id, box_id, box_name, box_type, url, username, connection_next, diff,
+		order_box, payload, ip, real_ip, user_agent, query_param, hostname, host)`)
+	require.NoError(t, err)
+
+	entry := TrackerEntry{LogId: "pii", JSONPayload: []byte(`{"user":{"email":"jane.doe@example.com"},"amount":12345678901234567}`)}
+	stored := func(config *ConfigWorkspace) string {
+		t.Helper()
+		_, err := db.Exec(`DELETE FROM log`)
+		require.NoError(t, err)
+		config.DatabaseNflow.QueryInsertLog = `INSERT INTO log VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		bp := &BatchProcessor{db: db, config: config, protectPayload: newTrackerPayloadProtector(config)}
+		require.NoError(t, bp.insertBatch(context.Background(), []TrackerEntry{entry}))
+		var payload string
+		require.NoError(t, db.QueryRow(`SELECT payload FROM log`).Scan(&payload))
+		return payload
+	}
+
+	// Raw unless configured
+	assert.Contains(t, stored(&ConfigWorkspace{}), "jane.doe@example.com")
+
+	config := &ConfigWorkspace{}
+	config.TrackerConfig.PayloadProtection = TrackerPayloadSanitize
+	config.SecurityConfig.LogShowType = true
+	payload := stored(config)
+	assert.NotContains(t, payload, "jane.doe@example.com")
+	assert.JSONEq(t, `{"user":{"email":"[REDACTED:email]"},"amount":12345678901234567}`, payload)
+
+	// Log sanitization turns it on unless the tracker opts out
+	config = &ConfigWorkspace{}
+	config.SecurityConfig.EnableLogSanitization = true
+	assert.NotContains(t, stored(config), "jane.doe@example.com")
+	config.TrackerConfig.PayloadProtection = TrackerPayloadNone
+	assert.Contains(t, stored(config), "jane.doe@example.com")
+}
+
+func TestTrackerEncryptsStoredPayloads(t *testing.T) {
+	config := &ConfigWorkspace{}
+	config.TrackerConfig.PayloadProtection = TrackerPayloadEncrypt
+	protect := newTrackerPayloadProtector(config)
+	require.NotNil(t, protect)
+	assert.Equal(t, "{}", string(protect([]byte(`{"email":"jane.doe@example.com"}`))), "without a key nothing readable is stored")
+
+	config.SecurityConfig.EncryptionKey = "tracker-test-key"
+	config.SecurityConfig.AlwaysEncryptFields = []string{"password"}
+	protect = newTrackerPayloadProtector(config)
+	stored := protect([]byte(`{"user":{"email":"jane.doe@example.com","password":"hunter22"},"amount":12}`))
+	assert.NotContains(t, string(stored), "jane.doe@example.com")
+	assert.NotContains(t, string(stored), "hunter22")
+
+	var payload struct {
+		User   map[string]string `json:"user"`
+		Amount float64           `json:"amount"`
+	}
+	require.NoError(t, json.Unmarshal(stored, &payload))
+	assert.Equal(t, float64(12), payload.Amount)
+
+	// Authorized tools holding the key recover the values
+	service, err := encryption.NewEncryptionService("tracker-test-key")
+	require.NoError(t, err)
+	decrypt := func(value, prefix string) string {
+		require.True(t, strings.HasPrefix(value, prefix), value)
+		plain, err := service.Decrypt(strings.TrimSuffix(strings.TrimPrefix(value, prefix), "]"))
+		require.NoError(t, err)
+		return plain
+	}
+	assert.Equal(t, "jane.doe@example.com", decrypt(payload.User["email"], "[ENCRYPTED_email:"))
+	assert.Equal(t, "hunter22", decrypt(payload.User["password"], "[ENCRYPTED_field:"))
+}
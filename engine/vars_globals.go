@@ -31,7 +31,7 @@ func saveInSession(form url.Values, c echo.Context) {
 	defer syncsession.EchoSessionsMutex.Unlock()
 	s, _ := session.Get("nflow_form", c)
 	for k, v := range form {
-		if k == "nflow_next_node_run" {
+		if k == "nflow_next_node_run" || isWorkflowStateKey(k) {
 			continue
 		}
 		if len(v) == 1 {
@@ -75,7 +75,12 @@ func AddGlobals(vm *goja.Runtime, c echo.Context) {
 	vm.Set("env", config.Env)
 
 	vm.Set("url_base", config.URLConfig.URLBase)
+	AddFeatureGlobals(vm, c)
+	AddFeatureSafeJSON(vm)
+	AddFeatureCSRF(vm, c)
+	AddFeatureContinuation(vm, c)
 	vm.Set("__vm", *vm)
 	vm.Set("ctx", context.Background())
+	AddFeatureContextValues(vm, c)
 
 }
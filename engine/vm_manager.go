@@ -1,11 +1,13 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/arturoeanton/nflow-runtime/plugins"
 	"github.com/arturoeanton/nflow-runtime/syncsession"
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/console"
@@ -23,8 +25,45 @@ type VMManager struct {
 	activeVMs map[string]*VMInstance
 	stats     VMStats
 	registry  *require.Registry
+	clearKeys []string
+
+	// requireModules are the module names scripts may require()
+	requireModules map[string]bool
+
+	maxReuses int64
+	mode      string
+
+	// acquireTimeout is how long AcquireVM waits for a VM when the pool
+	// is at capacity
+	acquireTimeout time.Duration
+
+	// preloadSize is the number of idle VMs created at startup and by Warm
+	preloadSize int
+
+	initFeatures FeatureInitializer
+
+	// createBreaker fast-fails VM creation for a cooldown after repeated
+	// factory failures so a systemic failure is not retried on every request
+	createBreaker *plugins.CircuitBreaker
 }
 
+// VM modes selected with [vm_pool].mode
+const (
+	VMModePool  = "pool"  // VMs are reused across requests
+	VMModeFresh = "fresh" // Every request gets a new VM that is discarded on release
+)
+
+// vmFactoryBreakerKey is the breaker key used for VM creation
+const vmFactoryBreakerKey = "vm_factory"
+
+// defaultAcquireTimeout is how long a request waits for a VM when the pool
+// is at capacity
+const defaultAcquireTimeout = 5 * time.Second
+
+// ErrVMPoolExhausted is returned by AcquireVM when no VM became available
+// before the acquire timeout. It is a transient capacity condition.
+var ErrVMPoolExhausted = errors.New("VM pool exhausted")
+
 // VMInstance represents a VM with metadata
 type VMInstance struct {
 	VM       *goja.Runtime
@@ -33,8 +72,27 @@ type VMInstance struct {
 	LastUsed time.Time
 	UseCount int64
 	mu       sync.Mutex
+
+	// baseline holds the globals present when the VM was created; anything
+	// else was set during a request and is removed on release
+	baseline map[string]struct{}
 }
 
+// defaultClearGlobals are reset on every release even when they were part
+// of the VM baseline
+var defaultClearGlobals = []string{
+	"form", "header", "query", "headers", "get_header", "auth_session", "profile",
+	"get_cookie", "set_cookie", "delete_cookie", "set_status", "redirect",
+	"locale", "t",
+	"redis_hset", "redis_hget", "redis_hdel",
+	"nflow_endpoint",
+	"shared_var", // For tests
+}
+
+// FeatureInitializer sets up the request features of a VM when it is
+// acquired. Tests can replace it with SetFeatureInitializer.
+type FeatureInitializer func(vm *goja.Runtime, c echo.Context)
+
 // VMFactory creates new VM instances with proper initialization
 type VMFactory func() (*goja.Runtime, error)
 
@@ -46,6 +104,7 @@ type VMStats struct {
 	Available int64
 	TotalUses int64
 	Errors    int64
+	Retired   int64 // VMs discarded after reaching the max reuses
 }
 
 var (
@@ -94,6 +153,36 @@ func NewVMManagerWithConfig(maxSize int, config *VMPoolConfig) *VMManager {
 		maxSize:   maxSize,
 		activeVMs: make(map[string]*VMInstance),
 		registry:  new(require.Registry),
+		clearKeys: defaultClearGlobals,
+		mode:      VMModePool,
+
+		acquireTimeout: defaultAcquireTimeout,
+
+		initFeatures: InitializeVMFeatures,
+	}
+	if config != nil && config.Mode == VMModeFresh {
+		manager.mode = VMModeFresh
+	}
+	threshold, cooldown := 3, 5*time.Second
+	if config != nil && config.CreateFailureThreshold > 0 {
+		threshold = config.CreateFailureThreshold
+	}
+	if config != nil && config.CreateBackoffSeconds > 0 {
+		cooldown = time.Duration(config.CreateBackoffSeconds) * time.Second
+	}
+	manager.createBreaker = plugins.NewCircuitBreaker(threshold, cooldown)
+	if config != nil && config.ClearGlobals != nil {
+		manager.clearKeys = config.ClearGlobals
+	}
+	if config != nil && config.AcquireTimeoutMs > 0 {
+		manager.acquireTimeout = time.Duration(config.AcquireTimeoutMs) * time.Millisecond
+	}
+	manager.requireModules = requireAllowlist(nil)
+	if config != nil && config.RequireModules != nil {
+		manager.requireModules = requireAllowlist(config.RequireModules)
+	}
+	if config != nil && config.MaxReusesPerVM > 0 {
+		manager.maxReuses = int64(config.MaxReusesPerVM)
 	}
 
 	// Setup registry once
@@ -104,38 +193,36 @@ func NewVMManagerWithConfig(maxSize int, config *VMPoolConfig) *VMManager {
 	manager.factory = manager.createVM
 
 	// Determine preload size
-	preloadSize := maxSize / 2
+	manager.preloadSize = maxSize / 2
 	if config != nil && config.PreloadSize > 0 {
-		preloadSize = config.PreloadSize
+		manager.preloadSize = config.PreloadSize
 	}
 
 	// Pre-populate pool
-	for i := 0; i < preloadSize; i++ {
-		if vm, err := manager.factory(); err == nil {
-			instance := &VMInstance{
-				VM:       vm,
-				ID:       fmt.Sprintf("vm-%d-%d", time.Now().UnixNano(), i),
-				LastUsed: time.Now(),
-			}
-			select {
-			case manager.pool <- instance:
-				manager.updateStats(func(s *VMStats) {
-					s.Created++
-					s.Available++
-				})
-			default:
-				// Pool is full
-			}
-		}
-	}
+	manager.Warm(manager.preloadSize)
 
 	return manager
 }
 
+// SetFeatureInitializer replaces the function that sets up the features of
+// an acquired VM; nil skips feature setup. Call it before using the manager.
+func (m *VMManager) SetFeatureInitializer(fn FeatureInitializer) {
+	m.initFeatures = fn
+}
+
+// Mode returns the VM mode in use, VMModePool or VMModeFresh
+func (m *VMManager) Mode() string {
+	return m.mode
+}
+
 // AcquireVM gets a VM from the pool or creates a new one
 func (m *VMManager) AcquireVM(c echo.Context) (*VMInstance, error) {
 	log.Printf("[VM Manager] AcquireVM called\n")
 
+	if m.mode == VMModeFresh {
+		return m.acquireFreshVM(c)
+	}
+
 	// First attempt - try to get from pool immediately
 	select {
 	case instance := <-m.pool:
@@ -173,7 +260,7 @@ func (m *VMManager) AcquireVM(c echo.Context) (*VMInstance, error) {
 			log.Printf("[VM Manager] Pool at capacity, waiting for available VM...\n")
 
 			// Wait with timeout for a VM to become available
-			timeout := time.NewTimer(5 * time.Second)
+			timeout := time.NewTimer(m.acquireTimeout)
 			defer timeout.Stop()
 
 			select {
@@ -203,17 +290,14 @@ func (m *VMManager) AcquireVM(c echo.Context) (*VMInstance, error) {
 					len(m.activeVMs), len(m.pool))
 				m.mu.RUnlock()
 
-				return nil, fmt.Errorf("VM pool exhausted: timeout waiting for available VM (max: %d)", m.maxSize)
+				return nil, fmt.Errorf("%w: timeout waiting for available VM (max: %d)", ErrVMPoolExhausted, m.maxSize)
 			}
 		}
 
 		// Create new VM
 		log.Printf("[VM Manager] Creating new VM (pool empty)\n")
-		vm, err := m.factory()
+		vm, err := m.newVM()
 		if err != nil {
-			m.updateStats(func(s *VMStats) {
-				s.Errors++
-			})
 			return nil, fmt.Errorf("failed to create VM: %w", err)
 		}
 
@@ -223,6 +307,7 @@ func (m *VMManager) AcquireVM(c echo.Context) (*VMInstance, error) {
 			InUse:    true,
 			LastUsed: time.Now(),
 			UseCount: 1,
+			baseline: globalKeys(vm),
 		}
 
 		m.mu.Lock()
@@ -270,8 +355,28 @@ func (m *VMManager) ReleaseVM(instance *VMInstance) {
 		log.Printf("[VM Manager] WARNING: VM %s was not in activeVMs map\n", instance.ID)
 	}
 
+	// Fresh VMs are never reused
+	if m.mode == VMModeFresh {
+		m.updateStats(func(s *VMStats) {
+			s.InUse--
+		})
+		return
+	}
+
+	// Retire VMs that reached the reuse limit so goja internal state can not
+	// accumulate; a fresh VM takes its place in the pool
+	if m.maxReuses > 0 && instance.UseCount >= m.maxReuses {
+		log.Printf("[VM Manager] Retiring VM %s after %d uses\n", instance.ID, instance.UseCount)
+		m.updateStats(func(s *VMStats) {
+			s.InUse--
+			s.Retired++
+		})
+		m.replaceRetiredVM()
+		return
+	}
+
 	// Clear sensitive data from VM
-	m.clearVM(instance.VM)
+	m.clearVM(instance)
 
 	// Try to return to pool
 	select {
@@ -290,13 +395,132 @@ func (m *VMManager) ReleaseVM(instance *VMInstance) {
 	}
 }
 
+// acquireFreshVM creates a VM for a single request
+func (m *VMManager) acquireFreshVM(c echo.Context) (*VMInstance, error) {
+	vm, err := m.newVM()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	instance := &VMInstance{
+		VM:       vm,
+		ID:       fmt.Sprintf("vm-%d", time.Now().UnixNano()),
+		InUse:    true,
+		LastUsed: time.Now(),
+		UseCount: 1,
+	}
+
+	m.mu.Lock()
+	m.activeVMs[instance.ID] = instance
+	m.mu.Unlock()
+
+	m.updateStats(func(s *VMStats) {
+		s.Created++
+		s.InUse++
+		s.TotalUses++
+	})
+
+	m.resetVM(vm, c)
+	return instance, nil
+}
+
+// replaceRetiredVM adds a fresh VM to the pool in place of a retired one
+func (m *VMManager) replaceRetiredVM() {
+	vm, err := m.newVM()
+	if err != nil {
+		return
+	}
+	m.addIdleVM(vm)
+}
+
+// addIdleVM puts a new VM in the pool; false when the pool is full
+func (m *VMManager) addIdleVM(vm *goja.Runtime) bool {
+	instance := &VMInstance{
+		VM:       vm,
+		ID:       fmt.Sprintf("vm-%d", time.Now().UnixNano()),
+		LastUsed: time.Now(),
+		baseline: globalKeys(vm),
+	}
+	select {
+	case m.pool <- instance:
+		m.updateStats(func(s *VMStats) {
+			s.Created++
+			s.Available++
+		})
+		return true
+	default:
+		// Pool is full
+		return false
+	}
+}
+
+// Available returns the number of idle VMs in the pool
+func (m *VMManager) Available() int {
+	return len(m.pool)
+}
+
+// PreloadSize returns the number of idle VMs the pool is warmed to
+func (m *VMManager) PreloadSize() int {
+	return m.preloadSize
+}
+
+// Warm creates VMs until n are idle in the pool, without going over the
+// max size counting the VMs in use. It returns how many were created and
+// stops at the first creation error. In fresh mode nothing is pooled and
+// Warm does nothing.
+func (m *VMManager) Warm(n int) (int, error) {
+	if m.mode == VMModeFresh {
+		return 0, nil
+	}
+
+	m.mu.RLock()
+	missing := n - len(m.pool)
+	if free := m.maxSize - len(m.activeVMs) - len(m.pool); missing > free {
+		missing = free
+	}
+	m.mu.RUnlock()
+
+	created := 0
+	for ; created < missing; created++ {
+		vm, err := m.newVM()
+		if err != nil {
+			return created, err
+		}
+		if !m.addIdleVM(vm) {
+			break
+		}
+	}
+	return created, nil
+}
+
+// newVM runs the factory behind the creation breaker. Failures, including
+// the ones rejected while the breaker is open, count as VMStats.Errors.
+func (m *VMManager) newVM() (*goja.Runtime, error) {
+	if err := m.createBreaker.Allow(vmFactoryBreakerKey); err != nil {
+		m.updateStats(func(s *VMStats) {
+			s.Errors++
+		})
+		return nil, err
+	}
+
+	vm, err := m.factory()
+	if err != nil {
+		m.createBreaker.RecordFailure(vmFactoryBreakerKey)
+		m.updateStats(func(s *VMStats) {
+			s.Errors++
+		})
+		return nil, err
+	}
+	m.createBreaker.RecordSuccess(vmFactoryBreakerKey)
+	return vm, nil
+}
+
 // createVM creates a new VM instance with base configuration
 func (m *VMManager) createVM() (*goja.Runtime, error) {
 	vm := goja.New()
 
-	// Enable require and console
-	m.registry.Enable(vm)
-	console.Enable(vm)
+	// Enable console and require, limited to the allowed modules
+	enableRequire(m.registry, vm, m.requireModules)
 
 	// Set base configuration
 	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
@@ -311,13 +535,17 @@ func (m *VMManager) resetVM(vm *goja.Runtime, c echo.Context) {
 	// Clear any previous global state
 	vm.Set("console", require.Require(vm, "console"))
 
-	// Check if this is a test context by looking for our specific test marker
-	if testMarker := c.Get("_test_context"); testMarker != nil {
-		log.Printf("[VM Reset] Test context detected, skipping feature setup\n")
-		// This is a test context, skip feature setup
+	if m.initFeatures == nil {
+		log.Printf("[VM Reset] No feature initializer, skipping feature setup\n")
 		return
 	}
+	m.initFeatures(vm, c)
+}
 
+// InitializeVMFeatures is the default FeatureInitializer. It registers the
+// session, users, token, template and CSV features, the globals and the
+// plugin functions for the request.
+func InitializeVMFeatures(vm *goja.Runtime, c echo.Context) {
 	log.Printf("[VM Reset] Initializing VM features for context\n")
 
 	// Add features - these will be called for each request
@@ -336,18 +564,25 @@ func (m *VMManager) resetVM(vm *goja.Runtime, c echo.Context) {
 	AddFeatureUsers(vm, c)
 	AddFeatureToken(vm, c)
 	AddFeatureTemplate(vm, c)
+	AddFeatureCSV(vm, c)
 	// Use wrapper for JS context
 	SetupJSContext(vm, c)
 	AddGlobals(vm, c)
 
 	// Add plugin features
-	log.Printf("[VM Reset] Adding plugin features (%d plugins)...\n", len(Plugins))
-	for _, p := range Plugins {
+	pluginSet := requestPlugins(c)
+	log.Printf("[VM Reset] Adding plugin features (%d plugins)...\n", len(pluginSet.plugins))
+	for _, p := range pluginSet.plugins {
 		features := p.AddFeatureJS()
 		log.Printf("[VM Reset] Plugin features: %d\n", len(features))
 		for key, fx := range features {
 			vm.Set(key, fx)
 		}
+		if rp, ok := p.(PluginRequestFeatures); ok {
+			for key, fx := range rp.AddFeatureJSRequest(c) {
+				vm.Set(key, fx)
+			}
+		}
 	}
 
 	// Verify critical functions are available
@@ -373,38 +608,36 @@ func (m *VMManager) resetVM(vm *goja.Runtime, c echo.Context) {
 	log.Printf("[VM Reset] VM reset completed\n")
 }
 
-// clearVM removes sensitive data from VM
-func (m *VMManager) clearVM(vm *goja.Runtime) {
-	// Clear sensitive globals and any user-defined variables
-	// NOTE: Don't clear 'c' and 'echo_context' as they need to be reset per request
-	sensitiveKeys := []string{
-		"form", "header", "auth_session", "profile",
-		"redis_hset", "redis_hget", "redis_hdel",
-		"nflow_endpoint",
-		"shared_var", // For tests
-	}
+// clearVM removes the data of the last request from the VM. Every global
+// added after the VM was created is deleted, which covers the ones set with
+// vm.Set by features and the ones assigned by scripts, without running JS.
+// The configured clear list is reset as well.
+func (m *VMManager) clearVM(instance *VMInstance) {
+	vm := instance.VM
+	global := vm.GlobalObject()
 
-	for _, key := range sensitiveKeys {
+	for _, key := range m.clearKeys {
 		vm.Set(key, goja.Undefined())
 	}
 
-	// Clear any global variables that might have been set
-	// Wrapped in try-catch to avoid issues during concurrent access
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("[VM Clear] Recovered from panic during cleanup: %v\n", r)
-			}
-		}()
+	for _, key := range global.Keys() {
+		if _, ok := instance.baseline[key]; ok {
+			continue
+		}
+		if err := global.Delete(key); err != nil {
+			// Non configurable bindings (top level var) can only be blanked
+			vm.Set(key, goja.Undefined())
+		}
+	}
+}
 
-		vm.RunString(`
-			for (var key in this) {
-				if (this.hasOwnProperty(key) && !['console', 'require', 'module', 'exports'].includes(key)) {
-					delete this[key];
-				}
-			}
-		`)
-	}()
+// globalKeys returns the enumerable globals currently defined in vm
+func globalKeys(vm *goja.Runtime) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, key := range vm.GlobalObject().Keys() {
+		keys[key] = struct{}{}
+	}
+	return keys
 }
 
 // updateStats safely updates statistics
@@ -450,6 +683,7 @@ func (m *VMManager) logMetrics() {
 			Available: m.stats.Available,
 			TotalUses: m.stats.TotalUses,
 			Errors:    m.stats.Errors,
+			Retired:   m.stats.Retired,
 		}
 		m.stats.mu.RUnlock()
 
@@ -458,8 +692,8 @@ func (m *VMManager) logMetrics() {
 		poolSize := len(m.pool)
 		m.mu.RUnlock()
 
-		log.Printf("[VM Pool Metrics] Created: %d, InUse: %d, Available: %d, TotalUses: %d, Errors: %d | ActiveVMs: %d, PoolSize: %d, MaxSize: %d\n",
-			stats.Created, stats.InUse, stats.Available, stats.TotalUses, stats.Errors,
+		log.Printf("[VM Pool Metrics] Created: %d, InUse: %d, Available: %d, TotalUses: %d, Errors: %d, Retired: %d | ActiveVMs: %d, PoolSize: %d, MaxSize: %d\n",
+			stats.Created, stats.InUse, stats.Available, stats.TotalUses, stats.Errors, stats.Retired,
 			activeVMs, poolSize, m.maxSize)
 
 		// Warn if pool is getting full
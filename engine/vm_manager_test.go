@@ -2,13 +2,16 @@ package engine
 
 import (
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/arturoeanton/nflow-runtime/plugins"
 	"github.com/dop251/goja"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
 )
@@ -17,17 +20,20 @@ func createTestContext() echo.Context {
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rec := httptest.NewRecorder()
-	ctx := e.NewContext(req, rec)
-
-	// Set up test marker to skip feature initialization in tests
-	ctx.Set("_test_context", true)
+	return e.NewContext(req, rec)
+}
 
-	return ctx
+// newTestVMManager creates a manager that skips the request features, which
+// need the session middleware, database and Redis of a real server
+func newTestVMManager(maxSize int, config *VMPoolConfig) *VMManager {
+	manager := NewVMManagerWithConfig(maxSize, config)
+	manager.SetFeatureInitializer(nil)
+	return manager
 }
 
 // TestVMManagerBasicOperations tests basic acquire/release operations
 func TestVMManagerBasicOperations(t *testing.T) {
-	manager := NewVMManager(5)
+	manager := newTestVMManager(5, nil)
 	ctx := createTestContext()
 
 	// Test acquire
@@ -54,7 +60,7 @@ func TestVMManagerBasicOperations(t *testing.T) {
 
 // TestVMManagerConcurrency tests concurrent access without race conditions
 func TestVMManagerConcurrency(t *testing.T) {
-	manager := NewVMManager(20) // Increased pool size
+	manager := newTestVMManager(20, nil) // Increased pool size
 	ctx := createTestContext()
 
 	numGoroutines := 20 // Reduced to match pool size
@@ -115,7 +121,7 @@ func TestVMManagerConcurrency(t *testing.T) {
 
 // TestVMManagerPoolExhaustion tests behavior when pool is exhausted
 func TestVMManagerPoolExhaustion(t *testing.T) {
-	manager := NewVMManager(2) // Very small pool
+	manager := newTestVMManager(2, nil) // Very small pool
 	ctx := createTestContext()
 
 	// Acquire all VMs
@@ -145,7 +151,7 @@ func TestVMManagerPoolExhaustion(t *testing.T) {
 
 // TestVMManagerIsolation tests that VMs are properly isolated
 func TestVMManagerIsolation(t *testing.T) {
-	manager := NewVMManager(2)
+	manager := newTestVMManager(2, nil)
 	ctx := createTestContext()
 
 	// First VM sets a value
@@ -162,7 +168,7 @@ func TestVMManagerIsolation(t *testing.T) {
 
 // TestVMManagerRaceCondition tests for race conditions using Go's race detector
 func TestVMManagerRaceCondition(t *testing.T) {
-	manager := NewVMManager(5)
+	manager := newTestVMManager(5, nil)
 	ctx := createTestContext()
 
 	var wg sync.WaitGroup
@@ -207,7 +213,7 @@ func TestVMManagerRaceCondition(t *testing.T) {
 
 // TestVMManagerWithVM tests the WithVM helper function
 func TestVMManagerWithVM(t *testing.T) {
-	manager := NewVMManager(3)
+	manager := newTestVMManager(3, nil)
 	ctx := createTestContext()
 
 	var executionCount int
@@ -232,7 +238,7 @@ func TestVMManagerWithVM(t *testing.T) {
 
 // BenchmarkVMManagerAcquireRelease benchmarks acquire/release operations
 func BenchmarkVMManagerAcquireRelease(b *testing.B) {
-	manager := NewVMManager(10)
+	manager := newTestVMManager(10, nil)
 	ctx := createTestContext()
 
 	b.ResetTimer()
@@ -249,7 +255,7 @@ func BenchmarkVMManagerAcquireRelease(b *testing.B) {
 
 // BenchmarkVMManagerWithVM benchmarks the WithVM helper
 func BenchmarkVMManagerWithVM(b *testing.B) {
-	manager := NewVMManager(10)
+	manager := newTestVMManager(10, nil)
 	ctx := createTestContext()
 
 	b.ResetTimer()
@@ -262,3 +268,281 @@ func BenchmarkVMManagerWithVM(b *testing.B) {
 		}
 	})
 }
+
+// TestVMManagerClearsRequestGlobals tests that only globals added during a
+// request are removed and the configured clear list is reset
+func TestVMManagerClearsRequestGlobals(t *testing.T) {
+	manager := newTestVMManager(1, &VMPoolConfig{PreloadSize: 1, ClearGlobals: []string{"console_level"}})
+	ctx := createTestContext()
+
+	instance, err := manager.AcquireVM(ctx)
+	assert.NoError(t, err)
+	instance.VM.Set("secret", "s3cr3t")
+	instance.VM.Set("console_level", "debug")
+	_, err = instance.VM.RunString(`token = "abc"; var declared = 1`)
+	assert.NoError(t, err)
+	manager.ReleaseVM(instance)
+
+	instance, err = manager.AcquireVM(ctx)
+	assert.NoError(t, err)
+	defer manager.ReleaseVM(instance)
+	for _, key := range []string{"secret", "token", "declared", "console_level"} {
+		val := instance.VM.Get(key)
+		assert.True(t, val == nil || goja.IsUndefined(val), "%s should be cleared", key)
+	}
+
+	// Baseline globals survive the release
+	val, err := instance.VM.RunString(`typeof require`)
+	assert.NoError(t, err)
+	assert.Equal(t, "function", val.String())
+}
+
+// requestGlobals simulates the globals a request leaves behind
+func requestGlobals(vm *goja.Runtime) {
+	for i := 0; i < 60; i++ {
+		vm.Set(fmt.Sprintf("global_%d", i), i)
+	}
+}
+
+// BenchmarkVMManagerReleaseTracked benchmarks the release path deleting the
+// globals added since the VM was created
+func BenchmarkVMManagerReleaseTracked(b *testing.B) {
+	manager := newTestVMManager(1, nil)
+	instance, err := manager.AcquireVM(createTestContext())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		requestGlobals(instance.VM)
+		manager.clearVM(instance)
+	}
+}
+
+// BenchmarkVMManagerReleaseScriptLoop benchmarks the previous release path,
+// which ran a JS loop deleting every global, for comparison
+func BenchmarkVMManagerReleaseScriptLoop(b *testing.B) {
+	manager := newTestVMManager(1, nil)
+	instance, err := manager.AcquireVM(createTestContext())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		requestGlobals(instance.VM)
+		for _, key := range defaultClearGlobals {
+			instance.VM.Set(key, goja.Undefined())
+		}
+		instance.VM.RunString(`
+			for (var key in this) {
+				if (this.hasOwnProperty(key) && !['console', 'require', 'module', 'exports'].includes(key)) {
+					delete this[key];
+				}
+			}
+		`)
+	}
+}
+
+// TestVMManagerRetiresAfterMaxReuses tests that a VM is discarded after the
+// configured number of uses and replaced by a fresh one
+func TestVMManagerRetiresAfterMaxReuses(t *testing.T) {
+	manager := newTestVMManager(1, &VMPoolConfig{PreloadSize: 1, MaxReusesPerVM: 3})
+	ctx := createTestContext()
+
+	var firstID string
+	for i := 0; i < 3; i++ {
+		instance, err := manager.AcquireVM(ctx)
+		assert.NoError(t, err)
+		if i == 0 {
+			firstID = instance.ID
+		}
+		assert.Equal(t, firstID, instance.ID, "VM is reused until the limit")
+		manager.ReleaseVM(instance)
+	}
+	assert.Equal(t, int64(1), manager.GetStats().Retired)
+
+	instance, err := manager.AcquireVM(ctx)
+	assert.NoError(t, err)
+	assert.NotEqual(t, firstID, instance.ID, "a fresh VM replaces the retired one")
+	assert.Equal(t, int64(1), instance.UseCount)
+	manager.ReleaseVM(instance)
+}
+
+// TestVMManagerCreationBackoff tests that repeated factory failures trip the
+// creation breaker and that creation recovers after the cooldown
+func TestVMManagerCreationBackoff(t *testing.T) {
+	manager := newTestVMManager(1, &VMPoolConfig{})
+	manager.createBreaker = plugins.NewCircuitBreaker(2, 50*time.Millisecond)
+	ctx := createTestContext()
+
+	var calls int
+	failing := true
+	factory := manager.factory
+	manager.factory = func() (*goja.Runtime, error) {
+		calls++
+		if failing {
+			return nil, fmt.Errorf("out of resources")
+		}
+		return factory()
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := manager.AcquireVM(ctx)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, calls)
+
+	// Breaker is open: no factory call, fast failure
+	_, err := manager.AcquireVM(ctx)
+	assert.ErrorIs(t, err, plugins.ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, int64(3), manager.GetStats().Errors)
+
+	// Recovers once the cooldown elapsed and the factory works again
+	failing = false
+	time.Sleep(60 * time.Millisecond)
+	instance, err := manager.AcquireVM(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	manager.ReleaseVM(instance)
+
+	instance, err = manager.AcquireVM(ctx)
+	assert.NoError(t, err)
+	manager.ReleaseVM(instance)
+}
+
+// TestVMManagerModes tests that both modes isolate requests and that only
+// the pool mode reuses VMs
+func TestVMManagerModes(t *testing.T) {
+	for _, mode := range []string{VMModePool, VMModeFresh} {
+		t.Run(mode, func(t *testing.T) {
+			manager := newTestVMManager(2, &VMPoolConfig{Mode: mode, PreloadSize: 1})
+			assert.Equal(t, mode, manager.Mode())
+			ctx := createTestContext()
+
+			first, err := manager.AcquireVM(ctx)
+			assert.NoError(t, err)
+			_, err = first.VM.RunString(`leaked = "request 1"`)
+			assert.NoError(t, err)
+			manager.ReleaseVM(first)
+
+			second, err := manager.AcquireVM(ctx)
+			assert.NoError(t, err)
+			defer manager.ReleaseVM(second)
+			val := second.VM.Get("leaked")
+			assert.True(t, val == nil || goja.IsUndefined(val), "state must not leak between requests")
+
+			if mode == VMModePool {
+				assert.Same(t, first.VM, second.VM)
+			} else {
+				assert.NotSame(t, first.VM, second.VM)
+				assert.Equal(t, int64(2), manager.GetStats().Created)
+			}
+		})
+	}
+}
+
+// TestVMManagerFeatureInitializer tests that managers set up the request
+// features by default and that a stub replaces them; request values can not
+// skip the setup
+func TestVMManagerFeatureInitializer(t *testing.T) {
+	manager := NewVMManagerWithConfig(1, &VMPoolConfig{})
+	assert.Equal(t, reflect.ValueOf(InitializeVMFeatures).Pointer(), reflect.ValueOf(manager.initFeatures).Pointer())
+
+	var calls int
+	manager.SetFeatureInitializer(func(vm *goja.Runtime, c echo.Context) {
+		calls++
+		vm.Set("feature_ready", true)
+	})
+
+	ctx := createTestContext()
+	ctx.Set("_test_context", true)
+	instance, err := manager.AcquireVM(ctx)
+	assert.NoError(t, err)
+	defer manager.ReleaseVM(instance)
+
+	assert.Equal(t, 1, calls)
+	assert.True(t, instance.VM.Get("feature_ready").ToBoolean())
+}
+
+// TestVMManagerWarm tests that Warm refills a drained pool up to the
+// preload size without going over the max size
+func TestVMManagerWarm(t *testing.T) {
+	manager := newTestVMManager(4, &VMPoolConfig{PreloadSize: 2})
+	assert.Equal(t, 2, manager.PreloadSize())
+	assert.Equal(t, 2, manager.Available())
+
+	// Idle VMs dropped by the cleanup are not replaced until warmed
+	<-manager.pool
+	<-manager.pool
+	assert.Equal(t, 0, manager.Available())
+
+	created, err := manager.Warm(manager.PreloadSize())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, created)
+	assert.Equal(t, 2, manager.Available())
+
+	created, err = manager.Warm(manager.PreloadSize())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created, "an already warm pool is left as is")
+
+	// VMs in use count towards the max size
+	ctx := createTestContext()
+	var held []*VMInstance
+	for i := 0; i < 3; i++ {
+		instance, err := manager.AcquireVM(ctx)
+		require.NoError(t, err)
+		held = append(held, instance)
+	}
+	created, err = manager.Warm(4)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+	for _, instance := range held {
+		manager.ReleaseVM(instance)
+	}
+
+	// Creation errors stop the warmup
+	<-manager.pool
+	<-manager.pool
+	manager.factory = func() (*goja.Runtime, error) { return nil, fmt.Errorf("out of resources") }
+	created, err = manager.Warm(4)
+	assert.Error(t, err)
+	assert.Equal(t, 0, created)
+
+	fresh := newTestVMManager(4, &VMPoolConfig{Mode: VMModeFresh})
+	created, err = fresh.Warm(2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created, "fresh mode never pools VMs")
+}
+
+func TestVMManagerRequireAllowlist(t *testing.T) {
+	manager := newTestVMManager(1, nil)
+	instance, err := manager.AcquireVM(createTestContext())
+	assert.NoError(t, err)
+	defer manager.ReleaseVM(instance)
+
+	_, err = instance.VM.RunString(`require('util').format('%s', 'ok')`)
+	assert.NoError(t, err)
+
+	for _, script := range []string{`require('fs')`, `require('child_process')`, `require('./config.json')`} {
+		_, err = instance.VM.RunString(script)
+		if assert.Error(t, err, script) {
+			assert.Contains(t, err.Error(), "is not allowed")
+		}
+	}
+
+	thrown, err := instance.VM.RunString(`(function() { try { require('fs') } catch (e) { return e instanceof Error } })()`)
+	assert.NoError(t, err)
+	assert.True(t, thrown.ToBoolean(), "a disallowed require throws a catchable Error")
+
+	restricted := newTestVMManager(1, &VMPoolConfig{RequireModules: []string{}})
+	instance2, err := restricted.AcquireVM(createTestContext())
+	assert.NoError(t, err)
+	defer restricted.ReleaseVM(instance2)
+	_, err = instance2.VM.RunString(`require('util')`)
+	assert.Error(t, err)
+	_, err = instance2.VM.RunString(`require('console')`)
+	assert.NoError(t, err, "console is always allowed")
+}
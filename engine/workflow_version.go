@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/arturoeanton/nflow-runtime/syncsession"
+	"github.com/labstack/echo/v4"
+)
+
+// playbookVersionKey is the nflow_form session key holding the version of
+// the playbook a multi-step workflow started with
+const playbookVersionKey = "nflow_playbook_version"
+
+// ErrWorkflowChangedMessage is answered with 409 when a workflow resumes
+// after its playbook was edited and the version it started with is no
+// longer known
+const ErrWorkflowChangedMessage = "Workflow changed, please restart"
+
+// maxPinnedPlaybooks bounds the playbook versions kept for resuming
+// workflows; the oldest are dropped first
+const maxPinnedPlaybooks = 256
+
+// playbookVersions memoizes the version per playbook. Cached playbooks are
+// never mutated, so the version of a pointer never changes; entries are
+// dropped when the repository replaces the playbooks.
+var playbookVersions sync.Map // *model.Playbook -> string
+
+// pinnedPlaybooks keeps the playbooks workflows started with by version, so
+// they resume against them after an edit
+var (
+	pinnedPlaybooks      = make(map[string]*model.Playbook)
+	pinnedPlaybooksOrder []string
+	pinnedPlaybooksMu    sync.Mutex
+)
+
+// PlaybookVersion returns a short hash of the playbook definition
+func PlaybookVersion(pb *model.Playbook) string {
+	if pb == nil {
+		return ""
+	}
+	if version, ok := playbookVersions.Load(pb); ok {
+		return version.(string)
+	}
+	data, err := json.Marshal(pb)
+	if err != nil {
+		logger.Error("Failed to hash playbook:", err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	version := hex.EncodeToString(sum[:8])
+	playbookVersions.Store(pb, version)
+	return version
+}
+
+// forgetPlaybookVersions drops the memoized versions of replaced playbooks
+func forgetPlaybookVersions(playbooks map[string]map[string]*model.Playbook) {
+	for _, flows := range playbooks {
+		for _, pb := range flows {
+			playbookVersions.Delete(pb)
+		}
+	}
+}
+
+// keepPinnedPlaybook remembers pb under version
+func keepPinnedPlaybook(version string, pb *model.Playbook) {
+	pinnedPlaybooksMu.Lock()
+	defer pinnedPlaybooksMu.Unlock()
+	if _, ok := pinnedPlaybooks[version]; ok {
+		return
+	}
+	pinnedPlaybooks[version] = pb
+	pinnedPlaybooksOrder = append(pinnedPlaybooksOrder, version)
+	if len(pinnedPlaybooksOrder) > maxPinnedPlaybooks {
+		delete(pinnedPlaybooks, pinnedPlaybooksOrder[0])
+		pinnedPlaybooksOrder = pinnedPlaybooksOrder[1:]
+	}
+}
+
+// pinnedPlaybook returns the playbook kept under version
+func pinnedPlaybook(version string) (*model.Playbook, bool) {
+	pinnedPlaybooksMu.Lock()
+	defer pinnedPlaybooksMu.Unlock()
+	pb, ok := pinnedPlaybooks[version]
+	return pb, ok
+}
+
+// pinPlaybookVersion stores the version of the playbook in the session at
+// the start of a workflow and keeps the playbook for resuming it
+func pinPlaybookVersion(c echo.Context, cc *model.Controller) {
+	if _, isIsolated := c.(*IsolatedContext); isIsolated {
+		return
+	}
+	version := PlaybookVersion(cc.Playbook)
+	if version == "" {
+		return
+	}
+	keepPinnedPlaybook(version, cc.Playbook)
+
+	EchoSessionsMutex.Lock()
+	defer EchoSessionsMutex.Unlock()
+	s, err := syncsession.Manager.GetSession("nflow_form", c)
+	if err != nil {
+		logger.Error("Error pinning playbook version:", err)
+		return
+	}
+	s.Values[playbookVersionKey] = version
+	syncsession.Manager.SaveSession("nflow_form", c, s)
+}
+
+// pinnedController returns the controller a resumed workflow continues
+// with: cc when the playbook is unchanged, or a copy running the version
+// the workflow started with. When that version is no longer known (another
+// instance, a restart, or evicted) it answers 409 and returns false.
+// Workflows started before versions were pinned resume as before.
+func pinnedController(c echo.Context, cc *model.Controller) (*model.Controller, bool) {
+	if _, isIsolated := c.(*IsolatedContext); isIsolated {
+		return cc, true
+	}
+
+	var pinned string
+	func() {
+		EchoSessionsMutex.Lock()
+		defer EchoSessionsMutex.Unlock()
+		if s, err := syncsession.Manager.GetSession("nflow_form", c); err == nil {
+			pinned, _ = s.Values[playbookVersionKey].(string)
+		}
+	}()
+	if pinned == "" {
+		return cc, true
+	}
+
+	current := PlaybookVersion(cc.Playbook)
+	if current == "" || current == pinned {
+		return cc, true
+	}
+	if pb, ok := pinnedPlaybook(pinned); ok {
+		logger.Infof("Workflow %s resumes with playbook version %s, current is %s", cc.FlowName, pinned, current)
+		resumed := *cc
+		resumed.Playbook = pb
+		return &resumed, true
+	}
+	logger.Infof("Workflow %s resumed with playbook version %s, started with %s", cc.FlowName, current, pinned)
+	c.JSON(http.StatusConflict, echo.Map{
+		"error":   ErrWorkflowChangedMessage,
+		"code":    "workflow_changed",
+		"version": current,
+	})
+	return nil, false
+}
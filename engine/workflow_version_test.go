@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaybookVersion(t *testing.T) {
+	pb := model.Playbook{"node_1": &model.Node{Data: map[string]interface{}{"type": "js", "code": "1"}}}
+	same := model.Playbook{"node_1": &model.Node{Data: map[string]interface{}{"type": "js", "code": "1"}}}
+	edited := model.Playbook{"node_1": &model.Node{Data: map[string]interface{}{"type": "js", "code": "2"}}}
+
+	version := PlaybookVersion(&pb)
+	assert.Len(t, version, 16)
+	assert.Equal(t, version, PlaybookVersion(&same), "the version depends on the definition only")
+	assert.NotEqual(t, version, PlaybookVersion(&edited))
+	assert.Empty(t, PlaybookVersion(nil))
+
+	forgetPlaybookVersions(map[string]map[string]*model.Playbook{"app": {"flow": &pb}})
+	_, memoized := playbookVersions.Load(&pb)
+	assert.False(t, memoized)
+}
+
+func TestResumeAgainstEditedPlaybook(t *testing.T) {
+	useVMManager(t, newTestVMManager(2, nil))
+
+	// AddGlobals binds the redis helpers; nothing in this playbook calls them
+	repo := GetConfigRepository()
+	previousRedis := repo.GetRedisClient()
+	repo.SetRedisClient(redis.NewClient(&redis.Options{}))
+	t.Cleanup(func() { repo.SetRedisClient(previousRedis) })
+
+	var received, edited []interface{}
+	Steps["test_version_ask"] = payloadTestStep{produce: `({"break": true})`, next: "node_2", received: &received}
+	Steps["test_version_answer"] = payloadTestStep{received: &received}
+	Steps["test_version_edited"] = payloadTestStep{received: &edited}
+	defer delete(Steps, "test_version_ask")
+	defer delete(Steps, "test_version_answer")
+	defer delete(Steps, "test_version_edited")
+
+	output := func(node string) *model.Output {
+		o := &model.Output{}
+		o.Connections = append(o.Connections, struct {
+			Node   string `json:"node"`
+			Output string `json:"output"`
+		}{Node: node, Output: "input_1"})
+		return o
+	}
+	playbook := func(answerType string) *model.Controller {
+		start := &model.Node{
+			Data:    map[string]interface{}{"type": "starter"},
+			Outputs: map[string]*model.Output{"output_1": output("node_1")},
+		}
+		pb := model.Playbook{
+			"start":  start,
+			"node_1": &model.Node{Data: map[string]interface{}{"type": "test_version_ask"}},
+			"node_2": &model.Node{Data: map[string]interface{}{"type": answerType}},
+		}
+		return &model.Controller{Playbook: &pb, Start: start}
+	}
+	original := playbook("test_version_answer")
+
+	// start runs the first round trip, which stops after node_1 waiting for
+	// input, and returns a resume function for the second one
+	start := func() func(cc *model.Controller) *httptest.ResponseRecorder {
+		c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+		require.NoError(t, run(original, c, model.Vars{}, "", "/form", uuid.New().String(), nil, false))
+		token := ContinuationToken(c, "node_2")
+		cookies := make(map[string]*http.Cookie)
+		for _, cookie := range rec.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		require.Contains(t, cookies, "nflow_form")
+
+		return func(cc *model.Controller) *httptest.ResponseRecorder {
+			c, rec := newTraceTestContext(t, "/form", DebugConfig{})
+			for _, cookie := range cookies {
+				c.Request().AddCookie(cookie)
+			}
+			require.NoError(t, run(cc, c, model.Vars{}, token, "/form", uuid.New().String(), nil, false))
+			return rec
+		}
+	}
+
+	// The playbook is edited before the second round trip: the workflow
+	// finishes with the version it started with
+	resume := start()
+	require.Len(t, received, 1)
+	rec := resume(playbook("test_version_edited"))
+	assert.NotEqual(t, http.StatusConflict, rec.Code)
+	assert.Len(t, received, 2, "node_2 of the pinned playbook runs")
+	assert.Empty(t, edited, "node_2 of the edited playbook must not run")
+
+	// The pinned version is no longer known, as after a restart
+	resume = start()
+	require.Len(t, received, 3)
+	pinnedPlaybooksMu.Lock()
+	pinnedPlaybooks = make(map[string]*model.Playbook)
+	pinnedPlaybooksOrder = nil
+	pinnedPlaybooksMu.Unlock()
+	rec = resume(playbook("test_version_edited"))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrWorkflowChangedMessage)
+	assert.Len(t, received, 3)
+	assert.Empty(t, edited)
+
+	// The unchanged playbook resumes normally
+	rec = resume(original)
+	assert.NotEqual(t, http.StatusConflict, rec.Code)
+	assert.Len(t, received, 4)
+}
@@ -0,0 +1,223 @@
+// Package i18n provides message catalogs per locale for workflows serving
+// several languages. Catalogs are loaded from one JSON file per locale
+// (en.json, es.json, pt-BR.json) and messages are resolved with fallback to
+// the base language and then to the default locale.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Catalog holds the messages of every locale. It is safe for concurrent use.
+type Catalog struct {
+	defaultLocale string
+
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+}
+
+// NewCatalog creates an empty catalog falling back to defaultLocale, "en"
+// when empty
+func NewCatalog(defaultLocale string) *Catalog {
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+	return &Catalog{
+		defaultLocale: normalize(defaultLocale),
+		messages:      make(map[string]map[string]string),
+	}
+}
+
+// LoadDir creates a catalog from the *.json files of dir, one per locale
+// named after the file. Nested objects are flattened into dotted keys:
+// {"errors": {"required": "..."}} is "errors.required".
+func LoadDir(dir, defaultLocale string) (*Catalog, error) {
+	catalog := NewCatalog(defaultLocale)
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+		messages := make(map[string]string)
+		flatten("", raw, messages)
+		catalog.Add(strings.TrimSuffix(filepath.Base(file), ".json"), messages)
+	}
+	return catalog, nil
+}
+
+func flatten(prefix string, raw map[string]interface{}, out map[string]string) {
+	for k, v := range raw {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch value := v.(type) {
+		case map[string]interface{}:
+			flatten(key, value, out)
+		case string:
+			out[key] = value
+		default:
+			out[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// Add merges messages into locale
+func (c *Catalog) Add(locale string, messages map[string]string) {
+	locale = normalize(locale)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string, len(messages))
+	}
+	for k, v := range messages {
+		c.messages[locale][k] = v
+	}
+}
+
+// DefaultLocale returns the locale used when nothing else matches
+func (c *Catalog) DefaultLocale() string {
+	return c.defaultLocale
+}
+
+// Locales returns the locales with messages, sorted
+func (c *Catalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	locales := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func (c *Catalog) has(locale string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.messages[locale]
+	return ok
+}
+
+// Match returns the catalog locale best matching an Accept-Language header,
+// honouring q weights; "es-AR" matches "es" when only the base language is
+// available. It returns the default locale when nothing matches.
+func (c *Catalog) Match(acceptLanguage string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := normalize(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{locale, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, cand := range candidates {
+		if c.has(cand.locale) {
+			return cand.locale
+		}
+		if base, _, found := strings.Cut(cand.locale, "-"); found && c.has(base) {
+			return base
+		}
+	}
+	return c.defaultLocale
+}
+
+// Translate returns the message of key in locale, falling back to the base
+// language and to the default locale, and the key itself when no locale has
+// it. {name} placeholders are replaced with args.
+func (c *Catalog) Translate(locale, key string, args map[string]interface{}) string {
+	locale = normalize(locale)
+	candidates := []string{locale}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, c.defaultLocale)
+
+	c.mu.RLock()
+	message, found := "", false
+	for _, candidate := range candidates {
+		if message, found = c.messages[candidate][key]; found {
+			break
+		}
+	}
+	c.mu.RUnlock()
+
+	if !found {
+		message = key
+	}
+	return interpolate(message, args)
+}
+
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// interpolate replaces {name} with args["name"], leaving unknown
+// placeholders as they are
+func interpolate(message string, args map[string]interface{}) string {
+	if len(args) == 0 || !strings.Contains(message, "{") {
+		return message
+	}
+	return placeholderPattern.ReplaceAllStringFunc(message, func(match string) string {
+		if value, ok := args[match[1:len(match)-1]]; ok {
+			return fmt.Sprint(value)
+		}
+		return match
+	})
+}
+
+// normalize lowercases locale and uses "-" as separator: pt_BR is pt-br
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// current is the catalog used by workflows and templates
+var current atomic.Pointer[Catalog]
+
+// SetDefault sets the catalog used by workflows and templates and returns
+// the previous one
+func SetDefault(c *Catalog) *Catalog {
+	return current.Swap(c)
+}
+
+// Default returns the catalog set with SetDefault, an empty "en" catalog
+// when none was set
+func Default() *Catalog {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	current.CompareAndSwap(nil, NewCatalog(""))
+	return current.Load()
+}
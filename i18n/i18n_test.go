@@ -0,0 +1,80 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCatalogs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestLoadDirAndTranslate(t *testing.T) {
+	dir := writeCatalogs(t, map[string]string{
+		"en.json":    `{"greeting": "Hello {name}", "bye": "Bye", "errors": {"required": "{field} is required"}}`,
+		"es.json":    `{"greeting": "Hola {name}", "errors": {"required": "{field} es obligatorio"}}`,
+		"es-AR.json": `{"greeting": "Che {name}"}`,
+		"notes.txt":  `ignored`,
+	})
+	catalog, err := LoadDir(dir, "en")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"en", "es", "es-ar"}, catalog.Locales())
+
+	args := map[string]interface{}{"name": "Ana", "field": "email"}
+	assert.Equal(t, "Hello Ana", catalog.Translate("en", "greeting", args))
+	assert.Equal(t, "Hola Ana", catalog.Translate("es", "greeting", args))
+	assert.Equal(t, "Che Ana", catalog.Translate("es_AR", "greeting", args))
+	assert.Equal(t, "email es obligatorio", catalog.Translate("es-AR", "errors.required", args), "falls back to the base language")
+	assert.Equal(t, "Bye", catalog.Translate("es-AR", "bye", nil), "falls back to the default locale")
+	assert.Equal(t, "Bye", catalog.Translate("fr", "bye", nil))
+	assert.Equal(t, "missing.key", catalog.Translate("es", "missing.key", nil), "falls back to the key")
+	assert.Equal(t, "Hello {name}", catalog.Translate("en", "greeting", nil), "unknown placeholders are kept")
+}
+
+func TestLoadDirInvalidCatalog(t *testing.T) {
+	dir := writeCatalogs(t, map[string]string{"en.json": `{"greeting": `})
+	_, err := LoadDir(dir, "en")
+	assert.ErrorContains(t, err, "en.json")
+}
+
+func TestMatch(t *testing.T) {
+	catalog := NewCatalog("en")
+	catalog.Add("en", map[string]string{"k": "v"})
+	catalog.Add("es", map[string]string{"k": "v"})
+	catalog.Add("pt-BR", map[string]string{"k": "v"})
+
+	tests := map[string]string{
+		"":                              "en",
+		"es":                            "es",
+		"es-AR,es;q=0.9":                "es",
+		"fr-FR,fr;q=0.9,pt-BR;q=0.8":    "pt-br",
+		"de;q=0.5,es;q=0.7":             "es",
+		"pt-BR;q=0.2,es;q=0.9,en;q=1.0": "en",
+		"fr, *;q=0.1":                   "en",
+		"es;q=0":                        "en",
+	}
+	for header, want := range tests {
+		assert.Equal(t, want, catalog.Match(header), header)
+	}
+}
+
+func TestDefaultCatalog(t *testing.T) {
+	previous := SetDefault(nil)
+	t.Cleanup(func() { SetDefault(previous) })
+
+	assert.Equal(t, "en", Default().DefaultLocale(), "an empty catalog is used when none was set")
+	assert.Equal(t, "greeting", Default().Translate("es", "greeting", nil))
+
+	catalog := NewCatalog("es")
+	SetDefault(catalog)
+	assert.Same(t, catalog, Default())
+}
@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,11 +25,38 @@ const (
 	LevelVerbose
 )
 
-// Logger represents a structured logger with configurable verbosity
+// String returns the level name as accepted by ParseLevel
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelInfo:
+		return "info"
+	case LevelVerbose:
+		return "verbose"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel converts "error", "info" or "verbose" to a Level
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "error":
+		return LevelError, nil
+	case "info":
+		return LevelInfo, nil
+	case "verbose", "debug":
+		return LevelVerbose, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger represents a structured logger with configurable verbosity.
+// The level is atomic so it can be changed at runtime while other
+// goroutines log.
 type Logger struct {
-	level      Level
+	level      atomic.Int32
 	prefix     string
-	mu         sync.RWMutex
 	timeFormat string
 }
 
@@ -51,25 +79,22 @@ func Initialize(verbose bool) {
 
 // New creates a new logger instance
 func New(prefix string, level Level) *Logger {
-	return &Logger{
-		level:      level,
+	l := &Logger{
 		prefix:     prefix,
 		timeFormat: "2006-01-02 15:04:05.000",
 	}
+	l.level.Store(int32(level))
+	return l
 }
 
 // SetLevel changes the logging level
 func (l *Logger) SetLevel(level Level) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.level = level
+	l.level.Store(int32(level))
 }
 
 // GetLevel returns the current logging level
 func (l *Logger) GetLevel() Level {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	return l.level
+	return Level(l.level.Load())
 }
 
 // Error logs an error message (always shown)
@@ -132,9 +157,7 @@ func (l *Logger) logf(level Level, levelStr string, format string, args ...inter
 
 // shouldLog checks if a message should be logged based on current level
 func (l *Logger) shouldLog(level Level) bool {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	return level <= l.level
+	return level <= l.GetLevel()
 }
 
 // getCaller returns the calling function's file and line number
@@ -201,6 +224,22 @@ func Verbosef(format string, args ...interface{}) {
 	Default.Verbosef(format, args...)
 }
 
+// SetLevel changes the level of the default logger at runtime
+func SetLevel(level Level) {
+	if Default == nil {
+		Initialize(false)
+	}
+	Default.SetLevel(level)
+}
+
+// GetLevel returns the level of the default logger
+func GetLevel() Level {
+	if Default == nil {
+		Initialize(false)
+	}
+	return Default.GetLevel()
+}
+
 // Fatal logs an error and exits the program
 func Fatal(args ...interface{}) {
 	Error(args...)
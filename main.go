@@ -5,28 +5,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/arturoeanton/gocommons/utils"
+	"github.com/arturoeanton/nflow-runtime/audit"
 	"github.com/arturoeanton/nflow-runtime/commons"
 	"github.com/arturoeanton/nflow-runtime/endpoints"
 	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/arturoeanton/nflow-runtime/i18n"
 	"github.com/arturoeanton/nflow-runtime/literals"
 	"github.com/arturoeanton/nflow-runtime/logger"
 	"github.com/arturoeanton/nflow-runtime/model"
 	"github.com/arturoeanton/nflow-runtime/process"
 	"github.com/arturoeanton/nflow-runtime/ratelimit"
 	"github.com/arturoeanton/nflow-runtime/syncsession"
-	"github.com/go-redis/redis"
-	"github.com/google/uuid"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -101,8 +104,11 @@ func (u *urlCacheAdapter) Clear() {
 	urlCache.cache = make(map[string]*urlParseResult)
 }
 
-// parseURL extracts endpoint and position tags with caching
+// parseURL extracts endpoint and position tags with caching.
+// The [server].base_path prefix is removed first.
 func parseURL(requestURI string) (string, int, int) {
+	requestURI = engine.StripBasePath(requestURI)
+
 	// Check cache first
 	urlCache.RLock()
 	if result, ok := urlCache.cache[requestURI]; ok {
@@ -112,21 +118,11 @@ func parseURL(requestURI string) (string, int, int) {
 	urlCache.RUnlock()
 
 	// Parse URL
-	endpoint := strings.Split(requestURI, "?")[0]
-	endpointParts := strings.Split(endpoint, "/")
-	lenEndpointParts := len(endpointParts)
-	positionTagNflowID := -1
-	positionTagNflowTK := -1
-
-	// Sequential search is faster than goroutines for small arrays
-	for i := 0; i < (lenEndpointParts - 1); i++ {
-		if endpointParts[i] == literals.FORMNFLOWID {
-			positionTagNflowID = i
-		}
-		if endpointParts[i] == literals.FORMNFLOWTK {
-			positionTagNflowTK = i
-		}
+	endpoint := requestURI
+	if i := strings.IndexByte(endpoint, '?'); i >= 0 {
+		endpoint = endpoint[:i]
 	}
+	positionTagNflowID, positionTagNflowTK := scanPositionTags(endpoint)
 
 	// Cache result (with size limit to prevent unbounded growth)
 	urlCache.Lock()
@@ -142,6 +138,29 @@ func parseURL(requestURI string) (string, int, int) {
 	return endpoint, positionTagNflowID, positionTagNflowTK
 }
 
+// scanPositionTags returns the index of the last FORMNFLOWID and FORMNFLOWTK
+// segments of endpoint, as in strings.Split(endpoint, "/"), or -1. The last
+// segment is never a tag since the value follows it. Segments are compared
+// in place, so nothing is allocated.
+func scanPositionTags(endpoint string) (int, int) {
+	positionTagNflowID := -1
+	positionTagNflowTK := -1
+	for i, start := 0, 0; ; i++ {
+		end := strings.IndexByte(endpoint[start:], '/')
+		if end < 0 {
+			// Last segment
+			return positionTagNflowID, positionTagNflowTK
+		}
+		switch endpoint[start : start+end] {
+		case literals.FORMNFLOWID:
+			positionTagNflowID = i
+		case literals.FORMNFLOWTK:
+			positionTagNflowTK = i
+		}
+		start += end + 1
+	}
+}
+
 // extractNextNodeRun extracts nflow_next_node_run from various sources
 func extractNextNodeRun(c echo.Context, endpointParts []string, positionTagNflowID int, positionTagNflowTK int) string {
 	nflowNextNodeRun := ""
@@ -246,7 +265,7 @@ func run(c echo.Context, appJson string) error {
 	logger.Verbose("Run endpoint:", endpoint, "nflowNextNodeRun:", runeable)
 
 	// Execute workflow
-	uuid1 := uuid.New().String()
+	uuid1 := engine.NewUUID()
 	return runeable.Run(c, vars, nflowNextNodeRun, endpoint, uuid1, nil)
 }
 
@@ -281,16 +300,50 @@ func main() {
 		if _, err := toml.Decode(data, &config); err != nil {
 			logger.Error("Failed to decode config.toml:", err)
 		}
+		// ${VAR} and ${VAR:-default} references are resolved from the environment
+		if missing := engine.ExpandConfigEnv(&config); len(missing) > 0 {
+			logger.Errorf("config.toml references unset environment variables: %s", strings.Join(missing, ", "))
+		}
+		// "secret:<name>" values of sensitive fields come from the secrets provider
+		provider, err := engine.NewSecretsProvider(config.SecretsConfig)
+		if err == nil {
+			err = engine.ResolveConfigSecrets(context.Background(), &config, provider)
+		}
+		if err != nil {
+			logger.Fatal("Failed to resolve secrets:", err)
+		}
 		configRepo.SetConfig(config)
 	}
 
-	// Initialize Redis
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     config.RedisConfig.Host,
-		Password: config.RedisConfig.Password, // no password set
-		DB:       0,                           // use default DB
-	})
-	configRepo.SetRedisClient(redisClient)
+	i18nDir := config.I18nConfig.Dir
+	if i18nDir == "" {
+		i18nDir = "locales"
+	}
+	catalog, err := i18n.LoadDir(i18nDir, config.I18nConfig.DefaultLocale)
+	if err != nil {
+		logger.Fatal("Failed to load message catalogs:", err)
+	}
+	i18n.SetDefault(catalog)
+	if locales := catalog.Locales(); len(locales) > 0 {
+		logger.Info("Message catalogs loaded:", strings.Join(locales, ", "))
+	}
+
+	if config.AuditConfig.Enabled {
+		destination := config.AuditConfig.Destination
+		if destination == "" {
+			destination = "audit.log"
+		}
+		auditLogger, err := audit.Open(destination)
+		if err != nil {
+			logger.Fatal("Failed to open audit log:", err)
+		}
+		defer auditLogger.Close()
+		audit.SetDefault(auditLogger)
+		logger.Info("Audit log enabled:", destination)
+	}
+
+	// Initialize the Redis client shared by the whole application
+	redisClient := configRepo.GetRedisClient()
 
 	engine.UpdateQueries()
 
@@ -305,6 +358,12 @@ func main() {
 	}
 	engine.InitializePlaybookRepository(db)
 	logger.Info("PlaybookRepository initialized")
+	if interval := config.PlaybookConfig.CacheWarmInterval; interval > 0 {
+		stopWarmer := engine.StartPlaybookCacheWarmer(engine.GetPlaybookRepository(),
+			time.Duration(interval)*time.Second, config.PlaybookConfig.CacheWarmCount)
+		defer stopWarmer()
+		logger.Infof("Playbook cache warmer reloads the most accessed apps every %ds", interval)
+	}
 
 	// Initialize ProcessRepository
 	process.InitializeRepository()
@@ -320,9 +379,12 @@ func main() {
 	logger.Info("Starting Session Manager cleanup routine...")
 	go syncsession.Manager.StartCleanupRoutine()
 
-	// VM pooling is disabled for now
-	// A fresh VM is created for each request to ensure stability
-	logger.Info("VM pooling disabled - creating fresh VM per request for stability")
+	// run() acquires its VMs from the manager, which honors [vm_pool].mode
+	if vmManager := engine.GetVMManager(); vmManager.Mode() == engine.VMModeFresh {
+		logger.Info("VM mode: fresh - creating a new VM per request")
+	} else {
+		logger.Infof("VM mode: pool - reusing up to %d VMs", config.VMPoolConfig.MaxSize)
+	}
 
 	// Initialize rate limiter
 	var rateLimiter ratelimit.RateLimiter
@@ -337,14 +399,35 @@ func main() {
 	// Create Echo server
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
+	e.Use(engine.RequestIDMiddleware(&config.ServerConfig))
+	e.Use(engine.RecoverMiddleware())
+	e.Use(engine.HeaderLimitsMiddleware(&config.ServerConfig))
+	e.Use(engine.AllowedMethodsMiddleware(&config.ServerConfig))
+
+	if config.HttpsEngineConfig.HTTPBasic {
+		basicAuth, err := basicAuthMiddleware(config.HttpsEngineConfig, config.MonitorConfig.HealthCheckPath)
+		if err != nil {
+			logger.Fatal("Invalid [https_engine] basic auth:", err)
+		}
+		e.Use(basicAuth)
+		logger.Info("HTTP basic auth enabled")
+	}
+
+	if config.SecurityHeaders.Enabled {
+		e.Use(engine.SecurityHeadersMiddleware(&config.SecurityHeaders))
+	}
 
 	// Add rate limiting middleware before session middleware
 	if config.RateLimitConfig.Enabled && rateLimiter != nil {
 		e.Use(ratelimit.Middleware(&config.RateLimitConfig, rateLimiter))
 	}
 
-	e.Use(session.Middleware(commons.GetSessionStore(&config.PgSessionConfig)))
+	e.Use(session.Middleware(commons.GetSessionStore(&config.PgSessionConfig, &config.SessionConfig)))
+
+	if config.CSRFConfig.Enabled {
+		e.Use(engine.CSRFMiddleware(&config.CSRFConfig))
+		logger.Info("CSRF protection enabled")
+	}
 
 	// Register monitoring endpoints (health and metrics)
 	endpoints.RegisterMonitoringEndpoints(e, &config)
@@ -378,7 +461,12 @@ func main() {
 	})
 
 	// Start server
-	logger.Info("Starting nFlow Runtime on :8080")
+	address := listenAddress(config.ServerConfig)
+	if config.HttpsEngineConfig.Enable {
+		logger.Infof("Starting nFlow Runtime on %s (HTTPS)", httpsListenAddress(config.HttpsEngineConfig))
+	} else {
+		logger.Infof("Starting nFlow Runtime on %s", address)
+	}
 	if config.MonitorConfig.Enabled {
 		logger.Infof("Health check available at %s", config.MonitorConfig.HealthCheckPath)
 		logger.Infof("Prometheus metrics available at %s", config.MonitorConfig.MetricsPath)
@@ -388,8 +476,10 @@ func main() {
 	}
 
 	// Add shutdown handler
+	serverDone := make(chan struct{})
 	go func() {
-		if err := e.Start(":8080"); err != nil && err != http.ErrServerClosed {
+		defer close(serverDone)
+		if err := startServer(e, address, config.HttpsEngineConfig); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server")
 		}
 	}()
@@ -398,6 +488,7 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
+	shutdownServer(e, serverDone)
 
 	// Cleanup rate limiter
 	if rateLimiter != nil {
@@ -410,40 +501,62 @@ func main() {
 
 // Debug handler functions
 
-// handleDebugCleanJSON removes corrupted starter nodes from playbooks
+// handleDebugCleanJSON removes corrupted starter nodes from playbooks and
+// lists the removed ones. The playbooks are read from the database as
+// stored, since the cached ones were already cleaned on load. With
+// ?dry_run=true only the removed nodes are returned.
 func handleDebugCleanJSON(c echo.Context, appJson string) error {
 	ctx := c.Request().Context()
-	repo := engine.GetPlaybookRepository()
-	if repo == nil {
-		return c.JSON(500, echo.Map{"error": "Repository not available"})
+	db, err := engine.GetDB()
+	if err != nil {
+		return c.JSON(500, echo.Map{"error": err.Error()})
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return c.JSON(500, echo.Map{"error": err.Error()})
 	}
+	defer conn.Close()
 
-	// Force reload to get fresh data from database
-	repo.InvalidateAllCache()
-	appPlaybooks, err := repo.LoadPlaybook(ctx, appJson)
+	appPlaybooks, err := engine.GetPlaybook(ctx, conn, appJson)
 	if err != nil {
 		return c.JSON(500, echo.Map{"error": err.Error()})
 	}
 
 	// Clean the playbooks
-	cleanedPlaybooks, removedCount := cleanPlaybooks(appPlaybooks)
+	cleanedPlaybooks, removed := cleanPlaybooks(appPlaybooks)
+
+	response := map[string]interface{}{
+		"message":       fmt.Sprintf("Cleaned JSON ready for database storage. Removed %d corrupted starter nodes.", len(removed)),
+		"removed_nodes": len(removed),
+		"removed":       removed,
+	}
+	if c.QueryParam("dry_run") == "true" {
+		response["message"] = fmt.Sprintf("Dry run: %d corrupted starter nodes would be removed.", len(removed))
+		return c.JSON(200, response)
+	}
 
 	// Wrap in drawflow structure for database storage
-	result := map[string]interface{}{
+	response["clean_json"] = map[string]interface{}{
 		"drawflow": cleanedPlaybooks,
 	}
+	return c.JSON(200, response)
+}
 
-	return c.JSON(200, map[string]interface{}{
-		"message":       fmt.Sprintf("Cleaned JSON ready for database storage. Removed %d corrupted starter nodes.", removedCount),
-		"removed_nodes": removedCount,
-		"clean_json":    result,
-	})
+// removedStarter describes a corrupted starter node removed by cleanPlaybooks
+type removedStarter struct {
+	FlowKey    string      `json:"flow_key"`
+	SubKey     string      `json:"sub_key"`
+	NodeID     string      `json:"node_id"`
+	URLPattern interface{} `json:"urlpattern"`
+	Method     interface{} `json:"method"`
+	Reason     string      `json:"reason"`
 }
 
-// cleanPlaybooks removes corrupted starter nodes
-func cleanPlaybooks(appPlaybooks map[string]map[string]*model.Playbook) (map[string]map[string]*model.Playbook, int) {
+// cleanPlaybooks removes corrupted starter nodes and returns the details of
+// the removed ones, sorted by flow and node id
+func cleanPlaybooks(appPlaybooks map[string]map[string]*model.Playbook) (map[string]map[string]*model.Playbook, []removedStarter) {
 	cleanedPlaybooks := make(map[string]map[string]*model.Playbook)
-	removedCount := 0
+	removed := []removedStarter{}
 
 	for key, flows := range appPlaybooks {
 		cleanedFlows := make(map[string]*model.Playbook)
@@ -455,9 +568,20 @@ func cleanPlaybooks(appPlaybooks map[string]map[string]*model.Playbook) (map[str
 
 			cleanedPlaybook := make(model.Playbook)
 			for nodeID, node := range *pb {
-				if isValidNode(node, nodeID, &removedCount) {
+				reason := corruptedStarterReason(node)
+				if reason == "" {
 					cleanedPlaybook[nodeID] = node
+					continue
 				}
+				logger.Verbosef("DEBUG: Removing starter node %s - %s", nodeID, reason)
+				removed = append(removed, removedStarter{
+					FlowKey:    key,
+					SubKey:     flowKey,
+					NodeID:     nodeID,
+					URLPattern: node.Data["urlpattern"],
+					Method:     node.Data["method"],
+					Reason:     reason,
+				})
 			}
 
 			cleanedFlows[flowKey] = &cleanedPlaybook
@@ -465,42 +589,48 @@ func cleanPlaybooks(appPlaybooks map[string]map[string]*model.Playbook) (map[str
 		cleanedPlaybooks[key] = cleanedFlows
 	}
 
-	return cleanedPlaybooks, removedCount
+	sort.Slice(removed, func(i, j int) bool {
+		a, b := removed[i], removed[j]
+		if a.FlowKey != b.FlowKey {
+			return a.FlowKey < b.FlowKey
+		}
+		if a.SubKey != b.SubKey {
+			return a.SubKey < b.SubKey
+		}
+		return a.NodeID < b.NodeID
+	})
+	return cleanedPlaybooks, removed
 }
 
-// isValidNode checks if a node is valid (not a corrupted starter)
-func isValidNode(node *model.Node, nodeID string, removedCount *int) bool {
+// corruptedStarterReason returns why a starter node is corrupted (no
+// outputs, no output_1, empty connections), or "" for valid starters and
+// any other node
+func corruptedStarterReason(node *model.Node) string {
 	if node == nil || node.Data == nil {
-		return true
+		return ""
 	}
 
 	// Check if this is a starter node
 	nodeType, ok := node.Data["type"]
 	if !ok || nodeType != "starter" {
-		return true
+		return ""
 	}
 
 	// Check if starter has proper connections
 	if node.Outputs == nil {
-		logger.Verbosef("DEBUG: Removing starter node %s - no outputs", nodeID)
-		*removedCount++
-		return false
+		return "no outputs"
 	}
 
 	output1, exists := node.Outputs["output_1"]
 	if !exists || output1 == nil {
-		logger.Verbosef("DEBUG: Removing starter node %s - no output_1", nodeID)
-		*removedCount++
-		return false
+		return "no output_1"
 	}
 
-	if output1.Connections == nil || len(output1.Connections) == 0 {
-		logger.Verbosef("DEBUG: Removing starter node %s - empty connections", nodeID)
-		*removedCount++
-		return false
+	if len(output1.Connections) == 0 {
+		return "empty connections"
 	}
 
-	return true
+	return ""
 }
 
 // handleDebugStarters shows all starter nodes in the playbooks
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/arturoeanton/nflow-runtime/literals"
+	"github.com/arturoeanton/nflow-runtime/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseURLWithBasePath(t *testing.T) {
+	repo := engine.GetConfigRepository()
+	original := *repo.GetConfig()
+	defer repo.SetConfig(original)
+
+	config := original
+	config.ServerConfig.BasePath = "/api/workflows"
+	repo.SetConfig(config)
+	(&urlCacheAdapter{}).Clear()
+	defer (&urlCacheAdapter{}).Clear()
+
+	endpoint, positionID, positionTK := parseURL("/api/workflows/users/list?page=2")
+	assert.Equal(t, "/users/list", endpoint)
+	assert.Equal(t, -1, positionID)
+	assert.Equal(t, -1, positionTK)
+
+	endpoint, positionID, _ = parseURL("/api/workflows/users/" + literals.FORMNFLOWID + "/node1")
+	assert.Equal(t, "/users/"+literals.FORMNFLOWID+"/node1", endpoint)
+	assert.Equal(t, 2, positionID)
+
+	// Paths outside the base path are not rewritten
+	endpoint, _, _ = parseURL("/users/list")
+	assert.Equal(t, "/users/list", endpoint)
+}
+
+func TestScanPositionTags(t *testing.T) {
+	id, tk := literals.FORMNFLOWID, literals.FORMNFLOWTK
+	cases := []struct {
+		endpoint string
+		id, tk   int
+	}{
+		{"", -1, -1},
+		{"/", -1, -1},
+		{"/users/list", -1, -1},
+		{"/users/" + id + "/node1", 2, -1},
+		{"/users/" + tk + "/step/" + id + "/node1", 4, 2},
+		{"/users/" + id, -1, -1},              // the last segment is never a tag
+		{"/" + id + "/a/" + id + "/b", 3, -1}, // the last tag wins
+		{"/users/" + id + "x/node1", -1, -1},  // whole segments only
+		{"//" + tk + "//", -1, 2},
+		{id + "/node1", 0, -1},
+	}
+	for _, tc := range cases {
+		gotID, gotTK := scanPositionTags(tc.endpoint)
+		assert.Equal(t, tc.id, gotID, tc.endpoint)
+		assert.Equal(t, tc.tk, gotTK, tc.endpoint)
+	}
+
+	endpoint := "/app/users/" + tk + "/form/" + id + "/node1"
+	assert.Zero(t, testing.AllocsPerRun(100, func() { scanPositionTags(endpoint) }))
+}
+
+// BenchmarkParseURLCacheMiss parses deep paths that are all different, as
+// with high path cardinality, so every call misses the cache
+func BenchmarkParseURLCacheMiss(b *testing.B) {
+	(&urlCacheAdapter{}).Clear()
+	defer (&urlCacheAdapter{}).Clear()
+
+	paths := make([]string, 20000)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/api/v1/tenants/%d/users/%d/orders/%d/items/%s/node_%d?page=2", i%97, i, i*7, literals.FORMNFLOWID, i)
+	}
+	// Fill the cache so the benchmark measures parsing, not map growth
+	for _, path := range paths[:10000] {
+		parseURL(path)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parseURL(paths[10000+i%10000])
+	}
+}
+
+func BenchmarkScanPositionTags(b *testing.B) {
+	endpoint := "/api/v1/tenants/7/users/42/orders/9/items/" + literals.FORMNFLOWTK + "/form/" + literals.FORMNFLOWID + "/node_1"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		scanPositionTags(endpoint)
+	}
+}
+
+func TestCleanPlaybooksListsRemovedStarters(t *testing.T) {
+	starter := func(urlpattern string, outputs map[string]*model.Output) *model.Node {
+		return &model.Node{
+			Data:    map[string]interface{}{"type": "starter", "urlpattern": urlpattern, "method": "POST"},
+			Outputs: outputs,
+		}
+	}
+	connected := &model.Output{}
+	connected.Connections = append(connected.Connections, struct {
+		Node   string `json:"node"`
+		Output string `json:"output"`
+	}{Node: "js_1", Output: "input_1"})
+
+	app := map[string]map[string]*model.Playbook{
+		"Home": {"data": &model.Playbook{
+			"ok":             starter("/ok", map[string]*model.Output{"output_1": connected}),
+			"no_outputs":     starter("/a", nil),
+			"no_output_1":    starter("/b", map[string]*model.Output{"output_2": connected}),
+			"no_connections": starter("/c", map[string]*model.Output{"output_1": {}}),
+			"js_1":           &model.Node{Data: map[string]interface{}{"type": "js"}},
+		}},
+	}
+
+	cleaned, removed := cleanPlaybooks(app)
+	assert.Equal(t, []removedStarter{
+		{FlowKey: "Home", SubKey: "data", NodeID: "no_connections", URLPattern: "/c", Method: "POST", Reason: "empty connections"},
+		{FlowKey: "Home", SubKey: "data", NodeID: "no_output_1", URLPattern: "/b", Method: "POST", Reason: "no output_1"},
+		{FlowKey: "Home", SubKey: "data", NodeID: "no_outputs", URLPattern: "/a", Method: "POST", Reason: "no outputs"},
+	}, removed)
+	assert.Len(t, *cleaned["Home"]["data"], 2)
+	assert.Contains(t, *cleaned["Home"]["data"], "ok")
+	assert.Contains(t, *cleaned["Home"]["data"], "js_1")
+}
@@ -0,0 +1,272 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = int32(0)
+	CircuitOpen     = int32(1)
+	CircuitHalfOpen = int32(2)
+)
+
+// maxBreakerHosts bounds the hosts tracked by a CircuitBreaker
+const maxBreakerHosts = 1024
+
+// ErrCircuitOpen is returned when a call is rejected because the breaker of
+// the target host is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreakerState is a snapshot of the breaker of a single host
+type CircuitBreakerState struct {
+	Host                string    `json:"host"`
+	State               string    `json:"state"`
+	ConsecutiveFailures int64     `json:"consecutive_failures"`
+	TotalFailures       int64     `json:"total_failures"`
+	Rejected            int64     `json:"rejected"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+}
+
+// hostBreaker tracks failures for one upstream host
+type hostBreaker struct {
+	state               int32
+	consecutiveFailures int64
+	totalFailures       int64
+	rejected            int64
+	openedAt            int64 // unix nanoseconds
+	trialAt             int64 // unix nanoseconds of the last trial call
+	lastUsed            int64 // unix nanoseconds
+}
+
+// CircuitBreaker keeps one breaker per host. It opens after Threshold
+// consecutive failures and fast-fails calls until Cooldown has elapsed, then
+// lets a single trial call through before closing again. A trial call whose
+// result is never recorded expires after another Cooldown, so the host is
+// not rejected forever.
+//
+// At most maxHosts hosts are tracked. When full, breakers that are closed
+// without failures or unused for a cooldown are dropped; if none can be,
+// calls to new hosts go through untracked.
+type CircuitBreaker struct {
+	mu        sync.RWMutex
+	hosts     map[string]*hostBreaker
+	maxHosts  int
+	enabled   int32
+	threshold int64
+	cooldown  int64 // nanoseconds
+}
+
+// NewCircuitBreaker creates a breaker registry with the given thresholds
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		hosts:    make(map[string]*hostBreaker),
+		maxHosts: maxBreakerHosts,
+	}
+	cb.Configure(true, threshold, cooldown)
+	return cb
+}
+
+// Configure updates the breaker thresholds. Defaults are 5 failures and 30s.
+func (cb *CircuitBreaker) Configure(enabled bool, threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	flag := int32(0)
+	if enabled {
+		flag = 1
+	}
+	atomic.StoreInt32(&cb.enabled, flag)
+	atomic.StoreInt64(&cb.threshold, int64(threshold))
+	atomic.StoreInt64(&cb.cooldown, int64(cooldown))
+}
+
+// IsEnabled reports whether the breaker is active
+func (cb *CircuitBreaker) IsEnabled() bool {
+	return atomic.LoadInt32(&cb.enabled) == 1
+}
+
+func (cb *CircuitBreaker) get(host string) *hostBreaker {
+	now := time.Now().UnixNano()
+	cb.mu.RLock()
+	hb, ok := cb.hosts[host]
+	cb.mu.RUnlock()
+	if ok {
+		atomic.StoreInt64(&hb.lastUsed, now)
+		return hb
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if hb, ok = cb.hosts[host]; ok {
+		atomic.StoreInt64(&hb.lastUsed, now)
+		return hb
+	}
+	hb = &hostBreaker{lastUsed: now}
+	if len(cb.hosts) >= cb.maxHosts {
+		cb.evict(now)
+	}
+	if len(cb.hosts) < cb.maxHosts {
+		cb.hosts[host] = hb
+	}
+	return hb
+}
+
+// evict drops the breakers that carry no state worth keeping: closed ones
+// without consecutive failures and those unused for a cooldown, after which
+// an open breaker would let a trial call through anyway. cb.mu is held.
+func (cb *CircuitBreaker) evict(now int64) {
+	cooldown := atomic.LoadInt64(&cb.cooldown)
+	for host, hb := range cb.hosts {
+		idle := now-atomic.LoadInt64(&hb.lastUsed) >= cooldown
+		clean := atomic.LoadInt32(&hb.state) == CircuitClosed && atomic.LoadInt64(&hb.consecutiveFailures) == 0
+		if idle || clean {
+			delete(cb.hosts, host)
+		}
+	}
+}
+
+// Allow checks whether a call to host may proceed
+func (cb *CircuitBreaker) Allow(host string) error {
+	if !cb.IsEnabled() {
+		return nil
+	}
+	hb := cb.get(host)
+
+	now := time.Now().UnixNano()
+	cooldown := atomic.LoadInt64(&cb.cooldown)
+	switch atomic.LoadInt32(&hb.state) {
+	case CircuitOpen:
+		if now-atomic.LoadInt64(&hb.openedAt) < cooldown {
+			atomic.AddInt64(&hb.rejected, 1)
+			return fmt.Errorf("%w for host %s", ErrCircuitOpen, host)
+		}
+		// Cooldown elapsed - only one caller gets the trial call
+		if cb.startTrial(hb, now) {
+			atomic.StoreInt32(&hb.state, CircuitHalfOpen)
+			return nil
+		}
+		atomic.AddInt64(&hb.rejected, 1)
+		return fmt.Errorf("%w for host %s", ErrCircuitOpen, host)
+	case CircuitHalfOpen:
+		// The trial call never reported back, let another one through
+		if cb.startTrial(hb, now) {
+			return nil
+		}
+		atomic.AddInt64(&hb.rejected, 1)
+		return fmt.Errorf("%w for host %s", ErrCircuitOpen, host)
+	}
+	return nil
+}
+
+// startTrial claims the trial call of hb, false when another caller got it
+func (cb *CircuitBreaker) startTrial(hb *hostBreaker, now int64) bool {
+	trialAt := atomic.LoadInt64(&hb.trialAt)
+	if now-trialAt < atomic.LoadInt64(&cb.cooldown) {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&hb.trialAt, trialAt, now)
+}
+
+// RecordSuccess closes the breaker of host
+func (cb *CircuitBreaker) RecordSuccess(host string) {
+	if !cb.IsEnabled() {
+		return
+	}
+	hb := cb.get(host)
+	atomic.StoreInt64(&hb.consecutiveFailures, 0)
+	atomic.StoreInt32(&hb.state, CircuitClosed)
+}
+
+// RecordFailure counts a failure and opens the breaker when the threshold is reached
+func (cb *CircuitBreaker) RecordFailure(host string) {
+	if !cb.IsEnabled() {
+		return
+	}
+	hb := cb.get(host)
+	atomic.AddInt64(&hb.totalFailures, 1)
+	failures := atomic.AddInt64(&hb.consecutiveFailures, 1)
+
+	// A failed trial call reopens immediately
+	if atomic.LoadInt32(&hb.state) == CircuitHalfOpen || failures >= atomic.LoadInt64(&cb.threshold) {
+		atomic.StoreInt64(&hb.openedAt, time.Now().UnixNano())
+		atomic.StoreInt32(&hb.state, CircuitOpen)
+	}
+}
+
+// Reset clears the state of every host
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.hosts = make(map[string]*hostBreaker)
+}
+
+// States returns a snapshot of all host breakers sorted by host
+func (cb *CircuitBreaker) States() []CircuitBreakerState {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+
+	states := make([]CircuitBreakerState, 0, len(cb.hosts))
+	for host, hb := range cb.hosts {
+		state := CircuitBreakerState{
+			Host:                host,
+			State:               circuitStateName(atomic.LoadInt32(&hb.state)),
+			ConsecutiveFailures: atomic.LoadInt64(&hb.consecutiveFailures),
+			TotalFailures:       atomic.LoadInt64(&hb.totalFailures),
+			Rejected:            atomic.LoadInt64(&hb.rejected),
+		}
+		if openedAt := atomic.LoadInt64(&hb.openedAt); openedAt > 0 {
+			state.OpenedAt = time.Unix(0, openedAt)
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+	return states
+}
+
+func circuitStateName(state int32) string {
+	switch state {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// httpCircuitBreaker protects the outbound calls of the HTTP plugin
+var httpCircuitBreaker = NewCircuitBreaker(5, 30*time.Second)
+
+// ConfigureHTTPCircuitBreaker sets the thresholds of the HTTP plugin breaker
+func ConfigureHTTPCircuitBreaker(enabled bool, threshold int, cooldown time.Duration) {
+	httpCircuitBreaker.Configure(enabled, threshold, cooldown)
+}
+
+// GetHTTPCircuitBreakerStates returns the state of every host seen by the HTTP plugin
+func GetHTTPCircuitBreakerStates() []CircuitBreakerState {
+	return httpCircuitBreaker.States()
+}
+
+// ResetHTTPCircuitBreakers closes every HTTP plugin breaker
+func ResetHTTPCircuitBreakers() {
+	httpCircuitBreaker.Reset()
+}
+
+// breakerHost returns the key used to group calls per upstream
+func breakerHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
@@ -0,0 +1,151 @@
+package plugins
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_TripAndRecover(t *testing.T) {
+	cb := NewCircuitBreaker(3, 50*time.Millisecond)
+	host := "api.example.com"
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, cb.Allow(host))
+		cb.RecordFailure(host)
+	}
+	// Still closed below the threshold
+	require.NoError(t, cb.Allow(host))
+	cb.RecordFailure(host)
+
+	// Third consecutive failure opens the breaker
+	err := cb.Allow(host)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, "open", cb.States()[0].State)
+
+	// After the cooldown a single trial call is let through
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, cb.Allow(host))
+	assert.True(t, errors.Is(cb.Allow(host), ErrCircuitOpen), "only one trial call while half open")
+
+	cb.RecordSuccess(host)
+	assert.NoError(t, cb.Allow(host))
+	assert.Equal(t, "closed", cb.States()[0].State)
+	assert.Equal(t, int64(0), cb.States()[0].ConsecutiveFailures)
+}
+
+func TestCircuitBreaker_FailedTrialReopens(t *testing.T) {
+	cb := NewCircuitBreaker(1, 20*time.Millisecond)
+	host := "api.example.com"
+
+	cb.RecordFailure(host)
+	assert.Error(t, cb.Allow(host))
+
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, cb.Allow(host))
+	cb.RecordFailure(host)
+	assert.Error(t, cb.Allow(host))
+}
+
+func TestCircuitBreaker_UnreportedTrialExpires(t *testing.T) {
+	cb := NewCircuitBreaker(1, 20*time.Millisecond)
+	host := "api.example.com"
+
+	cb.RecordFailure(host)
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, cb.Allow(host))
+	// The trial call never records a result
+	assert.Error(t, cb.Allow(host))
+
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, cb.Allow(host), "an expired trial lets another one through")
+	assert.Error(t, cb.Allow(host))
+	cb.RecordSuccess(host)
+	assert.NoError(t, cb.Allow(host))
+}
+
+func TestCircuitBreaker_BoundedHosts(t *testing.T) {
+	cb := NewCircuitBreaker(1, 50*time.Millisecond)
+	cb.maxHosts = 2
+
+	// Healthy hosts make room for new ones
+	cb.RecordSuccess("a.example.com")
+	cb.RecordSuccess("b.example.com")
+	cb.RecordFailure("c.example.com")
+	cb.RecordFailure("d.example.com")
+	states := cb.States()
+	require.Len(t, states, 2)
+	assert.Equal(t, "c.example.com", states[0].Host)
+	assert.Equal(t, "d.example.com", states[1].Host)
+
+	// Open breakers are kept; a new host goes through untracked
+	assert.NoError(t, cb.Allow("e.example.com"))
+	assert.Len(t, cb.States(), 2)
+	assert.Error(t, cb.Allow("c.example.com"))
+
+	// Once idle for a cooldown they are dropped too
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, cb.Allow("e.example.com"))
+	states = cb.States()
+	require.Len(t, states, 1)
+	assert.Equal(t, "e.example.com", states[0].Host)
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Minute)
+	cb.Configure(false, 1, time.Minute)
+
+	cb.RecordFailure("api.example.com")
+	assert.NoError(t, cb.Allow("api.example.com"))
+	assert.Empty(t, cb.States())
+}
+
+func TestHTTPClient_CircuitBreaker(t *testing.T) {
+	ResetHTTPCircuitBreakers()
+	ConfigureHTTPCircuitBreaker(true, 2, 50*time.Millisecond)
+	defer func() {
+		ResetHTTPCircuitBreakers()
+		ConfigureHTTPCircuitBreaker(true, 5, 30*time.Second)
+	}()
+
+	var healthy int32
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	vm := goja.New()
+	args := map[string]interface{}{"url": server.URL + "/flaky"}
+
+	// Two 5xx responses trip the breaker
+	for i := 0; i < 2; i++ {
+		_, err := CallHttpClient(vm, args)
+		require.NoError(t, err)
+	}
+
+	_, err := CallHttpClient(vm, args)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "open breaker must not reach the upstream")
+
+	// The upstream recovers and the breaker closes after the cooldown
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+
+	result, err := CallHttpClient(vm, args)
+	require.NoError(t, err)
+	assert.Equal(t, float64(200), result.(map[string]interface{})["statusCode"])
+	assert.Equal(t, "closed", GetHTTPCircuitBreakerStates()[0].State)
+}
@@ -1,20 +1,89 @@
 package plugins
 
 import (
-	"crypto/tls"
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"github.com/labstack/echo/v4"
 )
 
 type ClientHTTP string
 
+// defaultMaxResponseBytes is the in-memory response limit when none is configured
+const defaultMaxResponseBytes = int64(10 * 1024 * 1024)
+
 var (
 	fxs map[string]interface{} = make(map[string]interface{})
+
+	// maxResponseBytes caps the body read into memory, maxDownloadBytes caps
+	// bodies streamed to disk (0 = unlimited)
+	maxResponseBytes = defaultMaxResponseBytes
+	maxDownloadBytes = int64(0)
+
+	// ErrResponseTooLarge is returned when an upstream body exceeds the limit
+	ErrResponseTooLarge = errors.New("response body exceeds size limit")
 )
 
+// ConfigureHTTPLimits sets the response size limits of the HTTP plugin.
+// A non-positive maxResponse restores the 10MB default.
+func ConfigureHTTPLimits(maxResponse int64, maxDownload int64) {
+	if maxResponse <= 0 {
+		maxResponse = defaultMaxResponseBytes
+	}
+	if maxDownload < 0 {
+		maxDownload = 0
+	}
+	atomic.StoreInt64(&maxResponseBytes, maxResponse)
+	atomic.StoreInt64(&maxDownloadBytes, maxDownload)
+}
+
+// readLimitedBody reads r up to limit bytes and fails if there is more
+func readLimitedBody(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, limit)
+	}
+	return data, nil
+}
+
+// streamBodyToFile copies r into path without holding it in memory. The body
+// is written to a temporary file first so a failed download leaves no partial file.
+func streamBodyToFile(r io.Reader, path string, limit int64) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".nflow-download-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	src := r
+	if limit > 0 {
+		src = io.LimitReader(r, limit+1)
+	}
+	written, err := io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return written, err
+	}
+	if limit > 0 && written > limit {
+		return written, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, limit)
+	}
+	return written, os.Rename(tmp.Name(), path)
+}
+
 func (d ClientHTTP) Run(c echo.Context,
 	vars map[string]string, payloadIn interface{}, dromedaryData string,
 	callback chan string,
@@ -34,36 +103,87 @@ func (d ClientHTTP) Name() string {
 	return "client_http"
 }
 
-func httpRequest(method string, url string, body *string, header map[string][]string) map[string]interface{} {
+// httpRequest runs a call of the http_* helpers. Server certificates are
+// verified unless the tls option allows otherwise. With the download_to
+// option the body is streamed into that file, resolved like the paths of the
+// files helpers, instead of being returned.
+func httpRequest(method string, url string, body *string, header map[string][]string, options map[string]interface{}) map[string]interface{} {
+	downloadTo, _ := options["download_to"].(string)
+	if TestModeEnabled() {
+		data := map[string]interface{}{"method": method, "header": header}
+		if body != nil {
+			data["body"] = *body
+		}
+		if downloadTo != "" {
+			data["path"] = downloadTo
+			RecordCall("http", url, data)
+			return map[string]interface{}{"file": downloadTo, "size": 0, "err": nil, "status": "200 OK", "header": http.Header{}, "status_code": http.StatusOK}
+		}
+		RecordCall("http", url, data)
+		return map[string]interface{}{"body": "", "err": nil, "status": "200 OK", "header": http.Header{}, "status_code": http.StatusOK}
+	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	var target string
+	if downloadTo != "" {
+		full, _, err := resolvePath(downloadTo)
+		if err != nil {
+			return map[string]interface{}{"file": "", "size": 0, "err": err, "status": "", "header": http.Header{}, "status_code": 0}
+		}
+		target = full
 	}
 
-	client := &http.Client{
-		Transport: tr,
+	tlsOptions, err := parseTLSOptions(options)
+	if err != nil {
+		return map[string]interface{}{"body": "", "err": err, "status": "", "header": http.Header{}, "status_code": 0}
+	}
+	client, err := getHTTPClient(tlsOptions)
+	if err != nil {
+		return map[string]interface{}{"body": "", "err": err, "status": "", "header": http.Header{}, "status_code": 0}
 	}
 
 	// Create an http.Request instance
 	var req *http.Request
-	if method == http.MethodGet {
-		req, _ = http.NewRequest(method, url, nil)
-	} else if method == http.MethodDelete {
-		req, _ = http.NewRequest(method, url, nil)
+	if method == http.MethodGet || method == http.MethodDelete {
+		req, err = http.NewRequest(method, url, nil)
 	} else {
-		rb := strings.NewReader(*body)
-		req, _ = http.NewRequest(method, url, rb)
+		req, err = http.NewRequest(method, url, strings.NewReader(*body))
+	}
+	if err != nil {
+		return map[string]interface{}{"body": "", "err": err, "status": "", "header": http.Header{}, "status_code": 0}
 	}
 
 	if len(header) > 0 {
 		req.Header = header
 	}
 
+	// Every path after Allow records a result, or the trial call of a half
+	// open breaker would never report back
+	host := breakerHost(url)
+	if err := httpCircuitBreaker.Allow(host); err != nil {
+		return map[string]interface{}{"body": "", "err": err, "status": http.StatusText(http.StatusServiceUnavailable), "header": http.Header{}, "status_code": http.StatusServiceUnavailable}
+	}
+
 	res, err := client.Do(req)
 	if err != nil {
+		httpCircuitBreaker.RecordFailure(host)
+		// Downloads have always reported failed calls in err
+		if target != "" {
+			return map[string]interface{}{"file": "", "size": 0, "err": err, "status": "", "header": http.Header{}, "status_code": 0}
+		}
 		panic(err)
 	}
-	rbody, err := ioutil.ReadAll(res.Body)
+	if res.StatusCode >= http.StatusInternalServerError {
+		httpCircuitBreaker.RecordFailure(host)
+	} else {
+		httpCircuitBreaker.RecordSuccess(host)
+	}
+	defer res.Body.Close()
+
+	if target != "" {
+		return downloadResponse(res, downloadTo, target)
+	}
+
+	rbody, err := readLimitedBody(res.Body, atomic.LoadInt64(&maxResponseBytes))
 	if err != nil {
 		return map[string]interface{}{"body": "", "err": err, "status": res.Status, "header": res.Header, "status_code": res.StatusCode}
 	}
@@ -71,40 +191,69 @@ func httpRequest(method string, url string, body *string, header map[string][]st
 	return map[string]interface{}{"body": string(rbody), "err": err, "status": res.Status, "header": res.Header, "status_code": res.StatusCode}
 }
 
-func httpGet(url string) map[string]interface{} {
-	return httpRequest(http.MethodGet, url, nil, map[string][]string{})
+// downloadResponse streams the body of res into target, the resolved path
+// of the workflow path
+func downloadResponse(res *http.Response, path string, target string) map[string]interface{} {
+	size, err := streamBodyToFile(res.Body, target, atomic.LoadInt64(&maxDownloadBytes))
+	if err != nil {
+		return map[string]interface{}{"file": "", "size": size, "err": err, "status": res.Status, "header": res.Header, "status_code": res.StatusCode}
+	}
+	return map[string]interface{}{"file": path, "size": size, "err": nil, "status": res.Status, "header": res.Header, "status_code": res.StatusCode}
+}
+
+// httpDownload streams the body of a GET request into path, relative to the
+// filesystem base directory. It fails when filesystem access is disabled.
+func httpDownload(url string, path string, options ...map[string]interface{}) map[string]interface{} {
+	downloadOptions := map[string]interface{}{}
+	for key, value := range httpOptions(options) {
+		downloadOptions[key] = value
+	}
+	downloadOptions["download_to"] = path
+	return httpRequest(http.MethodGet, url, nil, map[string][]string{}, downloadOptions)
+}
+
+// httpOptions returns the optional last argument of the http_* helpers
+func httpOptions(options []map[string]interface{}) map[string]interface{} {
+	if len(options) == 0 {
+		return nil
+	}
+	return options[0]
+}
+
+func httpGet(url string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodGet, url, nil, map[string][]string{}, httpOptions(options))
 }
 
-func httpDelete(url string) map[string]interface{} {
-	return httpRequest(http.MethodDelete, url, nil, map[string][]string{})
+func httpDelete(url string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodDelete, url, nil, map[string][]string{}, httpOptions(options))
 }
 
-func httpPost(url string, body string) map[string]interface{} {
-	return httpRequest(http.MethodPost, url, &body, map[string][]string{})
+func httpPost(url string, body string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodPost, url, &body, map[string][]string{}, httpOptions(options))
 }
-func httpPut(url string, body string) map[string]interface{} {
-	return httpRequest(http.MethodPut, url, &body, map[string][]string{})
+func httpPut(url string, body string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodPut, url, &body, map[string][]string{}, httpOptions(options))
 }
-func httpPatch(url string, body string) map[string]interface{} {
-	return httpRequest(http.MethodPatch, url, &body, map[string][]string{})
+func httpPatch(url string, body string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodPatch, url, &body, map[string][]string{}, httpOptions(options))
 }
 
-func httpGetWithHeader(url string, header map[string][]string) map[string]interface{} {
-	return httpRequest(http.MethodGet, url, nil, header)
+func httpGetWithHeader(url string, header map[string][]string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodGet, url, nil, header, httpOptions(options))
 }
 
-func httpDeleteWithHeader(url string, header map[string][]string) map[string]interface{} {
-	return httpRequest(http.MethodDelete, url, nil, header)
+func httpDeleteWithHeader(url string, header map[string][]string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodDelete, url, nil, header, httpOptions(options))
 }
 
-func httpPostWithHeader(url string, body string, header map[string][]string) map[string]interface{} {
-	return httpRequest(http.MethodPost, url, &body, header)
+func httpPostWithHeader(url string, body string, header map[string][]string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodPost, url, &body, header, httpOptions(options))
 }
-func httpPutWithHeader(url string, body string, header map[string][]string) map[string]interface{} {
-	return httpRequest(http.MethodPut, url, &body, header)
+func httpPutWithHeader(url string, body string, header map[string][]string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodPut, url, &body, header, httpOptions(options))
 }
-func httpPatchWithHeader(url string, body string, header map[string][]string) map[string]interface{} {
-	return httpRequest(http.MethodPatch, url, &body, header)
+func httpPatchWithHeader(url string, body string, header map[string][]string, options ...map[string]interface{}) map[string]interface{} {
+	return httpRequest(http.MethodPatch, url, &body, header, httpOptions(options))
 }
 
 func addFeatureHttp() {
@@ -118,4 +267,5 @@ func addFeatureHttp() {
 	fxs["http_delete_with_header"] = httpDeleteWithHeader
 	fxs["http_put_with_header"] = httpPutWithHeader
 	fxs["http_patch_with_header"] = httpPatchWithHeader
+	fxs["http_download"] = httpDownload
 }
@@ -0,0 +1,192 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FilesPlugin exposes read_file, write_file and list_dir to workflows. Every
+// path is relative to a configured base directory and the helpers are only
+// registered when vm_pool.enable_filesystem is true.
+type FilesPlugin string
+
+// ErrPathOutsideBase is returned for paths escaping the base directory
+var ErrPathOutsideBase = errors.New("path is outside the allowed base directory")
+
+const defaultMaxFileSize = int64(1024 * 1024)
+
+var (
+	fxsFiles     map[string]interface{} = make(map[string]interface{})
+	filesBase    string
+	filesMax     = defaultMaxFileSize
+	filesMu      sync.RWMutex
+	filesWriteMu sync.Mutex
+)
+
+func (d FilesPlugin) Run(c echo.Context,
+	vars map[string]string, payloadIn interface{}, dromedaryData string,
+	callback chan string,
+) (payloadOut interface{}, next string, err error) {
+	return nil, "output_1", nil
+}
+
+// AddFeatureJS returns the helpers of the last Initialize. The map is
+// replaced, never modified, so callers may range over it.
+func (d FilesPlugin) AddFeatureJS() map[string]interface{} {
+	filesMu.RLock()
+	defer filesMu.RUnlock()
+	return fxsFiles
+}
+
+func (d FilesPlugin) Name() string {
+	return "files"
+}
+
+// Initialize enables the helpers for baseDir. With enable false or an empty
+// baseDir no function is exposed to JS.
+func (d FilesPlugin) Initialize(enable bool, baseDir string, maxFileSize int64) error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	fxsFiles = make(map[string]interface{})
+	filesBase = ""
+	if !enable || baseDir == "" {
+		return nil
+	}
+
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	if base, err = filepath.EvalSymlinks(base); err != nil {
+		return fmt.Errorf("invalid filesystem base_dir: %w", err)
+	}
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+
+	filesBase = base
+	filesMax = maxFileSize
+	fxsFiles = map[string]interface{}{
+		"read_file":  ReadFile,
+		"write_file": WriteFile,
+		"list_dir":   ListDir,
+	}
+	return nil
+}
+
+// resolvePath maps a workflow path to an absolute path inside the base
+// directory, following symlinks of the existing part of the path
+func resolvePath(path string) (string, int64, error) {
+	filesMu.RLock()
+	base, maxSize := filesBase, filesMax
+	filesMu.RUnlock()
+	if base == "" {
+		return "", 0, fmt.Errorf("filesystem access is disabled")
+	}
+	if filepath.IsAbs(path) {
+		return "", 0, ErrPathOutsideBase
+	}
+
+	full := filepath.Join(base, path)
+	if !insideBase(base, full) {
+		return "", 0, ErrPathOutsideBase
+	}
+
+	// Resolve symlinks of the deepest existing ancestor
+	existing := full
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", 0, err
+	}
+	if !insideBase(base, resolved) {
+		return "", 0, ErrPathOutsideBase
+	}
+	return full, maxSize, nil
+}
+
+func insideBase(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ReadFile returns the content of path as a string
+func ReadFile(path string) (string, error) {
+	full, maxSize, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxSize {
+		return "", fmt.Errorf("%s is larger than the max file size (%d bytes)", path, maxSize)
+	}
+	data, err := os.ReadFile(full)
+	return string(data), err
+}
+
+// WriteFile replaces the content of path, creating parent directories
+func WriteFile(path string, content string) error {
+	full, maxSize, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+	if int64(len(content)) > maxSize {
+		return fmt.Errorf("content is larger than the max file size (%d bytes)", maxSize)
+	}
+
+	filesWriteMu.Lock()
+	defer filesWriteMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(full, []byte(content), 0644)
+}
+
+// ListDir returns the entries of path with name, size, is_dir and mod_time
+func ListDir(path string) ([]map[string]interface{}, error) {
+	full, _, err := resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"name":     entry.Name(),
+			"size":     info.Size(),
+			"is_dir":   entry.IsDir(),
+			"mod_time": info.ModTime().Unix(),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package plugins
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupFilesPlugin(t *testing.T, maxSize int64) string {
+	base := t.TempDir()
+	require.NoError(t, FilesPlugin("files").Initialize(true, base, maxSize))
+	t.Cleanup(func() { FilesPlugin("files").Initialize(false, "", 0) })
+	return base
+}
+
+func TestFiles_ReadWriteList(t *testing.T) {
+	setupFilesPlugin(t, 0)
+
+	require.NoError(t, WriteFile("reports/today.txt", "hello"))
+	content, err := ReadFile("reports/today.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", content)
+
+	entries, err := ListDir("reports")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "today.txt", entries[0]["name"])
+	assert.Equal(t, int64(5), entries[0]["size"])
+
+	// Paths that stay inside the base after cleaning are allowed
+	content, err = ReadFile("reports/../reports/./today.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", content)
+}
+
+func TestFiles_RejectsTraversal(t *testing.T) {
+	base := setupFilesPlugin(t, 0)
+
+	outside := filepath.Join(filepath.Dir(base), "outside.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0600))
+	defer os.Remove(outside)
+
+	for _, path := range []string{"../outside.txt", "a/../../outside.txt", outside, "/etc/passwd"} {
+		_, err := ReadFile(path)
+		assert.True(t, errors.Is(err, ErrPathOutsideBase), "read %s", path)
+		assert.True(t, errors.Is(WriteFile(path, "x"), ErrPathOutsideBase), "write %s", path)
+	}
+	_, err := ListDir("..")
+	assert.True(t, errors.Is(err, ErrPathOutsideBase))
+
+	// A symlink pointing outside the base is not followed
+	require.NoError(t, os.Symlink(filepath.Dir(base), filepath.Join(base, "escape")))
+	_, err = ReadFile("escape/outside.txt")
+	assert.True(t, errors.Is(err, ErrPathOutsideBase))
+	assert.True(t, errors.Is(WriteFile("escape/new.txt", "x"), ErrPathOutsideBase))
+}
+
+func TestFiles_MaxSizeAndDisabled(t *testing.T) {
+	base := setupFilesPlugin(t, 4)
+
+	assert.Error(t, WriteFile("big.txt", "12345"))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "big.txt"), []byte(strings.Repeat("x", 10)), 0600))
+	_, err := ReadFile("big.txt")
+	assert.Error(t, err)
+
+	require.NoError(t, FilesPlugin("files").Initialize(false, base, 0))
+	assert.Empty(t, FilesPlugin("files").AddFeatureJS(), "helpers are not exposed without enable_filesystem")
+	_, err = ReadFile("big.txt")
+	assert.Error(t, err)
+}
@@ -1,7 +1,6 @@
 package plugins
 
 import (
-	"encoding/base64"
 	"io/ioutil"
 	"log"
 	"net/url"
@@ -10,7 +9,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -80,13 +78,6 @@ func addFeatureCommon() {
 		return elem
 	}
 
-	fxsGoja["atob"] = func(value string) string {
-		if d, err := base64.StdEncoding.DecodeString(value); err == nil {
-			return string(d)
-		}
-		return ""
-	}
-
 	fxsGoja["set_env"] = func(key string, value string) {
 		os.Setenv(key, value)
 	}
@@ -95,10 +86,6 @@ func addFeatureCommon() {
 		return os.Getenv(key)
 	}
 
-	fxsGoja["sleep"] = func(s int64) {
-		time.Sleep(time.Duration(s) * time.Millisecond)
-	}
-
 	fxsGoja["url_values_to_map"] = func(s url.Values) map[string][]string {
 		return map[string][]string(s)
 	}
@@ -143,8 +130,8 @@ func addFeatureCommon() {
 		return int(time.Now().Weekday())
 	}
 
-	fxsGoja["uuid"] = uuid.New().String
-
 	fxsGoja["clean_json"] = cleanJSON
+	// sign_hmac(payload, secret, algo, encoding) signs outbound webhooks
+	fxsGoja["sign_hmac"] = SignHMAC
 
 }
@@ -0,0 +1,504 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GrpcPlugin exposes unary gRPC calls to workflows. Message types are taken
+// from a FileDescriptorSet configured in [grpc_client] or passed per call,
+// or from the server through reflection when there is none.
+type GrpcPlugin string
+
+// ErrGrpcDisabled is returned when network access is disabled in the sandbox
+var ErrGrpcDisabled = errors.New("grpc client is disabled (vm_pool.enable_network = false)")
+
+// GrpcError is a non-OK status returned by the server
+type GrpcError struct {
+	Code    int
+	Message string
+}
+
+func (e *GrpcError) Error() string {
+	return fmt.Sprintf("grpc error %d: %s", e.Code, e.Message)
+}
+
+// grpcConnKey pools one connection per target and TLS setup
+type grpcConnKey struct {
+	Target    string
+	TLS       TLSOptions
+	Plaintext bool
+}
+
+// grpcReservedMetadata are headers gRPC sets itself, metadata can not override them
+var grpcReservedMetadata = map[string]bool{
+	"content-type":      true,
+	"te":                true,
+	"user-agent":        true,
+	"host":              true,
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+var (
+	fxsGrpc map[string]interface{} = make(map[string]interface{})
+
+	grpcEnabled        = int32(0)
+	grpcDefaultTimeout = int64(10 * time.Second)
+
+	grpcRegistries   = make(map[string]*protoregistry.Files)
+	grpcRegistriesMu sync.RWMutex
+	grpcDescriptor   string
+
+	grpcConns   = make(map[grpcConnKey]*grpc.ClientConn)
+	grpcConnsMu sync.Mutex
+
+	// grpcRetiredConns were pooled before the last Initialize and wait for Shutdown
+	grpcRetiredConns []*grpc.ClientConn
+)
+
+func init() {
+	fxsGrpc["grpc_call"] = CallGrpc
+}
+
+func (d GrpcPlugin) Run(c echo.Context,
+	vars map[string]string, payloadIn interface{}, dromedaryData string,
+	callback chan string,
+) (payloadOut interface{}, next string, err error) {
+	return nil, "output_1", nil
+}
+
+func (d GrpcPlugin) AddFeatureJS() map[string]interface{} {
+	return fxsGrpc
+}
+
+// AddFeatureJSRequest binds grpc_call to the request, so a call stops when
+// the client disconnects
+func (d GrpcPlugin) AddFeatureJSRequest(c echo.Context) map[string]interface{} {
+	ctx := c.Request().Context()
+	return map[string]interface{}{
+		"grpc_call": func(target, method string, request map[string]interface{}, options map[string]interface{}) (map[string]interface{}, error) {
+			return CallGrpcContext(ctx, target, method, request, options)
+		},
+	}
+}
+
+func (d GrpcPlugin) Name() string {
+	return "grpc"
+}
+
+// Initialize configures the plugin. Calls fail with ErrGrpcDisabled unless
+// enable is true. Later calls open new connections, the previous ones are
+// closed by Shutdown.
+func (d GrpcPlugin) Initialize(enable bool, descriptorSet string, timeout time.Duration) {
+	flag := int32(0)
+	if enable {
+		flag = 1
+	}
+	atomic.StoreInt32(&grpcEnabled, flag)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	atomic.StoreInt64(&grpcDefaultTimeout, int64(timeout))
+
+	grpcRegistriesMu.Lock()
+	grpcDescriptor = descriptorSet
+	grpcRegistries = make(map[string]*protoregistry.Files)
+	grpcRegistriesMu.Unlock()
+
+	grpcConnsMu.Lock()
+	for _, conn := range grpcConns {
+		grpcRetiredConns = append(grpcRetiredConns, conn)
+	}
+	grpcConns = make(map[grpcConnKey]*grpc.ClientConn)
+	grpcConnsMu.Unlock()
+}
+
+// HealthCheck reports the pooled connections that can not reach their
+// server. A disabled plugin, or one that made no call yet, is healthy.
+func (d GrpcPlugin) HealthCheck() error {
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	var errs []error
+	for key, conn := range grpcConns {
+		if state := conn.GetState(); state == connectivity.TransientFailure {
+			errs = append(errs, fmt.Errorf("grpc target %s: %s", key.Target, state))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown closes the connections pooled before the last Initialize
+func (d GrpcPlugin) Shutdown() error {
+	grpcConnsMu.Lock()
+	retired := grpcRetiredConns
+	grpcRetiredConns = nil
+	grpcConnsMu.Unlock()
+
+	var errs []error
+	for _, conn := range retired {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cachedRegistry returns the descriptors cached under key
+func cachedRegistry(key string) (*protoregistry.Files, bool) {
+	grpcRegistriesMu.RLock()
+	defer grpcRegistriesMu.RUnlock()
+	files, ok := grpcRegistries[key]
+	return files, ok
+}
+
+func cacheRegistry(key string, files *protoregistry.Files) {
+	grpcRegistriesMu.Lock()
+	grpcRegistries[key] = files
+	grpcRegistriesMu.Unlock()
+}
+
+// descriptorSetPath returns the descriptor set of a call: descriptor_set
+// resolved like the paths of the files helpers, or the configured one when
+// the call does not set it
+func descriptorSetPath(path string) (string, error) {
+	if path != "" {
+		full, _, err := resolvePath(path)
+		return full, err
+	}
+	grpcRegistriesMu.RLock()
+	defer grpcRegistriesMu.RUnlock()
+	return grpcDescriptor, nil
+}
+
+// loadDescriptorSet reads a FileDescriptorSet built with
+// protoc --include_imports --descriptor_set_out, cached after the first load
+func loadDescriptorSet(path string) (*protoregistry.Files, error) {
+	if files, ok := cachedRegistry(path); ok {
+		return files, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading grpc descriptor set: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("parsing grpc descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("parsing grpc descriptor set %s: %w", path, err)
+	}
+	cacheRegistry(path, files)
+	return files, nil
+}
+
+// reflectDescriptors asks the server for the file defining service and its
+// dependencies through the v1 reflection service, cached per target
+func reflectDescriptors(ctx context.Context, conn *grpc.ClientConn, service string) (*protoregistry.Files, error) {
+	key := "reflection:" + conn.Target() + "/" + service
+	if files, ok := cachedRegistry(key); ok {
+		return files, nil
+	}
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, grpcCallError(err)
+	}
+	defer stream.CloseSend()
+
+	fileProtos := make(map[string]*descriptorpb.FileDescriptorProto)
+	request := &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}
+	for request != nil {
+		if err := stream.Send(request); err != nil {
+			return nil, grpcCallError(err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, grpcCallError(err)
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, &GrpcError{Code: int(e.GetErrorCode()), Message: e.GetErrorMessage()}
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, fd); err != nil {
+				return nil, fmt.Errorf("parsing reflected descriptor: %w", err)
+			}
+			fileProtos[fd.GetName()] = fd
+		}
+		request = missingDependency(fileProtos)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range fileProtos {
+		set.File = append(set.File, fd)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reflected descriptors of %s: %w", service, err)
+	}
+	cacheRegistry(key, files)
+	return files, nil
+}
+
+// missingDependency returns the request for the first dependency not received
+// yet, nil when every one is known. Well-known types linked in the binary are
+// not asked for.
+func missingDependency(fileProtos map[string]*descriptorpb.FileDescriptorProto) *rpb.ServerReflectionRequest {
+	for _, fd := range fileProtos {
+		for _, dep := range fd.GetDependency() {
+			if _, ok := fileProtos[dep]; ok {
+				continue
+			}
+			if known, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				fileProtos[dep] = protodesc.ToFileDescriptorProto(known)
+				continue
+			}
+			return &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			}
+		}
+	}
+	return nil
+}
+
+// findMethod resolves "package.Service/Method" or "package.Service.Method"
+func findMethod(files *protoregistry.Files, name string) (protoreflect.MethodDescriptor, error) {
+	service, method := splitGrpcMethod(name)
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("grpc service %s not found", service)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a grpc service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("grpc method %s/%s not found", service, method)
+	}
+	return md, nil
+}
+
+// splitGrpcMethod splits a method name into its service and method parts
+func splitGrpcMethod(name string) (string, string) {
+	name = strings.TrimPrefix(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// getGrpcConn returns the pooled connection for key
+func getGrpcConn(key grpcConnKey) (*grpc.ClientConn, error) {
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	if conn, ok := grpcConns[key]; ok {
+		return conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if !key.Plaintext {
+		tlsConfig, err := buildTLSConfig(key.TLS)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(key.Target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	grpcConns[key] = conn
+	return conn, nil
+}
+
+// ResetGrpcClients closes the pooled connections and drops the cached descriptors
+func ResetGrpcClients() {
+	grpcConnsMu.Lock()
+	for _, conn := range grpcConns {
+		conn.Close()
+	}
+	for _, conn := range grpcRetiredConns {
+		conn.Close()
+	}
+	grpcConns = make(map[grpcConnKey]*grpc.ClientConn)
+	grpcRetiredConns = nil
+	grpcConnsMu.Unlock()
+
+	grpcRegistriesMu.Lock()
+	grpcRegistries = make(map[string]*protoregistry.Files)
+	grpcRegistriesMu.Unlock()
+}
+
+// grpcMetadata builds the outgoing metadata, skipping the headers gRPC owns
+func grpcMetadata(values map[string]interface{}) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range values {
+		key := strings.ToLower(k)
+		if grpcReservedMetadata[key] || strings.HasPrefix(key, "grpc-") || strings.HasPrefix(key, ":") {
+			continue
+		}
+		md.Append(key, fmt.Sprint(v))
+	}
+	return md
+}
+
+// grpcCallError turns a gRPC status into a GrpcError
+func grpcCallError(err error) error {
+	if st, ok := status.FromError(err); ok {
+		return &GrpcError{Code: int(st.Code()), Message: st.Message()}
+	}
+	return err
+}
+
+// CallGrpc performs a unary call. target is "host:port", method is
+// "package.Service/Method" and request is the JS object of the input message,
+// in the proto3 JSON mapping. Supported options: timeout_ms, metadata
+// (object), descriptor_set (path relative to the filesystem base directory)
+// and tls (true or an object like the HTTP plugin). Without tls the call
+// uses plaintext HTTP/2. Without a descriptor set the message types are
+// asked to the server through reflection.
+func CallGrpc(target, method string, request map[string]interface{}, options map[string]interface{}) (map[string]interface{}, error) {
+	return CallGrpcContext(context.Background(), target, method, request, options)
+}
+
+// CallGrpcContext is CallGrpc canceled with ctx. In test mode the call is
+// recorded instead and answers an empty response.
+func CallGrpcContext(ctx context.Context, target, method string, request map[string]interface{}, options map[string]interface{}) (map[string]interface{}, error) {
+	if atomic.LoadInt32(&grpcEnabled) == 0 {
+		return nil, ErrGrpcDisabled
+	}
+	if TestModeEnabled() {
+		RecordCall("grpc", target, map[string]interface{}{"method": method, "request": request})
+		return map[string]interface{}{
+			"response": map[string]interface{}{},
+			"headers":  map[string]interface{}{},
+		}, nil
+	}
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
+	key := grpcConnKey{Target: target, Plaintext: true}
+	var err error
+	switch v := options["tls"].(type) {
+	case bool:
+		key.Plaintext = !v
+	case map[string]interface{}:
+		key.Plaintext = false
+		if key.TLS, err = parseTLSOptions(options); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := getGrpcConn(key)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(atomic.LoadInt64(&grpcDefaultTimeout))
+	if ms, err := toInt64(options["timeout_ms"]); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var files *protoregistry.Files
+	descriptorSet, _ := options["descriptor_set"].(string)
+	path, err := descriptorSetPath(descriptorSet)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		files, err = loadDescriptorSet(path)
+	} else {
+		service, _ := splitGrpcMethod(method)
+		files, err = reflectDescriptors(ctx, conn, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	md, err := findMethod(files, method)
+	if err != nil {
+		return nil, err
+	}
+	fullMethod := "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("grpc method %s is streaming, only unary calls are supported", fullMethod)
+	}
+
+	in := dynamicpb.NewMessage(md.Input())
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := protojson.Unmarshal(body, in); err != nil {
+		return nil, fmt.Errorf("grpc request for %s: %w", fullMethod, err)
+	}
+
+	if values, ok := options["metadata"].(map[string]interface{}); ok {
+		ctx = metadata.NewOutgoingContext(ctx, grpcMetadata(values))
+	}
+
+	out := dynamicpb.NewMessage(md.Output())
+	var header metadata.MD
+	callOptions := []grpc.CallOption{grpc.Header(&header)}
+	if limit := atomic.LoadInt64(&maxResponseBytes); limit > 0 {
+		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(int(limit)))
+	}
+	if err := conn.Invoke(ctx, fullMethod, in, out, callOptions...); err != nil {
+		return nil, grpcCallError(err)
+	}
+
+	data, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	response := make(map[string]interface{})
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]interface{})
+	for k, v := range header {
+		if k != "content-type" {
+			headers[k] = strings.Join(v, ",")
+		}
+	}
+	return map[string]interface{}{
+		"response": response,
+		"headers":  headers,
+	}, nil
+}
@@ -0,0 +1,367 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// greeterDescriptor describes:
+//
+//	package demo;
+//	message HelloRequest { string name = 1; int32 times = 2; repeated string tags = 3; }
+//	message HelloReply {
+//	  enum Mood { UNKNOWN = 0; HAPPY = 1; }
+//	  string message = 1; sint64 count = 2; Mood mood = 3;
+//	  map<string, string> labels = 4; repeated int32 scores = 5;
+//	}
+//	service Greeter { rpc SayHello(HelloRequest) returns (HelloReply); }
+func greeterDescriptor() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Label: label.Enum(), Type: typ.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("greeter.proto"),
+		Package: proto.String("demo"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("HelloRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("times", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("tags", 3, repeated, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			},
+			{
+				Name: proto.String("HelloReply"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("message", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("count", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_SINT64, ""),
+					field("mood", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".demo.HelloReply.Mood"),
+					field("labels", 4, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".demo.HelloReply.LabelsEntry"),
+					field("scores", 5, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("LabelsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+						field("value", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+				EnumType: []*descriptorpb.EnumDescriptorProto{{
+					Name: proto.String("Mood"),
+					Value: []*descriptorpb.EnumValueDescriptorProto{
+						{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+						{Name: proto.String("HAPPY"), Number: proto.Int32(1)},
+					},
+				}},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("SayHello"),
+				InputType:  proto.String(".demo.HelloRequest"),
+				OutputType: proto.String(".demo.HelloReply"),
+			}},
+		}},
+	}
+}
+
+// greeterFiles returns the greeter descriptors and the service description
+// of a server implementing it
+func greeterFiles(t *testing.T) (*protoregistry.Files, *grpc.ServiceDesc) {
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{greeterDescriptor()}})
+	require.NoError(t, err)
+	method, err := findMethod(files, "demo.Greeter/SayHello")
+	require.NoError(t, err)
+
+	sayHello := func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := dynamicpb.NewMessage(method.Input())
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		fields := req.Descriptor().Fields()
+		name := req.Get(fields.ByName("name")).String()
+		switch name {
+		case "missing":
+			return nil, status.Error(codes.NotFound, "user not found")
+		case "slow":
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			return nil, ctx.Err()
+		}
+
+		var tags []string
+		list := req.Get(fields.ByName("tags")).List()
+		for i := 0; i < list.Len(); i++ {
+			tags = append(tags, list.Get(i).String())
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		user := strings.Join(md.Get("x-user"), ",")
+		if len(md.Get("te")) > 1 || strings.Join(md.Get("content-type"), "") != "application/grpc" {
+			user = "overridden"
+		}
+
+		reply := dynamicpb.NewMessage(method.Output())
+		out := reply.Descriptor().Fields()
+		reply.Set(out.ByName("message"), protoreflect.ValueOfString("hello "+name))
+		reply.Set(out.ByName("count"), protoreflect.ValueOfInt64(-req.Get(fields.ByName("times")).Int()))
+		reply.Set(out.ByName("mood"), protoreflect.ValueOfEnum(1))
+		labels := reply.Mutable(out.ByName("labels")).Map()
+		labels.Set(protoreflect.ValueOfString("tags").MapKey(), protoreflect.ValueOfString(strings.Join(tags, ",")))
+		labels.Set(protoreflect.ValueOfString("user").MapKey(), protoreflect.ValueOfString(user))
+		scores := reply.Mutable(out.ByName("scores")).List()
+		scores.Append(protoreflect.ValueOfInt32(1))
+		scores.Append(protoreflect.ValueOfInt32(2))
+		return reply, nil
+	}
+
+	return files, &grpc.ServiceDesc{
+		ServiceName: "demo.Greeter",
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "SayHello", Handler: sayHello}},
+		Metadata:    "greeter.proto",
+	}
+}
+
+// newGreeterServer starts a plaintext gRPC server implementing demo.Greeter,
+// with server reflection, and returns its address
+func newGreeterServer(t *testing.T) string {
+	files, desc := greeterFiles(t)
+	server := grpc.NewServer()
+	server.RegisterService(desc, struct{}{})
+	rpb.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           server,
+		DescriptorResolver: files,
+	}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+// setupGrpcPlugin enables the plugin, with the greeter descriptor set
+// configured unless reflect is set
+func setupGrpcPlugin(t *testing.T, enable bool, reflect bool) string {
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{greeterDescriptor()}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "greeter.pb")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	configured := path
+	if reflect {
+		configured = ""
+	}
+	ResetGrpcClients()
+	GrpcPlugin("grpc").Initialize(enable, configured, time.Second)
+	t.Cleanup(func() {
+		ResetGrpcClients()
+		GrpcPlugin("grpc").Initialize(false, "", 0)
+	})
+	return path
+}
+
+func TestGrpcClient_UnaryCall(t *testing.T) {
+	setupGrpcPlugin(t, true, false)
+	target := newGreeterServer(t)
+
+	call := GrpcPlugin("grpc").AddFeatureJS()["grpc_call"].(func(string, string, map[string]interface{}, map[string]interface{}) (map[string]interface{}, error))
+	result, err := call(target, "demo.Greeter/SayHello", map[string]interface{}{
+		"name":  "nflow",
+		"times": float64(3),
+		"tags":  []interface{}{"a", "b"},
+	}, map[string]interface{}{
+		"metadata": map[string]interface{}{"x-user": "admin"},
+	})
+	require.NoError(t, err)
+
+	response := result["response"].(map[string]interface{})
+	assert.Equal(t, "hello nflow", response["message"])
+	assert.Equal(t, "-3", response["count"], "64 bit integers follow the proto3 JSON mapping")
+	assert.Equal(t, "HAPPY", response["mood"])
+	assert.Equal(t, map[string]interface{}{"tags": "a,b", "user": "admin"}, response["labels"])
+	assert.Equal(t, []interface{}{float64(1), float64(2)}, response["scores"])
+
+	// The dotted method form resolves to the same call
+	_, err = CallGrpc(target, "demo.Greeter.SayHello", map[string]interface{}{"name": "x", "times": 1}, nil)
+	assert.NoError(t, err)
+}
+
+func TestGrpcClient_Reflection(t *testing.T) {
+	setupGrpcPlugin(t, true, true)
+	target := newGreeterServer(t)
+
+	result, err := CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "reflected", "times": 2}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello reflected", result["response"].(map[string]interface{})["message"])
+
+	_, err = CallGrpc(target, "demo.Missing/SayHello", map[string]interface{}{}, nil)
+	assert.Error(t, err)
+}
+
+func TestGrpcClient_ReservedMetadata(t *testing.T) {
+	setupGrpcPlugin(t, true, false)
+	target := newGreeterServer(t)
+
+	result, err := CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "x"}, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"Content-Type": "text/plain",
+			"TE":           "gzip",
+			"grpc-timeout": "1H",
+			"x-user":       "admin",
+		},
+	})
+	require.NoError(t, err)
+	labels := result["response"].(map[string]interface{})["labels"].(map[string]interface{})
+	assert.Equal(t, "admin", labels["user"])
+
+	md := grpcMetadata(map[string]interface{}{"content-type": "x", "Te": "x", "grpc-status": "0", ":authority": "x", "X-Tenant": "t1"})
+	assert.Equal(t, metadata.MD{"x-tenant": {"t1"}}, md)
+}
+
+func TestGrpcClient_StatusAndTimeout(t *testing.T) {
+	setupGrpcPlugin(t, true, false)
+	target := newGreeterServer(t)
+
+	_, err := CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "missing"}, nil)
+	var grpcErr *GrpcError
+	require.True(t, errors.As(err, &grpcErr))
+	assert.Equal(t, int(codes.NotFound), grpcErr.Code)
+	assert.Equal(t, "user not found", grpcErr.Message)
+
+	start := time.Now()
+	_, err = CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "slow"}, map[string]interface{}{"timeout_ms": float64(50)})
+	require.True(t, errors.As(err, &grpcErr))
+	assert.Equal(t, int(codes.DeadlineExceeded), grpcErr.Code)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	_, err = CallGrpc(target, "demo.Greeter/Unknown", map[string]interface{}{}, nil)
+	assert.Error(t, err)
+	_, err = CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"nope": 1}, nil)
+	assert.Error(t, err)
+}
+
+func TestGrpcClient_ShutdownClosesReplacedConnections(t *testing.T) {
+	path := setupGrpcPlugin(t, true, false)
+	target := newGreeterServer(t)
+
+	_, err := CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "x"}, nil)
+	require.NoError(t, err)
+	old, err := getGrpcConn(grpcConnKey{Target: target, Plaintext: true})
+	require.NoError(t, err)
+
+	// A reload initializes the new plugins before the old ones shut down
+	GrpcPlugin("grpc").Initialize(true, path, time.Second)
+	require.NoError(t, GrpcPlugin("grpc").Shutdown())
+	assert.Equal(t, connectivity.Shutdown, old.GetState())
+
+	_, err = CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "x"}, nil)
+	assert.NoError(t, err, "calls after the reload use new connections")
+}
+
+func TestGrpcClient_HealthCheck(t *testing.T) {
+	setupGrpcPlugin(t, true, false)
+	assert.NoError(t, GrpcPlugin("grpc").HealthCheck(), "no call made yet")
+
+	target := newGreeterServer(t)
+	_, err := CallGrpc(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "x"}, nil)
+	require.NoError(t, err)
+	assert.NoError(t, GrpcPlugin("grpc").HealthCheck())
+
+	// A target nobody listens on
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	down := lis.Addr().String()
+	lis.Close()
+	_, err = CallGrpc(down, "demo.Greeter/SayHello", map[string]interface{}{"name": "x"}, map[string]interface{}{"timeout_ms": 200})
+	require.Error(t, err)
+	err = GrpcPlugin("grpc").HealthCheck()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), down)
+}
+
+func TestGrpcClient_DescriptorSetOption(t *testing.T) {
+	path := setupGrpcPlugin(t, true, true)
+	target := newGreeterServer(t)
+	request := map[string]interface{}{"name": "x"}
+
+	// Filesystem access is disabled
+	_, err := CallGrpc(target, "demo.Greeter/SayHello", request, map[string]interface{}{"descriptor_set": path})
+	assert.Error(t, err)
+
+	base := setupFilesPlugin(t, 0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(base, "greeter.pb"), data, 0600))
+
+	_, err = CallGrpc(target, "demo.Greeter/SayHello", request, map[string]interface{}{"descriptor_set": path})
+	assert.True(t, errors.Is(err, ErrPathOutsideBase), "host paths are not readable")
+	_, err = CallGrpc(target, "demo.Greeter/SayHello", request, map[string]interface{}{"descriptor_set": "../greeter.pb"})
+	assert.True(t, errors.Is(err, ErrPathOutsideBase))
+
+	result, err := CallGrpc(target, "demo.Greeter/SayHello", request, map[string]interface{}{"descriptor_set": "greeter.pb"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello x", result["response"].(map[string]interface{})["message"])
+}
+
+func TestGrpcClient_CanceledWithRequest(t *testing.T) {
+	setupGrpcPlugin(t, true, false)
+	target := newGreeterServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	ctx, cancel := context.WithCancel(req.Context())
+	c := echo.New().NewContext(req.WithContext(ctx), httptest.NewRecorder())
+	call := GrpcPlugin("grpc").AddFeatureJSRequest(c)["grpc_call"].(func(string, string, map[string]interface{}, map[string]interface{}) (map[string]interface{}, error))
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := call(target, "demo.Greeter/SayHello", map[string]interface{}{"name": "slow"}, nil)
+	var grpcErr *GrpcError
+	require.True(t, errors.As(err, &grpcErr))
+	assert.Equal(t, int(codes.Canceled), grpcErr.Code)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "the call stops with the client")
+}
+
+func TestGrpcClient_DisabledWithoutNetwork(t *testing.T) {
+	setupGrpcPlugin(t, false, false)
+	_, err := CallGrpc("localhost:1", "demo.Greeter/SayHello", map[string]interface{}{}, nil)
+	assert.True(t, errors.Is(err, ErrGrpcDisabled))
+}
@@ -0,0 +1,150 @@
+package plugins
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TLSOptions describes the TLS setup of an outbound call. It is comparable so
+// it can key the client pool.
+type TLSOptions struct {
+	CertFile           string // Client certificate (PEM) for mutual TLS
+	KeyFile            string // Client private key (PEM) for mutual TLS
+	CAFile             string // CA bundle (PEM) used instead of the system roots
+	InsecureSkipVerify bool   // Skip server verification, only if allowed by config
+}
+
+// ErrInsecureTLSNotAllowed is returned when a call asks to skip verification
+// but the runtime configuration does not allow it
+var ErrInsecureTLSNotAllowed = errors.New("insecure_skip_verify is disabled by configuration")
+
+// defaultHTTPTimeout applies when [http_client].timeout is not set
+const defaultHTTPTimeout = 30 * time.Second
+
+var (
+	allowInsecureTLS = int32(0)
+	httpTimeout      = int64(defaultHTTPTimeout)
+
+	// httpClients pools one client (and its connections) per TLS setup
+	httpClients   = make(map[TLSOptions]*http.Client)
+	httpClientsMu sync.RWMutex
+)
+
+// AllowInsecureTLS enables or disables insecure_skip_verify for the HTTP plugin
+func AllowInsecureTLS(allow bool) {
+	flag := int32(0)
+	if allow {
+		flag = 1
+	}
+	atomic.StoreInt32(&allowInsecureTLS, flag)
+}
+
+// ConfigureHTTPTimeout sets the timeout of the pooled clients, reading the
+// body included. A non-positive timeout restores the 30s default.
+func ConfigureHTTPTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	if atomic.SwapInt64(&httpTimeout, int64(timeout)) != int64(timeout) {
+		ResetHTTPClients()
+	}
+}
+
+// parseTLSOptions reads the optional "tls" option of the http_* helpers
+func parseTLSOptions(args map[string]interface{}) (TLSOptions, error) {
+	var opts TLSOptions
+	raw, ok := args["tls"].(map[string]interface{})
+	if !ok {
+		return opts, nil
+	}
+
+	opts.CertFile, _ = raw["cert_file"].(string)
+	opts.KeyFile, _ = raw["key_file"].(string)
+	opts.CAFile, _ = raw["ca_file"].(string)
+	opts.InsecureSkipVerify, _ = raw["insecure_skip_verify"].(bool)
+
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return opts, fmt.Errorf("tls cert_file and key_file must be provided together")
+	}
+	if opts.InsecureSkipVerify && atomic.LoadInt32(&allowInsecureTLS) == 0 {
+		return opts, ErrInsecureTLSNotAllowed
+	}
+	return opts, nil
+}
+
+// buildTLSConfig loads the certificates referenced by opts
+func buildTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// getHTTPClient returns the pooled client for opts, creating it on first use.
+// Certificates are read once; changed files need a ResetHTTPClients call.
+func getHTTPClient(opts TLSOptions) (*http.Client, error) {
+	httpClientsMu.RLock()
+	client, ok := httpClients[opts]
+	httpClientsMu.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if client, ok = httpClients[opts]; ok {
+		return client, nil
+	}
+
+	tlsConfig, err := buildTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxIdleConnsPerHost = 10
+	transport.IdleConnTimeout = 90 * time.Second
+
+	client = &http.Client{Transport: transport, Timeout: time.Duration(atomic.LoadInt64(&httpTimeout))}
+	httpClients[opts] = client
+	return client, nil
+}
+
+// ResetHTTPClients drops every pooled client and its idle connections
+func ResetHTTPClients() {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	for _, client := range httpClients {
+		client.CloseIdleConnections()
+	}
+	httpClients = make(map[TLSOptions]*http.Client)
+}
@@ -0,0 +1,222 @@
+package plugins
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM writes a PEM block to dir/name and returns the path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+// newClientCertificate creates a self-signed client CA and a client
+// certificate signed by it
+func newClientCertificate(t *testing.T, dir string) (*x509.CertPool, string, string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nflow test client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "nflow-runtime"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return pool,
+		writePEM(t, dir, "client.crt", "CERTIFICATE", clientDER),
+		writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestHTTPClient_MutualTLS(t *testing.T) {
+	ResetHTTPClients()
+	defer ResetHTTPClients()
+
+	dir := t.TempDir()
+	clientCAs, certFile, keyFile := newClientCertificate(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"client":"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writePEM(t, dir, "server-ca.crt", "CERTIFICATE", server.Certificate().Raw)
+	vm := goja.New()
+
+	// Custom CA but no client certificate: the handshake is rejected
+	_, err := CallHttpClient(vm, map[string]interface{}{
+		"url": server.URL,
+		"tls": map[string]interface{}{"ca_file": caFile},
+	})
+	assert.Error(t, err)
+
+	// Client certificate and custom CA: the call succeeds
+	args := map[string]interface{}{
+		"url": server.URL,
+		"tls": map[string]interface{}{
+			"cert_file": certFile,
+			"key_file":  keyFile,
+			"ca_file":   caFile,
+		},
+	}
+	result, err := CallHttpClient(vm, args)
+	require.NoError(t, err)
+	body := result.(map[string]interface{})["body"].(map[string]interface{})
+	assert.Equal(t, "nflow-runtime", body["client"])
+
+	// The JS-facing helpers take the same tls option
+	res := httpGetWithHeader(server.URL, map[string][]string{}, map[string]interface{}{"tls": args["tls"]})
+	require.Nil(t, res["err"])
+	assert.Equal(t, `{"client":"nflow-runtime"}`, res["body"])
+
+	// The same TLS setup reuses the pooled client
+	opts, err := parseTLSOptions(args)
+	require.NoError(t, err)
+	first, err := getHTTPClient(opts)
+	require.NoError(t, err)
+	second, err := getHTTPClient(opts)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+}
+
+func TestHTTPClient_InsecureSkipVerifyGate(t *testing.T) {
+	ResetHTTPClients()
+	defer func() {
+		AllowInsecureTLS(false)
+		ResetHTTPClients()
+	}()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`ok`))
+	}))
+	defer server.Close()
+
+	vm := goja.New()
+	args := map[string]interface{}{
+		"url": server.URL,
+		"tls": map[string]interface{}{"insecure_skip_verify": true},
+	}
+
+	AllowInsecureTLS(false)
+	_, err := CallHttpClient(vm, args)
+	assert.True(t, errors.Is(err, ErrInsecureTLSNotAllowed))
+
+	AllowInsecureTLS(true)
+	result, err := CallHttpClient(vm, args)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result.(map[string]interface{})["body"])
+}
+
+func TestHTTPClient_TLSOptionsValidation(t *testing.T) {
+	_, err := parseTLSOptions(map[string]interface{}{
+		"tls": map[string]interface{}{"cert_file": "client.crt"},
+	})
+	assert.Error(t, err)
+
+	missing := map[string]interface{}{"ca_file": filepath.Join(t.TempDir(), "missing.pem")}
+	_, err = getHTTPClient(TLSOptions{CAFile: missing["ca_file"].(string)})
+	assert.Error(t, err)
+
+	// The helpers report setup errors in err instead of panicking
+	res := httpGet("https://localhost:1", map[string]interface{}{"tls": missing})
+	assert.Error(t, res["err"].(error))
+	res = httpGet("http://bad host/")
+	assert.Error(t, res["err"].(error))
+}
+
+func TestHTTPClient_HelpersVerifyServers(t *testing.T) {
+	ResetHTTPClients()
+	defer func() {
+		AllowInsecureTLS(false)
+		ResetHTTPClients()
+	}()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`ok`))
+	}))
+	defer server.Close()
+
+	// Self-signed servers are rejected by default
+	assert.Panics(t, func() { httpGet(server.URL) })
+
+	caFile := writePEM(t, t.TempDir(), "server-ca.crt", "CERTIFICATE", server.Certificate().Raw)
+	res := httpGet(server.URL, map[string]interface{}{"tls": map[string]interface{}{"ca_file": caFile}})
+	require.Nil(t, res["err"])
+	assert.Equal(t, "ok", res["body"])
+
+	insecure := map[string]interface{}{"tls": map[string]interface{}{"insecure_skip_verify": true}}
+	AllowInsecureTLS(false)
+	res = httpPost(server.URL, "{}", insecure)
+	assert.True(t, errors.Is(res["err"].(error), ErrInsecureTLSNotAllowed))
+
+	AllowInsecureTLS(true)
+	res = httpPost(server.URL, "{}", insecure)
+	require.Nil(t, res["err"])
+	assert.Equal(t, "ok", res["body"])
+}
+
+func TestHTTPClient_Timeout(t *testing.T) {
+	ConfigureHTTPTimeout(50 * time.Millisecond)
+	defer ConfigureHTTPTimeout(0)
+
+	client, err := getHTTPClient(TLSOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 50*time.Millisecond, client.Timeout)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	assert.Panics(t, func() { httpGet(server.URL) })
+}
@@ -1,9 +1,13 @@
 package plugins
 
 import (
+	"fmt"
 	"log"
+	"net"
 	"net/mail"
 	"net/smtp"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/scorredoira/email"
@@ -20,6 +24,7 @@ type ConfigMail struct {
 var (
 	fxsMail map[string]interface{} = make(map[string]interface{})
 	config  ConfigMail
+	mailMu  sync.RWMutex
 )
 
 func (d MailPlugin) Run(c echo.Context,
@@ -37,10 +42,45 @@ func (d MailPlugin) Name() string {
 	return "mail"
 }
 
+// HealthCheck connects to the SMTP server set with mail_config and waits for
+// its greeting. Mail that is not configured is healthy.
+func (d MailPlugin) HealthCheck() error {
+	cfg := mailConfig()
+	if cfg.MailSMTP == "" {
+		return nil
+	}
+	server := net.JoinHostPort(cfg.MailSMTP, cfg.MailSMTPPort)
+	conn, err := net.DialTimeout("tcp", server, healthCheckTimeout)
+	if err != nil {
+		return fmt.Errorf("smtp server %s: %w", server, err)
+	}
+	conn.SetDeadline(time.Now().Add(healthCheckTimeout))
+	client, err := smtp.NewClient(conn, cfg.MailSMTP)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp server %s: %w", server, err)
+	}
+	client.Quit()
+	return nil
+}
+
+// mailConfig returns the mail configuration, port 25 when none is set
+func mailConfig() ConfigMail {
+	mailMu.RLock()
+	cfg := config
+	mailMu.RUnlock()
+	if cfg.MailSMTPPort == "" {
+		cfg.MailSMTPPort = "25"
+	}
+	return cfg
+}
+
 func init() {
 	fxsMail["send_mail"] = SendMail
 	fxsMail["send_mail_async"] = SendMailAsync
 	fxsMail["mail_config"] = func(smtp string, port string, from string, password string) {
+		mailMu.Lock()
+		defer mailMu.Unlock()
 		config = ConfigMail{
 			MailSMTP:     smtp,
 			MailSMTPPort: port,
@@ -51,14 +91,21 @@ func init() {
 }
 
 func sendMail(mailTo string, subject string, msg string, attach string, format string) {
+	if TestModeEnabled() {
+		RecordCall("mail", mailTo, map[string]interface{}{
+			"subject": subject,
+			"body":    msg,
+			"format":  format,
+			"attach":  attach,
+		})
+		return
+	}
 
+	config := mailConfig()
 	if config.MailPassword == "" || config.MailSMTP == "" || config.MailFrom == "" {
 		log.Println("mail disabled")
 		return
 	}
-	if config.MailSMTPPort == "" {
-		config.MailSMTPPort = "25"
-	}
 	auth := smtp.PlainAuth("", config.MailFrom, config.MailPassword, config.MailSMTP)
 
 	m := email.NewMessage(subject, msg)
@@ -83,10 +130,10 @@ func sendMail(mailTo string, subject string, msg string, attach string, format s
 
 // SendMail return function for send mail
 func SendMail(mailTo string, subject string, msg string, format string, attach string) {
-	sendMail(mailTo, subject, msg, format, attach)
+	sendMail(mailTo, subject, msg, attach, format)
 }
 
 // SendMailAsync return function for send mail async
 func SendMailAsync(mailTo string, subject string, msg string, format string, attach string) {
-	go sendMail(mailTo, subject, msg, format, attach)
+	go sendMail(mailTo, subject, msg, attach, format)
 }
@@ -0,0 +1,41 @@
+package plugins
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// healthCheckTimeout bounds the HealthCheck of the plugins reaching a server
+const healthCheckTimeout = 5 * time.Second
+
+// toInt64 reads a numeric option, which JS may pass as a number or a string
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %T", value)
+}
+
+// toFloat reads a decimal option, which JS may pass as a number or a string
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	n, err := toInt64(value)
+	return float64(n), err
+}
@@ -1,12 +1,19 @@
 package plugins
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/stretchr/testify/assert"
@@ -145,6 +152,97 @@ func TestHTTPClient_ErrorHandling(t *testing.T) {
 	}
 }
 
+func TestHTTPClient_ResponseSizeLimit(t *testing.T) {
+	ConfigureHTTPLimits(1024, 0)
+	defer ConfigureHTTPLimits(0, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 4096))
+	}))
+	defer server.Close()
+
+	vm := goja.New()
+	_, err := CallHttpClient(vm, map[string]interface{}{"url": server.URL})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrResponseTooLarge))
+
+	// The JS-facing helper reports the error instead of the truncated body
+	result := httpGet(server.URL)
+	assert.Equal(t, "", result["body"])
+	assert.True(t, errors.Is(result["err"].(error), ErrResponseTooLarge))
+}
+
+func TestHTTPClient_DownloadToFile(t *testing.T) {
+	ConfigureHTTPLimits(1024, 0)
+	defer ConfigureHTTPLimits(0, 0)
+	base := setupFilesPlugin(t, 0)
+
+	payload := bytes.Repeat([]byte("b"), 8192)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	vm := goja.New()
+	result, err := CallHttpClient(vm, map[string]interface{}{
+		"url":         server.URL,
+		"download_to": "download.bin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, float64(len(payload)), result.(map[string]interface{})["size"])
+
+	written, err := os.ReadFile(filepath.Join(base, "download.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, payload, written)
+
+	// The JS-facing helpers stream with the download_to option
+	out := httpGet(server.URL, map[string]interface{}{"download_to": "get.bin"})
+	require.Nil(t, out["err"])
+	assert.Equal(t, "get.bin", out["file"])
+	assert.Equal(t, int64(len(payload)), out["size"])
+	written, err = os.ReadFile(filepath.Join(base, "get.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, payload, written)
+
+	// Downloads above the disk limit fail without leaving a file behind
+	ConfigureHTTPLimits(1024, 100)
+	out = httpDownload(server.URL, "limited.bin")
+	assert.True(t, errors.Is(out["err"].(error), ErrResponseTooLarge))
+	_, statErr := os.Stat(filepath.Join(base, "limited.bin"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestHTTPClient_DownloadStaysInBaseDir(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	outside := filepath.Join(t.TempDir(), "outside.bin")
+
+	// Without filesystem access nothing can be downloaded
+	out := httpDownload(server.URL, outside)
+	assert.Error(t, out["err"].(error))
+	out = httpGet(server.URL, map[string]interface{}{"download_to": "file.bin"})
+	assert.Error(t, out["err"].(error))
+
+	base := setupFilesPlugin(t, 0)
+	for _, path := range []string{outside, "../outside.bin", "link/outside.bin"} {
+		if path == "link/outside.bin" {
+			require.NoError(t, os.Symlink(filepath.Dir(outside), filepath.Join(base, "link")))
+		}
+		out = httpDownload(server.URL, path)
+		assert.True(t, errors.Is(out["err"].(error), ErrPathOutsideBase), path)
+		_, err := CallHttpClient(goja.New(), map[string]interface{}{"url": server.URL, "download_to": path})
+		assert.True(t, errors.Is(err, ErrPathOutsideBase), path)
+	}
+	_, err := os.Stat(outside)
+	assert.True(t, os.IsNotExist(err))
+	assert.Zero(t, hits, "refused downloads make no request")
+}
+
 // Test Email Plugin
 func TestEmail_Send(t *testing.T) {
 	// This is a mock test since we can't actually send emails
@@ -167,6 +265,36 @@ func TestEmail_Send(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestMailPlugin_HealthCheck(t *testing.T) {
+	setMailConfig := fxsMail["mail_config"].(func(string, string, string, string))
+	defer setMailConfig("", "", "", "")
+
+	setMailConfig("", "", "", "")
+	assert.NoError(t, MailPlugin("mail").HealthCheck(), "mail is not configured")
+
+	// A server answering the SMTP greeting is healthy
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("220 localhost ESMTP\r\n"))
+			bufio.NewReader(conn).ReadString('\n') // QUIT
+			conn.Write([]byte("221 bye\r\n"))
+			conn.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(lis.Addr().String())
+	setMailConfig(host, port, "nflow@example.com", "secret")
+	assert.NoError(t, MailPlugin("mail").HealthCheck())
+
+	lis.Close()
+	assert.Error(t, MailPlugin("mail").HealthCheck(), "the SMTP server is down")
+}
+
 // Test Template Plugin
 func TestTemplate_Render(t *testing.T) {
 	vm := goja.New()
@@ -346,6 +474,56 @@ func TestRuleEngine(t *testing.T) {
 	}
 }
 
+// Plugins are initialized again on reload while requests still copy their
+// features into VMs
+func TestPlugins_InitializeWhileInUse(t *testing.T) {
+	dir := t.TempDir()
+	features := []func() map[string]interface{}{
+		FilesPlugin("files").AddFeatureJS,
+		GrpcPlugin("grpc").AddFeatureJS,
+		QueuePlugin("queue").AddFeatureJS,
+		S3Plugin("s3").AddFeatureJS,
+	}
+	defer func() {
+		FilesPlugin("files").Initialize(false, "", 0)
+		GrpcPlugin("grpc").Initialize(false, "", 0)
+		QueuePlugin("queue").Initialize(nil)
+		S3Plugin("s3").Initialize(false, S3Options{})
+	}()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, feature := range features {
+					for range feature() {
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, FilesPlugin("files").Initialize(i%2 == 0, dir, 0))
+		GrpcPlugin("grpc").Initialize(true, "", time.Second)
+		QueuePlugin("queue").Initialize(nil)
+		require.NoError(t, S3Plugin("s3").Initialize(true, S3Options{Endpoint: "http://127.0.0.1:9000", Region: "us-east-1"}))
+	}
+	close(stop)
+	wg.Wait()
+
+	assert.Contains(t, GrpcPlugin("grpc").AddFeatureJS(), "grpc_call")
+	assert.Contains(t, QueuePlugin("queue").AddFeatureJS(), "publish")
+}
+
 // Test Type Conversion Utilities
 func TestTypeConversions(t *testing.T) {
 	tests := []struct {
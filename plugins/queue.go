@@ -0,0 +1,176 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/labstack/echo/v4"
+)
+
+// Publisher sends a serialized message to a topic. Implementations exist for
+// Redis; other brokers (NATS, Kafka) plug in by implementing this interface
+// and passing it to QueuePlugin.Initialize. Publishers owning a connection
+// also implement io.Closer, they are closed by Shutdown once replaced.
+type Publisher interface {
+	Publish(topic string, message []byte) error
+	Name() string
+}
+
+// QueuePlugin exposes publish(topic, message) to workflows
+type QueuePlugin string
+
+// ErrNoPublisher is returned when publish is called without a configured backend
+var ErrNoPublisher = errors.New("no message queue publisher configured")
+
+var (
+	fxsQueue    map[string]interface{} = make(map[string]interface{})
+	publisher   Publisher
+	publisherMu sync.RWMutex
+
+	// retiredPublishers were replaced by Initialize and wait for Shutdown
+	retiredPublishers []Publisher
+)
+
+func init() {
+	fxsQueue["publish"] = Publish
+}
+
+func (d QueuePlugin) Run(c echo.Context,
+	vars map[string]string, payloadIn interface{}, dromedaryData string,
+	callback chan string,
+) (payloadOut interface{}, next string, err error) {
+	return nil, "output_1", nil
+}
+
+func (d QueuePlugin) AddFeatureJS() map[string]interface{} {
+	return fxsQueue
+}
+
+func (d QueuePlugin) Name() string {
+	return "queue"
+}
+
+// Initialize sets the backend used by publish. A nil publisher makes every
+// call fail with ErrNoPublisher.
+func (d QueuePlugin) Initialize(p Publisher) {
+	publisherMu.Lock()
+	defer publisherMu.Unlock()
+	if publisher != nil {
+		retiredPublishers = append(retiredPublishers, publisher)
+	}
+	publisher = p
+}
+
+// Shutdown closes the publishers replaced by Initialize. Calls made after
+// Initialize already use the new publisher.
+func (d QueuePlugin) Shutdown() error {
+	publisherMu.Lock()
+	retired := retiredPublishers
+	retiredPublishers = nil
+	publisherMu.Unlock()
+
+	var errs []error
+	for _, p := range retired {
+		if closer, ok := p.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing %s publisher: %w", p.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HealthCheck pings the backend of publish when it supports it. No backend
+// is healthy, publish is just not configured.
+func (d QueuePlugin) HealthCheck() error {
+	publisherMu.RLock()
+	p := publisher
+	publisherMu.RUnlock()
+	if pinger, ok := p.(interface{ Ping() error }); ok {
+		if err := pinger.Ping(); err != nil {
+			return fmt.Errorf("%s: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Publish serializes message to JSON and sends it to topic. Errors are thrown
+// as exceptions in JS. In test mode the message is recorded instead.
+func Publish(topic string, message interface{}) error {
+	if topic == "" {
+		return fmt.Errorf("publish: topic is required")
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("publish: failed to serialize message: %w", err)
+	}
+	if TestModeEnabled() {
+		RecordCall("publish", topic, map[string]interface{}{"message": string(data)})
+		return nil
+	}
+
+	publisherMu.RLock()
+	p := publisher
+	publisherMu.RUnlock()
+	if p == nil {
+		return ErrNoPublisher
+	}
+	if err := p.Publish(topic, data); err != nil {
+		return fmt.Errorf("publish to %s via %s failed: %w", topic, p.Name(), err)
+	}
+	return nil
+}
+
+// Redis publish modes
+const (
+	RedisModePubSub = "pubsub"
+	RedisModeStream = "stream"
+)
+
+// RedisPublisher publishes with PUBLISH (pub/sub) or XADD (streams)
+type RedisPublisher struct {
+	client       *redis.Client
+	mode         string
+	streamMaxLen int64
+}
+
+// NewRedisPublisher creates a Redis publisher. mode defaults to pub/sub and
+// streamMaxLen (approximate, 0 = unbounded) only applies to streams.
+func NewRedisPublisher(client *redis.Client, mode string, streamMaxLen int64) (*RedisPublisher, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis client is not configured")
+	}
+	if mode == "" {
+		mode = RedisModePubSub
+	}
+	if mode != RedisModePubSub && mode != RedisModeStream {
+		return nil, fmt.Errorf("unknown redis publish mode %q", mode)
+	}
+	return &RedisPublisher{client: client, mode: mode, streamMaxLen: streamMaxLen}, nil
+}
+
+// Publish sends message to topic
+func (p *RedisPublisher) Publish(topic string, message []byte) error {
+	if p.mode == RedisModeStream {
+		return p.client.XAdd(&redis.XAddArgs{
+			Stream:       topic,
+			MaxLenApprox: p.streamMaxLen,
+			Values:       map[string]interface{}{"message": string(message)},
+		}).Err()
+	}
+	return p.client.Publish(topic, string(message)).Err()
+}
+
+// Name returns the backend name used in error messages
+func (p *RedisPublisher) Name() string {
+	return "redis " + p.mode
+}
+
+// Ping checks the connection to Redis
+func (p *RedisPublisher) Ping() error {
+	return p.client.Ping().Err()
+}
@@ -0,0 +1,224 @@
+package plugins
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is a tiny RESP server supporting PING, PUBLISH, SUBSCRIBE and XADD
+type fakeRedis struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	subscribers map[string][]net.Conn
+	streams     map[string][]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{
+		listener:    l,
+		subscribers: make(map[string][]net.Conn),
+		streams:     make(map[string][]string),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case "SUBSCRIBE":
+			for i, channel := range args[1:] {
+				f.subscribers[channel] = append(f.subscribers[channel], conn)
+				fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n%s:%d\r\n", respBulk(channel), i+1)
+			}
+		case "PUBLISH":
+			subs := f.subscribers[args[1]]
+			for _, sub := range subs {
+				fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n%s%s", respBulk(args[1]), respBulk(args[2]))
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(subs))
+		case "XADD":
+			// XADD stream [MAXLEN ~ n] * field value
+			f.streams[args[1]] = append(f.streams[args[1]], args[len(args)-1])
+			id := strconv.Itoa(len(f.streams[args[1]])) + "-0"
+			io.WriteString(conn, respBulk(id))
+		default:
+			io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+		f.mu.Unlock()
+	}
+}
+
+func respBulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil { // $len
+			return nil, err
+		}
+		value, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(value, "\r\n")
+	}
+	return args, nil
+}
+
+func TestQueuePlugin_PublishRedisPubSub(t *testing.T) {
+	server := newFakeRedis(t)
+	client := redis.NewClient(&redis.Options{Addr: server.listener.Addr().String()})
+	defer client.Close()
+
+	pubsub := client.Subscribe("orders")
+	defer pubsub.Close()
+	_, err := pubsub.ReceiveTimeout(time.Second)
+	require.NoError(t, err)
+
+	publisher, err := NewRedisPublisher(client, RedisModePubSub, 0)
+	require.NoError(t, err)
+	QueuePlugin("queue").Initialize(publisher)
+	defer QueuePlugin("queue").Initialize(nil)
+
+	publish := QueuePlugin("queue").AddFeatureJS()["publish"].(func(string, interface{}) error)
+	require.NoError(t, publish("orders", map[string]interface{}{"id": 7, "status": "paid"}))
+
+	msg, err := pubsub.ReceiveTimeout(time.Second)
+	require.NoError(t, err)
+	require.IsType(t, &redis.Message{}, msg)
+	assert.Equal(t, "orders", msg.(*redis.Message).Channel)
+	assert.JSONEq(t, `{"id":7,"status":"paid"}`, msg.(*redis.Message).Payload)
+}
+
+func TestQueuePlugin_PublishRedisStream(t *testing.T) {
+	server := newFakeRedis(t)
+	client := redis.NewClient(&redis.Options{Addr: server.listener.Addr().String()})
+	defer client.Close()
+
+	publisher, err := NewRedisPublisher(client, RedisModeStream, 1000)
+	require.NoError(t, err)
+	QueuePlugin("queue").Initialize(publisher)
+	defer QueuePlugin("queue").Initialize(nil)
+
+	require.NoError(t, Publish("events", "created"))
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, []string{`"created"`}, server.streams["events"])
+}
+
+// failingPublisher checks that backend errors reach the caller
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(topic string, message []byte) error {
+	return errors.New("connection refused")
+}
+
+func (failingPublisher) Name() string { return "failing" }
+
+// closingPublisher records whether Shutdown closed it
+type closingPublisher struct {
+	closed bool
+}
+
+func (p *closingPublisher) Publish(topic string, message []byte) error { return nil }
+
+func (p *closingPublisher) Name() string { return "closing" }
+
+func (p *closingPublisher) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestQueuePlugin_ShutdownClosesReplacedPublishers(t *testing.T) {
+	first, second := &closingPublisher{}, &closingPublisher{}
+	QueuePlugin("queue").Initialize(first)
+	defer QueuePlugin("queue").Initialize(nil)
+	defer QueuePlugin("queue").Shutdown()
+
+	// A reload initializes the new plugins before the old ones shut down
+	QueuePlugin("queue").Initialize(second)
+	require.NoError(t, QueuePlugin("queue").Shutdown())
+	assert.True(t, first.closed)
+	assert.False(t, second.closed, "the current publisher stays open")
+	assert.NoError(t, Publish("orders", 1))
+}
+
+func TestQueuePlugin_HealthCheck(t *testing.T) {
+	QueuePlugin("queue").Initialize(nil)
+	assert.NoError(t, QueuePlugin("queue").HealthCheck(), "no backend configured")
+
+	server := newFakeRedis(t)
+	client := redis.NewClient(&redis.Options{Addr: server.listener.Addr().String(), MaxRetries: 0})
+	defer client.Close()
+	publisher, err := NewRedisPublisher(client, RedisModePubSub, 0)
+	require.NoError(t, err)
+	QueuePlugin("queue").Initialize(publisher)
+	defer QueuePlugin("queue").Initialize(nil)
+	assert.NoError(t, QueuePlugin("queue").HealthCheck())
+
+	server.listener.Close()
+	client.Close()
+	assert.Error(t, QueuePlugin("queue").HealthCheck(), "redis is down")
+}
+
+func TestQueuePlugin_Errors(t *testing.T) {
+	QueuePlugin("queue").Initialize(nil)
+	assert.True(t, errors.Is(Publish("orders", 1), ErrNoPublisher))
+
+	QueuePlugin("queue").Initialize(failingPublisher{})
+	defer QueuePlugin("queue").Initialize(nil)
+
+	err := Publish("orders", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+
+	assert.Error(t, Publish("orders", make(chan int)), "unserializable messages are rejected")
+
+	_, err = NewRedisPublisher(nil, RedisModePubSub, 0)
+	assert.Error(t, err)
+	_, err = NewRedisPublisher(redis.NewClient(&redis.Options{}), "fanout", 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,415 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// S3Plugin exposes s3_put, s3_get and s3_presign for any S3 compatible
+// storage (AWS, MinIO, Ceph...). Requests are signed with AWS Signature V4.
+type S3Plugin string
+
+// S3Options configures the object storage client
+type S3Options struct {
+	Endpoint  string // e.g. https://s3.amazonaws.com or http://minio:9000
+	Region    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // bucket in the path instead of the host name (MinIO)
+}
+
+// ErrS3Disabled is returned when network access is disabled or S3 is not configured
+var ErrS3Disabled = errors.New("s3 plugin is disabled (requires vm_pool.enable_network and [s3] endpoint)")
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3TimeFormat     = "20060102T150405Z"
+	s3DateFormat     = "20060102"
+	s3MaxPresignTime = 7 * 24 * time.Hour
+)
+
+var (
+	fxsS3      map[string]interface{} = make(map[string]interface{})
+	s3Client   *S3Client
+	s3ClientMu sync.RWMutex
+)
+
+func init() {
+	fxsS3["s3_put"] = S3Put
+	fxsS3["s3_get"] = S3Get
+	fxsS3["s3_presign"] = S3Presign
+}
+
+func (d S3Plugin) Run(c echo.Context,
+	vars map[string]string, payloadIn interface{}, dromedaryData string,
+	callback chan string,
+) (payloadOut interface{}, next string, err error) {
+	return nil, "output_1", nil
+}
+
+func (d S3Plugin) AddFeatureJS() map[string]interface{} {
+	return fxsS3
+}
+
+func (d S3Plugin) Name() string {
+	return "s3"
+}
+
+// Initialize creates the shared client. Calls fail with ErrS3Disabled when
+// enable is false or no endpoint is configured.
+func (d S3Plugin) Initialize(enable bool, opts S3Options) error {
+	var client *S3Client
+	var err error
+	if enable && opts.Endpoint != "" {
+		client, err = NewS3Client(opts)
+	}
+
+	s3ClientMu.Lock()
+	s3Client = client
+	s3ClientMu.Unlock()
+	return err
+}
+
+// HealthCheck sends a HEAD request to the endpoint. Any HTTP answer, even
+// access denied, means the storage is reachable. A disabled plugin is healthy.
+func (d S3Plugin) HealthCheck() error {
+	client, err := getS3Client()
+	if err != nil {
+		return nil
+	}
+	httpClient, err := getHTTPClient(TLSOptions{})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, client.endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3 endpoint %s: %w", client.endpoint.Host, err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+func getS3Client() (*S3Client, error) {
+	s3ClientMu.RLock()
+	defer s3ClientMu.RUnlock()
+	if s3Client == nil {
+		return nil, ErrS3Disabled
+	}
+	return s3Client, nil
+}
+
+// S3Put uploads data to bucket/key and returns {etag, size}. In test mode
+// the upload is recorded instead, with an empty etag.
+func S3Put(bucket, key, data, contentType string) (map[string]interface{}, error) {
+	if TestModeEnabled() {
+		RecordCall("s3_put", bucket+"/"+key, map[string]interface{}{
+			"content_type": contentType,
+			"size":         len(data),
+		})
+		return map[string]interface{}{"etag": "", "size": len(data)}, nil
+	}
+	client, err := getS3Client()
+	if err != nil {
+		return nil, err
+	}
+	etag, err := client.Put(bucket, key, []byte(data), contentType)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"etag": etag, "size": len(data)}, nil
+}
+
+// S3Get downloads bucket/key as a string, capped by the HTTP plugin response limit
+func S3Get(bucket, key string) (string, error) {
+	client, err := getS3Client()
+	if err != nil {
+		return "", err
+	}
+	data, err := client.Get(bucket, key)
+	return string(data), err
+}
+
+// S3Presign returns a GET URL for bucket/key valid for ttl seconds (default 900)
+func S3Presign(bucket, key string, ttl int64) (string, error) {
+	client, err := getS3Client()
+	if err != nil {
+		return "", err
+	}
+	if ttl <= 0 {
+		ttl = 900
+	}
+	return client.Presign(http.MethodGet, bucket, key, time.Duration(ttl)*time.Second)
+}
+
+// S3Client is a minimal S3 REST client
+type S3Client struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	now       func() time.Time
+}
+
+// NewS3Client validates opts and creates a client
+func NewS3Client(opts S3Options) (*S3Client, error) {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	return &S3Client{
+		endpoint:  endpoint,
+		region:    opts.Region,
+		accessKey: opts.AccessKey,
+		secretKey: opts.SecretKey,
+		pathStyle: opts.PathStyle,
+		now:       time.Now,
+	}, nil
+}
+
+// objectURL builds the URL of bucket/key for the configured addressing style
+func (s *S3Client) objectURL(bucket, key string) (*url.URL, error) {
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3 bucket and key are required")
+	}
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		u.Path = base + "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	return &u, nil
+}
+
+// Put uploads data and returns the ETag
+func (s *S3Client) Put(bucket, key string, data []byte, contentType string) (string, error) {
+	u, err := s.objectURL(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(data)
+	s.sign(req, hex.EncodeToString(sum[:]))
+
+	resp, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+// Get downloads an object
+func (s *S3Client) Get(bucket, key string) ([]byte, error) {
+	u, err := s.objectURL(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(nil)
+	s.sign(req, hex.EncodeToString(sum[:]))
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+type s3Response struct {
+	*http.Response
+	body []byte
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *S3Client) do(req *http.Request) (*s3Response, error) {
+	client, err := getHTTPClient(TLSOptions{})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readLimitedBody(resp.Body, atomic.LoadInt64(&maxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var s3err s3Error
+		if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+			return nil, fmt.Errorf("s3 %s %s: %s (%s)", req.Method, req.URL.Path, s3err.Message, s3err.Code)
+		}
+		return nil, fmt.Errorf("s3 %s %s failed with status %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return &s3Response{Response: resp, body: body}, nil
+}
+
+// sign adds the Signature V4 Authorization header to req
+func (s *S3Client) sign(req *http.Request, payloadHash string) {
+	t := s.now().UTC()
+	req.Header.Set("X-Amz-Date", t.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(headers)
+
+	scope := s.scope(t)
+	signature := s.signature(t, req.Method, req.URL, "", canonicalHeaders, signedHeaders, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+// Presign returns a URL carrying the signature in the query string
+func (s *S3Client) Presign(method, bucket, key string, ttl time.Duration) (string, error) {
+	if ttl > s3MaxPresignTime {
+		return "", fmt.Errorf("s3 presign ttl cannot exceed %s", s3MaxPresignTime)
+	}
+	u, err := s.objectURL(bucket, key)
+	if err != nil {
+		return "", err
+	}
+
+	t := s.now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(ttl/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := s3CanonicalQuery(query)
+
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(map[string]string{"host": u.Host})
+	signature := s.signature(t, method, u, canonicalQuery, canonicalHeaders, signedHeaders, s3UnsignedBody)
+
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+func (s *S3Client) scope(t time.Time) string {
+	return t.Format(s3DateFormat) + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *S3Client) signature(t time.Time, method string, u *url.URL, canonicalQuery, canonicalHeaders, signedHeaders, payloadHash string) string {
+	canonicalRequest := strings.Join([]string{
+		method,
+		s3Escape(u.Path, false),
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3TimeFormat),
+		s.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.secretKey), t.Format(s3DateFormat))
+	key = s3HMAC(key, s.region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+	return hex.EncodeToString(s3HMAC(key, stringToSign))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalHeaders returns the signed header list and the canonical header block
+func s3CanonicalHeaders(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + ":" + headers[name] + "\n")
+	}
+	return strings.Join(names, ";"), sb.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except the RFC 3986 unreserved
+// characters, and '/' unless encodeSlash is set
+func s3Escape(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,39 @@
+package plugins
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// SignHMAC returns the HMAC of payload with secret, as used by signed
+// webhooks (X-Hub-Signature-256, X-Signature...). algo is "sha256"
+// (default) or "sha1"; encoding is "hex" (default) or "base64".
+func SignHMAC(payload, secret, algo, encoding string) (string, error) {
+	var newHash func() hash.Hash
+	switch strings.ToLower(strings.ReplaceAll(algo, "-", "")) {
+	case "", "sha256":
+		newHash = sha256.New
+	case "sha1":
+		newHash = sha1.New
+	default:
+		return "", fmt.Errorf("unsupported hmac algorithm %q, use sha256 or sha1", algo)
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(payload))
+	sum := mac.Sum(nil)
+
+	switch strings.ToLower(encoding) {
+	case "", "hex":
+		return hex.EncodeToString(sum), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(sum), nil
+	}
+	return "", fmt.Errorf("unsupported signature encoding %q, use hex or base64", encoding)
+}
@@ -0,0 +1,50 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignHMAC(t *testing.T) {
+	// RFC 4231 and RFC 2202 test case 2
+	const payload, secret = "what do ya want for nothing?", "Jefe"
+
+	tests := []struct {
+		algo, encoding, want string
+	}{
+		{"", "", "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"sha256", "hex", "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"SHA-256", "base64", "W9zBRr9gdU5qBCQmCJV1x1oAPwidJzmDnexYuWTsOEM="},
+		{"sha1", "hex", "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79"},
+		{"sha1", "base64", "7/zfauXrL6LSdBbV8YTfnCWafHk="},
+	}
+	for _, tt := range tests {
+		got, err := SignHMAC(payload, secret, tt.algo, tt.encoding)
+		require.NoError(t, err, tt.algo)
+		assert.Equal(t, tt.want, got, "%s %s", tt.algo, tt.encoding)
+	}
+
+	_, err := SignHMAC(payload, secret, "md5", "")
+	assert.ErrorContains(t, err, "unsupported hmac algorithm")
+	_, err = SignHMAC(payload, secret, "sha256", "base32")
+	assert.ErrorContains(t, err, "unsupported signature encoding")
+}
+
+func TestSignHMACFromJS(t *testing.T) {
+	vm := goja.New()
+	vm.Set("sign_hmac", fxsGoja["sign_hmac"])
+
+	v, err := vm.RunString(`sign_hmac("The quick brown fox jumps over the lazy dog", "key")`)
+	require.NoError(t, err)
+	assert.Equal(t, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", v.String())
+
+	v, err = vm.RunString(`"sha1=" + sign_hmac("what do ya want for nothing?", "Jefe", "sha1")`)
+	require.NoError(t, err)
+	assert.Equal(t, "sha1=effcdf6ae5eb2fa2d27416d5f184df9c259a7c79", v.String())
+
+	_, err = vm.RunString(`sign_hmac("x", "key", "md5")`)
+	assert.ErrorContains(t, err, "unsupported hmac algorithm")
+}
@@ -2,9 +2,14 @@ package plugins
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"html/template"
 	"log"
+	"sync"
 
+	"github.com/arturoeanton/nflow-runtime/i18n"
 	"github.com/cbroglie/mustache"
 	"github.com/labstack/echo/v4"
 )
@@ -35,20 +40,141 @@ func (d TemplatePluings) Name() string {
 	return "template"
 }
 
+// Template engines accepted by RenderTemplate
+const (
+	TemplateEngineMustache = "mustache" // Mustache, no escaping of {{{ }}} and & tags
+	TemplateEngineGo       = "go"       // html/template, contextual XSS-safe escaping
+)
+
+// maxCachedTemplates bounds the parsed template cache; templates built at
+// runtime from data would otherwise grow it forever
+const maxCachedTemplates = 1000
+
+var (
+	templateCache   = make(map[string]interface{})
+	templateCacheMu sync.RWMutex
+)
+
+// goTemplateFuncs are available to the go engine and template(), along
+// with t bound to the locale of the render, see translateFunc
+var goTemplateFuncs = template.FuncMap{
+	"unescapeHTML": func(s string) template.HTML {
+		return template.HTML(s)
+	},
+}
+
+// translateFunc returns the t template function for locale, the catalog
+// default when empty: {{t "greeting" "name" .name}} resolves the key with
+// the name/value pairs after it as placeholder args
+func translateFunc(locale string) func(key string, pairs ...interface{}) string {
+	return func(key string, pairs ...interface{}) string {
+		catalog := i18n.Default()
+		target := locale
+		if target == "" {
+			target = catalog.DefaultLocale()
+		}
+		var args map[string]interface{}
+		if len(pairs) > 0 {
+			args = make(map[string]interface{}, len(pairs)/2)
+			for i := 0; i+1 < len(pairs); i += 2 {
+				args[fmt.Sprint(pairs[i])] = pairs[i+1]
+			}
+		}
+		return catalog.Translate(target, key, args)
+	}
+}
+
+// parseTemplate returns the parsed template of code for engine, cached by
+// engine and hash of the code. Go templates are cached per locale too, as
+// their t function is bound to it at parse time.
+func parseTemplate(engine, code, locale string) (interface{}, error) {
+	sum := sha256.Sum256([]byte(code))
+	key := engine + ":" + hex.EncodeToString(sum[:])
+	if engine == TemplateEngineGo {
+		key += ":" + locale
+	}
+
+	templateCacheMu.RLock()
+	parsed, ok := templateCache[key]
+	templateCacheMu.RUnlock()
+	if ok {
+		return parsed, nil
+	}
+
+	var err error
+	switch engine {
+	case TemplateEngineMustache:
+		parsed, err = mustache.ParseString(code)
+	case TemplateEngineGo:
+		parsed, err = template.New("code").Funcs(goTemplateFuncs).Funcs(template.FuncMap{"t": translateFunc(locale)}).Parse(code)
+	default:
+		return nil, fmt.Errorf("unknown template engine %q, use %s or %s", engine, TemplateEngineMustache, TemplateEngineGo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	templateCacheMu.Lock()
+	if len(templateCache) < maxCachedTemplates {
+		templateCache[key] = parsed
+	}
+	templateCacheMu.Unlock()
+	return parsed, nil
+}
+
+// renderTemplate renders code with data using engine, mustache when empty.
+// locale selects the language of {{t "key"}} in go templates.
+func renderTemplate(engine, code, locale string, data interface{}) (string, error) {
+	if engine == "" {
+		engine = TemplateEngineMustache
+	}
+	parsed, err := parseTemplate(engine, code, locale)
+	if err != nil {
+		return "", err
+	}
+	switch t := parsed.(type) {
+	case *mustache.Template:
+		return t.Render(data)
+	case *template.Template:
+		buf := new(bytes.Buffer)
+		if err := t.Execute(buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	return "", fmt.Errorf("unexpected parsed template %T", parsed)
+}
+
+// renderTemplateArgs renders args.template with args.data using
+// args.engine: "mustache" (default) or "go"; args.locale is the language of
+// {{t "key"}}
+func renderTemplateArgs(args map[string]interface{}) (string, error) {
+	code, ok := args["template"].(string)
+	if !ok {
+		return "", fmt.Errorf("template is required")
+	}
+	data := args["data"]
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	engine, _ := args["engine"].(string)
+	locale, _ := args["locale"].(string)
+	return renderTemplate(engine, code, locale, data)
+}
+
 func templater(code string, data interface{}) string {
-	t := template.Must(template.New("code").Funcs(template.FuncMap{
-		"unescapeHTML": func(s string) template.HTML {
-			return template.HTML(s)
-		},
-	}).Parse(code))
+	t, err := parseTemplate(TemplateEngineGo, code, "")
+	if err != nil {
+		panic(err)
+	}
 	buf := new(bytes.Buffer)
-	_ = t.Execute(buf, data)
+	_ = t.(*template.Template).Execute(buf, data)
 	return buf.String()
 }
 
 func mustacher(template string, data interface{}) string {
 
-	ret, err := mustache.Render(template, data)
+	ret, err := renderTemplate(TemplateEngineMustache, template, "", data)
 	if err != nil {
 		log.Println(err)
 		return ""
@@ -59,4 +185,5 @@ func mustacher(template string, data interface{}) string {
 func addFeatureTemplater() {
 	fxsTemplate["template"] = templater
 	fxsTemplate["mustache"] = mustacher
+	fxsTemplate["render_template"] = renderTemplateArgs
 }
@@ -0,0 +1,129 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/i18n"
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplateEngines(t *testing.T) {
+	vm := goja.New()
+	data := map[string]interface{}{
+		"name": `<script>alert("x")</script>`,
+		"url":  `javascript:alert(1)`,
+	}
+
+	tests := []struct {
+		name     string
+		engine   string
+		template string
+		want     string
+	}{
+		{
+			name:     "mustache escapes double braces",
+			engine:   "",
+			template: `<p>{{name}}</p>`,
+			want:     `<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>`,
+		},
+		{
+			name:     "mustache leaves triple braces raw",
+			engine:   TemplateEngineMustache,
+			template: `<p>{{{name}}}</p>`,
+			want:     `<p><script>alert("x")</script></p>`,
+		},
+		{
+			name:     "mustache does not know about attributes",
+			engine:   TemplateEngineMustache,
+			template: `<a href="{{url}}">x</a>`,
+			want:     `<a href="javascript:alert(1)">x</a>`,
+		},
+		{
+			name:     "go escapes html",
+			engine:   TemplateEngineGo,
+			template: `<p>{{.name}}</p>`,
+			want:     `<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>`,
+		},
+		{
+			name:     "go escapes by context",
+			engine:   TemplateEngineGo,
+			template: `<a href="{{.url}}">x</a>`,
+			want:     `<a href="#ZgotmplZ">x</a>`,
+		},
+		{
+			name:     "go escapes inside scripts",
+			engine:   TemplateEngineGo,
+			template: `<script>var n = {{.name}};</script>`,
+			want:     `<script>var n = "\u003cscript\u003ealert(\"x\")\u003c/script\u003e";</script>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderTemplate(vm, map[string]interface{}{
+				"template": tt.template,
+				"data":     data,
+				"engine":   tt.engine,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result)
+		})
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	vm := goja.New()
+
+	_, err := RenderTemplate(vm, map[string]interface{}{"template": "x", "engine": "jinja"})
+	assert.ErrorContains(t, err, "unknown template engine")
+
+	_, err = RenderTemplate(vm, map[string]interface{}{"template": "{{.name", "engine": TemplateEngineGo})
+	assert.Error(t, err)
+
+	_, err = RenderTemplate(vm, map[string]interface{}{"template": "{{#open}}", "engine": TemplateEngineMustache})
+	assert.Error(t, err)
+}
+
+func TestParseTemplateCache(t *testing.T) {
+	first, err := parseTemplate(TemplateEngineGo, "cached {{.}}", "")
+	require.NoError(t, err)
+	second, err := parseTemplate(TemplateEngineGo, "cached {{.}}", "")
+	require.NoError(t, err)
+	assert.Same(t, first, second, "parsed once per engine and code")
+
+	other, err := parseTemplate(TemplateEngineMustache, "cached {{.}}", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other, "engines have separate entries")
+
+	localized, err := parseTemplate(TemplateEngineGo, "cached {{.}}", "es")
+	require.NoError(t, err)
+	assert.NotSame(t, first, localized, "go templates have an entry per locale")
+}
+
+func TestRenderTemplateTranslations(t *testing.T) {
+	catalog := i18n.NewCatalog("en")
+	catalog.Add("en", map[string]string{"greeting": "Hello {name}", "title": "<Welcome>"})
+	catalog.Add("es", map[string]string{"greeting": "Hola {name}"})
+	previous := i18n.SetDefault(catalog)
+	t.Cleanup(func() { i18n.SetDefault(previous) })
+
+	vm := goja.New()
+	code := `<h1>{{t "title"}}</h1><p>{{t "greeting" "name" .name}}</p>`
+	render := func(locale string) interface{} {
+		result, err := RenderTemplate(vm, map[string]interface{}{
+			"template": code,
+			"data":     map[string]interface{}{"name": "<Ana>"},
+			"engine":   TemplateEngineGo,
+			"locale":   locale,
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	assert.Equal(t, `<h1>&lt;Welcome&gt;</h1><p>Hola &lt;Ana&gt;</p>`, render("es"))
+	assert.Equal(t, `<h1>&lt;Welcome&gt;</h1><p>Hello &lt;Ana&gt;</p>`, render(""), "the default locale without a locale arg")
+	assert.Equal(t, `<h1>&lt;Welcome&gt;</h1><p>Hola &lt;Ana&gt;</p>`, render("es"), "each locale has its own cached template")
+	assert.Equal(t, `<h1>&lt;Welcome&gt;</h1><p>Hello &lt;Ana&gt;</p>`, render("en"))
+}
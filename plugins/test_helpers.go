@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 
-	"github.com/cbroglie/mustache"
 	"github.com/dop251/goja"
 )
 
@@ -45,14 +45,55 @@ func CallHttpClient(vm *goja.Runtime, args map[string]interface{}) (interface{},
 		}
 	}
 
-	client := &http.Client{}
+	var target string
+	if path, ok := args["download_to"].(string); ok && path != "" {
+		if target, _, err = resolvePath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsOptions, err := parseTLSOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getHTTPClient(tlsOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	host := breakerHost(url)
+	if err := httpCircuitBreaker.Allow(host); err != nil {
+		return nil, err
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
+		httpCircuitBreaker.RecordFailure(host)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		httpCircuitBreaker.RecordFailure(host)
+	} else {
+		httpCircuitBreaker.RecordSuccess(host)
+	}
+
+	// Stream large downloads to disk instead of memory
+	if target != "" {
+		size, err := streamBodyToFile(resp.Body, target, atomic.LoadInt64(&maxDownloadBytes))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"statusCode": float64(resp.StatusCode),
+			"headers":    resp.Header,
+			"file":       args["download_to"],
+			"size":       float64(size),
+		}, nil
+	}
+
+	respBody, err := readLimitedBody(resp.Body, atomic.LoadInt64(&maxResponseBytes))
 	if err != nil {
 		return nil, err
 	}
@@ -87,19 +128,10 @@ func SendEmail(vm *goja.Runtime, args map[string]interface{}) (interface{}, erro
 	return nil, fmt.Errorf("SMTP not configured")
 }
 
-// RenderTemplate renders a mustache template for testing
+// RenderTemplate renders args.template with args.data for testing. The
+// engine arg selects "mustache" (default) or "go" (html/template).
 func RenderTemplate(vm *goja.Runtime, args map[string]interface{}) (interface{}, error) {
-	template, ok := args["template"].(string)
-	if !ok {
-		return nil, fmt.Errorf("template is required")
-	}
-
-	data := args["data"]
-	if data == nil {
-		data = make(map[string]interface{})
-	}
-
-	result, err := mustache.Render(template, data)
+	result, err := renderTemplateArgs(args)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxRecordedCalls bounds the calls kept while test mode is on
+const DefaultMaxRecordedCalls = 1000
+
+// RecordedCall is a side effect captured by test mode instead of being
+// performed
+type RecordedCall struct {
+	Kind   string                 `json:"kind"`   // mail, http, publish, s3_put, grpc, otp, exec or db_write
+	Target string                 `json:"target"` // recipient, URL, topic, bucket/key, target, phone, command or table
+	Data   map[string]interface{} `json:"data"`
+	Time   time.Time              `json:"time"`
+}
+
+var (
+	testMode         atomic.Bool
+	recordedMu       sync.Mutex
+	recordedCalls    []RecordedCall
+	maxRecordedCalls = DefaultMaxRecordedCalls
+)
+
+// ConfigureTestMode turns test mode on or off. While on, mail, HTTP,
+// publish, S3 uploads, gRPC, Twilio OTP, exec nodes and tracker DB writes
+// are recorded instead of performed; maxCalls <= 0 keeps the default. Turning it off drops the recorded calls.
+func ConfigureTestMode(enabled bool, maxCalls int) {
+	if maxCalls <= 0 {
+		maxCalls = DefaultMaxRecordedCalls
+	}
+	recordedMu.Lock()
+	maxRecordedCalls = maxCalls
+	if !enabled {
+		recordedCalls = nil
+	}
+	recordedMu.Unlock()
+	testMode.Store(enabled)
+}
+
+// TestModeEnabled reports whether side effects are being recorded
+func TestModeEnabled() bool {
+	return testMode.Load()
+}
+
+// RecordCall captures a side effect, dropping the oldest one when the
+// limit is reached
+func RecordCall(kind, target string, data map[string]interface{}) {
+	recordedMu.Lock()
+	defer recordedMu.Unlock()
+	if len(recordedCalls) >= maxRecordedCalls {
+		recordedCalls = recordedCalls[len(recordedCalls)-maxRecordedCalls+1:]
+	}
+	recordedCalls = append(recordedCalls, RecordedCall{
+		Kind:   kind,
+		Target: target,
+		Data:   data,
+		Time:   time.Now(),
+	})
+}
+
+// RecordedCalls returns the captured side effects of the given kind, all
+// of them when kind is empty, oldest first
+func RecordedCalls(kind string) []RecordedCall {
+	recordedMu.Lock()
+	defer recordedMu.Unlock()
+	calls := make([]RecordedCall, 0, len(recordedCalls))
+	for _, call := range recordedCalls {
+		if kind == "" || call.Kind == kind {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ClearRecordedCalls drops the captured side effects
+func ClearRecordedCalls() {
+	recordedMu.Lock()
+	recordedCalls = nil
+	recordedMu.Unlock()
+}
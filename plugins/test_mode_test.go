@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestModeRecordsHTTP(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	ConfigureTestMode(true, 0)
+	defer ConfigureTestMode(false, 0)
+
+	res := httpPostWithHeader(server.URL+"/orders", `{"id":1}`, map[string][]string{"X-Test": {"1"}})
+	assert.Equal(t, http.StatusOK, res["status_code"])
+	res = httpDownload(server.URL+"/file", t.TempDir()+"/file")
+	assert.Equal(t, http.StatusOK, res["status_code"])
+	assert.Equal(t, int32(0), hits.Load(), "no request should reach the server")
+
+	calls := RecordedCalls("http")
+	require.Len(t, calls, 2)
+	assert.Equal(t, server.URL+"/orders", calls[0].Target)
+	assert.Equal(t, http.MethodPost, calls[0].Data["method"])
+	assert.Equal(t, `{"id":1}`, calls[0].Data["body"])
+	assert.Equal(t, server.URL+"/file", calls[1].Target)
+}
+
+func TestTestModeRecordsMail(t *testing.T) {
+	previous := config
+	config = ConfigMail{MailSMTP: "127.0.0.1", MailSMTPPort: "1", MailFrom: "nflow@example.com", MailPassword: "secret"}
+	defer func() { config = previous }()
+
+	ConfigureTestMode(true, 0)
+	defer ConfigureTestMode(false, 0)
+
+	SendMail("ana@example.com", "Welcome", "<b>hi</b>", "html", "")
+
+	calls := RecordedCalls("mail")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "ana@example.com", calls[0].Target)
+	assert.Equal(t, "Welcome", calls[0].Data["subject"])
+	assert.Equal(t, "html", calls[0].Data["format"])
+	assert.Equal(t, "", calls[0].Data["attach"])
+}
+
+func TestRecordedCallsLimit(t *testing.T) {
+	ConfigureTestMode(true, 2)
+	defer ConfigureTestMode(false, 0)
+
+	RecordCall("http", "a", nil)
+	RecordCall("mail", "b", nil)
+	RecordCall("http", "c", nil)
+
+	calls := RecordedCalls("")
+	require.Len(t, calls, 2)
+	assert.Equal(t, "b", calls[0].Target)
+	assert.Equal(t, "c", calls[1].Target)
+	assert.Len(t, RecordedCalls("mail"), 1)
+
+	ClearRecordedCalls()
+	assert.Empty(t, RecordedCalls(""))
+}
+
+func TestTestModeRecordsServiceCalls(t *testing.T) {
+	setupGrpcPlugin(t, true, false)
+	ConfigureTestMode(true, 0)
+	defer ConfigureTestMode(false, 0)
+
+	// No publisher, S3 endpoint or gRPC server is configured: nothing is sent
+	require.NoError(t, Publish("orders", map[string]interface{}{"id": 1}))
+	put, err := S3Put("reports", "today.txt", "hello", "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, 5, put["size"])
+	result, err := CallGrpc("localhost:1", "demo.Greeter/SayHello", map[string]interface{}{"name": "x"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, result["response"])
+
+	calls := RecordedCalls("")
+	require.Len(t, calls, 3)
+	assert.Equal(t, "publish", calls[0].Kind)
+	assert.Equal(t, "orders", calls[0].Target)
+	assert.JSONEq(t, `{"id":1}`, calls[0].Data["message"].(string))
+	assert.Equal(t, "s3_put", calls[1].Kind)
+	assert.Equal(t, "reports/today.txt", calls[1].Target)
+	assert.Equal(t, "grpc", calls[2].Kind)
+	assert.Equal(t, "demo.Greeter/SayHello", calls[2].Data["method"])
+}
@@ -1,6 +1,8 @@
 package plugins
 
 import (
+	"sync"
+
 	"github.com/labstack/echo/v4"
 	"github.com/twilio/twilio-go"
 	openapi "github.com/twilio/twilio-go/rest/verify/v2"
@@ -18,8 +20,14 @@ var (
 	fxsTwilio    map[string]interface{} = make(map[string]interface{})
 	configTwilio ConfigTwilio
 	client       *twilio.RestClient
+	twilioMu     sync.RWMutex
 )
 
+func init() {
+	fxsTwilio["send_otp"] = sendOtp
+	fxsTwilio["check_otp"] = checkOtp
+}
+
 func (d TwilioPlugin) Run(c echo.Context,
 	vars map[string]string, payloadIn interface{}, dromaderyData string,
 	callback chan string,
@@ -33,6 +41,8 @@ func (d TwilioPlugin) Name() string {
 	return "twilio"
 }
 func (d TwilioPlugin) Initialize(enable bool, accoundSid, authToken, serviceSid string) {
+	twilioMu.Lock()
+	defer twilioMu.Unlock()
 	configTwilio = ConfigTwilio{
 		AccountSid:      accoundSid,
 		AuthToken:       authToken,
@@ -43,10 +53,21 @@ func (d TwilioPlugin) Initialize(enable bool, accoundSid, authToken, serviceSid
 		Username: configTwilio.AccountSid,
 		Password: configTwilio.AuthToken,
 	})
-	fxsTwilio["send_otp"] = sendOtp
-	fxsTwilio["check_otp"] = checkOtp
 }
+
+// twilioClient returns the configuration and client of the last Initialize
+func twilioClient() (ConfigTwilio, *twilio.RestClient) {
+	twilioMu.RLock()
+	defer twilioMu.RUnlock()
+	return configTwilio, client
+}
+
 func sendOtp(to string) bool {
+	if TestModeEnabled() {
+		RecordCall("otp", to, map[string]interface{}{"action": "send"})
+		return true
+	}
+	configTwilio, client := twilioClient()
 	if !configTwilio.EnableTwilio {
 		return true
 	}
@@ -57,7 +78,14 @@ func sendOtp(to string) bool {
 	status := err == nil
 	return status
 }
+
+// checkOtp accepts any code in test mode, like with Twilio disabled
 func checkOtp(to string, code string) bool {
+	if TestModeEnabled() {
+		RecordCall("otp", to, map[string]interface{}{"action": "check", "code": code})
+		return true
+	}
+	configTwilio, client := twilioClient()
 	if !configTwilio.EnableTwilio {
 		return true
 	}
@@ -1,9 +1,11 @@
 package process
 
 import (
+	"errors"
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/labstack/echo/v4"
 	"golang.org/x/net/websocket"
@@ -16,15 +18,27 @@ type Process struct {
 	Type           string
 	Payload        interface{}
 	Killeable      bool
+	Endpoint       string // Request path that started the workflow
+	FlowName       string
+	Username       string          // From the session profile, empty for anonymous requests
+	Goroutines     int64           // Spawned for the request, counted on the process the request started
 	Callback       chan string     `json:"-"`
 	FlagExit       int             `json:"-"`
 	Ws             *websocket.Conn `json:"-"`
 	mu             sync.Mutex      `json:"-"` // Mutex para proteger campos modificables
+	parent         *Process        // Process the request started, nil when it is this one
 }
 
+// ErrProcessLimitReached is returned by TryCreateProcess when the limit of
+// active processes is reached
+var ErrProcessLimitReached = errors.New("active process limit reached")
+
 var (
 	// repo es la instancia global del repository
 	repo ProcessRepository
+
+	// rejected cuenta los procesos rechazados por el límite
+	rejected atomic.Uint64
 )
 
 // InitializeRepository inicializa el repository de procesos
@@ -142,6 +156,41 @@ func CreateProcessWithCallback(wid string) *Process {
 	return p
 }
 
+// TryCreateProcess creates a process unless limit processes are already
+// active (limit <= 0 means no limit). Rejections are counted, see Rejected.
+func TryCreateProcess(wid string, limit int) (*Process, error) {
+	return tryCreate(&Process{
+		UUID:      wid,
+		State:     "wait",
+		Killeable: true,
+	}, limit)
+}
+
+// TryCreateProcessWithCallback is TryCreateProcess for a process with a
+// callback channel
+func TryCreateProcessWithCallback(wid string, limit int) (*Process, error) {
+	return tryCreate(&Process{
+		UUID:      wid,
+		State:     "wait",
+		Callback:  make(chan string, 1), // Buffer de 1 para evitar bloqueos
+		Killeable: true,
+	}, limit)
+}
+
+func tryCreate(p *Process, limit int) (*Process, error) {
+	if !GetRepository().SetIfBelow(p.UUID, p, limit) {
+		rejected.Add(1)
+		return nil, ErrProcessLimitReached
+	}
+	return p, nil
+}
+
+// Rejected returns how many processes were rejected by the limit of active
+// processes since startup
+func Rejected() uint64 {
+	return rejected.Load()
+}
+
 func Ps() string {
 	var b strings.Builder
 
@@ -169,6 +218,84 @@ func GetProcessList() map[string]*Process {
 	return GetRepository().GetAll()
 }
 
+// Filter selects processes by their tags; empty fields match any process
+type Filter struct {
+	Endpoint string // Path prefix: /orders matches /orders and /orders/42
+	Username string
+	State    string
+	FlowName string
+}
+
+// FilterProcesses returns the active processes matching filter
+func FilterProcesses(filter Filter) map[string]*Process {
+	processes := GetRepository().GetAll()
+	for wid, p := range processes {
+		if !p.matches(filter) {
+			delete(processes, wid)
+		}
+	}
+	return processes
+}
+
+// SetTags records the request a process runs for, used by FilterProcesses
+func (p *Process) SetTags(endpoint, flowName, username string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Endpoint = endpoint
+	p.FlowName = flowName
+	p.Username = username
+}
+
+// SetParent makes the goroutines p spawns count for the request of
+// parent, for processes forked by a workflow
+func (p *Process) SetParent(parent *Process) {
+	root := parent.root()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.parent = root
+}
+
+// root returns the process the request of p started
+func (p *Process) root() *Process {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.parent != nil {
+		return p.parent
+	}
+	return p
+}
+
+// AddGoroutine counts a goroutine spawned for the request of p and
+// returns how many the request has spawned
+func (p *Process) AddGoroutine() int64 {
+	root := p.root()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.Goroutines++
+	return root.Goroutines
+}
+
+// SpawnedGoroutines returns how many goroutines the request of p has
+// spawned
+func (p *Process) SpawnedGoroutines() int64 {
+	root := p.root()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	return root.Goroutines
+}
+
+func (p *Process) matches(filter Filter) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if filter.Endpoint != "" && p.Endpoint != filter.Endpoint &&
+		!strings.HasPrefix(p.Endpoint, strings.TrimSuffix(filter.Endpoint, "/")+"/") {
+		return false
+	}
+	return (filter.Username == "" || p.Username == filter.Username) &&
+		(filter.State == "" || p.State == filter.State) &&
+		(filter.FlowName == "" || p.FlowName == filter.FlowName)
+}
+
 func (p *Process) SendCallback(data string) {
 	if p.Callback != nil {
 		select {
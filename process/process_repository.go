@@ -9,6 +9,7 @@ type ProcessRepository interface {
 	Get(wid string) (*Process, bool)
 	GetAll() map[string]*Process
 	Set(wid string, process *Process)
+	SetIfBelow(wid string, process *Process, limit int) bool
 	Delete(wid string)
 	Exists(wid string) bool
 	GetAllKeys() []string
@@ -58,6 +59,19 @@ func (r *processRepository) Set(wid string, process *Process) {
 	r.processes[wid] = process
 }
 
+// SetIfBelow agrega el proceso solo si hay menos de limit procesos;
+// limit <= 0 no tiene límite. Devuelve false si lo rechazó.
+func (r *processRepository) SetIfBelow(wid string, process *Process, limit int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.processes[wid]; !exists && limit > 0 && len(r.processes) >= limit {
+		return false
+	}
+	r.processes[wid] = process
+	return true
+}
+
 // Delete elimina un proceso
 func (r *processRepository) Delete(wid string) {
 	r.mu.Lock()
@@ -1,6 +1,8 @@
 package process
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -184,3 +186,57 @@ func TestWKillConcurrency(t *testing.T) {
 		}
 	}
 }
+
+func TestTryCreateProcessLimit(t *testing.T) {
+	limit := len(GetProcessList()) + 3
+	rejectedBefore := Rejected()
+
+	var created []*Process
+	defer func() {
+		for _, p := range created {
+			p.Close()
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		p, err := TryCreateProcess(fmt.Sprintf("limit-%d", i), limit)
+		if err != nil {
+			t.Fatalf("Process %d should be created: %v", i, err)
+		}
+		created = append(created, p)
+	}
+
+	if _, err := TryCreateProcessWithCallback("limit-rejected", limit); !errors.Is(err, ErrProcessLimitReached) {
+		t.Errorf("Expected ErrProcessLimitReached, got %v", err)
+	}
+	if _, exists := GetProcessID("limit-rejected"); exists {
+		t.Error("Rejected process should not be registered")
+	}
+	if Rejected() != rejectedBefore+1 {
+		t.Errorf("Expected 1 rejection, got %d", Rejected()-rejectedBefore)
+	}
+
+	// Replacing an active process does not need a free slot
+	if _, err := TryCreateProcess("limit-0", limit); err != nil {
+		t.Errorf("Existing process should be replaced: %v", err)
+	}
+
+	// Capacity frees when a process ends
+	created[0].Close()
+	p, err := TryCreateProcessWithCallback("limit-3", limit)
+	if err != nil {
+		t.Fatalf("Process should be created once one ended: %v", err)
+	}
+	created = append(created, p)
+	if p.Callback == nil {
+		t.Error("Callback channel should be created")
+	}
+
+	// No limit
+	for i := 0; i < 10; i++ {
+		p, err := TryCreateProcess(fmt.Sprintf("unlimited-%d", i), 0)
+		if err != nil {
+			t.Fatalf("Process should be created without limit: %v", err)
+		}
+		created = append(created, p)
+	}
+}
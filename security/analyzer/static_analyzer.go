@@ -155,6 +155,30 @@ func (sa *StaticAnalyzer) AnalyzeScript(script string) ([]SecurityIssue, error)
 	return issues, nil
 }
 
+// shellMetacharacters matches characters with special meaning to a shell
+var shellMetacharacters = regexp.MustCompile(`[;&|<>$\\\n\r()*?]|` + "`")
+
+// AnalyzeCommand checks a command and its arguments before they are executed.
+// Commands never run through a shell, but shell metacharacters usually mean
+// the caller expects one, so they are flagged as high severity.
+func AnalyzeCommand(command string, args []string) []SecurityIssue {
+	var issues []SecurityIssue
+	for i, part := range append([]string{command}, args...) {
+		loc := shellMetacharacters.FindStringIndex(part)
+		if loc == nil {
+			continue
+		}
+		issues = append(issues, SecurityIssue{
+			Type:        "shell_metacharacters",
+			Severity:    SeverityHigh,
+			Description: fmt.Sprintf("Shell metacharacter %q in command argument %d", part[loc[0]:loc[1]], i),
+			Column:      loc[0] + 1,
+			Snippet:     part,
+		})
+	}
+	return issues
+}
+
 // AddPattern adds a custom security pattern to the analyzer
 // This allows extending the analyzer without modifying the code
 func (sa *StaticAnalyzer) AddPattern(name, pattern, severity, description string) error {
@@ -419,6 +419,28 @@ func TestThreadSafety(t *testing.T) {
 }
 
 // Benchmark tests
+func TestAnalyzeCommand(t *testing.T) {
+	safe := AnalyzeCommand("git", []string{"log", "--oneline", "-n", "5"})
+	if len(safe) != 0 {
+		t.Errorf("Expected no issues for plain arguments, got %v", safe)
+	}
+
+	dangerous := [][]string{
+		{"echo", "hello; rm -rf /"},
+		{"echo", "$(whoami)"},
+		{"echo", "`id`"},
+		{"cat", "a | b"},
+		{"ls", "*.txt"},
+		{"echo", "line\nnext"},
+	}
+	for _, args := range dangerous {
+		issues := AnalyzeCommand(args[0], args[1:])
+		if !HasHighSeverityIssues(issues) {
+			t.Errorf("Expected shell metacharacters to be flagged in %q", args)
+		}
+	}
+}
+
 func BenchmarkAnalyzeScript_Small(b *testing.B) {
 	analyzer := NewStaticAnalyzer()
 	script := `console.log("Hello world");`
@@ -4,10 +4,15 @@ package interceptor
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/arturoeanton/nflow-runtime/security/encryption"
 )
@@ -26,6 +31,20 @@ const (
 	PatternCustom     PatternType = "custom"
 )
 
+// DefaultMaxDepth is the nesting ProcessResponse processes when
+// Config.MaxDepth is not set
+const DefaultMaxDepth = 100
+
+// DefaultContextWindow is how many bytes around a match are searched for
+// context keywords when Config.ContextWindow is not set
+const DefaultContextWindow = 30
+
+// Markers replacing the values ProcessResponse does not process
+const (
+	MaxDepthMarker = "[TRUNCATED:max_depth]" // Map or slice nested deeper than the max depth
+	CycleMarker    = "[TRUNCATED:cycle]"     // Map containing itself
+)
+
 // SensitivePattern defines a pattern for detecting sensitive data
 type SensitivePattern struct {
 	Type       PatternType
@@ -34,6 +53,21 @@ type SensitivePattern struct {
 	MinLength  int            // Minimum length to consider
 	MaxLength  int            // Maximum length to consider (0 = no limit)
 	Confidence float32        // Confidence threshold (0.0-1.0)
+	Priority   int            // Higher priorities are matched first and keep overlapping text
+
+	// ContextKeywords, when set, must appear within ContextWindow bytes
+	// before or after a match, case-insensitively, for it to count
+	ContextKeywords []string
+	ContextWindow   int
+}
+
+// priorityKey names the pattern in Config.PatternPriorities: the type of
+// built-in patterns, the name of custom ones
+func (p *SensitivePattern) priorityKey() string {
+	if p.Type == PatternCustom {
+		return p.Name
+	}
+	return string(p.Type)
 }
 
 // Detection represents a found sensitive data instance
@@ -55,12 +89,16 @@ type SensitiveDataInterceptor struct {
 	enabled        bool
 	encryptInPlace bool   // Replace values in-place vs metadata
 	metadataKey    string // Key to store encryption metadata
+	maxDepth       int    // Nesting processed, deeper values are truncated
+	priorities     map[string]int
+	contextRules   map[string][]string
+	contextWindow  int
 
 	// Performance optimization
 	compiledPatterns []*SensitivePattern // Pre-sorted by performance
 	patternCache     sync.Map            // Cache compiled patterns
 
-	// Metrics
+	// Metrics, updated atomically
 	detectionCount uint64
 	encryptCount   uint64
 	mu             sync.RWMutex
@@ -72,6 +110,18 @@ type Config struct {
 	EncryptInPlace bool
 	MetadataKey    string
 	CustomPatterns map[string]string // name -> regex pattern
+	MaxDepth       int               // Nesting processed by ProcessResponse (default: 100)
+
+	// PatternPriorities overrides the priority of built-in patterns, by
+	// type, and sets the one of custom patterns, by name (default: 0).
+	// Built-in: jwt 60, api_key 50, credit_card 40, ssn 30, email 20, phone 10.
+	PatternPriorities map[string]int
+
+	// ContextKeywords requires one of the keywords near the matches of a
+	// pattern, by type or custom pattern name, e.g. "phone": {"tel", "call"}
+	// so order numbers are not taken for phones (default: none)
+	ContextKeywords map[string][]string
+	ContextWindow   int // Bytes searched around a match (default: 30)
 }
 
 // NewSensitiveDataInterceptor creates a new interceptor
@@ -91,10 +141,23 @@ func NewSensitiveDataInterceptor(encService *encryption.EncryptionService, confi
 		enabled:           config.Enabled,
 		encryptInPlace:    config.EncryptInPlace,
 		metadataKey:       config.MetadataKey,
+		maxDepth:          config.MaxDepth,
+		priorities:        config.PatternPriorities,
+		contextRules:      config.ContextKeywords,
+		contextWindow:     config.ContextWindow,
+	}
+	if interceptor.maxDepth <= 0 {
+		interceptor.maxDepth = DefaultMaxDepth
+	}
+	if interceptor.contextWindow <= 0 {
+		interceptor.contextWindow = DefaultContextWindow
 	}
 
 	// Initialize default patterns
 	interceptor.initializeDefaultPatterns()
+	for _, p := range interceptor.patterns {
+		interceptor.applyPatternConfig(p)
+	}
 
 	// Add custom patterns from config
 	for name, pattern := range config.CustomPatterns {
@@ -102,11 +165,28 @@ func NewSensitiveDataInterceptor(encService *encryption.EncryptionService, confi
 	}
 
 	// Compile patterns for performance
+	interceptor.mu.Lock()
 	interceptor.compilePatterns()
+	interceptor.mu.Unlock()
 
 	return interceptor
 }
 
+// applyPatternConfig sets the configured priority and context rules of p
+func (sdi *SensitiveDataInterceptor) applyPatternConfig(p *SensitivePattern) {
+	key := p.priorityKey()
+	if priority, ok := sdi.priorities[key]; ok {
+		p.Priority = priority
+	}
+	if keywords := sdi.contextRules[key]; len(keywords) > 0 {
+		p.ContextKeywords = make([]string, len(keywords))
+		for i, keyword := range keywords {
+			p.ContextKeywords[i] = strings.ToLower(keyword)
+		}
+		p.ContextWindow = sdi.contextWindow
+	}
+}
+
 // initializeDefaultPatterns sets up common sensitive data patterns
 func (sdi *SensitiveDataInterceptor) initializeDefaultPatterns() {
 	sdi.patterns = map[PatternType]*SensitivePattern{
@@ -117,6 +197,7 @@ func (sdi *SensitiveDataInterceptor) initializeDefaultPatterns() {
 			MinLength:  5,
 			MaxLength:  254,
 			Confidence: 0.9,
+			Priority:   20,
 		},
 		PatternPhone: {
 			Type: PatternPhone,
@@ -126,6 +207,7 @@ func (sdi *SensitiveDataInterceptor) initializeDefaultPatterns() {
 			MinLength:  10,
 			MaxLength:  20,
 			Confidence: 0.8,
+			Priority:   10,
 		},
 		PatternSSN: {
 			Type:       PatternSSN,
@@ -134,6 +216,7 @@ func (sdi *SensitiveDataInterceptor) initializeDefaultPatterns() {
 			MinLength:  11,
 			MaxLength:  11,
 			Confidence: 0.95,
+			Priority:   30,
 		},
 		PatternCreditCard: {
 			Type: PatternCreditCard,
@@ -143,6 +226,7 @@ func (sdi *SensitiveDataInterceptor) initializeDefaultPatterns() {
 			MinLength:  13,
 			MaxLength:  19,
 			Confidence: 0.7,
+			Priority:   40,
 		},
 		PatternAPIKey: {
 			Type: PatternAPIKey,
@@ -152,6 +236,7 @@ func (sdi *SensitiveDataInterceptor) initializeDefaultPatterns() {
 			MinLength:  16,
 			MaxLength:  256,
 			Confidence: 0.85,
+			Priority:   50,
 		},
 		PatternJWT: {
 			Type:       PatternJWT,
@@ -160,15 +245,14 @@ func (sdi *SensitiveDataInterceptor) initializeDefaultPatterns() {
 			MinLength:  30,
 			MaxLength:  0,
 			Confidence: 0.9,
+			Priority:   60,
 		},
 	}
 }
 
 // compilePatterns optimizes patterns for better performance
+// MUST be called with sdi.mu already locked
 func (sdi *SensitiveDataInterceptor) compilePatterns() {
-	sdi.mu.Lock()
-	defer sdi.mu.Unlock()
-
 	// Combine all patterns
 	allPatterns := make([]*SensitivePattern, 0, len(sdi.patterns)+len(sdi.customPatterns))
 
@@ -180,19 +264,26 @@ func (sdi *SensitiveDataInterceptor) compilePatterns() {
 		allPatterns = append(allPatterns, p)
 	}
 
-	// Sort by expected performance (simple patterns first)
-	// In real implementation, we'd sort by pattern complexity
+	// Highest priority first, ties by name, so overlapping matches
+	// always resolve the same way
+	sort.Slice(allPatterns, func(i, j int) bool {
+		if allPatterns[i].Priority != allPatterns[j].Priority {
+			return allPatterns[i].Priority > allPatterns[j].Priority
+		}
+		return allPatterns[i].priorityKey() < allPatterns[j].priorityKey()
+	})
 	sdi.compiledPatterns = allPatterns
 }
 
 // ProcessResponse intercepts and processes response data
 func (sdi *SensitiveDataInterceptor) ProcessResponse(data interface{}) (interface{}, error) {
-	if !sdi.enabled || data == nil {
+	if !sdi.IsEnabled() || data == nil {
 		return data, nil
 	}
 
-	// Convert to JSON for processing
-	jsonData, err := json.Marshal(data)
+	// Convert to JSON for processing, without the values nested too deep
+	// or cycling back to their parents
+	jsonData, err := json.Marshal(limitDepth(reflect.ValueOf(data), 1, sdi.maxDepth, make(map[uintptr]bool)))
 	if err != nil {
 		return data, fmt.Errorf("failed to marshal data: %w", err)
 	}
@@ -205,18 +296,67 @@ func (sdi *SensitiveDataInterceptor) ProcessResponse(data interface{}) (interfac
 	return sdi.processWithMetadata(jsonData)
 }
 
+// ProcessResponses processes many payloads like ProcessResponse, up to
+// GOMAXPROCS at a time sharing the compiled patterns. Results keep the
+// order of data; a payload that fails is returned unchanged and its error
+// joined into the returned error.
+func (sdi *SensitiveDataInterceptor) ProcessResponses(data []interface{}) ([]interface{}, error) {
+	if !sdi.IsEnabled() || len(data) == 0 {
+		return data, nil
+	}
+
+	results := make([]interface{}, len(data))
+	errs := make([]error, len(data))
+	process := func(i int) {
+		result, err := sdi.ProcessResponse(data[i])
+		if err != nil {
+			result = data[i]
+			errs[i] = fmt.Errorf("payload %d: %w", i, err)
+		}
+		results[i] = result
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(data) {
+		workers = len(data)
+	}
+	if workers == 1 {
+		for i := range data {
+			process(i)
+		}
+		return results, errors.Join(errs...)
+	}
+
+	// Workers take the next payload as they finish, so a few large
+	// payloads do not hold back the rest
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(data) {
+					return
+				}
+				process(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
 // processInPlace replaces sensitive data with encrypted versions
 func (sdi *SensitiveDataInterceptor) processInPlace(jsonData []byte) (interface{}, error) {
 	strData := string(jsonData)
 	detections := sdi.detectSensitiveData(strData)
 
-	// Sort detections by position (reverse order to maintain positions)
-	// This ensures we replace from end to start
-	sortDetectionsByPosition(detections, strData)
-
-	// Replace each detection with encrypted version
-	for i := len(detections) - 1; i >= 0; i-- {
-		detection := detections[i]
+	// Replace each detection with encrypted version, in priority order.
+	// Replacements search for the quoted value, positions do not matter.
+	for _, detection := range detections {
 
 		encrypted, err := sdi.encryptionService.Encrypt(detection.Value)
 		if err != nil {
@@ -229,9 +369,7 @@ func (sdi *SensitiveDataInterceptor) processInPlace(jsonData []byte) (interface{
 		// Replace in string (this is simplified, real implementation would handle JSON properly)
 		strData = strings.Replace(strData, fmt.Sprintf(`"%s"`, detection.Value), replacement, 1)
 
-		sdi.mu.Lock()
-		sdi.encryptCount++
-		sdi.mu.Unlock()
+		atomic.AddUint64(&sdi.encryptCount, 1)
 	}
 
 	// Parse back to interface{}
@@ -272,9 +410,7 @@ func (sdi *SensitiveDataInterceptor) processWithMetadata(jsonData []byte) (inter
 		detection.Encrypted = encrypted
 		metadata = append(metadata, detection)
 
-		sdi.mu.Lock()
-		sdi.encryptCount++
-		sdi.mu.Unlock()
+		atomic.AddUint64(&sdi.encryptCount, 1)
 	}
 
 	// Add metadata if any sensitive data was found
@@ -285,23 +421,30 @@ func (sdi *SensitiveDataInterceptor) processWithMetadata(jsonData []byte) (inter
 	return result, nil
 }
 
-// detectSensitiveData finds all sensitive data in the input
+// detectSensitiveData finds all sensitive data in the input, in pattern
+// priority order. Text matched by a pattern is not matched again by lower
+// priority ones.
 func (sdi *SensitiveDataInterceptor) detectSensitiveData(data string) []Detection {
 	var detections []Detection
+	var claimed [][2]int
 
 	sdi.mu.RLock()
 	patterns := sdi.compiledPatterns
 	sdi.mu.RUnlock()
 
 	for _, pattern := range patterns {
-		matches := pattern.Pattern.FindAllStringSubmatch(data, -1)
+		matches := pattern.Pattern.FindAllStringSubmatchIndex(data, -1)
 
 		for _, match := range matches {
-			value := match[0]
+			start, end := match[0], match[1]
 			// For API keys, use the captured group if available
-			if pattern.Type == PatternAPIKey && len(match) > 1 && match[1] != "" {
-				value = match[1]
+			if pattern.Type == PatternAPIKey && len(match) > 3 && match[2] >= 0 && match[3] > match[2] {
+				start, end = match[2], match[3]
+			}
+			if overlaps(claimed, start, end) {
+				continue
 			}
+			value := data[start:end]
 
 			// Check length constraints
 			if pattern.MinLength > 0 && len(value) < pattern.MinLength {
@@ -315,6 +458,9 @@ func (sdi *SensitiveDataInterceptor) detectSensitiveData(data string) []Detectio
 			if pattern.Type == PatternCreditCard && !isValidCreditCard(value) {
 				continue
 			}
+			if !hasContext(data, start, end, pattern.ContextKeywords, pattern.ContextWindow) {
+				continue
+			}
 
 			detections = append(detections, Detection{
 				Type:       pattern.Type,
@@ -322,10 +468,9 @@ func (sdi *SensitiveDataInterceptor) detectSensitiveData(data string) []Detectio
 				Confidence: pattern.Confidence,
 				Path:       "", // Would need JSON path tracking for real implementation
 			})
+			claimed = append(claimed, [2]int{start, end})
 
-			sdi.mu.Lock()
-			sdi.detectionCount++
-			sdi.mu.Unlock()
+			atomic.AddUint64(&sdi.detectionCount, 1)
 		}
 	}
 
@@ -342,7 +487,7 @@ func (sdi *SensitiveDataInterceptor) AddCustomPattern(name, pattern string) erro
 	sdi.mu.Lock()
 	defer sdi.mu.Unlock()
 
-	sdi.customPatterns[name] = &SensitivePattern{
+	custom := &SensitivePattern{
 		Type:       PatternCustom,
 		Name:       name,
 		Pattern:    compiled,
@@ -350,6 +495,8 @@ func (sdi *SensitiveDataInterceptor) AddCustomPattern(name, pattern string) erro
 		MaxLength:  0,
 		Confidence: 0.8,
 	}
+	sdi.applyPatternConfig(custom)
+	sdi.customPatterns[name] = custom
 
 	// Recompile patterns
 	sdi.compilePatterns()
@@ -378,19 +525,22 @@ func (sdi *SensitiveDataInterceptor) SetEnabled(enabled bool) {
 	sdi.enabled = enabled
 }
 
-// GetMetrics returns detection and encryption counts
-func (sdi *SensitiveDataInterceptor) GetMetrics() (detectionCount, encryptCount uint64) {
+// IsEnabled returns whether the interceptor is enabled
+func (sdi *SensitiveDataInterceptor) IsEnabled() bool {
 	sdi.mu.RLock()
 	defer sdi.mu.RUnlock()
-	return sdi.detectionCount, sdi.encryptCount
+	return sdi.enabled
+}
+
+// GetMetrics returns detection and encryption counts
+func (sdi *SensitiveDataInterceptor) GetMetrics() (detectionCount, encryptCount uint64) {
+	return atomic.LoadUint64(&sdi.detectionCount), atomic.LoadUint64(&sdi.encryptCount)
 }
 
 // ResetMetrics resets the metrics counters
 func (sdi *SensitiveDataInterceptor) ResetMetrics() {
-	sdi.mu.Lock()
-	defer sdi.mu.Unlock()
-	sdi.detectionCount = 0
-	sdi.encryptCount = 0
+	atomic.StoreUint64(&sdi.detectionCount, 0)
+	atomic.StoreUint64(&sdi.encryptCount, 0)
 }
 
 // Helper functions
@@ -416,10 +566,80 @@ func isValidCreditCard(number string) bool {
 	return true
 }
 
-// sortDetectionsByPosition sorts detections by their position in the string
-func sortDetectionsByPosition(detections []Detection, data string) {
-	// Simple implementation - in production would track actual positions
-	// This is a placeholder that doesn't actually sort
+// hasContext reports whether one of the lowercase keywords appears within
+// window bytes before or after data[start:end]. No keywords means no
+// context is required.
+func hasContext(data string, start, end int, keywords []string, window int) bool {
+	if len(keywords) == 0 {
+		return true
+	}
+	before := strings.ToLower(data[max(0, start-window):start])
+	after := strings.ToLower(data[end:min(len(data), end+window)])
+	for _, keyword := range keywords {
+		if strings.Contains(before, keyword) || strings.Contains(after, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether [start, end) overlaps one of the ranges
+func overlaps(ranges [][2]int, start, end int) bool {
+	for _, r := range ranges {
+		if start < r[1] && r[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// limitDepth copies the maps and slices of value down to maxDepth. Deeper
+// ones are replaced by MaxDepthMarker and maps containing themselves by
+// CycleMarker. Other values are returned as they are.
+func limitDepth(value reflect.Value, depth, maxDepth int, ancestors map[uintptr]bool) interface{} {
+	for value.Kind() == reflect.Interface && !value.IsNil() {
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String || value.IsNil() {
+			return value.Interface()
+		}
+		id := value.Pointer()
+		if ancestors[id] {
+			return CycleMarker
+		}
+		if depth > maxDepth {
+			return MaxDepthMarker
+		}
+		ancestors[id] = true
+		defer delete(ancestors, id)
+
+		result := make(map[string]interface{}, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			result[iter.Key().String()] = limitDepth(iter.Value(), depth+1, maxDepth, ancestors)
+		}
+		return result
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Interface() // []byte is encoded as a string
+		}
+		if depth > maxDepth {
+			return MaxDepthMarker
+		}
+		result := make([]interface{}, value.Len())
+		for i := range result {
+			result[i] = limitDepth(value.Index(i), depth+1, maxDepth, ancestors)
+		}
+		return result
+	default:
+		return value.Interface()
+	}
 }
 
 // ProcessMap processes a map directly (useful for middleware integration)
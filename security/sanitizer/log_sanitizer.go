@@ -5,6 +5,7 @@ package sanitizer
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
@@ -27,6 +28,16 @@ const (
 	TypeAccessToken SensitiveDataType = "access_token"
 )
 
+// DefaultMaxDepth is the nesting SanitizeMap processes when Config.MaxDepth
+// is not set
+const DefaultMaxDepth = 100
+
+// Markers replacing the values SanitizeMap does not process
+const (
+	MaxDepthMarker = "[TRUNCATED:max_depth]" // Map or slice nested deeper than the max depth
+	CycleMarker    = "[TRUNCATED:cycle]"     // Map containing itself
+)
+
 // Pattern defines a pattern for detecting sensitive data in logs
 type Pattern struct {
 	Type        SensitiveDataType
@@ -45,6 +56,7 @@ type LogSanitizer struct {
 	maskingChar    string
 	preserveLength bool
 	showType       bool
+	maxDepth       int
 
 	// Performance optimization
 	compiledPatterns []*Pattern
@@ -64,6 +76,7 @@ type Config struct {
 	PreserveLength bool              // Preserve original length when masking
 	ShowType       bool              // Show data type in replacement (e.g., [REDACTED:email])
 	CustomPatterns map[string]string // name -> regex pattern
+	MaxDepth       int               // Nesting processed by SanitizeMap (default: 100)
 }
 
 // NewLogSanitizer creates a new log sanitizer
@@ -80,12 +93,17 @@ func NewLogSanitizer(config *Config) *LogSanitizer {
 	if config.MaskingChar == "" {
 		config.MaskingChar = "*"
 	}
+	maxDepth := config.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
 
 	sanitizer := &LogSanitizer{
 		enabled:        config.Enabled,
 		maskingChar:    config.MaskingChar,
 		preserveLength: config.PreserveLength,
 		showType:       config.ShowType,
+		maxDepth:       maxDepth,
 		customPatterns: make(map[string]*Pattern),
 		bufferPool: sync.Pool{
 			New: func() interface{} {
@@ -259,50 +277,65 @@ func (ls *LogSanitizer) maskMatch(match string, pattern *Pattern) string {
 	return "[REDACTED]"
 }
 
-// SanitizeMap sanitizes all string values in a map
+// SanitizeMap sanitizes all string values in a map. Maps and slices nested
+// deeper than the max depth are replaced by MaxDepthMarker, and maps
+// containing themselves by CycleMarker.
 func (ls *LogSanitizer) SanitizeMap(data map[string]interface{}) map[string]interface{} {
 	if !ls.enabled || data == nil {
 		return data
 	}
 
-	result := make(map[string]interface{}, len(data))
+	return ls.sanitizeMap(data, 1, make(map[uintptr]bool))
+}
 
+// sanitizeMap sanitizes a map at depth, ancestors holding the maps being
+// sanitized above it
+func (ls *LogSanitizer) sanitizeMap(data map[string]interface{}, depth int, ancestors map[uintptr]bool) map[string]interface{} {
+	id := reflect.ValueOf(data).Pointer()
+	ancestors[id] = true
+	defer delete(ancestors, id)
+
+	result := make(map[string]interface{}, len(data))
 	for key, value := range data {
-		switch v := value.(type) {
-		case string:
-			result[key] = ls.Sanitize(v)
-		case map[string]interface{}:
-			result[key] = ls.SanitizeMap(v)
-		case []interface{}:
-			result[key] = ls.sanitizeSlice(v)
-		default:
-			result[key] = value
-		}
+		result[key] = ls.sanitizeValue(value, depth+1, ancestors)
 	}
 
 	return result
 }
 
 // sanitizeSlice sanitizes all string values in a slice
-func (ls *LogSanitizer) sanitizeSlice(data []interface{}) []interface{} {
+func (ls *LogSanitizer) sanitizeSlice(data []interface{}, depth int, ancestors map[uintptr]bool) []interface{} {
 	result := make([]interface{}, len(data))
 
 	for i, value := range data {
-		switch v := value.(type) {
-		case string:
-			result[i] = ls.Sanitize(v)
-		case map[string]interface{}:
-			result[i] = ls.SanitizeMap(v)
-		case []interface{}:
-			result[i] = ls.sanitizeSlice(v)
-		default:
-			result[i] = value
-		}
+		result[i] = ls.sanitizeValue(value, depth+1, ancestors)
 	}
 
 	return result
 }
 
+func (ls *LogSanitizer) sanitizeValue(value interface{}, depth int, ancestors map[uintptr]bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		return ls.Sanitize(v)
+	case map[string]interface{}:
+		if ancestors[reflect.ValueOf(v).Pointer()] {
+			return CycleMarker
+		}
+		if depth > ls.maxDepth {
+			return MaxDepthMarker
+		}
+		return ls.sanitizeMap(v, depth, ancestors)
+	case []interface{}:
+		if depth > ls.maxDepth {
+			return MaxDepthMarker
+		}
+		return ls.sanitizeSlice(v, depth, ancestors)
+	default:
+		return value
+	}
+}
+
 // AddCustomPattern adds a custom pattern for detection
 func (ls *LogSanitizer) AddCustomPattern(name, pattern string) error {
 	compiled, err := regexp.Compile(pattern)
@@ -410,6 +410,102 @@ func TestSanitizeMap(t *testing.T) {
 	}
 }
 
+func TestSanitizeMapMaxDepth(t *testing.T) {
+	ls := NewLogSanitizer(&Config{Enabled: true, ShowType: true, MaxDepth: 3})
+
+	// Depth 1 holds the top-level map, each level nests one more
+	input := map[string]interface{}{
+		"email": "test@example.com",
+		"level2": map[string]interface{}{
+			"level3": map[string]interface{}{
+				"email":  "deep@example.com",
+				"level4": map[string]interface{}{"email": "deeper@example.com"},
+				"list":   []interface{}{"x"},
+			},
+		},
+	}
+
+	result := ls.SanitizeMap(input)
+
+	level3 := result["level2"].(map[string]interface{})["level3"].(map[string]interface{})
+	if level3["email"] != "[REDACTED:email]" {
+		t.Error("Values within the max depth should be sanitized")
+	}
+	if level3["level4"] != MaxDepthMarker {
+		t.Errorf("Map beyond the max depth should be truncated, got %v", level3["level4"])
+	}
+	if level3["list"] != MaxDepthMarker {
+		t.Errorf("Slice beyond the max depth should be truncated, got %v", level3["list"])
+	}
+}
+
+func TestSanitizeMapDeeplyNested(t *testing.T) {
+	ls := NewLogSanitizer(nil)
+
+	input := map[string]interface{}{}
+	current := input
+	for i := 0; i < 100000; i++ {
+		next := map[string]interface{}{}
+		current["child"] = next
+		current = next
+	}
+	current["email"] = "test@example.com"
+
+	result := ls.SanitizeMap(input)
+
+	depth := 1
+	for {
+		child, ok := result["child"].(map[string]interface{})
+		if !ok {
+			if result["child"] != MaxDepthMarker {
+				t.Errorf("Expected truncation marker, got %v", result["child"])
+			}
+			break
+		}
+		result = child
+		depth++
+	}
+	if depth != DefaultMaxDepth {
+		t.Errorf("Expected %d levels, got %d", DefaultMaxDepth, depth)
+	}
+}
+
+func TestSanitizeMapCycles(t *testing.T) {
+	ls := NewLogSanitizer(nil)
+
+	shared := map[string]interface{}{"email": "shared@example.com"}
+	input := map[string]interface{}{
+		"email": "test@example.com",
+		"a":     shared,
+		"b":     shared,
+	}
+	input["self"] = input
+	shared["parent"] = input
+
+	list := []interface{}{"test@example.com"}
+	list = append(list, nil)
+	list[1] = list
+	input["list"] = list
+
+	result := ls.SanitizeMap(input)
+
+	if result["self"] != CycleMarker {
+		t.Errorf("Map containing itself should be truncated, got %v", result["self"])
+	}
+	for _, key := range []string{"a", "b"} {
+		m := result[key].(map[string]interface{})
+		if m["email"] != "[REDACTED:email]" {
+			t.Errorf("Map referenced twice should be sanitized under %s", key)
+		}
+		if m["parent"] != CycleMarker {
+			t.Errorf("Reference back to the parent should be truncated under %s", key)
+		}
+	}
+	if result["list"].([]interface{})[0] != "[REDACTED:email]" {
+		t.Error("Self-referencing slice should be sanitized up to the max depth")
+	}
+}
+
 func TestAddCustomPattern(t *testing.T) {
 	ls := NewLogSanitizer(nil)
 
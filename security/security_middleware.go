@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/arturoeanton/nflow-runtime/audit"
 	"github.com/arturoeanton/nflow-runtime/security/analyzer"
 	"github.com/arturoeanton/nflow-runtime/security/encryption"
 	"github.com/arturoeanton/nflow-runtime/security/interceptor"
@@ -41,13 +42,16 @@ type Config struct {
 	AllowedPatterns      []string `toml:"allowed_patterns"` // Patterns to whitelist
 
 	// Encryption
-	EnableEncryption     bool              `toml:"enable_encryption"`
-	EncryptionKey        string            `toml:"encryption_key"`
-	EncryptSensitiveData bool              `toml:"encrypt_sensitive_data"`
-	EncryptInPlace       bool              `toml:"encrypt_in_place"`
-	SensitivePatterns    []string          `toml:"sensitive_patterns"`
-	AlwaysEncryptFields  []string          `toml:"always_encrypt_fields"`
-	CustomPatterns       map[string]string `toml:"custom_patterns"`
+	EnableEncryption     bool                `toml:"enable_encryption"`
+	EncryptionKey        string              `toml:"encryption_key" secret:"true"`
+	EncryptSensitiveData bool                `toml:"encrypt_sensitive_data"`
+	EncryptInPlace       bool                `toml:"encrypt_in_place"`
+	SensitivePatterns    []string            `toml:"sensitive_patterns"`
+	AlwaysEncryptFields  []string            `toml:"always_encrypt_fields"`
+	CustomPatterns       map[string]string   `toml:"custom_patterns"`
+	PatternPriorities    map[string]int      `toml:"pattern_priorities"`     // Pattern type or custom pattern name -> priority, higher ones claim overlapping matches
+	PatternContext       map[string][]string `toml:"pattern_context"`        // Pattern type or custom pattern name -> keywords required near a match
+	PatternContextWindow int                 `toml:"pattern_context_window"` // Bytes searched around a match for the keywords (default: 30)
 
 	// Log Sanitization
 	EnableLogSanitization bool              `toml:"enable_log_sanitization"`
@@ -59,6 +63,7 @@ type Config struct {
 	// Performance
 	CacheAnalysisResults bool          `toml:"cache_analysis_results"`
 	CacheTTL             time.Duration `toml:"cache_ttl"`
+	MaxDepth             int           `toml:"max_depth"` // Nesting processed by the interceptor and the log sanitizer, deeper values are truncated (default: 100)
 }
 
 // SecurityMetrics tracks security-related metrics
@@ -127,6 +132,11 @@ func NewSecurityMiddleware(config *Config) (*SecurityMiddleware, error) {
 			EncryptInPlace: config.EncryptInPlace,
 			MetadataKey:    "_encrypted_fields",
 			CustomPatterns: config.CustomPatterns,
+			MaxDepth:       config.MaxDepth,
+
+			PatternPriorities: config.PatternPriorities,
+			ContextKeywords:   config.PatternContext,
+			ContextWindow:     config.PatternContextWindow,
 		}
 		sm.interceptor = interceptor.NewSensitiveDataInterceptor(encService, interceptorConfig)
 	}
@@ -139,6 +149,7 @@ func NewSecurityMiddleware(config *Config) (*SecurityMiddleware, error) {
 			PreserveLength: config.LogPreserveLength,
 			ShowType:       config.LogShowType,
 			CustomPatterns: config.LogCustomPatterns,
+			MaxDepth:       config.MaxDepth,
 		}
 		sm.sanitizer = sanitizer.NewLogSanitizer(sanitizerConfig)
 	}
@@ -188,8 +199,20 @@ func (sm *SecurityMiddleware) AnalyzeScript(script string, scriptID string) erro
 		sm.metrics.ScriptsBlocked++
 		sm.mu.Unlock()
 
+		highIssues := analyzer.FilterBySeverity(issues, analyzer.SeverityHigh)
+		descriptions := make([]string, 0, len(highIssues))
+		for _, issue := range highIssues {
+			descriptions = append(descriptions, issue.Description)
+		}
+		if err := audit.Record(audit.EventScriptBlocked, "", "", map[string]interface{}{
+			"script_id": scriptID,
+			"issues":    descriptions,
+		}); err != nil {
+			log.Printf("[ERROR] Audit log: %v", err)
+		}
+
 		return fmt.Errorf("script blocked due to security issues: %d high severity issues found",
-			len(analyzer.FilterBySeverity(issues, analyzer.SeverityHigh)))
+			len(highIssues))
 	}
 
 	return nil
@@ -220,6 +243,36 @@ func (sm *SecurityMiddleware) ProcessResponse(data interface{}) (interface{}, er
 	return result, nil
 }
 
+// ProcessResponses encrypts sensitive data in many responses at once
+func (sm *SecurityMiddleware) ProcessResponses(data []interface{}) ([]interface{}, error) {
+	if !sm.config.EnableEncryption || sm.interceptor == nil {
+		return data, nil
+	}
+
+	start := time.Now()
+	defer func() {
+		sm.mu.Lock()
+		sm.metrics.EncryptionTime += time.Since(start)
+		sm.mu.Unlock()
+	}()
+
+	results, err := sm.interceptor.ProcessResponses(data)
+
+	// The error joins one error per failed payload
+	failed := 0
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		failed = len(joined.Unwrap())
+	}
+	sm.mu.Lock()
+	sm.metrics.DataEncrypted += uint64(len(data) - failed)
+	sm.mu.Unlock()
+
+	if err != nil {
+		return results, fmt.Errorf("response processing failed: %w", err)
+	}
+	return results, nil
+}
+
 // WrapEchoHandler wraps an Echo handler with security features
 func (sm *SecurityMiddleware) WrapEchoHandler(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -1,10 +1,13 @@
 package security
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"sync"
 	"testing"
+
+	"github.com/arturoeanton/nflow-runtime/audit"
 )
 
 func TestNewSecurityMiddleware(t *testing.T) {
@@ -109,6 +112,35 @@ func TestAnalyzeScript(t *testing.T) {
 	}
 }
 
+func TestAnalyzeScriptAudit(t *testing.T) {
+	var buf bytes.Buffer
+	previous := audit.SetDefault(audit.New(&buf))
+	defer audit.SetDefault(previous)
+
+	sm, err := NewSecurityMiddleware(&Config{
+		EnableStaticAnalysis: true,
+		BlockOnHighSeverity:  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+
+	if err := sm.AnalyzeScript(`console.log("Hello world");`, "safe"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no audit event for a safe script, got %s", buf.String())
+	}
+
+	if err := sm.AnalyzeScript(`eval("dangerous code");`, "node_7"); err == nil {
+		t.Fatal("Expected the script to be blocked")
+	}
+	line := buf.String()
+	if !strings.Contains(line, `"event":"script_blocked"`) || !strings.Contains(line, `"script_id":"node_7"`) {
+		t.Errorf("Expected a script_blocked audit event, got %s", line)
+	}
+}
+
 func TestAnalyzeScriptDisabled(t *testing.T) {
 	config := &Config{
 		EnableStaticAnalysis: false,
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/arturoeanton/nflow-runtime/logger"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	// defaultAddress is used when [server].address is empty
+	defaultAddress = ":8080"
+	// defaultHTTPSAddress is used when [https_engine].address is empty
+	defaultHTTPSAddress = ":8443"
+	// shutdownTimeout bounds the wait for in-flight requests on shutdown
+	shutdownTimeout = 10 * time.Second
+)
+
+// listenAddress returns the plain HTTP listen address. The PORT env var,
+// set by most container platforms, replaces the configured port and keeps
+// the configured host.
+func listenAddress(config engine.ServerConfig) string {
+	address := config.Address
+	if address == "" {
+		address = defaultAddress
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = ""
+		}
+		address = net.JoinHostPort(host, port)
+	}
+	return address
+}
+
+// startServer starts e on plain HTTP at address, or on HTTPS with the
+// configured cert and key when https.Enable is set. With https.RedirectHTTP
+// the plain HTTP listener is kept and redirects every request to HTTPS; it
+// is shut down when e stops. It blocks like e.Start.
+func startServer(e *echo.Echo, address string, https engine.HttpsConfig) error {
+	if !https.Enable {
+		return e.Start(address)
+	}
+
+	httpsAddress := httpsListenAddress(https)
+	if https.RedirectHTTP {
+		redirect := &http.Server{Addr: address, Handler: httpsRedirectHandler(httpsAddress)}
+		go func() {
+			if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("HTTP redirect listener stopped:", err)
+			}
+		}()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := redirect.Shutdown(ctx); err != nil {
+				logger.Error("HTTP redirect listener shutdown:", err)
+			}
+		}()
+		logger.Infof("Redirecting HTTP on %s to HTTPS", address)
+	}
+
+	return e.StartTLS(httpsAddress, https.Cert, https.Key)
+}
+
+// basicAuthMiddleware requires the [https_engine] basic auth credentials on
+// every route but healthPath, so load balancers can still probe the
+// server. It fails unless HTTPS is enabled and both credentials are set.
+func basicAuthMiddleware(https engine.HttpsConfig, healthPath string) (echo.MiddlewareFunc, error) {
+	if !https.Enable {
+		return nil, errors.New("httpbasic needs https_engine.enable, credentials would travel in clear text")
+	}
+	if https.BasicUser == "" || https.BasicPassword == "" {
+		return nil, errors.New("httpbasic needs basic_user and basic_password")
+	}
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper: func(c echo.Context) bool {
+			return healthPath != "" && c.Request().URL.Path == healthPath
+		},
+		Validator: func(user, password string, c echo.Context) (bool, error) {
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(https.BasicUser)) == 1
+			passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(https.BasicPassword)) == 1
+			return userOK && passwordOK, nil
+		},
+		Realm: "nFlow",
+	}), nil
+}
+
+// shutdownServer stops e, waiting up to shutdownTimeout for in-flight
+// requests, then waits for startServer to return
+func shutdownServer(e *echo.Echo, done <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		logger.Error("Server shutdown:", err)
+	}
+	<-done
+}
+
+// httpsListenAddress returns the HTTPS listen address
+func httpsListenAddress(https engine.HttpsConfig) string {
+	if https.Address == "" {
+		return defaultHTTPSAddress
+	}
+	return https.Address
+}
+
+// httpsRedirectHandler permanently redirects to the same host and URI on
+// the HTTPS listener port
+func httpsRedirectHandler(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
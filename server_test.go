@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arturoeanton/nflow-runtime/engine"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and returns
+// the cert and key paths
+func writeTestCert(t *testing.T) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nflow-test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile, cert
+}
+
+func TestStartServerTLS(t *testing.T) {
+	certFile, keyFile, cert := writeTestCert(t)
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET("/ping", func(c echo.Context) error {
+		return c.String(http.StatusOK, "pong")
+	})
+	defer e.Close()
+
+	go startServer(e, "127.0.0.1:0", engine.HttpsConfig{
+		Enable:  true,
+		Cert:    certFile,
+		Key:     keyFile,
+		Address: "127.0.0.1:0",
+	})
+	var addr net.Addr
+	require.Eventually(t, func() bool {
+		addr = e.TLSListenerAddr()
+		return addr != nil
+	}, 2*time.Second, 10*time.Millisecond, "TLS listener did not start")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	resp, err := client.Get("https://" + addr.String() + "/ping")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, resp.TLS)
+	assert.Equal(t, cert.Raw, resp.TLS.PeerCertificates[0].Raw)
+}
+
+func TestStartServerRedirectListenerStops(t *testing.T) {
+	certFile, keyFile, _ := writeTestCert(t)
+
+	// Reserve a free port for the plain HTTP listener
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpAddress := lis.Addr().String()
+	lis.Close()
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startServer(e, httpAddress, engine.HttpsConfig{
+			Enable:       true,
+			Cert:         certFile,
+			Key:          keyFile,
+			Address:      "127.0.0.1:0",
+			RedirectHTTP: true,
+		})
+	}()
+	require.Eventually(t, func() bool { return e.TLSListenerAddr() != nil }, 2*time.Second, 10*time.Millisecond)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = client.Get("http://" + httpAddress + "/ping")
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond, "redirect listener did not start")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+
+	shutdownServer(e, done)
+	_, err = client.Get("http://" + httpAddress + "/ping")
+	assert.Error(t, err, "the redirect listener stops with the server")
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	https := engine.HttpsConfig{Enable: true, HTTPBasic: true, BasicUser: "ops", BasicPassword: "s3cret"}
+	basicAuth, err := basicAuthMiddleware(https, "/health")
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(basicAuth)
+	e.GET("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+	serve := func(path, user, password string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("/flow", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("/flow", "ops", "wrong"))
+	assert.Equal(t, http.StatusOK, serve("/flow", "ops", "s3cret"))
+	assert.Equal(t, http.StatusOK, serve("/health", "", ""), "load balancers probe without credentials")
+
+	_, err = basicAuthMiddleware(engine.HttpsConfig{HTTPBasic: true, BasicUser: "ops", BasicPassword: "s3cret"}, "/health")
+	assert.Error(t, err, "basic auth over plain HTTP is rejected")
+	_, err = basicAuthMiddleware(engine.HttpsConfig{Enable: true, HTTPBasic: true, BasicUser: "ops"}, "/health")
+	assert.Error(t, err, "credentials are required")
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsAddress string
+		host         string
+		expected     string
+	}{
+		{":8443", "example.com:8080", "https://example.com:8443/api/x?a=1"},
+		{":443", "example.com:8080", "https://example.com/api/x?a=1"},
+		{"0.0.0.0:8443", "example.com", "https://example.com:8443/api/x?a=1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/x?a=1", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		httpsRedirectHandler(tt.httpsAddress).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, tt.expected, rec.Header().Get("Location"))
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	t.Setenv("PORT", "")
+	assert.Equal(t, ":8080", listenAddress(engine.ServerConfig{}))
+	assert.Equal(t, "127.0.0.1:9000", listenAddress(engine.ServerConfig{Address: "127.0.0.1:9000"}))
+
+	t.Setenv("PORT", "3000")
+	assert.Equal(t, ":3000", listenAddress(engine.ServerConfig{}))
+	assert.Equal(t, "127.0.0.1:3000", listenAddress(engine.ServerConfig{Address: "127.0.0.1:9000"}))
+}
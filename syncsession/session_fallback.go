@@ -0,0 +1,158 @@
+package syncsession
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// sessionStoreKey is the context key where the echo-contrib session
+// middleware keeps the store
+const sessionStoreKey = "_session_store"
+
+// fallbackSession keeps the values written while the session store was
+// unavailable until they can be flushed back
+type fallbackSession struct {
+	values  map[interface{}]interface{}
+	cleared bool // DeleteSession ran during the outage
+	since   time.Time
+}
+
+// loadSession gets the session from the store. When a configured store
+// fails, an in-memory session is returned instead (degraded is true) so
+// workflows keep running during a transient outage. Values written
+// meanwhile are flushed to the store on the first successful load.
+// A missing store is a configuration error and is returned as such, and
+// so is an outage for a client without a session ID.
+func (sm *SessionManager) loadSession(sessionName string, c echo.Context) (s *sessions.Session, degraded bool, err error) {
+	if c.Get(sessionStoreKey) == nil {
+		_, err = session.Get(sessionName, c)
+		return nil, false, err
+	}
+
+	cacheKey, hasID := fallbackKey(sessionName, c)
+	s, err = session.Get(sessionName, c)
+	if err != nil {
+		if !hasID {
+			return nil, false, err
+		}
+		log.Printf("[Session] WARNING: session store unavailable for %s, using in-memory session: %v\n", sessionName, err)
+		return sm.fallbackFor(cacheKey, sessionName), true, nil
+	}
+	if !hasID {
+		return s, false, nil
+	}
+
+	if fb := sm.takeFallback(cacheKey); fb != nil {
+		if fb.cleared {
+			for k := range s.Values {
+				delete(s.Values, k)
+			}
+		}
+		for k, v := range fb.values {
+			s.Values[k] = v
+		}
+		if err := s.Save(c.Request(), c.Response()); err != nil {
+			log.Printf("[Session] WARNING: could not flush in-memory session %s to the store: %v\n", sessionName, err)
+			sm.keepFallback(cacheKey, s.Values, fb.cleared)
+			return sm.fallbackFor(cacheKey, sessionName), true, nil
+		}
+		log.Printf("[Session] Session store recovered, flushed %s after %s\n", sessionName, time.Since(fb.since).Round(time.Millisecond))
+	}
+	return s, false, nil
+}
+
+// saveSession saves s, keeping its values in memory when the store fails
+func (sm *SessionManager) saveSession(sessionName string, c echo.Context, s *sessions.Session) error {
+	// In-memory sessions share their values map with the fallback
+	if s.Store() == nil {
+		return nil
+	}
+	if err := s.Save(c.Request(), c.Response()); err != nil {
+		cacheKey, hasID := fallbackKey(sessionName, c)
+		if c.Get(sessionStoreKey) == nil || !hasID {
+			return err
+		}
+		log.Printf("[Session] WARNING: session store unavailable saving %s, keeping values in memory: %v\n", sessionName, err)
+		sm.keepFallback(cacheKey, s.Values, false)
+	}
+	return nil
+}
+
+// fallbackKey identifies the in-memory session by the session's own
+// cookie. Without it there is no session ID to tell clients apart (those
+// behind the same IP would share values), so no fallback is kept.
+func fallbackKey(sessionName string, c echo.Context) (string, bool) {
+	cookie, err := c.Cookie(sessionName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return sessionName + ":" + cookie.Value, true
+}
+
+// fallbackFor returns an in-memory session backed by the fallback values
+func (sm *SessionManager) fallbackFor(cacheKey, sessionName string) *sessions.Session {
+	sm.fallbackMu.Lock()
+	defer sm.fallbackMu.Unlock()
+
+	if sm.fallback == nil {
+		sm.fallback = make(map[string]*fallbackSession)
+	}
+	fb, ok := sm.fallback[cacheKey]
+	if !ok {
+		fb = &fallbackSession{values: make(map[interface{}]interface{}), since: time.Now()}
+		sm.fallback[cacheKey] = fb
+	}
+
+	s := sessions.NewSession(nil, sessionName)
+	s.Values = fb.values
+	return s
+}
+
+// keepFallback stores values to be flushed once the store recovers
+func (sm *SessionManager) keepFallback(cacheKey string, values map[interface{}]interface{}, cleared bool) {
+	sm.fallbackMu.Lock()
+	defer sm.fallbackMu.Unlock()
+
+	if sm.fallback == nil {
+		sm.fallback = make(map[string]*fallbackSession)
+	}
+	fb, ok := sm.fallback[cacheKey]
+	if !ok {
+		fb = &fallbackSession{values: make(map[interface{}]interface{}), since: time.Now()}
+		sm.fallback[cacheKey] = fb
+	}
+	fb.cleared = fb.cleared || cleared
+	for k, v := range values {
+		fb.values[k] = v
+	}
+}
+
+// takeFallback removes and returns the pending in-memory session, if any
+func (sm *SessionManager) takeFallback(cacheKey string) *fallbackSession {
+	sm.fallbackMu.Lock()
+	defer sm.fallbackMu.Unlock()
+
+	fb, ok := sm.fallback[cacheKey]
+	if !ok {
+		return nil
+	}
+	delete(sm.fallback, cacheKey)
+	return fb
+}
+
+// clearFallback records a DeleteSession made while the store was down
+func (sm *SessionManager) clearFallback(cacheKey string) {
+	sm.fallbackMu.Lock()
+	defer sm.fallbackMu.Unlock()
+
+	if fb, ok := sm.fallback[cacheKey]; ok {
+		for k := range fb.values {
+			delete(fb.values, k)
+		}
+		fb.cleared = true
+	}
+}
@@ -0,0 +1,168 @@
+package syncsession
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStore es un store que puede simular una caída del backend
+type flakyStore struct {
+	mu   sync.Mutex
+	down bool
+	data map[string]map[interface{}]interface{}
+}
+
+var errStoreDown = errors.New("store unavailable")
+
+func (f *flakyStore) setDown(down bool) {
+	f.mu.Lock()
+	f.down = down
+	f.mu.Unlock()
+}
+
+func (f *flakyStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return f.New(r, name)
+}
+
+func (f *flakyStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return nil, errStoreDown
+	}
+	s := sessions.NewSession(f, name)
+	for k, v := range f.data[name] {
+		s.Values[k] = v
+	}
+	return s, nil
+}
+
+func (f *flakyStore) Save(r *http.Request, w http.ResponseWriter, s *sessions.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errStoreDown
+	}
+	values := make(map[interface{}]interface{}, len(s.Values))
+	for k, v := range s.Values {
+		values[k] = v
+	}
+	f.data[s.Name()] = values
+	return nil
+}
+
+func (f *flakyStore) stored(name, key string) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.data[name][key]
+}
+
+// newSessionContext crea un contexto con el store y, si id no está vacío,
+// la cookie de la sesión "form"
+func newSessionContext(store sessions.Store, id string) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	if id != "" {
+		req.AddCookie(&http.Cookie{Name: "form", Value: id})
+	}
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(sessionStoreKey, store)
+	return c
+}
+
+// TestSessionManager_StoreOutageAndRecovery simula la caída del store y su recuperación
+func TestSessionManager_StoreOutageAndRecovery(t *testing.T) {
+	store := &flakyStore{data: make(map[string]map[interface{}]interface{})}
+	c := newSessionContext(store, "id-ana")
+
+	sm := &SessionManager{
+		cache: make(map[string]*SessionCache),
+		ttl:   5 * time.Minute,
+	}
+
+	require.NoError(t, sm.SetValue("form", "step", 1, c))
+	assert.Equal(t, 1, store.stored("form", "step"))
+
+	// Caída: las escrituras y lecturas siguen funcionando en memoria
+	store.setDown(true)
+	require.NoError(t, sm.SetValue("form", "step", 2, c))
+	require.NoError(t, sm.SetMultipleValues("form", map[string]interface{}{"name": "ana"}, c))
+
+	value, err := sm.GetValue("form", "step", c)
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+	value, err = sm.GetValue("form", "name", c)
+	require.NoError(t, err)
+	assert.Equal(t, "ana", value)
+	assert.Equal(t, 1, store.stored("form", "step"), "store is not written during the outage")
+
+	// Recuperación: la primera lectura vuelca los valores al store
+	store.setDown(false)
+	value, err = sm.GetValue("form", "step", c)
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+	assert.Equal(t, 2, store.stored("form", "step"))
+	assert.Equal(t, "ana", store.stored("form", "name"))
+	assert.Empty(t, sm.fallback)
+}
+
+// TestSessionManager_FallbackKeyedBySessionID verifica que clientes detrás
+// de la misma IP no comparten la sesión en memoria
+func TestSessionManager_FallbackKeyedBySessionID(t *testing.T) {
+	store := &flakyStore{data: make(map[string]map[interface{}]interface{})}
+	ana := newSessionContext(store, "id-ana")
+	bob := newSessionContext(store, "id-bob")
+
+	sm := &SessionManager{
+		cache: make(map[string]*SessionCache),
+		ttl:   5 * time.Minute,
+	}
+
+	store.setDown(true)
+	require.NoError(t, sm.SetValue("form", "user", "ana", ana))
+	require.NoError(t, sm.SetValue("form", "user", "bob", bob))
+
+	value, err := sm.GetValue("form", "user", ana)
+	require.NoError(t, err)
+	assert.Equal(t, "ana", value)
+	value, err = sm.GetValue("form", "user", bob)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", value)
+
+	s, err := sm.GetSession("form", ana)
+	require.NoError(t, err)
+	s.Values["step"] = 3
+	require.NoError(t, sm.SaveSession("form", ana, s))
+	value, err = sm.GetValue("form", "step", bob)
+	require.NoError(t, err)
+	assert.Nil(t, value)
+}
+
+// TestSessionManager_NoFallbackWithoutSessionID verifica que sin cookie de
+// sesión la caída del store se devuelve como error
+func TestSessionManager_NoFallbackWithoutSessionID(t *testing.T) {
+	store := &flakyStore{data: make(map[string]map[interface{}]interface{})}
+	c := newSessionContext(store, "")
+
+	sm := &SessionManager{
+		cache: make(map[string]*SessionCache),
+		ttl:   5 * time.Minute,
+	}
+
+	require.NoError(t, sm.SetValue("form", "step", 1, c))
+
+	store.setDown(true)
+	assert.ErrorIs(t, sm.SetValue("form", "step", 2, c), errStoreDown)
+	_, err := sm.GetSession("form", c)
+	assert.ErrorIs(t, err, errStoreDown)
+	assert.Empty(t, sm.fallback)
+}
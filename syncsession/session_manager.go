@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/gorilla/sessions"
-	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
 
@@ -14,6 +13,10 @@ type SessionManager struct {
 	mu    sync.RWMutex
 	cache map[string]*SessionCache
 	ttl   time.Duration
+
+	// Sesiones en memoria mientras el store no está disponible
+	fallbackMu sync.Mutex
+	fallback   map[string]*fallbackSession
 }
 
 type SessionCache struct {
@@ -44,10 +47,14 @@ func (sm *SessionManager) GetValue(sessionName, key string, c echo.Context) (int
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	s, err := session.Get(sessionName, c)
+	s, degraded, err := sm.loadSession(sessionName, c)
 	if err != nil {
 		return nil, err
 	}
+	if degraded {
+		// Sin cache para detectar la recuperación del store
+		return s.Values[key], nil
+	}
 
 	// Actualizar cache
 	sm.cache[cacheKey] = &SessionCache{
@@ -64,13 +71,13 @@ func (sm *SessionManager) SetValue(sessionName, key string, value interface{}, c
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	s, err := session.Get(sessionName, c)
+	s, _, err := sm.loadSession(sessionName, c)
 	if err != nil {
 		return err
 	}
 
 	s.Values[key] = value
-	err = s.Save(c.Request(), c.Response())
+	err = sm.saveSession(sessionName, c, s)
 
 	// Invalidar cache
 	cacheKey := sm.getCacheKey(sessionName, c)
@@ -84,7 +91,7 @@ func (sm *SessionManager) SetMultipleValues(sessionName string, values map[strin
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	s, err := session.Get(sessionName, c)
+	s, _, err := sm.loadSession(sessionName, c)
 	if err != nil {
 		return err
 	}
@@ -93,7 +100,7 @@ func (sm *SessionManager) SetMultipleValues(sessionName string, values map[strin
 		s.Values[k] = v
 	}
 
-	err = s.Save(c.Request(), c.Response())
+	err = sm.saveSession(sessionName, c, s)
 
 	// Invalidar cache
 	cacheKey := sm.getCacheKey(sessionName, c)
@@ -107,7 +114,8 @@ func (sm *SessionManager) GetSession(sessionName string, c echo.Context) (*sessi
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	return session.Get(sessionName, c)
+	s, _, err := sm.loadSession(sessionName, c)
+	return s, err
 }
 
 // SaveSession guarda la sesión después de modificaciones
@@ -115,7 +123,7 @@ func (sm *SessionManager) SaveSession(sessionName string, c echo.Context, s *ses
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	err := s.Save(c.Request(), c.Response())
+	err := sm.saveSession(sessionName, c, s)
 
 	// Invalidar cache
 	cacheKey := sm.getCacheKey(sessionName, c)
@@ -129,20 +137,25 @@ func (sm *SessionManager) DeleteSession(sessionName string, c echo.Context) erro
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	s, err := session.Get(sessionName, c)
+	s, degraded, err := sm.loadSession(sessionName, c)
 	if err != nil {
 		return err
 	}
 
 	// Limpiar valores
+	cacheKey := sm.getCacheKey(sessionName, c)
+	if degraded {
+		if key, ok := fallbackKey(sessionName, c); ok {
+			sm.clearFallback(key)
+		}
+	}
 	for k := range s.Values {
 		delete(s.Values, k)
 	}
 
-	err = s.Save(c.Request(), c.Response())
+	err = sm.saveSession(sessionName, c, s)
 
 	// Eliminar de cache
-	cacheKey := sm.getCacheKey(sessionName, c)
 	delete(sm.cache, cacheKey)
 
 	return err